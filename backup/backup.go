@@ -0,0 +1,300 @@
+// Package backup writes and restores portable Cogniflow archives.
+//
+// An archive is a gzip-compressed tar holding one NDJSON file per dataset
+// (users, goals, study_sessions, fatigue_scores) followed by manifest.json, which
+// records the format version, the filter used and a SHA-256 per file.
+package backup
+
+import (
+	"archive/tar"
+	"authentication/config"
+	"authentication/models"
+	"authentication/store"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// FormatVersion is bumped whenever the archive layout changes incompatibly.
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+const (
+	usersFile    = "users.ndjson"
+	goalsFile    = "goals.ndjson"
+	sessionsFile = "study_sessions.ndjson"
+	scoresFile   = "fatigue_scores.ndjson"
+)
+
+type FileEntry struct {
+	Name    string `json:"name"`
+	Records int    `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+type Manifest struct {
+	FormatVersion int         `json:"format_version"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Backend       string      `json:"backend"`
+	UserID        string      `json:"user_id,omitempty"`
+	OrgID         string      `json:"org_id,omitempty"`
+	Files         []FileEntry `json:"files"`
+}
+
+// Options narrows a backup to one user or one organization.
+type Options struct {
+	UserID string
+	OrgID  string
+}
+
+// spool is a temporary NDJSON file that hashes what is written to it, so a
+// dataset can be streamed from the database without holding it in memory.
+type spool struct {
+	name    string
+	file    *os.File
+	buf     *bufio.Writer
+	sum     hash.Hash
+	enc     *json.Encoder
+	records int
+}
+
+func newSpool(name string) (*spool, error) {
+	f, err := os.CreateTemp("", "cogniflow-backup-*.ndjson")
+	if err != nil {
+		return nil, err
+	}
+	sp := &spool{name: name, file: f, sum: sha256.New()}
+	sp.buf = bufio.NewWriter(io.MultiWriter(f, sp.sum))
+	sp.enc = json.NewEncoder(sp.buf)
+	return sp, nil
+}
+
+func (sp *spool) write(v interface{}) error {
+	sp.records++
+	return sp.enc.Encode(v)
+}
+
+func (sp *spool) close() {
+	sp.file.Close()
+	os.Remove(sp.file.Name())
+}
+
+// copyTo appends the spooled file to the tar archive.
+func (sp *spool) copyTo(tw *tar.Writer) (FileEntry, error) {
+	if err := sp.buf.Flush(); err != nil {
+		return FileEntry{}, err
+	}
+	info, err := sp.file.Stat()
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if _, err := sp.file.Seek(0, io.SeekStart); err != nil {
+		return FileEntry{}, err
+	}
+	hdr := &tar.Header{Name: sp.name, Mode: 0o600, Size: info.Size(), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return FileEntry{}, err
+	}
+	if _, err := io.Copy(tw, sp.file); err != nil {
+		return FileEntry{}, err
+	}
+	return FileEntry{Name: sp.name, Records: sp.records, SHA256: hex.EncodeToString(sp.sum.Sum(nil))}, nil
+}
+
+// Write streams the selected users and their goals, sessions and scores
+// from st to w. An organization backup also takes the organization's goals.
+func Write(ctx context.Context, st store.Store, w io.Writer, opts Options) (*Manifest, error) {
+	users, err := newSpool(usersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer users.close()
+	goals, err := newSpool(goalsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer goals.close()
+	sessions, err := newSpool(sessionsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer sessions.close()
+	scores, err := newSpool(scoresFile)
+	if err != nil {
+		return nil, err
+	}
+	defer scores.close()
+
+	// A nil slice means "every user"; a filtered backup only follows the
+	// users that matched.
+	var userIDs []string
+	if opts.UserID != "" || opts.OrgID != "" {
+		userIDs = []string{}
+	}
+	err = st.EachUser(ctx, opts.OrgID, opts.UserID, func(u *models.User) error {
+		// Access tokens are re-issued on login and never belong in an archive.
+		u.Token = nil
+		u.Refresh_token = nil
+		if userIDs != nil {
+			userIDs = append(userIDs, u.User_id)
+		}
+		return users.write(u)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export users: %w", err)
+	}
+	err = st.EachGoal(ctx, userIDs, func(g *models.Goal) error {
+		return goals.write(g)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export goals: %w", err)
+	}
+	if opts.OrgID != "" && opts.UserID == "" {
+		shared, err := st.ListGoals(ctx, "", opts.OrgID, true)
+		if err != nil {
+			return nil, fmt.Errorf("export goals: %w", err)
+		}
+		for i := range shared {
+			if err := goals.write(&shared[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = st.EachSession(ctx, userIDs, func(s *models.StudySession) error {
+		return sessions.write(s)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export study sessions: %w", err)
+	}
+	err = st.EachFatigueScore(ctx, userIDs, func(s *models.FatigueScore) error {
+		return scores.write(s)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("export fatigue scores: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Backend:       config.DBBackend(),
+		UserID:        opts.UserID,
+		OrgID:         opts.OrgID,
+	}
+	for _, sp := range []*spool{users, goals, sessions, scores} {
+		entry, err := sp.copyTo(tw)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o600, Size: int64(len(body)), ModTime: time.Now()}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// WriteFile creates path and writes a backup into it.
+func WriteFile(ctx context.Context, st store.Store, path string, opts Options) (*Manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Write(ctx, st, f, opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return m, nil
+}
+
+// eachEntry calls fn for every file in the archive at path.
+func eachEntry(path string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Verify reads the whole archive, checks the format version and compares
+// every data file against the SHA-256 recorded in the manifest.
+func Verify(path string) (*Manifest, error) {
+	sums := make(map[string]string)
+	var manifest *Manifest
+	err := eachEntry(path, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == manifestName {
+			manifest = &Manifest{}
+			return json.NewDecoder(r).Decode(manifest)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		sums[hdr.Name] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("archive has no %s", manifestName)
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported archive format version %d (want %d)", manifest.FormatVersion, FormatVersion)
+	}
+	for _, entry := range manifest.Files {
+		got, ok := sums[entry.Name]
+		if !ok {
+			return nil, fmt.Errorf("archive is missing %s", entry.Name)
+		}
+		if got != entry.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", entry.Name)
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"archive/tar"
+	"authentication/models"
+	"authentication/store"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Conflict decides what Restore does with a record whose ID already exists.
+type Conflict string
+
+const (
+	ConflictSkip      Conflict = "skip"
+	ConflictOverwrite Conflict = "overwrite"
+	// ConflictRename restores a clashing record as a new one with a fresh
+	// ID. A user renamed this way, or whose email belongs to another
+	// account, also gets a tagged alias of the email (ada@x.io becomes
+	// ada+restored-<new id>@x.io), no phone and no tokens, so it never
+	// shares a login with the account it clashed with.
+	ConflictRename Conflict = "rename"
+)
+
+// ParseConflict validates a conflict strategy name.
+func ParseConflict(s string) (Conflict, error) {
+	switch c := Conflict(s); c {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown conflict strategy %q (want skip, overwrite or rename)", s)
+}
+
+type RestoreOptions struct {
+	Conflict Conflict
+	DryRun   bool
+}
+
+// Counts tallies what happened to one dataset during a restore.
+type Counts struct {
+	Inserted    int `json:"inserted"`
+	Overwritten int `json:"overwritten"`
+	Renamed     int `json:"renamed"`
+	Skipped     int `json:"skipped"`
+}
+
+type RestoreReport struct {
+	Manifest      *Manifest `json:"manifest"`
+	DryRun        bool      `json:"dry_run"`
+	Users         Counts    `json:"users"`
+	Goals         Counts    `json:"goals"`
+	StudySessions Counts    `json:"study_sessions"`
+	FatigueScores Counts    `json:"fatigue_scores"`
+}
+
+// decodeLines decodes each NDJSON line of r into a fresh T and calls fn.
+func decodeLines[T any](r io.Reader, fn func(*T) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var v T
+		if err := dec.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+	}
+}
+
+// Restore verifies the archive at path and then writes its records into st.
+// Nothing is written if verification fails. Users are restored first, then
+// goals, so that the records after them can follow any IDs changed by
+// ConflictRename.
+func Restore(ctx context.Context, st store.Store, path string, opts RestoreOptions) (*RestoreReport, error) {
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+	manifest, err := Verify(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &RestoreReport{Manifest: manifest, DryRun: opts.DryRun}
+
+	// userIDs maps archived user IDs to the ID they are restored under.
+	// Users dropped because of an email clash are absent, and their sessions
+	// and scores are skipped with them.
+	userIDs := make(map[string]string)
+	// goalIDs maps archived goal IDs that were renamed to their new ID.
+	goalIDs := make(map[string]string)
+
+	err = eachEntry(path, func(hdr *tar.Header, r io.Reader) error {
+		switch hdr.Name {
+		case usersFile:
+			return decodeLines(r, func(u *models.User) error {
+				return restoreUser(ctx, st, u, opts, userIDs, &report.Users)
+			})
+		case goalsFile:
+			return decodeLines(r, func(g *models.Goal) error {
+				return restoreGoal(ctx, st, g, opts, userIDs, goalIDs, &report.Goals)
+			})
+		case sessionsFile:
+			return decodeLines(r, func(s *models.StudySession) error {
+				if newID, ok := goalIDs[s.GoalID]; ok {
+					s.GoalID = newID
+				}
+				return restoreSession(ctx, st, s, opts, userIDs, &report.StudySessions)
+			})
+		case scoresFile:
+			return decodeLines(r, func(s *models.FatigueScore) error {
+				return restoreFatigueScore(ctx, st, s, opts, userIDs, &report.FatigueScores)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// RestoreFile is Restore with the conflict strategy given by name.
+func RestoreFile(ctx context.Context, st store.Store, path, conflict string, dryRun bool) (*RestoreReport, error) {
+	c, err := ParseConflict(conflict)
+	if err != nil {
+		return nil, err
+	}
+	return Restore(ctx, st, path, RestoreOptions{Conflict: c, DryRun: dryRun})
+}
+
+func restoreUser(ctx context.Context, st store.Store, u *models.User, opts RestoreOptions, userIDs map[string]string, counts *Counts) error {
+	oldID := u.User_id
+	exists, err := st.UserExists(ctx, oldID)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		switch opts.Conflict {
+		case ConflictSkip:
+			userIDs[oldID] = oldID
+			counts.Skipped++
+			return nil
+		case ConflictRename:
+			u.ID = primitive.NewObjectID()
+			u.User_id = u.ID.Hex()
+		}
+	}
+
+	// A different account may already own the email; two accounts with one
+	// email would make login ambiguous, so that user is left out unless it
+	// is being renamed.
+	renamed := exists && opts.Conflict == ConflictRename
+	if (!exists || renamed) && u.Email != nil {
+		taken, err := st.CountUsersWithContact(ctx, *u.Email, "")
+		if err != nil {
+			return err
+		}
+		if taken > 0 && opts.Conflict != ConflictRename {
+			counts.Skipped++
+			return nil
+		}
+		if taken > 0 || renamed {
+			alias := renamedEmail(*u.Email, u.User_id)
+			if taken, err = st.CountUsersWithContact(ctx, alias, ""); err != nil {
+				return err
+			}
+			if taken > 0 {
+				return fmt.Errorf("user %s: email alias %s is already taken", oldID, alias)
+			}
+			u.Email, u.Phone = &alias, nil
+			u.Token, u.Refresh_token = nil, nil
+			renamed = true
+		}
+	}
+
+	userIDs[oldID] = u.User_id
+	switch {
+	case renamed:
+		counts.Renamed++
+	case !exists:
+		counts.Inserted++
+	default:
+		counts.Overwritten++
+	}
+	if opts.DryRun {
+		return nil
+	}
+	return st.ReplaceUser(ctx, u)
+}
+
+// renamedEmail tags email with the restored user's new ID.
+func renamedEmail(email, userID string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email + "+restored-" + userID
+	}
+	return email[:at] + "+restored-" + userID + email[at:]
+}
+
+// restoreGoal restores a user's goal along with its owner; organization
+// goals are restored as they are.
+func restoreGoal(ctx context.Context, st store.Store, g *models.Goal, opts RestoreOptions, userIDs, goalIDs map[string]string, counts *Counts) error {
+	if g.UserID != "" {
+		newUserID, ok := userIDs[g.UserID]
+		if !ok {
+			counts.Skipped++
+			return nil
+		}
+		g.UserID = newUserID
+	}
+	_, err := st.FindGoal(ctx, g.ID.Hex())
+	exists := err == nil
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	switch {
+	case !exists:
+		counts.Inserted++
+	case opts.Conflict == ConflictSkip:
+		counts.Skipped++
+		return nil
+	case opts.Conflict == ConflictRename:
+		oldID := g.ID.Hex()
+		g.ID = primitive.NewObjectID()
+		goalIDs[oldID] = g.ID.Hex()
+		counts.Renamed++
+	default:
+		counts.Overwritten++
+	}
+	if opts.DryRun {
+		return nil
+	}
+	return st.ReplaceGoal(ctx, g)
+}
+
+func restoreSession(ctx context.Context, st store.Store, s *models.StudySession, opts RestoreOptions, userIDs map[string]string, counts *Counts) error {
+	newUserID, ok := userIDs[s.UserID]
+	if !ok {
+		counts.Skipped++
+		return nil
+	}
+	s.UserID = newUserID
+	exists, err := st.SessionExists(ctx, s.ID.Hex())
+	if err != nil {
+		return err
+	}
+	switch {
+	case !exists:
+		counts.Inserted++
+	case opts.Conflict == ConflictSkip:
+		counts.Skipped++
+		return nil
+	case opts.Conflict == ConflictRename:
+		s.ID = primitive.NewObjectID()
+		counts.Renamed++
+	default:
+		counts.Overwritten++
+	}
+	if opts.DryRun {
+		return nil
+	}
+	return st.ReplaceSession(ctx, s)
+}
+
+// restoreFatigueScore keys scores by (user, day) rather than ID, since there
+// is only ever one score per user per day. Under ConflictRename a clash can
+// only remain when the user kept their ID, so the existing score is kept.
+func restoreFatigueScore(ctx context.Context, st store.Store, s *models.FatigueScore, opts RestoreOptions, userIDs map[string]string, counts *Counts) error {
+	newUserID, ok := userIDs[s.UserID]
+	if !ok {
+		counts.Skipped++
+		return nil
+	}
+	s.UserID = newUserID
+	exists, err := st.FatigueScoreExists(ctx, s.UserID, s.Date)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !exists:
+		counts.Inserted++
+	case opts.Conflict == ConflictOverwrite:
+		counts.Overwritten++
+	default:
+		counts.Skipped++
+		return nil
+	}
+	if s.ID.IsZero() {
+		s.ID = primitive.NewObjectID()
+	}
+	if opts.DryRun {
+		return nil
+	}
+	return st.UpsertFatigueScore(ctx, s)
+}
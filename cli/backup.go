@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"authentication/backup"
+	"authentication/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func init() {
+	register("backup", "write users, study sessions and fatigue scores to an archive", runBackup)
+	register("restore", "verify an archive and load it into the database", runRestore)
+}
+
+func runBackup(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	out := fs.String("out", "", "archive path to write (e.g. cogniflow-backup.tar.gz)")
+	userID := fs.String("user", "", "only back up this user")
+	orgID := fs.String("org", "", "only back up users in this organization")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+	manifest, err := backup.WriteFile(ctx, store.Get(), *out, backup.Options{UserID: *userID, OrgID: *orgID})
+	if err != nil {
+		return err
+	}
+	for _, f := range manifest.Files {
+		log.Printf("backup: %s: %d records", f.Name, f.Records)
+	}
+	log.Printf("backup: wrote %s", *out)
+	return nil
+}
+
+func runRestore(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	in := fs.String("in", "", "archive path to restore")
+	conflict := fs.String("conflict", string(backup.ConflictSkip), "when a record already exists: skip, overwrite or rename")
+	dryRun := fs.Bool("dry-run", false, "verify and report without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+	report, err := backup.RestoreFile(ctx, store.Get(), *in, *conflict, *dryRun)
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	}
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	return nil
+}
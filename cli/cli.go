@@ -0,0 +1,54 @@
+// Package cli implements the cogniflow maintenance commands, run as
+// "cogniflow <command> [flags]" instead of starting the HTTP server.
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	summary string
+	run     func(ctx context.Context, fs *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]command{}
+
+func register(name, summary string, run func(ctx context.Context, fs *flag.FlagSet, args []string) error) {
+	commands[name] = command{summary: summary, run: run}
+}
+
+// Run executes the command named by args[0]. It returns handled=false when
+// args does not name a command, so the caller can start the server instead.
+func Run(ctx context.Context, args []string) (handled bool, err error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		Usage()
+		return true, nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false, nil
+	}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	return true, cmd.run(ctx, fs, args[1:])
+}
+
+// Usage prints the available commands.
+func Usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: cogniflow [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nWith no command the HTTP server is started. Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"authentication/importer"
+	"authentication/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	register("import-sessions", "import study sessions from a tracker's CSV or JSON export", runImportSessions)
+}
+
+func runImportSessions(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	userID := fs.String("user", "", "user to import the sessions for")
+	in := fs.String("in", "-", "export file to read, - for stdin")
+	format := fs.String("format", "", "csv or json (default: from the file extension, else csv)")
+	preset := fs.String("preset", "generic", "column mapping: "+strings.Join(importer.PresetNames(), ", "))
+	mappingFile := fs.String("mapping", "", "JSON file with a custom column mapping, overrides -preset")
+	timezone := fs.String("timezone", "", "zone for times without an offset (default: the user's)")
+	dryRun := fs.Bool("dry-run", false, "validate and count duplicates without writing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return errors.New("-user is required")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+		if *format == "" && strings.EqualFold(filepath.Ext(*in), ".json") {
+			*format = "json"
+		}
+	}
+	opts := services.SessionImportOptions{Format: *format, Preset: *preset, Timezone: *timezone, DryRun: *dryRun}
+	if *mappingFile != "" {
+		b, err := os.ReadFile(*mappingFile)
+		if err != nil {
+			return err
+		}
+		opts.Mapping = &importer.Mapping{}
+		if err := json.Unmarshal(b, opts.Mapping); err != nil {
+			return fmt.Errorf("-mapping: %w", err)
+		}
+	}
+
+	res, err := services.ImportSessions(ctx, *userID, r, opts)
+	if res != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+	}
+	if err != nil {
+		return fmt.Errorf("import-sessions: %w", err)
+	}
+	return nil
+}
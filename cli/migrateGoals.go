@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"authentication/services"
+	"context"
+	"flag"
+	"log"
+)
+
+func init() {
+	register("migrate-goals", "move free-text session goals into the goals catalog", runMigrateGoals)
+}
+
+func runMigrateGoals(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	userID := fs.String("user", "", "only migrate this user")
+	orgID := fs.String("org", "", "only migrate users in this organization")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var total services.GoalMigration
+	report := func(r services.GoalMigration) {
+		if r.GoalsCreated > 0 || r.SessionsLinked > 0 {
+			log.Printf("migrate-goals: %s: %d goal(s) created, %d session(s) linked", r.UserID, r.GoalsCreated, r.SessionsLinked)
+		}
+		total.GoalsCreated += r.GoalsCreated
+		total.SessionsLinked += r.SessionsLinked
+		total.SessionsSkipped += r.SessionsSkipped
+	}
+	if *userID != "" {
+		r, err := services.MigrateLegacyGoals(ctx, *userID)
+		if err != nil {
+			return err
+		}
+		report(r)
+	} else if err := services.MigrateAllLegacyGoals(ctx, *orgID, report); err != nil {
+		return err
+	}
+	log.Printf("migrate-goals: %d goal(s) created, %d session(s) linked, %d left as is",
+		total.GoalsCreated, total.SessionsLinked, total.SessionsSkipped)
+	return nil
+}
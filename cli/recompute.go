@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"authentication/models"
+	"authentication/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+func init() {
+	register("recompute", "re-score sessions and re-roll daily fatigue scores", runRecompute)
+}
+
+func runRecompute(ctx context.Context, fs *flag.FlagSet, args []string) error {
+	userID := fs.String("user", "", "only recompute this user")
+	orgID := fs.String("org", "", "only recompute users in this organization")
+	from := fs.String("from", "", "first day to recompute (YYYY-MM-DD)")
+	to := fs.String("to", time.Now().UTC().Format("2006-01-02"), "last day to recompute, inclusive (YYYY-MM-DD)")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	workers := fs.Int("workers", 4, "users recomputed in parallel")
+	model := fs.String("model", "", "scoring model version to apply to everyone (default: each user's own)")
+	resume := fs.String("resume", "", "resume the job with this ID from its checkpoint")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		job *models.RecomputeJob
+		err error
+	)
+	if *resume != "" {
+		job, err = services.ResumableRecomputeJob(ctx, *resume)
+	} else {
+		if *from == "" {
+			return errors.New("-from is required")
+		}
+		start, perr := time.Parse("2006-01-02", *from)
+		if perr != nil {
+			return fmt.Errorf("-from: %w", perr)
+		}
+		end, perr := time.Parse("2006-01-02", *to)
+		if perr != nil {
+			return fmt.Errorf("-to: %w", perr)
+		}
+		job, err = services.NewRecomputeJob(ctx, services.RecomputeScope{
+			UserID:       *userID,
+			OrgID:        *orgID,
+			From:         start,
+			To:           end.AddDate(0, 0, 1),
+			DryRun:       *dryRun,
+			ModelVersion: *model,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("recompute: job %s (resume with -resume %s)", job.ID.Hex(), job.ID.Hex())
+
+	err = services.RunRecompute(ctx, job, *workers)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(job)
+	if err != nil {
+		return fmt.Errorf("recompute: %w", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -43,13 +44,42 @@ func ConnectDB() *mongo.Client {
 	return client
 }
 
-var Client *mongo.Client = ConnectDB()
+var (
+	client     *mongo.Client
+	clientOnce sync.Once
+)
+
+// MongoClient returns the shared client, connecting on first use so that
+// deployments on the Postgres backend never dial MongoDB.
+func MongoClient() *mongo.Client {
+	clientOnce.Do(func() {
+		client = ConnectDB()
+	})
+	return client
+}
 
 func OpenCollection(collectionName string) *mongo.Collection {
 
-	if Client == nil {
+	c := MongoClient()
+	if c == nil {
 		log.Fatal("MongoDB client is not initialized.")
 	}
 
-	return Client.Database("usersdb").Collection(collectionName)
+	return c.Database("usersdb").Collection(collectionName)
+}
+
+// Storage backends selectable with DB_BACKEND.
+const (
+	BackendMongo    = "mongo"
+	BackendPostgres = "postgres"
+)
+
+// DBBackend returns the configured storage backend (default "mongo").
+func DBBackend() string {
+	switch os.Getenv("DB_BACKEND") {
+	case BackendPostgres, "postgresql", "pg":
+		return BackendPostgres
+	default:
+		return BackendMongo
+	}
 }
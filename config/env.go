@@ -0,0 +1,36 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DurationEnv reads a Go duration (e.g. "30m") from name, or returns def.
+func DurationEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("config: ignoring invalid %s=%q, using %s", name, v, def)
+		return def
+	}
+	return d
+}
+
+// IntEnv reads a positive integer from name, or returns def.
+func IntEnv(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("config: ignoring invalid %s=%q, using %d", name, v, def)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"authentication/models"
+	"authentication/services"
+	"authentication/store"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// alertFilter reads the status and rule_id query filters. On a bad status
+// it writes a 400 and returns ok=false.
+func alertFilter(c *gin.Context) (store.AlertFilter, bool) {
+	f := store.AlertFilter{Status: c.Query("status"), RuleID: c.Query("rule_id")}
+	switch f.Status {
+	case "", models.AlertOpen, models.AlertAcknowledged, models.AlertResolved:
+		return f, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open, acknowledged or resolved"})
+	return f, false
+}
+
+// GetMyAlerts returns a page of the current user's burnout alerts.
+// Filters: status, rule_id. Sort: created_at, date.
+func GetMyAlerts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		f, ok := alertFilter(c)
+		if !ok {
+			return
+		}
+		f.UserID = userID
+		alerts, next, err := services.ListAlerts(c.Request.Context(), f, parseListOptions(c, 20))
+		respondList(c, alerts, next, err)
+	}
+}
+
+// GetAlerts returns a page of alerts across users (admin only).
+// Filters: org, user_id, status, rule_id.
+func GetAlerts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f, ok := alertFilter(c)
+		if !ok {
+			return
+		}
+		f.OrgID = c.Query("org")
+		f.UserID = c.Query("user_id")
+		alerts, next, err := services.ListAlerts(c.Request.Context(), f, parseListOptions(c, 50))
+		respondList(c, alerts, next, err)
+	}
+}
+
+// AcknowledgeAlert marks an open alert as seen.
+func AcknowledgeAlert() gin.HandlerFunc {
+	return setAlertStatus(models.AlertAcknowledged)
+}
+
+// ResolveAlert closes an open or acknowledged alert.
+func ResolveAlert() gin.HandlerFunc {
+	return setAlertStatus(models.AlertResolved)
+}
+
+func setAlertStatus(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		a, err := services.UpdateAlertStatus(c.Request.Context(), userID, isAdmin(c), c.Param("id"), status)
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, a)
+		case errors.Is(err, services.ErrAlertNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAlertState):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "alert": a})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// ===================== ALERT RULES (ADMIN) =====================
+
+func GetAlertRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := services.ListAlertRules(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if rules == nil {
+			rules = []models.AlertRule{}
+		}
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+// CreateAlertRule adds a rule; set org_id to limit it to one organization.
+func CreateAlertRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body models.AlertRule
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		err := services.CreateAlertRule(c.Request.Context(), &body)
+		switch {
+		case errors.Is(err, services.ErrInvalidAlertRule):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, store.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "alert rule already exists"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusCreated, body)
+		}
+	}
+}
+
+// UpdateAlertRule replaces a rule's thresholds, cooldown or enabled flag.
+func UpdateAlertRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body models.AlertRule
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		body.ID = c.Param("id")
+		err := services.UpdateAlertRule(c.Request.Context(), &body)
+		switch {
+		case errors.Is(err, services.ErrInvalidAlertRule):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, store.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "alert rule not found"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, body)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"authentication/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateStudySessionsBatch stores sessions a client recorded while offline,
+// timed by the client's clock, and reports on each one.
+func CreateStudySessionsBatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body struct {
+			Sessions []struct {
+				ClientID   string    `json:"client_id"` // echoed back in the result
+				Mode       string    `json:"mode"`      // timer | stopwatch
+				GoalID     string    `json:"goal_id"`   // catalog goal; takes precedence over goal
+				Goal       string    `json:"goal"`
+				PlannedMin int       `json:"planned_min"`
+				StartedAt  time.Time `json:"started_at"`
+				EndedAt    time.Time `json:"ended_at"`
+				ActualMin  int       `json:"actual_min"` // active minutes; defaults to ended_at - started_at
+				PauseCount int       `json:"pause_count"`
+				SelfRating int       `json:"self_rating"`  // 1-5
+				SelfOnTask string    `json:"self_on_task"` // yes / somewhat / no
+			} `json:"sessions"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch payload"})
+			return
+		}
+		items := make([]services.BatchSessionInput, len(body.Sessions))
+		for i, s := range body.Sessions {
+			items[i] = services.BatchSessionInput{
+				ClientID:   s.ClientID,
+				Mode:       s.Mode,
+				GoalID:     s.GoalID,
+				Goal:       s.Goal,
+				PlannedMin: s.PlannedMin,
+				StartedAt:  s.StartedAt,
+				EndedAt:    s.EndedAt,
+				ActualMin:  s.ActualMin,
+				PauseCount: s.PauseCount,
+				SelfRating: s.SelfRating,
+				SelfOnTask: s.SelfOnTask,
+			}
+		}
+		results, err := services.CreateStudySessionsBatch(c.Request.Context(), userID, items)
+		if errors.Is(err, services.ErrInvalidBatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		counts := map[string]int{services.BatchCreated: 0, services.BatchDuplicate: 0, services.BatchInvalid: 0}
+		for _, r := range results {
+			counts[r.Status]++
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"results":    results,
+			"created":    counts[services.BatchCreated],
+			"duplicates": counts[services.BatchDuplicate],
+			"invalid":    counts[services.BatchInvalid],
+		})
+	}
+}
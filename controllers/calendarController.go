@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"authentication/services"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCalendarUpload bounds ICS uploads.
+const maxCalendarUpload = 2 << 20
+
+// GetMyCalendarSettings returns whether the ICS feed is enabled and the
+// import keywords.
+func GetMyCalendarSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		cs, err := services.CalendarSettings(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"feed_enabled":    cs.FeedTokenHash != "",
+			"feed_created_at": cs.FeedCreatedAt,
+			"import_keywords": cs.ImportKeywords,
+		})
+	}
+}
+
+// SetMyCalendarSettings replaces the import keywords.
+func SetMyCalendarSettings() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body struct {
+			ImportKeywords []string `json:"import_keywords"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		cs, err := services.SetCalendarImportKeywords(c.Request.Context(), userID, body.ImportKeywords)
+		if errors.Is(err, services.ErrInvalidCalendarSettings) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"feed_enabled":    cs.FeedTokenHash != "",
+			"feed_created_at": cs.FeedCreatedAt,
+			"import_keywords": cs.ImportKeywords,
+		})
+	}
+}
+
+// RotateCalendarFeed issues a new secret feed URL, revoking any earlier
+// one. The URL is only shown in this response.
+func RotateCalendarFeed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		token, cs, err := services.RotateCalendarFeedToken(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"feed_url":        scheme + "://" + c.Request.Host + c.Request.URL.Path + "/" + token + ".ics",
+			"feed_created_at": cs.FeedCreatedAt,
+		})
+	}
+}
+
+// DisableCalendarFeed revokes the feed URL.
+func DisableCalendarFeed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		err := services.DisableCalendarFeed(c.Request.Context(), userID)
+		if errors.Is(err, services.ErrCalendarFeedNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Calendar feed disabled"})
+	}
+}
+
+// GetCalendarFeed serves the ICS feed. The token in the URL is the only
+// credential, so calendar apps can subscribe without logging in.
+func GetCalendarFeed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSuffix(c.Param("token"), ".ics")
+		cal, err := services.CalendarFeed(c.Request.Context(), token)
+		if errors.Is(err, services.ErrCalendarFeedNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var buf strings.Builder
+		if err := cal.Encode(&buf); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Cache-Control", "private, max-age=900")
+		c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(buf.String()))
+	}
+}
+
+// ImportCalendar reads an ICS file, sent as the "file" field of a
+// multipart form or as the request body, into study plans.
+func ImportCalendar() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCalendarUpload)
+		var r io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			f, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+				return
+			}
+			file, err := f.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			defer file.Close()
+			r = file
+		}
+		res, err := services.ImportCalendar(c.Request.Context(), userID, r)
+		switch {
+		case errors.Is(err, services.ErrInvalidCalendar), errors.Is(err, services.ErrNoImportKeywords):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, res)
+		}
+	}
+}
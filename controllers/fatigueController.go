@@ -2,7 +2,11 @@ package controllers
 
 import (
 	"authentication/helpers"
+	"authentication/models"
 	"authentication/services"
+	"authentication/store"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -19,6 +23,7 @@ func CreateStudySession() gin.HandlerFunc {
 		}
 		var body struct {
 			Mode       string `json:"mode"`        // timer | stopwatch
+			GoalID     string `json:"goal_id"`     // catalog goal; takes precedence over goal
 			Goal       string `json:"goal"`        // coding, studying, etc.
 			PlannedMin int    `json:"planned_min"` // only for timer
 			ActualMin  int    `json:"actual_min"`
@@ -34,7 +39,8 @@ func CreateStudySession() gin.HandlerFunc {
 		if body.Mode != "timer" && body.Mode != "stopwatch" {
 			body.Mode = "stopwatch"
 		}
-		if strings.TrimSpace(body.Goal) == "" {
+		body.GoalID = strings.TrimSpace(body.GoalID)
+		if strings.TrimSpace(body.Goal) == "" && body.GoalID == "" {
 			body.Goal = "unspecified"
 		}
 		if body.ActualMin <= 0 {
@@ -49,8 +55,10 @@ func CreateStudySession() gin.HandlerFunc {
 		}
 
 		session, err := services.CreateStudySession(
+			c.Request.Context(),
 			userID,
 			body.Mode,
+			body.GoalID,
 			body.Goal,
 			body.PlannedMin,
 			body.ActualMin,
@@ -58,6 +66,10 @@ func CreateStudySession() gin.HandlerFunc {
 			body.SelfRating,
 			body.SelfOnTask,
 		)
+		if errors.Is(err, services.ErrGoalNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown goal_id"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -80,47 +92,55 @@ func getUserID(c *gin.Context) string {
 	return claims.UserID
 }
 
-// GetMySessions returns study sessions for the current user.
+// GetMySessions returns a page of study sessions for the current user.
+// Filters: goal, goal_id, mode, from, to (started_at; dates are days in the
+// user's timezone). Sort: created_at, started_at,
+// duration_min, focus_score (prefix "-" for descending).
 func GetMySessions() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			return
 		}
-		limit := int64(30)
-		if l := c.Query("limit"); l != "" {
-			if n, err := strconv.ParseInt(l, 10, 64); err == nil && n > 0 {
-				limit = n
-			}
+		loc := services.UserLocation(c.Request.Context(), userID)
+		from, ok := parseTimeQueryIn(c, "from", false, loc)
+		if !ok {
+			return
 		}
-		sessions, err := services.GetSessionsByUser(userID, limit)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		to, ok := parseTimeQueryIn(c, "to", true, loc)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, sessions)
+		filter := store.SessionFilter{
+			Goal:   c.Query("goal"),
+			GoalID: c.Query("goal_id"),
+			Mode:   c.Query("mode"),
+			From:   from,
+			To:     to,
+		}
+		sessions, next, err := services.ListSessions(c.Request.Context(), userID, filter, parseListOptions(c, 30))
+		respondList(c, sessions, next, err)
 	}
 }
 
-// GetMyFatigueScores returns fatigue scores for the current user.
+// GetMyFatigueScores returns a page of fatigue scores for the current user.
+// Filters: from, to (date). Sort: date, fatigue_index, burnout_probability.
 func GetMyFatigueScores() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := getUserID(c)
 		if userID == "" {
 			return
 		}
-		limit := int64(14)
-		if l := c.Query("limit"); l != "" {
-			if n, err := strconv.ParseInt(l, 10, 64); err == nil && n > 0 {
-				limit = n
-			}
+		from, ok := parseTimeQuery(c, "from", false)
+		if !ok {
+			return
 		}
-		scores, err := services.GetFatigueScoresByUser(userID, limit)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		to, ok := parseTimeQuery(c, "to", true)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, scores)
+		scores, next, err := services.ListFatigueScores(c.Request.Context(), userID, from, to, parseListOptions(c, 14))
+		respondList(c, scores, next, err)
 	}
 }
 
@@ -133,11 +153,154 @@ func GetHighRiskUsers() gin.HandlerFunc {
 				limit = n
 			}
 		}
-		scores, err := services.GetHighRiskUsers(limit)
+		scores, err := services.GetHighRiskUsers(c.Request.Context(), limit)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, scores)
 	}
-}
\ No newline at end of file
+}
+
+// GetMyBaselines lists the current user's learned per-goal session targets.
+func GetMyBaselines() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		respondBaselines(c, userID)
+	}
+}
+
+// GetUserBaselines lets an admin see any user's baselines.
+func GetUserBaselines() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		respondBaselines(c, c.Param("id"))
+	}
+}
+
+func respondBaselines(c *gin.Context, userID string) {
+	baselines, err := services.GetGoalBaselines(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if baselines == nil {
+		baselines = []models.GoalBaseline{}
+	}
+	c.JSON(http.StatusOK, baselines)
+}
+
+// GetMyFatigueTrend returns rolling means, slopes and anomalous days for the
+// current user's fatigue scores. ?from= and ?to= are days, both included
+// (default: the last 28 days); ?z= is the anomaly threshold in standard
+// deviations.
+func GetMyFatigueTrend() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		respondFatigueTrend(c, userID)
+	}
+}
+
+// GetUserFatigueTrend lets an admin see any user's fatigue trend.
+func GetUserFatigueTrend() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		respondFatigueTrend(c, c.Param("id"))
+	}
+}
+
+func respondFatigueTrend(c *gin.Context, userID string) {
+	from, ok := parseTimeQuery(c, "from", false)
+	if !ok {
+		return
+	}
+	to, ok := parseTimeQuery(c, "to", false)
+	if !ok {
+		return
+	}
+	var z float64
+	if v := c.Query("z"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n <= 0 || n > 10 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "z must be a number between 0 and 10"})
+			return
+		}
+		z = n
+	}
+	t, err := services.FatigueTrend(c.Request.Context(), userID, from, to, z)
+	if errors.Is(err, services.ErrInvalidTrendRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// GetMyBurnoutForecast projects the current user's fatigue index and burnout
+// probability over the next 7 days, with 80% and 95% prediction intervals.
+func GetMyBurnoutForecast() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		respondBurnoutForecast(c, userID)
+	}
+}
+
+// GetUserBurnoutForecast lets an admin see any user's forecast.
+func GetUserBurnoutForecast() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		respondBurnoutForecast(c, c.Param("id"))
+	}
+}
+
+func respondBurnoutForecast(c *gin.Context, userID string) {
+	f, err := services.BurnoutForecast(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrNotEnoughHistory) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+// GetProjectedHighRiskUsers lists users whose forecast burnout probability
+// reaches ?threshold= (default 70) within 7 days, highest first (admin
+// only). ?org= narrows it to one organization. Each page forecasts a slice
+// of the users; follow next_cursor for the rest.
+func GetProjectedHighRiskUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 10
+		if l := c.Query("limit"); l != "" {
+			if n, err := strconv.Atoi(l); err == nil && n > 0 {
+				limit = n
+			}
+		}
+		threshold := 70.0
+		if v := c.Query("threshold"); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 || n > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be between 0 and 100"})
+				return
+			}
+			threshold = n
+		}
+		users, next, err := services.ProjectedHighRiskUsers(c.Request.Context(), c.Query("org"), threshold, limit, c.Query("cursor"))
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "forecasting took too long; narrow it with ?org="})
+			return
+		}
+		respondList(c, users, next, err)
+	}
+}
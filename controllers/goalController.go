@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"authentication/helpers"
+	"authentication/models"
+	"authentication/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type goalBody struct {
+	Name            string   `json:"name"`
+	Category        string   `json:"category"`
+	Color           string   `json:"color"` // #RRGGBB
+	TargetMin       int      `json:"target_min"`
+	WeeklyTargetMin int      `json:"weekly_target_min"` // 0 = no weekly target
+	Aliases         []string `json:"aliases"`
+	Archived        bool     `json:"archived"`
+}
+
+func (b goalBody) input() services.GoalInput {
+	return services.GoalInput{
+		Name:            b.Name,
+		Category:        b.Category,
+		Color:           b.Color,
+		TargetMin:       b.TargetMin,
+		WeeklyTargetMin: b.WeeklyTargetMin,
+		Aliases:         b.Aliases,
+		Archived:        b.Archived,
+	}
+}
+
+func isAdmin(c *gin.Context) bool {
+	claimsVal, _ := c.Get("claims")
+	claims, ok := claimsVal.(*helpers.Claims)
+	return ok && claims.Role == "ADMIN"
+}
+
+// respondGoal writes the goal or maps a goal error to a status.
+func respondGoal(c *gin.Context, status int, g *models.Goal, err error) {
+	switch {
+	case err == nil:
+		c.JSON(status, g)
+	case errors.Is(err, services.ErrInvalidGoal):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGoalNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGoalReadOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGoalExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func respondGoals(c *gin.Context, goals []models.Goal, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if goals == nil {
+		goals = []models.Goal{}
+	}
+	c.JSON(http.StatusOK, goals)
+}
+
+// GetMyGoals lists the current user's goals and their organization's.
+// ?archived=true includes archived goals.
+func GetMyGoals() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		goals, err := services.ListGoals(c.Request.Context(), userID, c.Query("archived") == "true")
+		respondGoals(c, goals, err)
+	}
+}
+
+// CreateGoal adds a goal for the current user.
+func CreateGoal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body goalBody
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		g, err := services.CreateGoal(c.Request.Context(), userID, "", body.input())
+		respondGoal(c, http.StatusCreated, g, err)
+	}
+}
+
+// UpdateGoal replaces a goal's fields. Organization goals need an admin.
+func UpdateGoal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body goalBody
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		g, err := services.UpdateGoal(c.Request.Context(), userID, isAdmin(c), c.Param("id"), body.input())
+		respondGoal(c, http.StatusOK, g, err)
+	}
+}
+
+// ArchiveGoal hides a goal from new sessions; past sessions keep it.
+func ArchiveGoal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		g, err := services.ArchiveGoal(c.Request.Context(), userID, isAdmin(c), c.Param("id"))
+		respondGoal(c, http.StatusOK, g, err)
+	}
+}
+
+// GetOrgGoals lists an organization's shared goals (admin only).
+func GetOrgGoals() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		goals, err := services.ListOrgGoals(c.Request.Context(), c.Param("org"), c.Query("archived") == "true")
+		respondGoals(c, goals, err)
+	}
+}
+
+// CreateOrgGoal adds a goal shared with every member of an organization
+// (admin only).
+func CreateOrgGoal() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body goalBody
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		g, err := services.CreateGoal(c.Request.Context(), "", c.Param("org"), body.input())
+		respondGoal(c, http.StatusCreated, g, err)
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"authentication/importer"
+	"authentication/services"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSessionImport bounds session import uploads.
+const maxSessionImport = 10 << 20
+
+// ImportStudySessions creates sessions from another tracker's CSV or JSON
+// export, sent as the "file" field of a multipart form or as the request
+// body. ?preset picks a column mapping; a custom one can be sent as JSON in
+// the "mapping" form field or query parameter.
+func ImportStudySessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSessionImport)
+		opts := services.SessionImportOptions{
+			Format:   c.Query("format"),
+			Preset:   c.Query("preset"),
+			Timezone: c.Query("timezone"),
+			DryRun:   c.Query("dry_run") == "true",
+		}
+		var r io.Reader = c.Request.Body
+		mapping := c.Query("mapping")
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			f, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+				return
+			}
+			file, err := f.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			defer file.Close()
+			r = file
+			if opts.Format == "" && strings.EqualFold(filepath.Ext(f.Filename), ".json") {
+				opts.Format = "json"
+			}
+			if v := c.PostForm("mapping"); v != "" {
+				mapping = v
+			}
+		} else if opts.Format == "" && c.ContentType() == "application/json" {
+			opts.Format = "json"
+		}
+		if mapping != "" {
+			opts.Mapping = &importer.Mapping{}
+			if err := json.Unmarshal([]byte(mapping), opts.Mapping); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object"})
+				return
+			}
+		}
+		res, err := services.ImportSessions(c.Request.Context(), userID, r, opts)
+		switch {
+		case errors.Is(err, services.ErrInvalidImport), errors.Is(err, services.ErrInvalidTimezone):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			// Report what was stored so far; importing the file again
+			// finishes the job.
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "import": res})
+		case opts.DryRun:
+			c.JSON(http.StatusOK, res)
+		default:
+			c.JSON(http.StatusCreated, res)
+		}
+	}
+}
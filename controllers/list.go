@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"authentication/store"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseListOptions reads limit, cursor and sort query params.
+func parseListOptions(c *gin.Context, defaultLimit int64) store.ListOptions {
+	opts := store.ListOptions{
+		Limit:  defaultLimit,
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort"),
+	}
+	if l := c.Query("limit"); l != "" {
+		if n, err := strconv.ParseInt(l, 10, 64); err == nil && n > 0 {
+			opts.Limit = n
+		}
+	}
+	return opts
+}
+
+// parseTimeQuery parses an RFC3339 or YYYY-MM-DD query param. A date-only
+// upper bound (endOfDay) is moved to the next midnight so the day is included.
+// On a bad value it writes a 400 and returns ok=false.
+func parseTimeQuery(c *gin.Context, name string, endOfDay bool) (*time.Time, bool) {
+	return parseTimeQueryIn(c, name, endOfDay, time.UTC)
+}
+
+// parseTimeQueryIn is parseTimeQuery with dates taken as calendar days in loc.
+func parseTimeQueryIn(c *gin.Context, name string, endOfDay bool, loc *time.Location) (*time.Time, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	t, err := parseTimeValue(v, endOfDay, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be RFC3339 or YYYY-MM-DD"})
+		return nil, false
+	}
+	return &t, true
+}
+
+// parseTimeValue parses v as RFC3339 or YYYY-MM-DD (midnight in loc),
+// moving a date-only upper bound (endOfDay) to the next midnight.
+func parseTimeValue(v string, endOfDay bool, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, loc)
+	if err != nil {
+		return t, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// respondList writes a page of items, or maps a listing error to a status.
+func respondList(c *gin.Context, items interface{}, next string, err error) {
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) || errors.Is(err, store.ErrInvalidSort) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":       items,
+		"next_cursor": next,
+	})
+}
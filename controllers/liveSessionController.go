@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"authentication/models"
+	"authentication/services"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondLiveSession writes the session or maps a lifecycle error to a status.
+func respondLiveSession(c *gin.Context, s *models.StudySession, err error) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, s)
+	case errors.Is(err, services.ErrGoalNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown goal_id"})
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSessionInProgress), errors.Is(err, services.ErrSessionState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "session": s})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// StartLiveSession opens a server-tracked session for the current user.
+func StartLiveSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body struct {
+			Mode       string `json:"mode"`        // timer | stopwatch
+			GoalID     string `json:"goal_id"`     // catalog goal; takes precedence over goal
+			Goal       string `json:"goal"`        // coding, studying, etc.
+			PlannedMin int    `json:"planned_min"` // only for timer
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session payload"})
+			return
+		}
+		body.Mode = strings.ToLower(strings.TrimSpace(body.Mode))
+		if body.Mode != "timer" && body.Mode != "stopwatch" {
+			body.Mode = "stopwatch"
+		}
+		body.GoalID = strings.TrimSpace(body.GoalID)
+		if strings.TrimSpace(body.Goal) == "" && body.GoalID == "" {
+			body.Goal = "unspecified"
+		}
+		if body.Mode == "timer" && body.PlannedMin <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "planned_min must be greater than 0 for timer sessions"})
+			return
+		}
+		s, err := services.StartLiveSession(c.Request.Context(), userID, body.Mode, body.GoalID, body.Goal, body.PlannedMin)
+		respondLiveSession(c, s, err)
+	}
+}
+
+// GetActiveSession returns the current user's running or paused session.
+func GetActiveSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		s, err := services.GetOpenSession(c.Request.Context(), userID)
+		respondLiveSession(c, s, err)
+	}
+}
+
+// PauseLiveSession starts a break in the session.
+func PauseLiveSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		s, err := services.PauseLiveSession(c.Request.Context(), userID, c.Param("id"))
+		respondLiveSession(c, s, err)
+	}
+}
+
+// ResumeLiveSession ends the current break.
+func ResumeLiveSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		s, err := services.ResumeLiveSession(c.Request.Context(), userID, c.Param("id"))
+		respondLiveSession(c, s, err)
+	}
+}
+
+// HeartbeatLiveSession keeps an open session from being auto-closed.
+func HeartbeatLiveSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		s, err := services.HeartbeatLiveSession(c.Request.Context(), userID, c.Param("id"))
+		respondLiveSession(c, s, err)
+	}
+}
+
+// EndLiveSession finishes the session with the user's reflection.
+func EndLiveSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body struct {
+			SelfRating int    `json:"self_rating"`  // 1-5
+			SelfOnTask string `json:"self_on_task"` // yes / somewhat / no
+		}
+		// The reflection is optional; an empty body ends with defaults.
+		if c.Request.ContentLength > 0 {
+			if err := c.BindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session payload"})
+				return
+			}
+		}
+		s, err := services.EndLiveSession(c.Request.Context(), userID, c.Param("id"), body.SelfRating, body.SelfOnTask)
+		respondLiveSession(c, s, err)
+	}
+}
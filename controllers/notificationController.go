@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"authentication/models"
+	"authentication/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyNotifications returns a page of the current user's inbox, newest
+// first. ?unread=true leaves out items already read.
+func GetMyNotifications() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		items, next, err := services.ListNotifications(c.Request.Context(), userID, c.Query("unread") == "true", parseListOptions(c, 20))
+		respondList(c, items, next, err)
+	}
+}
+
+func GetUnreadNotificationCount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		n, err := services.CountUnreadNotifications(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"unread": n})
+	}
+}
+
+func MarkNotificationRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		n, err := services.MarkNotificationRead(c.Request.Context(), userID, c.Param("id"))
+		switch {
+		case errors.Is(err, services.ErrNotificationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, n)
+		}
+	}
+}
+
+func MarkAllNotificationsRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		n, err := services.MarkAllNotificationsRead(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"marked": n})
+	}
+}
+
+// GetMyNotificationPrefs returns the user's channels per kind (defaults
+// filled in), webhook URL and quiet hours.
+func GetMyNotificationPrefs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		p, err := services.GetNotificationPrefs(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// SetMyNotificationPrefs replaces the user's preferences. Quiet hours are
+// HH:MM in the user's timezone.
+func SetMyNotificationPrefs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body models.NotificationPrefs
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		p, err := services.SetNotificationPrefs(c.Request.Context(), userID, &body)
+		switch {
+		case errors.Is(err, services.ErrInvalidNotifyPrefs):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, p)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"authentication/models"
+	"authentication/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type planBody struct {
+	Goal       string      `json:"goal"`
+	GoalID     string      `json:"goal_id"`
+	StartAt    time.Time   `json:"start_at"`
+	PlannedMin int         `json:"planned_min"`
+	RRule      string      `json:"rrule"`    // e.g. FREQ=WEEKLY;BYDAY=MO,WE,FR
+	ExDates    []time.Time `json:"exdates"`  // occurrences to skip
+	Timezone   string      `json:"timezone"` // defaults to the user's timezone
+	Note       string      `json:"note"`
+}
+
+func (b planBody) input() services.PlanInput {
+	return services.PlanInput{
+		Goal:       b.Goal,
+		GoalID:     b.GoalID,
+		StartAt:    b.StartAt,
+		PlannedMin: b.PlannedMin,
+		RRule:      b.RRule,
+		ExDates:    b.ExDates,
+		Timezone:   b.Timezone,
+		Note:       b.Note,
+	}
+}
+
+// planError maps a planner error to a status.
+func planError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidPlan), errors.Is(err, services.ErrInvalidPlanRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGoalNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown goal_id"})
+	case errors.Is(err, services.ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetMyStudyPlans lists the current user's study plans.
+func GetMyStudyPlans() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		plans, err := services.ListStudyPlans(c.Request.Context(), userID)
+		if err != nil {
+			planError(c, err)
+			return
+		}
+		if plans == nil {
+			plans = []models.StudyPlan{}
+		}
+		c.JSON(http.StatusOK, plans)
+	}
+}
+
+// CreateStudyPlan schedules a session, or with rrule a recurring block.
+func CreateStudyPlan() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body planBody
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		p, err := services.CreateStudyPlan(c.Request.Context(), userID, body.input())
+		if err != nil {
+			planError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, p)
+	}
+}
+
+// UpdateStudyPlan replaces a study plan's fields.
+func UpdateStudyPlan() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body planBody
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		p, err := services.UpdateStudyPlan(c.Request.Context(), userID, c.Param("id"), body.input())
+		if err != nil {
+			planError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, p)
+	}
+}
+
+// DeleteStudyPlan removes a study plan and its matched occurrences.
+func DeleteStudyPlan() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		if err := services.DeleteStudyPlan(c.Request.Context(), userID, c.Param("id")); err != nil {
+			planError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Study plan deleted"})
+	}
+}
+
+// parsePlanRange reads ?from= and ?to= as dates in the user's timezone (or
+// RFC3339). On a bad value it writes a 400 and returns ok=false.
+func parsePlanRange(c *gin.Context, userID string) (from, to *time.Time, ok bool) {
+	loc := services.UserLocation(c.Request.Context(), userID)
+	if from, ok = parseTimeQueryIn(c, "from", false, loc); !ok {
+		return nil, nil, false
+	}
+	if to, ok = parseTimeQueryIn(c, "to", true, loc); !ok {
+		return nil, nil, false
+	}
+	return from, to, true
+}
+
+// GetMyPlanSchedule lists planned occurrences with their status, the next
+// 7 days by default.
+func GetMyPlanSchedule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		from, to, ok := parsePlanRange(c, userID)
+		if !ok {
+			return
+		}
+		occs, err := services.PlanSchedule(c.Request.Context(), userID, from, to)
+		if err != nil {
+			planError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, occs)
+	}
+}
+
+// GetMyPlanAdherence summarizes how closely the user kept to their plans,
+// the last 28 days by default.
+func GetMyPlanAdherence() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		from, to, ok := parsePlanRange(c, userID)
+		if !ok {
+			return
+		}
+		sum, err := services.PlanAdherence(c.Request.Context(), userID, from, to)
+		if err != nil {
+			planError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, sum)
+	}
+}
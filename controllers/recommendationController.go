@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"authentication/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNextSessionRecommendation suggests a length, break cadence and time
+// today for the current user's next session. ?goal_id= or ?goal= picks the
+// goal; by default it is the goal of their latest session.
+func GetNextSessionRecommendation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		rec, err := services.RecommendNextSession(c.Request.Context(), userID, c.Query("goal_id"), c.Query("goal"))
+		if errors.Is(err, services.ErrGoalNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown goal_id"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rec)
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"authentication/services"
+	"authentication/store"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== RECOMPUTE SCORES (ADMIN) =====================
+
+// StartRecompute queues a re-score of sessions and daily fatigue scores for
+// one user, one organization or everyone. "to" is inclusive for plain dates.
+func StartRecompute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			UserID  string `json:"user_id"`
+			OrgID   string `json:"org_id"`
+			From    string `json:"from"` // RFC3339 or YYYY-MM-DD
+			To      string `json:"to"`
+			DryRun  bool   `json:"dry_run"`
+			Workers int    `json:"workers"`
+			Model   string `json:"model_version"` // defaults to each user's own model
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		from, err := parseTimeValue(strings.TrimSpace(body.From), false, time.UTC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+		to, err := parseTimeValue(strings.TrimSpace(body.To), true, time.UTC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+
+		job, err := services.NewRecomputeJob(c.Request.Context(), services.RecomputeScope{
+			UserID:       strings.TrimSpace(body.UserID),
+			OrgID:        strings.TrimSpace(body.OrgID),
+			From:         from,
+			To:           to,
+			DryRun:       body.DryRun,
+			ModelVersion: strings.TrimSpace(body.Model),
+		})
+		if errors.Is(err, services.ErrRecomputeRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scoring model version"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := services.StartRecompute(job, body.Workers); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// GetRecomputeJob reports a job's progress and, for dry runs, its diff.
+func GetRecomputeJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := services.GetRecomputeJob(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "recompute job not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// ResumeRecompute restarts a failed or interrupted job from its checkpoint.
+func ResumeRecompute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workers, _ := strconv.Atoi(c.Query("workers"))
+		job, err := services.ResumableRecomputeJob(c.Request.Context(), c.Param("id"))
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "recompute job not found"})
+			return
+		case errors.Is(err, services.ErrRecomputeDone):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := services.StartRecompute(job, workers); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"authentication/report"
+	"authentication/services"
+	"authentication/store"
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetWeeklyReport renders the current user's weekly wellbeing report.
+// ?week= takes an ISO week (2026-W42) or any date in the week, defaulting
+// to this week; ?format= is html (default), pdf or json. Admins may pass
+// ?user_id= to see another user's report.
+func GetWeeklyReport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		if other := c.Query("user_id"); other != "" && other != userID {
+			if !isAdmin(c) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+				return
+			}
+			userID = other
+		}
+		format := c.DefaultQuery("format", "html")
+		if format != "html" && format != "pdf" && format != "json" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be html, pdf or json"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		week, err := services.ParseReportWeek(c.Query("week"), services.UserLocation(ctx, userID))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		w, err := services.WeeklyReport(ctx, userID, week)
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var buf bytes.Buffer
+		switch format {
+		case "json":
+			c.JSON(http.StatusOK, w)
+			return
+		case "pdf":
+			err = report.RenderPDF(&buf, w)
+			c.Header("Content-Disposition", `inline; filename="weekly-report-`+w.ISOWeek()+`.pdf"`)
+		default:
+			err = report.RenderHTML(&buf, w)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		contentType := "text/html; charset=utf-8"
+		if format == "pdf" {
+			contentType = "application/pdf"
+		}
+		c.Data(http.StatusOK, contentType, buf.Bytes())
+	}
+}
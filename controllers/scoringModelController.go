@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"authentication/models"
+	"authentication/services"
+	"authentication/store"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ===================== SCORING MODELS (ADMIN) =====================
+
+func GetScoringModels() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := services.ListScoringModels(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// CreateScoringModel adds a new, inactive model version.
+func CreateScoringModel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body models.ScoringModel
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		err := services.CreateScoringModel(c.Request.Context(), &body)
+		switch {
+		case errors.Is(err, services.ErrInvalidScoringModel):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, store.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "scoring model version already exists"})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusCreated, body)
+		}
+	}
+}
+
+// ActivateScoringModel makes the version the one new scores are computed with.
+func ActivateScoringModel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, err := services.ActivateScoringModel(c.Request.Context(), c.Param("version"))
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "scoring model not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// GetOrgScoringModel shows which version an organization pins.
+func GetOrgScoringModel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID := c.Param("org")
+		version, err := services.OrgScoringModel(c.Request.Context(), orgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"org_id": orgID, "scoring_model": version})
+	}
+}
+
+// SetOrgScoringModel pins an organization to a version; an empty version
+// makes it follow the active model again.
+func SetOrgScoringModel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Version string `json:"version"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		orgID := c.Param("org")
+		version := strings.TrimSpace(body.Version)
+		err := services.SetOrgScoringModel(c.Request.Context(), orgID, version)
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "scoring model not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"org_id": orgID, "scoring_model": version})
+	}
+}
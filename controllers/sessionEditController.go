@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"authentication/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionEditError maps a session edit error to a status.
+func sessionEditError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSessionEdit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGoalNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown goal_id"})
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSessionState):
+		c.JSON(http.StatusConflict, gin.H{"error": "study session is still in progress"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// UpdateStudySession corrects fields of one of the current user's finished
+// sessions. Omitted fields are left as they are.
+func UpdateStudySession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body struct {
+			Mode       *string    `json:"mode"`    // timer | stopwatch
+			GoalID     *string    `json:"goal_id"` // catalog goal; "" unlinks it
+			Goal       *string    `json:"goal"`
+			PlannedMin *int       `json:"planned_min"`
+			ActualMin  *int       `json:"actual_min"`
+			StartedAt  *time.Time `json:"started_at"`
+			PauseCount *int       `json:"pause_count"`
+			SelfRating *int       `json:"self_rating"`  // 1-5
+			SelfOnTask *string    `json:"self_on_task"` // yes / somewhat / no
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session payload"})
+			return
+		}
+		s, err := services.UpdateStudySession(c.Request.Context(), userID, c.Param("id"), services.SessionPatch{
+			Mode:       body.Mode,
+			Goal:       body.Goal,
+			GoalID:     body.GoalID,
+			PlannedMin: body.PlannedMin,
+			ActualMin:  body.ActualMin,
+			StartedAt:  body.StartedAt,
+			PauseCount: body.PauseCount,
+			SelfRating: body.SelfRating,
+			SelfOnTask: body.SelfOnTask,
+		})
+		if err != nil {
+			sessionEditError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// DeleteStudySession removes one of the current user's finished sessions.
+func DeleteStudySession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		if err := services.DeleteStudySession(c.Request.Context(), userID, c.Param("id")); err != nil {
+			sessionEditError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Study session deleted"})
+	}
+}
+
+// GetStudySessionHistory lists the edits of one of the current user's
+// sessions, each with the values it replaced.
+func GetStudySessionHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		edits, err := services.SessionHistory(c.Request.Context(), userID, c.Param("id"))
+		if err != nil {
+			sessionEditError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, edits)
+	}
+}
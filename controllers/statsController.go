@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"authentication/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseStatsRange reads ?from= and ?to= as dates in the user's timezone
+// (or RFC3339). On a bad value it writes a 400 and returns ok=false.
+func parseStatsRange(c *gin.Context, userID string) (services.StatsRange, bool) {
+	loc := services.UserLocation(c.Request.Context(), userID)
+	from, ok := parseTimeQueryIn(c, "from", false, loc)
+	if !ok {
+		return services.StatsRange{}, false
+	}
+	to, ok := parseTimeQueryIn(c, "to", true, loc)
+	if !ok {
+		return services.StatsRange{}, false
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return services.StatsRange{}, false
+	}
+	return services.StatsRange{From: from, To: to}, true
+}
+
+// statsHandler wraps a stats query with the user and range parsing every
+// /stats endpoint shares.
+func statsHandler(fn func(c *gin.Context, userID string, r services.StatsRange) (interface{}, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		r, ok := parseStatsRange(c, userID)
+		if !ok {
+			return
+		}
+		out, err := fn(c, userID, r)
+		if errors.Is(err, services.ErrInvalidBucket) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// GetMyStreaks returns the current and longest daily study streaks.
+func GetMyStreaks() gin.HandlerFunc {
+	return statsHandler(func(c *gin.Context, userID string, r services.StatsRange) (interface{}, error) {
+		return services.SessionStreaks(c.Request.Context(), userID, r)
+	})
+}
+
+// GetMyTotals returns minutes studied per goal and per mode.
+func GetMyTotals() gin.HandlerFunc {
+	return statsHandler(func(c *gin.Context, userID string, r services.StatsRange) (interface{}, error) {
+		return services.SessionTotalsByGoalAndMode(c.Request.Context(), userID, r)
+	})
+}
+
+// GetMyHeatmap returns minutes per calendar day, the last year by default.
+func GetMyHeatmap() gin.HandlerFunc {
+	return statsHandler(func(c *gin.Context, userID string, r services.StatsRange) (interface{}, error) {
+		return services.MinutesHeatmap(c.Request.Context(), userID, r)
+	})
+}
+
+// GetMyFocusByTime returns average focus by hour of day and weekday.
+func GetMyFocusByTime() gin.HandlerFunc {
+	return statsHandler(func(c *gin.Context, userID string, r services.StatsRange) (interface{}, error) {
+		return services.FocusByTimeOfDay(c.Request.Context(), userID, r)
+	})
+}
+
+// GetMyPauseRate returns the pause rate per ?bucket=day|week (default week).
+func GetMyPauseRate() gin.HandlerFunc {
+	return statsHandler(func(c *gin.Context, userID string, r services.StatsRange) (interface{}, error) {
+		return services.PauseRateTrends(c.Request.Context(), userID, r, c.Query("bucket"))
+	})
+}
@@ -1,27 +1,28 @@
 package controllers
 
 import (
-	"authentication/config"
 	"authentication/helpers"
 	"authentication/models"
+	"authentication/services"
+	"authentication/store"
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var validate = validator.New()
-var userCollection = config.OpenCollection("users")
 
 // ===================== SIGNUP =====================
 func Signup() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
 
 		var user models.User
@@ -36,19 +37,13 @@ func Signup() gin.HandlerFunc {
 			return
 		}
 
-		// Build uniqueness filter: always check email, only check phone when provided.
-		orConditions := []bson.M{
-			{"email": user.Email},
-		}
+		// Uniqueness: always check email, only check phone when provided.
+		phone := ""
 		if user.Phone != nil {
-			if phoneVal := *user.Phone; phoneVal != "" {
-				orConditions = append(orConditions, bson.M{"phone": user.Phone})
-			}
+			phone = *user.Phone
 		}
 
-		count, err := userCollection.CountDocuments(ctx, bson.M{
-			"$or": orConditions,
-		})
+		count, err := store.Get().CountUsersWithContact(ctx, *user.Email, phone)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -63,6 +58,8 @@ func Signup() gin.HandlerFunc {
 		// Force default role (SECURE)
 		role := "USER"
 		user.Role = &role
+		// Organization membership is assigned by an admin
+		user.Org_id = ""
 
 		user.Password = helpers.HashPassword(user.Password)
 		user.Created_at = time.Now()
@@ -76,7 +73,7 @@ func Signup() gin.HandlerFunc {
 		user.Token = &accessToken
 		user.Refresh_token = &refreshToken
 
-		_, insertErr := userCollection.InsertOne(ctx, user)
+		insertErr := services.RegisterUser(ctx, &user)
 		if insertErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": insertErr.Error()})
 			return
@@ -99,11 +96,10 @@ func Signup() gin.HandlerFunc {
 func Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
 
 		var loginInput models.User
-		var foundUser models.User
 
 		// Bind JSON
 		if err := c.BindJSON(&loginInput); err != nil {
@@ -121,10 +117,8 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
-		// 🔥 FIXED: Dereference pointer in Mongo query
-		err := userCollection.
-			FindOne(ctx, bson.M{"email": *loginInput.Email}).
-			Decode(&foundUser)
+		// Look up the account by email
+		foundUser, err := store.Get().FindUserByEmail(ctx, *loginInput.Email)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -152,7 +146,12 @@ func Login() gin.HandlerFunc {
 				*foundUser.Role,
 			)
 
-		helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+		if err := helpers.UpdateAllTokens(ctx, token, refreshToken, foundUser.User_id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update tokens",
+			})
+			return
+		}
 
 		// 🔒 Remove sensitive data before sending response
 		foundUser.Password = nil
@@ -176,10 +175,9 @@ func GetMe() gin.HandlerFunc {
 			return
 		}
 		claims := claimsValue.(*helpers.Claims)
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
-		var user models.User
-		err := userCollection.FindOne(ctx, bson.M{"user_id": claims.UserID}).Decode(&user)
+		user, err := store.Get().FindUserByID(ctx, claims.UserID)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
@@ -215,14 +213,10 @@ func GetUser() gin.HandlerFunc {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
 
-		var user models.User
-
-		err := userCollection.
-			FindOne(ctx, bson.M{"user_id": requestedUserId}).
-			Decode(&user)
+		user, err := store.Get().FindUserByID(ctx, requestedUserId)
 
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -237,25 +231,67 @@ func GetUser() gin.HandlerFunc {
 	}
 }
 
-// ===================== GET ALL USERS =====================
-func GetUsers() gin.HandlerFunc {
+// ===================== DELETE ACCOUNT =====================
+// DELETE /me removes the caller; DELETE /user/:id lets an ADMIN (or the user
+// themselves) remove an account. Sessions and fatigue scores go with it.
+func DeleteUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		claimsValue, exists := c.Get("claims")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		tokenClaims := claimsValue.(*helpers.Claims)
+
+		userID := c.Param("id")
+		if userID == "" {
+			userID = tokenClaims.UserID
+		}
+		if tokenClaims.Role != "ADMIN" && tokenClaims.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
 
-		cursor, err := userCollection.Find(ctx, bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if _, err := store.Get().FindUserByID(ctx, userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err := services.DeleteAccount(ctx, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
 			return
 		}
-		defer cursor.Close(ctx)
 
-		var users []models.User
-		if err := cursor.All(ctx, &users); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+	}
+}
+
+// ===================== GET ALL USERS =====================
+// Filters: org, role, q (name or email), created_from, created_to.
+// Sort: created_at, first_name, last_name, email (prefix "-" for descending).
+func GetUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		createdFrom, ok := parseTimeQuery(c, "created_from", false)
+		if !ok {
+			return
+		}
+		createdTo, ok := parseTimeQuery(c, "created_to", true)
+		if !ok {
 			return
 		}
+		filter := store.UserFilter{
+			OrgID:       c.Query("org"),
+			Role:        c.Query("role"),
+			Search:      strings.TrimSpace(c.Query("q")),
+			CreatedFrom: createdFrom,
+			CreatedTo:   createdTo,
+		}
+
+		users, next, err := services.ListUsers(c.Request.Context(), filter, parseListOptions(c, 50))
 
 		// Remove sensitive data
 		for i := range users {
@@ -264,14 +300,78 @@ func GetUsers() gin.HandlerFunc {
 			users[i].Refresh_token = nil
 		}
 
-		c.JSON(http.StatusOK, users)
+		respondList(c, users, next, err)
+	}
+}
+
+// ===================== SET USER ORGANIZATION (ADMIN) =====================
+func SetUserOrg() gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		var body struct {
+			OrgID string `json:"org_id"` // empty removes the user from their organization
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		userID := c.Param("id")
+		if _, err := store.Get().FindUserByID(ctx, userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err := store.Get().SetUserOrg(ctx, userID, strings.TrimSpace(body.OrgID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "org_id": strings.TrimSpace(body.OrgID)})
+	}
+}
+
+// ===================== SET TIMEZONE =====================
+// PUT /me/timezone stores the caller's IANA timezone ("" for UTC). Days are
+// counted in it from then on and past scores are recomputed in the background.
+func SetMyTimezone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserID(c)
+		if userID == "" {
+			return
+		}
+		var body struct {
+			Timezone string `json:"timezone"` // e.g. America/New_York
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		job, err := services.SetUserTimezone(c.Request.Context(), userID, body.Timezone)
+		if errors.Is(err, services.ErrInvalidTimezone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := gin.H{"timezone": strings.TrimSpace(body.Timezone)}
+		if job != nil {
+			resp["recompute_job_id"] = job.ID.Hex()
+		}
+		c.JSON(http.StatusOK, resp)
 	}
 }
 
 // ===================== FORGOT PASSWORD =====================
 func ForgotPassword() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
 
 		var body struct {
@@ -282,8 +382,7 @@ func ForgotPassword() gin.HandlerFunc {
 			return
 		}
 
-		var foundUser models.User
-		err := userCollection.FindOne(ctx, bson.M{"email": *body.Email}).Decode(&foundUser)
+		foundUser, err := store.Get().FindUserByEmail(ctx, *body.Email)
 		if err != nil {
 			// Don't reveal whether email exists
 			c.JSON(http.StatusOK, gin.H{
@@ -298,14 +397,7 @@ func ForgotPassword() gin.HandlerFunc {
 			return
 		}
 		expires := time.Now().Add(1 * time.Hour)
-		update := bson.D{
-			{"$set", bson.D{
-				{"reset_token", resetToken},
-				{"reset_expires", expires},
-				{"updated_at", time.Now()},
-			}},
-		}
-		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": foundUser.User_id}, update)
+		err = store.Get().SetResetToken(ctx, foundUser.User_id, resetToken, expires)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set reset token"})
 			return
@@ -322,7 +414,7 @@ func ForgotPassword() gin.HandlerFunc {
 // ===================== RESET PASSWORD =====================
 func ResetPassword() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 		defer cancel()
 
 		var body struct {
@@ -334,8 +426,7 @@ func ResetPassword() gin.HandlerFunc {
 			return
 		}
 
-		var foundUser models.User
-		err := userCollection.FindOne(ctx, bson.M{"reset_token": body.Token}).Decode(&foundUser)
+		foundUser, err := store.Get().FindUserByResetToken(ctx, body.Token)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
 			return
@@ -346,14 +437,7 @@ func ResetPassword() gin.HandlerFunc {
 		}
 
 		hashed := helpers.HashPassword(body.NewPassword)
-		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": foundUser.User_id}, bson.D{
-			{"$set", bson.D{
-				{"password", *hashed},
-				{"reset_token", nil},
-				{"reset_expires", nil},
-				{"updated_at", time.Now()},
-			}},
-		})
+		err = services.ResetUserPassword(ctx, foundUser.User_id, *hashed)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 			return
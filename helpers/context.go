@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+type ctxKey string
+
+const (
+	requestIDKey ctxKey = "request_id"
+	userIDKey    ctxKey = "user_id"
+)
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated user ID.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserIDFromContext returns the user ID stored in ctx, or "".
+func UserIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(userIDKey).(string)
+	return id
+}
+
+// Logf logs a message prefixed with the request and user IDs carried by ctx.
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	prefix := ""
+	if id := RequestIDFromContext(ctx); id != "" {
+		prefix += "[req=" + id + "] "
+	}
+	if id := UserIDFromContext(ctx); id != "" {
+		prefix += "[user=" + id + "] "
+	}
+	log.Print(prefix + fmt.Sprintf(format, args...))
+}
@@ -8,10 +8,9 @@ import (
 	"log"
 	"time"
 
-	"authentication/config"
+	"authentication/store"
 
 	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -100,31 +99,11 @@ func HashPassword(password *string) *string {
 	return &hashedPwd
 }
 
-func UpdateAllTokens(signedToken, signedRefreshToken, userID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+func UpdateAllTokens(ctx context.Context, signedToken, signedRefreshToken, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	userCollection := config.OpenCollection("users")
-	//Crate an update object
-
-	updateObj := bson.D{
-		{"$set", bson.D{
-			{"token", signedToken},
-			{"refresh_token", signedRefreshToken},
-			{"updated_at", time.Now()},
-		}},
-	}
-
-	//Create a filter
-	filter := bson.M{"user_id": userID}
-
-	// upsert := true
-	// opt := options.UpdateOptions{
-	// 	Upsert: &upsert,
-	// }
-
-	_, err := userCollection.UpdateOne(ctx, filter, updateObj)
 
-	return err
+	return store.Get().UpdateUserTokens(ctx, userID, signedToken, signedRefreshToken)
 }
 
 func VerifyPassword(foundPwd, pwd string) (bool, error) {
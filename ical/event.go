@@ -0,0 +1,222 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a VEVENT with its times resolved to instants.
+type Event struct {
+	UID          string
+	Summary      string
+	Description  string
+	Categories   []string
+	Status       string // TENTATIVE, CONFIRMED or CANCELLED
+	Start        time.Time
+	End          time.Time
+	AllDay       bool
+	Zone         *Zone  // DTSTART's zone; nil for UTC and floating times
+	RRule        string // as written, without the "RRULE:" prefix
+	ExDates      []time.Time
+	RDates       int
+	RecurrenceID *time.Time // set on an overridden instance of a recurring event
+}
+
+// BadEvent is a VEVENT that could not be read.
+type BadEvent struct {
+	UID     string
+	Summary string
+	Err     error
+}
+
+// Events reads the calendar's VEVENTs. Floating times (no TZID and no Z)
+// are read in floating.
+func Events(cal *Component, floating *time.Location) ([]Event, []BadEvent) {
+	zs := calendarZones(cal)
+	var (
+		events []Event
+		bad    []BadEvent
+	)
+	for _, c := range cal.Children("VEVENT") {
+		e, err := readEvent(c, zs, floating)
+		if err != nil {
+			bad = append(bad, BadEvent{UID: e.UID, Summary: e.Summary, Err: err})
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, bad
+}
+
+func readEvent(c *Component, zs zones, floating *time.Location) (Event, error) {
+	e := Event{}
+	if p := c.Get("UID"); p != nil {
+		e.UID = strings.TrimSpace(p.Value)
+	}
+	if p := c.Get("SUMMARY"); p != nil {
+		e.Summary = strings.TrimSpace(p.Text())
+	}
+	if p := c.Get("DESCRIPTION"); p != nil {
+		e.Description = p.Text()
+	}
+	if p := c.Get("STATUS"); p != nil {
+		e.Status = strings.ToUpper(strings.TrimSpace(p.Value))
+	}
+	for _, p := range c.All("CATEGORIES") {
+		for _, cat := range splitList(p.Value) {
+			if cat = strings.TrimSpace(unescapeText(cat)); cat != "" {
+				e.Categories = append(e.Categories, cat)
+			}
+		}
+	}
+	if e.UID == "" {
+		return e, errors.New("missing UID")
+	}
+
+	start := c.Get("DTSTART")
+	if start == nil {
+		return e, errors.New("missing DTSTART")
+	}
+	var err error
+	if e.Start, e.AllDay, e.Zone, err = dateTime(start, start.Value, zs, floating); err != nil {
+		return e, fmt.Errorf("DTSTART: %w", err)
+	}
+	switch end, dur := c.Get("DTEND"), c.Get("DURATION"); {
+	case end != nil:
+		if e.End, _, _, err = dateTime(end, end.Value, zs, floating); err != nil {
+			return e, fmt.Errorf("DTEND: %w", err)
+		}
+	case dur != nil:
+		d, err := ParseDuration(dur.Value)
+		if err != nil {
+			return e, fmt.Errorf("DURATION: %w", err)
+		}
+		e.End = e.Start.Add(d)
+	case e.AllDay:
+		e.End = e.Start.AddDate(0, 0, 1)
+	default:
+		e.End = e.Start
+	}
+	if e.End.Before(e.Start) {
+		return e, errors.New("ends before it starts")
+	}
+
+	if p := c.Get("RRULE"); p != nil {
+		e.RRule = strings.TrimSpace(p.Value)
+	}
+	for _, p := range c.All("EXDATE") {
+		for _, v := range splitList(p.Value) {
+			t, _, _, err := dateTime(&p, v, zs, floating)
+			if err != nil {
+				return e, fmt.Errorf("EXDATE: %w", err)
+			}
+			e.ExDates = append(e.ExDates, t)
+		}
+	}
+	for _, p := range c.All("RDATE") {
+		e.RDates += len(splitList(p.Value))
+	}
+	if p := c.Get("RECURRENCE-ID"); p != nil {
+		t, _, _, err := dateTime(p, p.Value, zs, floating)
+		if err != nil {
+			return e, fmt.Errorf("RECURRENCE-ID: %w", err)
+		}
+		e.RecurrenceID = &t
+	}
+	return e, nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] == '\\':
+			i++
+		case v[i] == ',':
+			out = append(out, v[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, v[start:])
+}
+
+// dateTime reads a DATE or DATE-TIME value of p. UTC values and dates
+// have a nil zone; dates are midnight in floating.
+func dateTime(p *Property, v string, zs zones, floating *time.Location) (time.Time, bool, *Zone, error) {
+	v = strings.TrimSpace(v)
+	if p.Param("VALUE") == "DATE" || len(v) == 8 {
+		t, err := time.ParseInLocation("20060102", v, floating)
+		if err != nil {
+			return t, true, nil, fmt.Errorf("date %q", v)
+		}
+		return t, true, nil, nil
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		if err != nil {
+			return t, false, nil, fmt.Errorf("date-time %q", v)
+		}
+		return t, false, nil, nil
+	}
+	wall, err := time.Parse("20060102T150405", v)
+	if err != nil {
+		return wall, false, nil, fmt.Errorf("date-time %q", v)
+	}
+	tzid := p.Param("TZID")
+	if tzid == "" {
+		y, m, d := wall.Date()
+		hh, mm, ss := wall.Clock()
+		return time.Date(y, m, d, hh, mm, ss, 0, floating), false, nil, nil
+	}
+	z, err := zs.lookup(tzid)
+	if err != nil {
+		return wall, false, nil, err
+	}
+	return z.At(wall), false, z, nil
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration reads an RFC 5545 DURATION such as PT1H30M or P1D.
+func ParseDuration(v string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(v)))
+	if m == nil || v == "P" || strings.HasSuffix(v, "T") {
+		return 0, fmt.Errorf("duration %q", v)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("duration %q", v)
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// FormatDuration writes d as a DURATION in whole minutes, e.g. PT90M.
+func FormatDuration(d time.Duration) string {
+	return "PT" + strconv.Itoa(int(d.Minutes())) + "M"
+}
+
+// FormatUTC writes t as a UTC DATE-TIME.
+func FormatUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// FormatLocal writes t's wall clock as a DATE-TIME for use with a TZID.
+func FormatLocal(t time.Time) string {
+	return t.Format("20060102T150405")
+}
@@ -0,0 +1,298 @@
+// Package ical reads and writes the parts of RFC 5545 iCalendar files the
+// calendar feed and import need: components and their properties, events
+// with their timezones, and VTIMEZONE definitions.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid iCalendar data")
+
+// maxLines bounds parsing of a single upload.
+const maxLines = 200000
+
+// Property is one content line: NAME;PARAM=VALUE:VALUE.
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Param returns the named parameter, or "".
+func (p *Property) Param(name string) string {
+	return p.Params[name]
+}
+
+// Text returns the value with TEXT escapes such as \n and \; undone.
+func (p *Property) Text() string {
+	return unescapeText(p.Value)
+}
+
+// Component is a BEGIN:NAME ... END:NAME block.
+type Component struct {
+	Name       string
+	Props      []Property
+	Components []*Component
+}
+
+func NewComponent(name string) *Component {
+	return &Component{Name: name}
+}
+
+// Get returns the first property with the name, or nil.
+func (c *Component) Get(name string) *Property {
+	for i := range c.Props {
+		if c.Props[i].Name == name {
+			return &c.Props[i]
+		}
+	}
+	return nil
+}
+
+// All returns every property with the name.
+func (c *Component) All(name string) []Property {
+	var out []Property
+	for _, p := range c.Props {
+		if p.Name == name {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Children returns the sub-components with the name.
+func (c *Component) Children(name string) []*Component {
+	var out []*Component
+	for _, sub := range c.Components {
+		if sub.Name == name {
+			out = append(out, sub)
+		}
+	}
+	return out
+}
+
+// Add appends a property whose value is written as is. params alternate
+// names and values.
+func (c *Component) Add(name, value string, params ...string) {
+	p := Property{Name: name, Value: value}
+	if len(params) > 0 {
+		p.Params = make(map[string]string, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			p.Params[params[i]] = params[i+1]
+		}
+	}
+	c.Props = append(c.Props, p)
+}
+
+// AddText appends a TEXT property, escaping the value.
+func (c *Component) AddText(name, value string, params ...string) {
+	c.Add(name, escapeText(value), params...)
+}
+
+// Append adds a sub-component.
+func (c *Component) Append(sub *Component) {
+	c.Components = append(c.Components, sub)
+}
+
+// Parse reads an iCalendar stream and returns its VCALENDAR.
+func Parse(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		root  *Component
+		stack []*Component
+	)
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalid, n+1, err)
+		}
+		switch p.Name {
+		case "BEGIN":
+			c := NewComponent(strings.ToUpper(p.Value))
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("%w: line %d: more than one calendar", ErrInvalid, n+1)
+				}
+				root = c
+			} else {
+				stack[len(stack)-1].Append(c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("%w: line %d: unexpected END:%s", ErrInvalid, n+1, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("%w: line %d: property outside a component", ErrInvalid, n+1)
+			}
+			top := stack[len(stack)-1]
+			top.Props = append(top.Props, p)
+		}
+	}
+	switch {
+	case root == nil || root.Name != "VCALENDAR":
+		return nil, fmt.Errorf("%w: no VCALENDAR", ErrInvalid)
+	case len(stack) > 0:
+		return nil, fmt.Errorf("%w: %s is not closed", ErrInvalid, stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// unfold joins continuation lines, which start with a space or tab.
+func unfold(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if len(lines) >= maxLines {
+			return nil, fmt.Errorf("%w: more than %d lines", ErrInvalid, maxLines)
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return lines, nil
+}
+
+// parseLine splits NAME;PARAM=VALUE;PARAM="QUOTED":VALUE. Names are
+// upper-cased; parameter values keep their case without the quotes.
+func parseLine(line string) (Property, error) {
+	p := Property{}
+	inQuote := false
+	start, inName := 0, true
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		if ch == '"' {
+			inQuote = !inQuote
+			continue
+		}
+		if inQuote || (ch != ';' && ch != ':') {
+			continue
+		}
+		part := line[start:i]
+		if inName {
+			p.Name = strings.ToUpper(strings.TrimSpace(part))
+			inName = false
+		} else if err := p.addParam(part); err != nil {
+			return p, err
+		}
+		start = i + 1
+		if ch == ':' {
+			p.Value = line[start:]
+			if p.Name == "" {
+				return p, errors.New("missing property name")
+			}
+			return p, nil
+		}
+	}
+	return p, fmt.Errorf("%q has no value", line)
+}
+
+func (p *Property) addParam(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("parameter %q is not NAME=VALUE", s)
+	}
+	if p.Params == nil {
+		p.Params = map[string]string{}
+	}
+	p.Params[strings.ToUpper(strings.TrimSpace(k))] = strings.ReplaceAll(v, `"`, "")
+	return nil
+}
+
+func unescapeText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// Encode writes c with CRLF line endings, folding lines at 75 octets.
+func (c *Component) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.encode(bw)
+	return bw.Flush()
+}
+
+func (c *Component) encode(w *bufio.Writer) {
+	writeFolded(w, "BEGIN:"+c.Name)
+	for _, p := range c.Props {
+		var b strings.Builder
+		b.WriteString(p.Name)
+		keys := make([]string, 0, len(p.Params))
+		for k := range p.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := p.Params[k]
+			if strings.ContainsAny(v, ";:,") {
+				v = `"` + v + `"`
+			}
+			b.WriteString(";" + k + "=" + v)
+		}
+		b.WriteString(":" + p.Value)
+		writeFolded(w, b.String())
+	}
+	for _, sub := range c.Components {
+		sub.encode(w)
+	}
+	writeFolded(w, "END:"+c.Name)
+}
+
+// writeFolded splits line into chunks of at most 75 octets without
+// breaking a UTF-8 sequence.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts
+	}
+	w.WriteString(line + "\r\n")
+}
@@ -0,0 +1,287 @@
+package ical
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFixture(t *testing.T, name string) *Component {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cal, err := Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func eventsByKey(events []Event) map[string]Event {
+	out := make(map[string]Event)
+	for _, e := range events {
+		key := e.UID
+		if e.RecurrenceID != nil {
+			key += "#" + FormatUTC(*e.RecurrenceID)
+		}
+		out[key] = e
+	}
+	return out
+}
+
+func utc(y int, m time.Month, d, hh, mm int) time.Time {
+	return time.Date(y, m, d, hh, mm, 0, 0, time.UTC)
+}
+
+func TestLoadZone(t *testing.T) {
+	tests := []struct {
+		tzid string
+		want string // "" = not resolvable
+	}{
+		{"Europe/Berlin", "Europe/Berlin"},
+		{"W. Europe Standard Time", "Europe/Berlin"},
+		{`"Pacific Standard Time"`, "America/Los_Angeles"},
+		{"/mozilla.org/20050126_1/Europe/Berlin", "Europe/Berlin"},
+		{"/softwarestudio.org/Olson_20011030_5/America/New_York", "America/New_York"},
+		{"Campus Time", ""},
+		{"Local", ""},
+	}
+	for _, tt := range tests {
+		loc, ok := LoadZone(tt.tzid)
+		got := ""
+		if ok {
+			got = loc.String()
+		}
+		if got != tt.want {
+			t.Errorf("LoadZone(%q) = %q, want %q", tt.tzid, got, tt.want)
+		}
+	}
+}
+
+func TestEventsOutlook(t *testing.T) {
+	events, bad := Events(parseFixture(t, "outlook.ics"), time.UTC)
+	if len(bad) != 1 || !strings.Contains(bad[0].Err.Error(), "UID") {
+		t.Fatalf("bad events %+v, want the one without a UID", bad)
+	}
+	byKey := eventsByKey(events)
+
+	master, ok := byKey["weekly-1@example.com"]
+	if !ok {
+		t.Fatal("recurring event missing")
+	}
+	if master.Zone == nil || master.Zone.Name() != "Europe/Berlin" {
+		t.Fatalf("Windows TZID resolved to %v, want Europe/Berlin", master.Zone)
+	}
+	if !master.Start.Equal(utc(2026, 3, 2, 8, 0)) || master.End.Sub(master.Start) != 90*time.Minute {
+		t.Fatalf("start %v end %v", master.Start, master.End)
+	}
+	if master.RRule != "FREQ=WEEKLY;BYDAY=MO;COUNT=10" {
+		t.Fatalf("rrule %q", master.RRule)
+	}
+	wantEx := []time.Time{utc(2026, 3, 9, 8, 0), utc(2026, 3, 16, 8, 0)}
+	if len(master.ExDates) != len(wantEx) {
+		t.Fatalf("exdates %v, want %v", master.ExDates, wantEx)
+	}
+	for i := range wantEx {
+		if !master.ExDates[i].Equal(wantEx[i]) {
+			t.Fatalf("exdates %v, want %v", master.ExDates, wantEx)
+		}
+	}
+	wantDesc := "Chapters 3, 4 and 5.\nBring the exercise sheet and the notes from last week's lecture on dynamic programming; ask about problem 7."
+	if master.Description != wantDesc {
+		t.Fatalf("folded description %q", master.Description)
+	}
+	if len(master.Categories) != 2 || master.Categories[1] != "Uni" {
+		t.Fatalf("categories %v", master.Categories)
+	}
+
+	moved, ok := byKey["weekly-1@example.com#20260323T080000Z"]
+	if !ok {
+		t.Fatalf("moved instance missing; have %v", keys(byKey))
+	}
+	if !moved.Start.Equal(utc(2026, 3, 23, 13, 0)) || moved.Status != "" {
+		t.Fatalf("moved instance starts %v status %q", moved.Start, moved.Status)
+	}
+	// The cancelled instance is after the switch to summer time.
+	cancelled, ok := byKey["weekly-1@example.com#20260330T070000Z"]
+	if !ok {
+		t.Fatalf("cancelled instance missing; have %v", keys(byKey))
+	}
+	if cancelled.Status != "CANCELLED" {
+		t.Fatalf("cancelled instance status %q", cancelled.Status)
+	}
+
+	mozilla := byKey["mozilla-1@example.com"]
+	if mozilla.Zone == nil || mozilla.Zone.Name() != "America/New_York" {
+		t.Fatalf("vendor-prefixed TZID resolved to %v", mozilla.Zone)
+	}
+	if !mozilla.Start.Equal(utc(2026, 3, 10, 22, 0)) || mozilla.End.Sub(mozilla.Start) != 45*time.Minute {
+		t.Fatalf("start %v end %v", mozilla.Start, mozilla.End)
+	}
+
+	allDay := byKey["allday-1@example.com"]
+	if !allDay.AllDay || allDay.End.Sub(allDay.Start) != 24*time.Hour {
+		t.Fatalf("all-day event %+v", allDay)
+	}
+}
+
+func TestEventsCustomZone(t *testing.T) {
+	floating, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	byKey := eventsByKey(mustEvents(t, parseFixture(t, "custom_tz.ics"), floating))
+	tests := []struct {
+		uid      string
+		want     time.Time
+		zoneName string // IANA name of the zone, "" for VTIMEZONE offsets only
+		noZone   bool   // floating time
+	}{
+		{uid: "winter@example.com", want: utc(2026, 1, 15, 14, 0)},
+		{uid: "summer@example.com", want: utc(2026, 7, 15, 13, 0)},
+		{uid: "office@example.com", want: utc(2026, 7, 15, 7, 0), zoneName: "Europe/Berlin"},
+		{uid: "floating@example.com", want: utc(2026, 7, 15, 11, 0), noZone: true},
+	}
+	for _, tt := range tests {
+		e, ok := byKey[tt.uid]
+		if !ok {
+			t.Fatalf("%s missing", tt.uid)
+		}
+		if !e.Start.Equal(tt.want) {
+			t.Errorf("%s starts %v, want %v", tt.uid, e.Start.UTC(), tt.want)
+		}
+		switch {
+		case tt.noZone:
+			if e.Zone != nil {
+				t.Errorf("%s: floating time has zone %v", tt.uid, e.Zone)
+			}
+		case e.Zone == nil || e.Zone.Name() != tt.zoneName:
+			t.Errorf("%s: zone %+v, want IANA name %q", tt.uid, e.Zone, tt.zoneName)
+		}
+	}
+}
+
+func mustEvents(t *testing.T, cal *Component, floating *time.Location) []Event {
+	t.Helper()
+	events, bad := Events(cal, floating)
+	if len(bad) > 0 {
+		t.Fatalf("bad events: %+v", bad)
+	}
+	return events
+}
+
+func keys(m map[string]Event) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func TestFolding(t *testing.T) {
+	long := strings.Repeat("Lernplan für Woche 12 — Übungsblatt ", 6)
+	cal := NewComponent("VCALENDAR")
+	e := NewComponent("VEVENT")
+	e.Add("UID", "fold@example.com")
+	e.Add("DTSTART", "20260101T090000Z")
+	e.AddText("DESCRIPTION", long)
+	cal.Append(e)
+
+	var buf bytes.Buffer
+	if err := cal.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	folded := 0
+	for _, line := range lines {
+		if len(line) > 75 {
+			t.Fatalf("line of %d octets: %q", len(line), line)
+		}
+		if strings.HasPrefix(line, " ") {
+			folded++
+		}
+	}
+	if folded == 0 {
+		t.Fatal("long line was not folded")
+	}
+
+	back, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.Children("VEVENT")[0].Get("DESCRIPTION").Text(); got != long {
+		t.Fatalf("unfolded %q, want %q", got, long)
+	}
+
+	// Tabs continue lines too.
+	tabbed := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:tab@exa\r\n\tmple.com\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	cal, err = Parse(strings.NewReader(tabbed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid := cal.Children("VEVENT")[0].Get("UID").Value; uid != "tab@example.com" {
+		t.Fatalf("tab-folded UID %q", uid)
+	}
+}
+
+// TestRoundTrip encodes parsed fixtures and reads them again: every event
+// must come back with the same times, zones and overrides.
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"outlook.ics", "custom_tz.ics"} {
+		t.Run(name, func(t *testing.T) {
+			cal := parseFixture(t, name)
+			var buf bytes.Buffer
+			if err := cal.Encode(&buf); err != nil {
+				t.Fatal(err)
+			}
+			back, err := Parse(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before, _ := Events(cal, time.UTC)
+			after, _ := Events(back, time.UTC)
+			if len(before) != len(after) {
+				t.Fatalf("%d events after the round trip, want %d", len(after), len(before))
+			}
+			for i := range before {
+				a, b := before[i], after[i]
+				if a.UID != b.UID || a.Summary != b.Summary || a.Description != b.Description ||
+					!a.Start.Equal(b.Start) || !a.End.Equal(b.End) || a.RRule != b.RRule ||
+					len(a.ExDates) != len(b.ExDates) || a.Status != b.Status ||
+					(a.RecurrenceID == nil) != (b.RecurrenceID == nil) ||
+					(a.RecurrenceID != nil && !a.RecurrenceID.Equal(*b.RecurrenceID)) {
+					t.Fatalf("event %d changed:\n%+v\n%+v", i, a, b)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"PT1H30M", 90 * time.Minute, true},
+		{"P1D", 24 * time.Hour, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"-PT15M", -15 * time.Minute, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"1H", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
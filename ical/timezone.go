@@ -0,0 +1,464 @@
+package ical
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowsZones maps the Windows zone names Outlook and Exchange put in
+// TZID to IANA zones.
+var windowsZones = map[string]string{
+	"UTC":                            "UTC",
+	"Coordinated Universal Time":     "UTC",
+	"GMT Standard Time":              "Europe/London",
+	"Greenwich Standard Time":        "Atlantic/Reykjavik",
+	"W. Europe Standard Time":        "Europe/Berlin",
+	"Romance Standard Time":          "Europe/Paris",
+	"Central Europe Standard Time":   "Europe/Budapest",
+	"Central European Standard Time": "Europe/Warsaw",
+	"E. Europe Standard Time":        "Europe/Chisinau",
+	"FLE Standard Time":              "Europe/Kiev",
+	"GTB Standard Time":              "Europe/Bucharest",
+	"Russian Standard Time":          "Europe/Moscow",
+	"Turkey Standard Time":           "Europe/Istanbul",
+	"Israel Standard Time":           "Asia/Jerusalem",
+	"South Africa Standard Time":     "Africa/Johannesburg",
+	"Arabian Standard Time":          "Asia/Dubai",
+	"India Standard Time":            "Asia/Kolkata",
+	"China Standard Time":            "Asia/Shanghai",
+	"Singapore Standard Time":        "Asia/Singapore",
+	"Tokyo Standard Time":            "Asia/Tokyo",
+	"Korea Standard Time":            "Asia/Seoul",
+	"AUS Eastern Standard Time":      "Australia/Sydney",
+	"E. Australia Standard Time":     "Australia/Brisbane",
+	"New Zealand Standard Time":      "Pacific/Auckland",
+	"Eastern Standard Time":          "America/New_York",
+	"Central Standard Time":          "America/Chicago",
+	"Mountain Standard Time":         "America/Denver",
+	"US Mountain Standard Time":      "America/Phoenix",
+	"Pacific Standard Time":          "America/Los_Angeles",
+	"Alaskan Standard Time":          "America/Anchorage",
+	"Hawaiian Standard Time":         "Pacific/Honolulu",
+	"Atlantic Standard Time":         "America/Halifax",
+	"E. South America Standard Time": "America/Sao_Paulo",
+	"Argentina Standard Time":        "America/Argentina/Buenos_Aires",
+	"Central Standard Time (Mexico)": "America/Mexico_City",
+}
+
+// Zone is the timezone of a date-time: an IANA location when the TZID
+// names one, otherwise the offsets of the calendar's VTIMEZONE.
+type Zone struct {
+	Location *time.Location // nil when only the VTIMEZONE is known
+	TZID     string
+	vtz      *vtimezone
+}
+
+// Name is the zone's IANA name, or "" when it has none.
+func (z *Zone) Name() string {
+	if z == nil || z.Location == nil {
+		return ""
+	}
+	return z.Location.String()
+}
+
+// At returns the instant the wall-clock time wall (read from its date and
+// clock fields) has in z.
+func (z *Zone) At(wall time.Time) time.Time {
+	y, m, d := wall.Date()
+	hh, mm, ss := wall.Clock()
+	if z.Location != nil {
+		return time.Date(y, m, d, hh, mm, ss, 0, z.Location)
+	}
+	civil := time.Date(y, m, d, hh, mm, ss, 0, time.UTC)
+	return civil.Add(-time.Duration(z.vtz.offsetAt(civil)) * time.Second)
+}
+
+// LoadZone resolves an IANA name, a Windows zone name or a TZID with a
+// vendor prefix such as "/mozilla.org/20050126_1/Europe/Berlin".
+func LoadZone(tzid string) (*time.Location, bool) {
+	tzid = strings.Trim(strings.TrimSpace(tzid), `"`)
+	if name, ok := windowsZones[tzid]; ok {
+		tzid = name
+	}
+	for s := tzid; s != ""; {
+		if s != "Local" {
+			if loc, err := time.LoadLocation(s); err == nil {
+				return loc, true
+			}
+		}
+		i := strings.IndexByte(s, '/')
+		if i < 0 {
+			break
+		}
+		s = s[i+1:]
+	}
+	return nil, false
+}
+
+// zones resolves the TZIDs a calendar uses from its VTIMEZONEs.
+type zones map[string]*Zone
+
+func calendarZones(cal *Component) zones {
+	out := zones{}
+	for _, c := range cal.Children("VTIMEZONE") {
+		id := c.Get("TZID")
+		if id == nil {
+			continue
+		}
+		z := &Zone{TZID: id.Value}
+		if loc, ok := LoadZone(id.Value); ok {
+			z.Location = loc
+		} else if lic := c.Get("X-LIC-LOCATION"); lic != nil {
+			z.Location, _ = LoadZone(lic.Value)
+		}
+		if z.Location == nil {
+			vtz, err := parseVTimezone(c)
+			if err != nil {
+				continue
+			}
+			z.vtz = vtz
+		}
+		out[id.Value] = z
+	}
+	return out
+}
+
+// lookup returns the zone for a TZID parameter, falling back to an IANA or
+// Windows name for calendars that leave out the VTIMEZONE.
+func (zs zones) lookup(tzid string) (*Zone, error) {
+	if z, ok := zs[tzid]; ok {
+		return z, nil
+	}
+	if loc, ok := LoadZone(tzid); ok {
+		z := &Zone{Location: loc, TZID: tzid}
+		zs[tzid] = z
+		return z, nil
+	}
+	return nil, fmt.Errorf("unknown timezone %q", tzid)
+}
+
+// observance is a STANDARD or DAYLIGHT block: from Start (local time in
+// OffsetFrom) on, and again each year by the rule, OffsetTo applies.
+type observance struct {
+	start      time.Time // civil time, UTC fields
+	offsetFrom int
+	offsetTo   int
+	yearly     bool
+	month      time.Month
+	weekday    time.Weekday
+	n          int       // 1..5, or -1 for the last
+	until      time.Time // last onset, in UTC; zero = none
+}
+
+type vtimezone struct {
+	observances []observance
+}
+
+func parseVTimezone(c *Component) (*vtimezone, error) {
+	vtz := &vtimezone{}
+	for _, sub := range c.Components {
+		if sub.Name != "STANDARD" && sub.Name != "DAYLIGHT" {
+			continue
+		}
+		start, from, to := sub.Get("DTSTART"), sub.Get("TZOFFSETFROM"), sub.Get("TZOFFSETTO")
+		if start == nil || from == nil || to == nil {
+			return nil, fmt.Errorf("%s needs DTSTART, TZOFFSETFROM and TZOFFSETTO", sub.Name)
+		}
+		var (
+			o   observance
+			err error
+		)
+		if o.start, err = time.Parse("20060102T150405", start.Value); err != nil {
+			return nil, fmt.Errorf("%s DTSTART %q", sub.Name, start.Value)
+		}
+		if o.offsetFrom, err = parseOffset(from.Value); err != nil {
+			return nil, err
+		}
+		if o.offsetTo, err = parseOffset(to.Value); err != nil {
+			return nil, err
+		}
+		if rule := sub.Get("RRULE"); rule != nil {
+			if err := o.parseYearly(rule.Value); err != nil {
+				return nil, err
+			}
+		}
+		vtz.observances = append(vtz.observances, o)
+	}
+	if len(vtz.observances) == 0 {
+		return nil, fmt.Errorf("VTIMEZONE %s has no STANDARD or DAYLIGHT", c.Get("TZID").Value)
+	}
+	return vtz, nil
+}
+
+// parseYearly reads the FREQ=YEARLY;BYMONTH=m;BYDAY=nDD rules VTIMEZONEs
+// use for DST changes.
+func (o *observance) parseYearly(rule string) error {
+	for _, part := range strings.Split(strings.ToUpper(rule), ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "FREQ":
+			if v != "YEARLY" {
+				return fmt.Errorf("VTIMEZONE rule %q is not yearly", rule)
+			}
+		case "BYMONTH":
+			m, err := strconv.Atoi(v)
+			if err != nil || m < 1 || m > 12 {
+				return fmt.Errorf("VTIMEZONE rule %q", rule)
+			}
+			o.month = time.Month(m)
+		case "UNTIL":
+			t, err := time.Parse("20060102T150405Z", v)
+			if err != nil {
+				return fmt.Errorf("VTIMEZONE rule %q", rule)
+			}
+			o.until = t
+		case "BYDAY":
+			if len(v) < 3 {
+				return fmt.Errorf("VTIMEZONE rule %q", rule)
+			}
+			n, err := strconv.Atoi(v[:len(v)-2])
+			wd, ok := dayCodes[v[len(v)-2:]]
+			if err != nil || !ok || n == 0 {
+				return fmt.Errorf("VTIMEZONE rule %q", rule)
+			}
+			o.n, o.weekday = n, wd
+		}
+	}
+	if o.month == 0 || o.n == 0 {
+		return fmt.Errorf("VTIMEZONE rule %q needs BYMONTH and BYDAY", rule)
+	}
+	o.yearly = true
+	return nil
+}
+
+var dayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+var dayNames = [7]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// parseOffset reads a UTC offset such as +0100 or -053000 in seconds.
+func parseOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("UTC offset %q", s)
+	}
+	h, err1 := strconv.Atoi(s[1:3])
+	m, err2 := strconv.Atoi(s[3:5])
+	sec := 0
+	var err3 error
+	if len(s) == 7 {
+		sec, err3 = strconv.Atoi(s[5:7])
+	}
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, fmt.Errorf("UTC offset %q", s)
+	}
+	off := h*3600 + m*60 + sec
+	if s[0] == '-' {
+		off = -off
+	}
+	return off, nil
+}
+
+func formatOffset(off int) string {
+	sign := '+'
+	if off < 0 {
+		sign, off = '-', -off
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, off/3600, off/60%60)
+	if off%60 != 0 {
+		s += fmt.Sprintf("%02d", off%60)
+	}
+	return s
+}
+
+// onset returns when o takes effect in year (civil time), if it does.
+func (o *observance) onset(year int) (time.Time, bool) {
+	if !o.yearly {
+		return o.start, o.start.Year() == year
+	}
+	hh, mm, ss := o.start.Clock()
+	var day int
+	if o.n > 0 {
+		first := time.Date(year, o.month, 1, 0, 0, 0, 0, time.UTC)
+		day = 1 + (int(o.weekday)-int(first.Weekday())+7)%7 + (o.n-1)*7
+	} else {
+		last := time.Date(year, o.month+1, 0, 0, 0, 0, 0, time.UTC)
+		day = last.Day() - (int(last.Weekday())-int(o.weekday)+7)%7 + (o.n+1)*7
+	}
+	t := time.Date(year, o.month, day, hh, mm, ss, 0, time.UTC)
+	if t.Month() != o.month || t.Before(o.start) {
+		return time.Time{}, false
+	}
+	if !o.until.IsZero() && t.Add(-time.Duration(o.offsetFrom)*time.Second).After(o.until) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// offsetAt returns the UTC offset in effect at the civil time: that of
+// the observance with the latest onset at or before it.
+func (v *vtimezone) offsetAt(civil time.Time) int {
+	var (
+		best     time.Time
+		offset   int
+		found    bool
+		earliest = v.observances[0]
+	)
+	for _, o := range v.observances {
+		if o.start.Before(earliest.start) {
+			earliest = o
+		}
+		// A rule that ended years ago still set the offset it left.
+		y := civil.Year() - 1
+		if !o.until.IsZero() && o.until.Year() < y {
+			y = o.until.Year()
+		}
+		for ; y <= civil.Year(); y++ {
+			t, ok := o.onset(y)
+			if !ok && !o.yearly && !o.start.After(civil) {
+				t, ok = o.start, true
+			}
+			if ok && !t.After(civil) && (!found || t.After(best)) {
+				best, offset, found = t, o.offsetTo, true
+			}
+		}
+	}
+	if !found {
+		return earliest.offsetFrom
+	}
+	return offset
+}
+
+// Timezone builds a VTIMEZONE for loc covering the years from to to. Each
+// run of years whose DST changes follow the same rules becomes one yearly
+// observance per change, ended with UNTIL when the rules change again; the
+// last run stays open. Zones without DST get a single STANDARD block.
+func Timezone(loc *time.Location, from, to int) *Component {
+	c := NewComponent("VTIMEZONE")
+	c.Add("TZID", loc.String())
+
+	type period struct {
+		first, last []tzTransition
+		closed      bool // a year with other rules followed
+	}
+	var (
+		periods []period
+		prevKey string
+	)
+	for y := from; y <= to; y++ {
+		ts := transitions(loc, y)
+		key := transitionsKey(ts)
+		if len(periods) > 0 && key == prevKey && !periods[len(periods)-1].closed {
+			periods[len(periods)-1].last = ts
+			continue
+		}
+		if len(periods) > 0 {
+			periods[len(periods)-1].closed = true
+		}
+		prevKey = key
+		if len(ts) > 0 {
+			periods = append(periods, period{first: ts, last: ts})
+		}
+	}
+
+	for _, p := range periods {
+		for i, t := range p.first {
+			o := NewComponent(t.kind)
+			o.Add("DTSTART", t.local.Format("20060102T150405"))
+			o.Add("TZOFFSETFROM", formatOffset(t.from))
+			o.Add("TZOFFSETTO", formatOffset(t.to))
+			if last := p.last[i]; last.utc.After(t.utc) || !p.closed {
+				rule := "FREQ=YEARLY;BYMONTH=" + strconv.Itoa(int(t.local.Month())) + ";BYDAY=" + t.byDay()
+				if p.closed {
+					rule += ";UNTIL=" + last.utc.Format("20060102T150405Z")
+				}
+				o.Add("RRULE", rule)
+			}
+			o.Add("TZNAME", t.name)
+			c.Append(o)
+		}
+	}
+	if len(periods) == 0 {
+		name, off := time.Date(from, 1, 1, 0, 0, 0, 0, time.UTC).In(loc).Zone()
+		o := NewComponent("STANDARD")
+		o.Add("DTSTART", "19700101T000000")
+		o.Add("TZOFFSETFROM", formatOffset(off))
+		o.Add("TZOFFSETTO", formatOffset(off))
+		o.Add("TZNAME", name)
+		c.Append(o)
+	}
+	return c
+}
+
+// tzTransition is one change of a zone's UTC offset.
+type tzTransition struct {
+	kind     string    // STANDARD or DAYLIGHT
+	utc      time.Time // the instant of the change
+	local    time.Time // wall clock just before it, UTC fields
+	from, to int
+	name     string
+}
+
+// byDay is the transition's day as a VTIMEZONE BYDAY, such as 2SU or -1SU.
+func (t tzTransition) byDay() string {
+	days := time.Date(t.local.Year(), t.local.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	n := strconv.Itoa((t.local.Day()-1)/7 + 1)
+	if t.local.Day()+7 > days {
+		n = "-1"
+	}
+	return n + dayNames[t.local.Weekday()]
+}
+
+// transitionsKey is equal for two years whose changes follow the same
+// yearly rules.
+func transitionsKey(ts []tzTransition) string {
+	var b strings.Builder
+	for _, t := range ts {
+		fmt.Fprintf(&b, "%s %d %s %s %d %d %s;", t.kind, t.local.Month(), t.byDay(),
+			t.local.Format("150405"), t.from, t.to, t.name)
+	}
+	return b.String()
+}
+
+// transitions returns loc's offset changes during year, in order.
+func transitions(loc *time.Location, year int) []tzTransition {
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	_, prev := start.In(loc).Zone()
+	var out []tzTransition
+	for t := start.Add(time.Hour); t.Before(end); t = t.Add(time.Hour) {
+		_, off := t.In(loc).Zone()
+		if off == prev {
+			continue
+		}
+		// Narrow the change down to the second.
+		lo, hi := t.Add(-time.Hour), t
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == prev {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		at := hi.In(loc)
+		kind := "STANDARD"
+		if at.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		name, _ := at.Zone()
+		out = append(out, tzTransition{
+			kind:  kind,
+			utc:   hi.UTC(),
+			local: hi.Add(time.Duration(prev) * time.Second).UTC(),
+			from:  prev,
+			to:    off,
+			name:  name,
+		})
+		prev = off
+	}
+	return out
+}
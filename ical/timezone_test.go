@@ -0,0 +1,30 @@
+package ical
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTimezoneRules checks that a generated VTIMEZONE, read back without
+// its IANA name, gives loc's offset on every day of the range, including
+// zones whose rules changed partway through it.
+func TestTimezoneRules(t *testing.T) {
+	for _, name := range []string{"America/New_York", "Europe/Moscow", "Europe/Berlin", "Australia/Sydney", "Asia/Tokyo", "America/Sao_Paulo"} {
+		t.Run(name, func(t *testing.T) {
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				t.Skip(err)
+			}
+			vtz, err := parseVTimezone(Timezone(loc, 2000, 2030))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for d := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC); d.Year() <= 2030; d = d.AddDate(0, 0, 1) {
+				_, want := time.Date(d.Year(), d.Month(), d.Day(), 12, 0, 0, 0, loc).Zone()
+				if got := vtz.offsetAt(d); got != want {
+					t.Fatalf("%s: offset %d, want %d", d.Format("2006-01-02"), got, want)
+				}
+			}
+		})
+	}
+}
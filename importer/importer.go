@@ -0,0 +1,466 @@
+// Package importer reads study sessions exported by other time trackers:
+// CSV with a header row, or a JSON array of objects, with a Mapping naming
+// the columns that hold each field.
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid import")
+
+// MaxRows bounds a single import.
+const MaxRows = 10000
+
+// Session lengths outside these bounds are rejected.
+const (
+	minDurationMin = 1
+	maxDurationMin = 12 * 60
+)
+
+// Mapping names the columns holding each session field. Column names are
+// matched case-insensitively; nested JSON keys are joined with dots, e.g.
+// "timeInterval.start".
+type Mapping struct {
+	Start        string   `json:"start"`                   // start date-time, or the date when StartTime is set
+	StartTime    string   `json:"start_time,omitempty"`    // start time of day, if in its own column
+	End          string   `json:"end,omitempty"`           // used when there is no duration
+	EndTime      string   `json:"end_time,omitempty"`      // end time of day, if in its own column
+	Duration     string   `json:"duration,omitempty"`      // wins over End when filled in
+	DurationUnit string   `json:"duration_unit,omitempty"` // clock (h:mm:ss), hours, minutes, seconds or iso; guessed if empty
+	Goal         []string `json:"goal,omitempty"`          // the first non-empty column is the goal
+	Mode         string   `json:"mode,omitempty"`
+	PlannedMin   string   `json:"planned_min,omitempty"`
+	PauseCount   string   `json:"pause_count,omitempty"`
+	SelfRating   string   `json:"self_rating,omitempty"`
+	SelfOnTask   string   `json:"self_on_task,omitempty"`
+	Layouts      []string `json:"layouts,omitempty"` // Go time layouts tried before the built-in ones
+}
+
+// Presets map the exports of common trackers.
+var Presets = map[string]Mapping{
+	// Our own session fields, for spreadsheets.
+	"generic": {
+		Start: "started_at", End: "ended_at",
+		Duration: "duration_min", DurationUnit: "minutes",
+		Goal: []string{"goal"}, Mode: "mode", PlannedMin: "planned_min",
+		PauseCount: "pause_count", SelfRating: "self_rating", SelfOnTask: "self_on_task",
+	},
+	// Toggl Track detailed report, CSV.
+	"toggl": {
+		Start: "Start date", StartTime: "Start time", End: "End date", EndTime: "End time",
+		Duration: "Duration", DurationUnit: "clock",
+		Goal: []string{"Project", "Description"},
+	},
+	// Toggl Track API time entries.
+	"toggl-json": {
+		Start: "start", End: "stop",
+		Duration: "duration", DurationUnit: "seconds",
+		Goal: []string{"project_name", "description"},
+	},
+	// Clockify detailed report, CSV.
+	"clockify": {
+		Start: "Start Date", StartTime: "Start Time", End: "End Date", EndTime: "End Time",
+		Duration: "Duration (h)", DurationUnit: "clock",
+		Goal:    []string{"Project", "Description"},
+		Layouts: []string{"01/02/2006 03:04:05 PM", "01/02/2006 03:04 PM", "01/02/2006 15:04:05", "01/02/2006 15:04"},
+	},
+	// Clockify API time entries.
+	"clockify-json": {
+		Start: "timeInterval.start", End: "timeInterval.end",
+		Duration: "timeInterval.duration", DurationUnit: "iso",
+		Goal: []string{"project.name", "description"},
+	},
+}
+
+// PresetNames lists the presets in order.
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for n := range Presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// layouts are tried after the mapping's own.
+var layouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// Row is one valid session read from the file.
+type Row struct {
+	Line        int
+	StartedAt   time.Time
+	DurationMin int
+	Goal        string
+	Mode        string
+	PlannedMin  int
+	PauseCount  int
+	SelfRating  int
+	SelfOnTask  string
+}
+
+// RowError is a row that was skipped. Line is the CSV line, or the
+// 1-based position in a JSON array.
+type RowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type record struct {
+	line   int
+	fields map[string]string // lower-cased column -> value
+}
+
+func (r record) get(col string) string {
+	if col == "" {
+		return ""
+	}
+	return strings.TrimSpace(r.fields[strings.ToLower(col)])
+}
+
+// Read parses r in format ("csv" or "json") with m. Times without an
+// offset are read in loc. Rows that fail validation come back as errors;
+// only a file that cannot be read at all is an error.
+func Read(r io.Reader, format string, m Mapping, loc *time.Location) ([]Row, []RowError, error) {
+	if m.Start == "" {
+		return nil, nil, fmt.Errorf("%w: mapping has no start column", ErrInvalid)
+	}
+	if m.Duration == "" && m.End == "" {
+		return nil, nil, fmt.Errorf("%w: mapping needs a duration or end column", ErrInvalid)
+	}
+	var (
+		recs []record
+		err  error
+	)
+	switch strings.ToLower(format) {
+	case "", "csv":
+		recs, err = readCSV(r)
+	case "json":
+		recs, err = readJSON(r)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown format %q", ErrInvalid, format)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		rows []Row
+		bad  []RowError
+	)
+	for _, rec := range recs {
+		row, err := m.row(rec, loc)
+		if err != nil {
+			bad = append(bad, RowError{Line: rec.line, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, bad, nil
+}
+
+func readCSV(r io.Reader) ([]record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\uFEFF")
+		}
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+	}
+	var recs []record
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if len(recs) == MaxRows {
+			return nil, fmt.Errorf("%w: more than %d rows", ErrInvalid, MaxRows)
+		}
+		line, _ := cr.FieldPos(0)
+		rec := record{line: line, fields: make(map[string]string, len(header))}
+		blank := true
+		for i, v := range fields {
+			if i < len(header) {
+				rec.fields[header[i]] = v
+			}
+			if strings.TrimSpace(v) != "" {
+				blank = false
+			}
+		}
+		if !blank {
+			recs = append(recs, rec)
+		}
+	}
+	return recs, nil
+}
+
+func readJSON(r io.Reader) ([]record, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var items []map[string]interface{}
+	if err := dec.Decode(&items); err != nil {
+		return nil, fmt.Errorf("%w: expected a JSON array of objects: %v", ErrInvalid, err)
+	}
+	if len(items) > MaxRows {
+		return nil, fmt.Errorf("%w: more than %d rows", ErrInvalid, MaxRows)
+	}
+	recs := make([]record, 0, len(items))
+	for i, item := range items {
+		rec := record{line: i + 1, fields: map[string]string{}}
+		flatten(rec.fields, "", item)
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// flatten stores v's leaves under dotted, lower-cased keys. Lists of
+// scalars are joined with commas.
+func flatten(out map[string]string, prefix string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range v {
+			key := strings.ToLower(k)
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			flatten(out, key, sub)
+		}
+	case []interface{}:
+		var parts []string
+		for _, sub := range v {
+			if s := scalar(sub); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		out[prefix] = strings.Join(parts, ", ")
+	default:
+		out[prefix] = scalar(v)
+	}
+}
+
+func scalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
+
+func (m Mapping) row(rec record, loc *time.Location) (Row, error) {
+	row := Row{Line: rec.line}
+	start := joinDateTime(rec.get(m.Start), rec.get(m.StartTime))
+	if start == "" {
+		return row, fmt.Errorf("%s is empty", m.Start)
+	}
+	var err error
+	if row.StartedAt, err = m.parseTime(start, loc); err != nil {
+		return row, fmt.Errorf("%s: %v", m.Start, err)
+	}
+
+	var d time.Duration
+	if v := rec.get(m.Duration); v != "" {
+		if d, err = parseDuration(v, m.DurationUnit); err != nil {
+			return row, fmt.Errorf("%s: %v", m.Duration, err)
+		}
+	} else if v := joinDateTime(rec.get(m.End), rec.get(m.EndTime)); v != "" {
+		end, err := m.parseTime(v, loc)
+		if err != nil {
+			return row, fmt.Errorf("%s: %v", m.End, err)
+		}
+		// Split date and time columns leave an entry past midnight
+		// ending on its start date.
+		if m.EndTime != "" && end.Before(row.StartedAt) && rec.get(m.End) == rec.get(m.Start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		d = end.Sub(row.StartedAt)
+	} else {
+		return row, errors.New("no duration or end time")
+	}
+	if d < 0 {
+		return row, errors.New("still running or ends before it starts")
+	}
+	row.DurationMin = int((d + 30*time.Second) / time.Minute)
+	if row.DurationMin < minDurationMin || row.DurationMin > maxDurationMin {
+		return row, fmt.Errorf("duration of %d min is outside %d-%d", row.DurationMin, minDurationMin, maxDurationMin)
+	}
+
+	for _, col := range m.Goal {
+		if v := rec.get(col); v != "" {
+			row.Goal = v
+			break
+		}
+	}
+	row.Mode = strings.ToLower(rec.get(m.Mode))
+	if row.Mode != "timer" {
+		row.Mode = "stopwatch"
+	}
+	if row.PlannedMin, err = optionalInt(rec.get(m.PlannedMin), 0, maxDurationMin); err != nil {
+		return row, fmt.Errorf("%s: %v", m.PlannedMin, err)
+	}
+	if row.PauseCount, err = optionalInt(rec.get(m.PauseCount), 0, 1000); err != nil {
+		return row, fmt.Errorf("%s: %v", m.PauseCount, err)
+	}
+	if row.SelfRating, err = optionalInt(rec.get(m.SelfRating), 0, 5); err != nil {
+		return row, fmt.Errorf("%s: %v", m.SelfRating, err)
+	}
+	if row.SelfRating == 0 {
+		row.SelfRating = 3
+	}
+	switch v := strings.ToLower(rec.get(m.SelfOnTask)); v {
+	case "", "yes", "somewhat", "no":
+		row.SelfOnTask = v
+	default:
+		return row, fmt.Errorf("%s: %q is not yes, somewhat or no", m.SelfOnTask, v)
+	}
+	return row, nil
+}
+
+func joinDateTime(date, clock string) string {
+	if date == "" || clock == "" {
+		return date
+	}
+	return date + " " + clock
+}
+
+func (m Mapping) parseTime(v string, loc *time.Location) (time.Time, error) {
+	for _, layout := range append(m.Layouts, layouts...) {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", v)
+}
+
+// parseDuration reads v in unit, guessing the unit from v's shape when
+// unit is empty.
+func parseDuration(v, unit string) (time.Duration, error) {
+	if unit == "" {
+		switch {
+		case strings.Contains(v, ":"):
+			unit = "clock"
+		case strings.HasPrefix(strings.ToUpper(v), "P"):
+			unit = "iso"
+		default:
+			unit = "minutes"
+		}
+	}
+	switch unit {
+	case "clock":
+		return parseClock(v)
+	case "iso":
+		return parseISODuration(v)
+	case "hours", "minutes", "seconds":
+		n, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", "."), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		scale := map[string]time.Duration{"hours": time.Hour, "minutes": time.Minute, "seconds": time.Second}[unit]
+		return time.Duration(n * float64(scale)), nil
+	}
+	return 0, fmt.Errorf("unknown duration unit %q", unit)
+}
+
+// parseClock reads h:mm:ss or h:mm.
+func parseClock(v string) (time.Duration, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("%q is not h:mm:ss", v)
+	}
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not h:mm:ss", v)
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return d, nil
+}
+
+// parseISODuration reads ISO 8601 durations such as PT1H30M15S or P1DT2H.
+// Days are taken as 24 hours.
+func parseISODuration(v string) (time.Duration, error) {
+	bad := fmt.Errorf("%q is not an ISO 8601 duration", v)
+	s := strings.ToUpper(v)
+	if !strings.HasPrefix(s, "P") {
+		return 0, bad
+	}
+	date, clock, hasT := strings.Cut(s[1:], "T")
+	if (date == "" && clock == "") || (hasT && clock == "") {
+		return 0, bad
+	}
+	var d time.Duration
+	for _, part := range []struct {
+		s     string
+		units map[rune]time.Duration
+	}{
+		{date, map[rune]time.Duration{'D': 24 * time.Hour}},
+		{clock, map[rune]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}},
+	} {
+		num := ""
+		for _, ch := range part.s {
+			unit, ok := part.units[ch]
+			if !ok {
+				num += string(ch)
+				continue
+			}
+			n, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, bad
+			}
+			d += time.Duration(n * float64(unit))
+			num = ""
+		}
+		if num != "" {
+			return 0, bad
+		}
+	}
+	return d, nil
+}
+
+func optionalInt(v string, min, max int) (int, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a whole number", v)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("%d is outside %d-%d", n, min, max)
+	}
+	return n, nil
+}
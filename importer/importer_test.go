@@ -0,0 +1,137 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPresets(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		preset, format string
+		input          string
+		want           []Row // Line, StartedAt, DurationMin and Goal are compared
+		badLines       []int
+	}{
+		{
+			preset: "toggl", format: "csv",
+			input: "User,Email,Client,Project,Task,Description,Billable,Start date,Start time,End date,End time,Duration,Tags\n" +
+				"Ada,ada@example.com,,Thesis,,Writing,No,2026-03-02,09:00:00,2026-03-02,10:30:00,01:30:00,\n" +
+				"Ada,ada@example.com,,,,Reading,No,2026-03-02,23:30:00,2026-03-02,00:45:00,,\n" +
+				"Ada,ada@example.com,,Thesis,,,No,2026-03-03,not a time,2026-03-03,10:00:00,01:00:00,\n",
+			want: []Row{
+				{Line: 2, StartedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, berlin), DurationMin: 90, Goal: "Thesis"},
+				{Line: 3, StartedAt: time.Date(2026, 3, 2, 23, 30, 0, 0, berlin), DurationMin: 75, Goal: "Reading"},
+			},
+			badLines: []int{4},
+		},
+		{
+			preset: "toggl-json", format: "json",
+			input: `[{"start":"2026-03-02T09:00:00+01:00","stop":"2026-03-02T10:00:00+01:00","duration":3600,"project_name":"Thesis"},
+				{"start":"2026-03-02T11:00:00+01:00","stop":null,"duration":-1712345678,"description":"running"}]`,
+			want: []Row{
+				{Line: 1, StartedAt: time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC), DurationMin: 60, Goal: "Thesis"},
+			},
+			badLines: []int{2},
+		},
+		{
+			preset: "clockify", format: "csv",
+			input: "\uFEFFProject,Client,Description,Task,User,Email,Tags,Billable,Start Date,Start Time,End Date,End Time,Duration (h),Duration (decimal)\n" +
+				"Stats,,Exercises,,Ada,ada@example.com,,No,03/02/2026,09:15:00 PM,03/02/2026,10:00:00 PM,00:45:00,0.75\n" +
+				"Stats,,,,Ada,ada@example.com,,No,03/02/2026,11:30 PM,03/02/2026,12:15 AM,,\n",
+			want: []Row{
+				{Line: 2, StartedAt: time.Date(2026, 3, 2, 21, 15, 0, 0, berlin), DurationMin: 45, Goal: "Stats"},
+				{Line: 3, StartedAt: time.Date(2026, 3, 2, 23, 30, 0, 0, berlin), DurationMin: 45, Goal: "Stats"},
+			},
+		},
+		{
+			preset: "clockify-json", format: "json",
+			input: `[{"description":"Reading","project":{"name":"Stats"},"timeInterval":{"start":"2026-03-02T08:00:00Z","end":"2026-03-02T09:00:00Z","duration":"PT1H"}},
+				{"description":"Review","project":null,"timeInterval":{"start":"2026-03-03T08:00:00Z","end":"2026-03-03T08:20:00Z","duration":"PT20M"}}]`,
+			want: []Row{
+				{Line: 1, StartedAt: time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC), DurationMin: 60, Goal: "Stats"},
+				{Line: 2, StartedAt: time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC), DurationMin: 20, Goal: "Review"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			rows, bad, err := Read(strings.NewReader(tt.input), tt.format, Presets[tt.preset], berlin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows %+v (errors %+v), want %d", len(rows), rows, bad, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := rows[i]
+				if got.Line != want.Line || !got.StartedAt.Equal(want.StartedAt) || got.DurationMin != want.DurationMin || got.Goal != want.Goal {
+					t.Errorf("row %d: got %+v, want %+v", i, got, want)
+				}
+			}
+			if len(bad) != len(tt.badLines) {
+				t.Fatalf("errors %+v, want lines %v", bad, tt.badLines)
+			}
+			for i, line := range tt.badLines {
+				if bad[i].Line != line {
+					t.Errorf("error %d on line %d, want %d", i, bad[i].Line, line)
+				}
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"1:30", 90 * time.Minute, true},
+		{"01:30:15", time.Hour + 30*time.Minute + 15*time.Second, true},
+		{"0:00:59", 59 * time.Second, true},
+		{"26:00:00", 26 * time.Hour, true},
+		{"90", 0, false},
+		{"1:2:3:4", 0, false},
+		{"1:-5", 0, false},
+		{"a:30", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseClock(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseClock(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"PT1H30M15S", time.Hour + 30*time.Minute + 15*time.Second, true},
+		{"PT45M", 45 * time.Minute, true},
+		{"pt0.5h", 30 * time.Minute, true},
+		{"P1D", 24 * time.Hour, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"P0DT20M", 20 * time.Minute, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1DT", 0, false},
+		{"P1H", 0, false},
+		{"PT1D", 0, false},
+		{"PT5", 0, false},
+		{"1H", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseISODuration(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseISODuration(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -1,30 +1,87 @@
 package main
 
 import (
+	"authentication/cli"
+	"authentication/config"
 	"authentication/helpers"
+	"authentication/middleware"
+	"authentication/notify"
 	"authentication/routes"
+	"authentication/services"
+	"authentication/store"
+	"context"
 	"fmt"
 
 	"log"
 	"os"
+	"time"
+	_ "time/tzdata" // user timezones; the runtime image has no zoneinfo
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 
-	//Connect to mongoDB
-
 	log.Println("Starting application...")
 
+	//Connect to the configured database (DB_BACKEND=mongo|postgres)
+	if err := store.Init(context.Background()); err != nil {
+		log.Fatalf("Failed to initialise storage: %v", err)
+	}
+
+	// Maintenance commands (backup, restore, ...) run instead of the server,
+	// before anything is seeded so a restore starts from what is on disk.
+	if handled, err := cli.Run(context.Background(), os.Args[1:]); handled {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Seed scoring model versions (SCORING_MODELS_FILE) and pick the active one
+	if err := services.InitScoringModels(context.Background(),
+		os.Getenv("SCORING_MODELS_FILE"), os.Getenv("SCORING_MODEL")); err != nil {
+		log.Fatalf("Failed to load scoring models: %v", err)
+	}
+	if err := services.InitAlertRules(context.Background()); err != nil {
+		log.Fatalf("Failed to seed alert rules: %v", err)
+	}
+
 	key := os.Getenv("JWT_SECRET")
 	if key == "" {
 		log.Fatal("JWT_SECRET not set")
 	}
 	helpers.SetJWTKey(key)
+
+	// Finish account changes left half-applied on servers without transactions
+	store.StartOutboxRelay(context.Background(), time.Minute)
+
+	// Daily fatigue rollup; also runs after every new study session
+	services.StartRollupJob(context.Background(),
+		config.DurationEnv("ROLLUP_INTERVAL", time.Hour),
+		config.IntEnv("ROLLUP_LOOKBACK_DAYS", 3))
+
+	// Auto-close live sessions with no activity for SESSION_IDLE_TIMEOUT
+	services.StartIdleSessionJob(context.Background(),
+		5*time.Minute,
+		config.DurationEnv("SESSION_IDLE_TIMEOUT", 30*time.Minute))
+
+	// Drop stored Idempotency-Key responses past IDEMPOTENCY_TTL
+	services.StartIdempotencyPurgeJob(context.Background(), time.Hour)
+
+	// Email (SMTP_HOST, else logged) and webhook deliveries from the notification queue
+	notify.SetEmailSender(notify.EmailSenderFromEnv())
+	notify.SetWebhookSender(notify.NewHTTPWebhook(os.Getenv("WEBHOOK_SECRET"), os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"))
+	services.StartNotificationWorker(context.Background(),
+		config.DurationEnv("NOTIFY_INTERVAL", 30*time.Second))
+
+	// Last week's report goes out on Monday from WEEKLY_REPORT_HOUR, user's local time
+	services.StartWeeklyReportJob(context.Background(), time.Hour,
+		config.IntEnv("WEEKLY_REPORT_HOUR", 8))
 	fmt.Printf("Generated Key: %s\n", key)
 	//Init gin router
 	r := gin.Default()
+	r.Use(middleware.RequestID())
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status": "running",
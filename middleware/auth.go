@@ -40,6 +40,7 @@ func Authenticate() gin.HandlerFunc {
 		}
 
 		c.Set("claims", claims)
+		c.Request = c.Request.WithContext(helpers.WithUserID(c.Request.Context(), claims.UserID))
 		c.Next()
 	}
 }
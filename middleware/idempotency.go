@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"authentication/helpers"
+	"authentication/services"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKey    = 255
+	maxIdempotentBody    = 4 << 20
+)
+
+// responseRecorder keeps a copy of the response body.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to
+// retry: the first response is stored for ttl and replayed to retries with
+// the same key and body. Requests without the header pass through. It must
+// run after Authenticate, since keys are scoped to the user.
+func Idempotency(ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			c.Abort()
+			return
+		}
+		claimsVal, _ := c.Get("claims")
+		claims, ok := claimsVal.(*helpers.Claims)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBody))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body is too large"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		h := sha256.New()
+		io.WriteString(h, c.Request.Method+" "+c.FullPath()+"\n")
+		h.Write(body)
+		hash := hex.EncodeToString(h.Sum(nil))
+
+		prev, err := services.BeginIdempotentRequest(c.Request.Context(), claims.UserID, key, hash, ttl)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyInFlight):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		case errors.Is(err, services.ErrIdempotencyMismatch):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		case prev != nil:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(prev.Status, prev.ContentType, prev.Body)
+			c.Abort()
+			return
+		}
+
+		w := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = w
+		// Store the response even if the client has gone away; its retry
+		// is what the key is for. A panicking handler releases the key.
+		defer func() {
+			status := w.Status()
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+			services.FinishIdempotentRequest(context.WithoutCancel(c.Request.Context()), claims.UserID, key,
+				status, w.Header().Get("Content-Type"), w.body.Bytes())
+			if p != nil {
+				panic(p)
+			}
+		}()
+		c.Next()
+	}
+}
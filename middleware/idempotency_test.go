@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"authentication/helpers"
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keyStore is an in-memory IdempotencyStore.
+type keyStore struct {
+	store.Store
+	mu   sync.Mutex
+	keys map[string]models.IdempotencyRecord
+}
+
+func (s *keyStore) ClaimIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[r.ID]; ok {
+		return store.ErrDuplicate
+	}
+	s.keys[r.ID] = *r
+	return nil
+}
+
+func (s *keyStore) TakeOverIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.keys[r.ID]
+	if !ok || (prev.ExpiresAt.After(now) && (prev.Status != 0 || prev.LockedUntil.After(now))) {
+		return store.ErrDuplicate
+	}
+	s.keys[r.ID] = *r
+	return nil
+}
+
+func (s *keyStore) FindIdempotencyKey(ctx context.Context, id string) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.keys[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &r, nil
+}
+
+func (s *keyStore) SaveIdempotencyResponse(ctx context.Context, r *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.keys[r.ID]
+	if !ok {
+		return store.ErrNotFound
+	}
+	prev.Status, prev.ContentType, prev.Body = r.Status, r.ContentType, r.Body
+	s.keys[r.ID] = prev
+	return nil
+}
+
+func (s *keyStore) DeleteIdempotencyKey(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	return nil
+}
+
+// idempotentAPI serves POST /run behind Idempotency. Each call of the
+// handler is counted, and it answers with what next returns.
+type idempotentAPI struct {
+	r     *gin.Engine
+	store *keyStore
+	calls int
+	next  func(c *gin.Context)
+}
+
+func newIdempotentAPI() *idempotentAPI {
+	gin.SetMode(gin.TestMode)
+	a := &idempotentAPI{store: &keyStore{keys: map[string]models.IdempotencyRecord{}}}
+	store.Set(a.store)
+	a.r = gin.New()
+	a.r.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	a.r.POST("/run", func(c *gin.Context) {
+		c.Set("claims", &helpers.Claims{UserID: "u1"})
+	}, Idempotency(time.Hour), func(c *gin.Context) {
+		a.calls++
+		a.next(c)
+	})
+	return a
+}
+
+func (a *idempotentAPI) post(key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	a := newIdempotentAPI()
+	n := 0
+	a.next = func(c *gin.Context) {
+		n++
+		c.JSON(http.StatusCreated, gin.H{"n": n})
+	}
+	first := a.post("k1", `{"x":1}`)
+	again := a.post("k1", `{"x":1}`)
+	if first.Code != http.StatusCreated || again.Code != http.StatusCreated {
+		t.Fatalf("got %d then %d, want 201 twice", first.Code, again.Code)
+	}
+	if again.Body.String() != first.Body.String() || again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry got %q (replayed %q), want the stored %q", again.Body, again.Header().Get("Idempotent-Replayed"), first.Body)
+	}
+	if ct := again.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("replayed content type %q", ct)
+	}
+	if a.calls != 1 {
+		t.Fatalf("handler ran %d times, want once", a.calls)
+	}
+
+	if w := a.post("k1", `{"x":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with another body: got %d, want 422", w.Code)
+	}
+	if w := a.post("", `{"x":1}`); w.Code != http.StatusCreated || a.calls != 2 {
+		t.Fatalf("request without a key: got %d after %d calls", w.Code, a.calls)
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	a := newIdempotentAPI()
+	entered, release := make(chan struct{}), make(chan struct{})
+	a.next = func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- a.post("k1", `{}`) }()
+	<-entered
+	if w := a.post("k1", `{}`); w.Code != http.StatusConflict {
+		t.Fatalf("retry while in flight: got %d, want 409", w.Code)
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Fatalf("first request: got %d", w.Code)
+	}
+
+	// A claim whose lease ran out belongs to a request that died; a
+	// retry may take it over.
+	a.store.keys["u1:k2"] = models.IdempotencyRecord{
+		ID:          "u1:k2",
+		UserID:      "u1",
+		RequestHash: a.store.keys["u1:k1"].RequestHash,
+		ExpiresAt:   time.Now().Add(time.Hour),
+		LockedUntil: time.Now().Add(-time.Second),
+	}
+	a.next = func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) }
+	if w := a.post("k2", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("retry after the lease: got %d, want 200", w.Code)
+	}
+}
+
+func TestIdempotencyReleasesKey(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(c *gin.Context)
+	}{
+		{"server error", func(c *gin.Context) { c.JSON(http.StatusServiceUnavailable, gin.H{"error": "down"}) }},
+		{"panic", func(c *gin.Context) { panic("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newIdempotentAPI()
+			a.next = tt.fail
+			if w := a.post("k1", `{}`); w.Code < 500 {
+				t.Fatalf("failing request: got %d", w.Code)
+			}
+			if _, ok := a.store.keys["u1:k1"]; ok {
+				t.Fatal("key still held after the failure")
+			}
+			a.next = func(c *gin.Context) { c.JSON(http.StatusCreated, gin.H{"ok": true}) }
+			if w := a.post("k1", `{}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+				t.Fatalf("retry: got %d (replayed %q), want a fresh 201", w.Code, w.Header().Get("Idempotent-Replayed"))
+			}
+			if a.calls != 2 {
+				t.Fatalf("handler ran %d times, want twice", a.calls)
+			}
+		})
+	}
+}
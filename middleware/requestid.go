@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"authentication/helpers"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	maxRequestID    = 64
+)
+
+// validRequestID accepts IDs made only of letters, digits, '.', '_' and
+// '-', so a client cannot smuggle line breaks into logs or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID tags every request with an ID (taken from the X-Request-ID header
+// when the client sends a valid one) and stores it on the request context.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = ""
+			b := make([]byte, 8)
+			if _, err := rand.Read(b); err == nil {
+				id = hex.EncodeToString(b)
+			}
+		}
+		c.Request = c.Request.WithContext(helpers.WithRequestID(c.Request.Context(), id))
+		c.Set("request_id", id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
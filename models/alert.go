@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Alert rule kinds.
+const (
+	// RuleThreshold fires when Metric is at or above Threshold on Days
+	// consecutive days.
+	RuleThreshold = "threshold"
+	// RuleWeekOverWeek fires when the average of Metric over the last 7
+	// days is more than Threshold percent above the 7 days before.
+	RuleWeekOverWeek = "week_over_week"
+	// RuleAnomaly fires when the latest day's Metric is Threshold or more
+	// standard deviations above the user's own recent baseline.
+	RuleAnomaly = "anomaly"
+)
+
+// Alert states.
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+// AlertRule describes when a user's daily fatigue scores raise an alert.
+// Rules without an OrgID apply to everyone; org rules apply to its members
+// on top of those.
+type AlertRule struct {
+	ID            string    `bson:"_id" json:"id"` // e.g. burnout-3d
+	OrgID         string    `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	Name          string    `bson:"name" json:"name"`
+	Kind          string    `bson:"kind" json:"kind"`     // threshold | week_over_week | anomaly
+	Metric        string    `bson:"metric" json:"metric"` // burnout_probability | fatigue_index
+	Threshold     float64   `bson:"threshold" json:"threshold"`
+	Days          int       `bson:"days,omitempty" json:"days,omitempty"` // threshold rules only
+	Severity      string    `bson:"severity" json:"severity"`             // warning | critical
+	CooldownHours int       `bson:"cooldown_hours" json:"cooldown_hours"` // minimum gap between alerts for one user
+	Enabled       bool      `bson:"enabled" json:"enabled"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Alert is one firing of a rule for a user.
+type Alert struct {
+	ID             primitive.ObjectID `bson:"_id" json:"id"`
+	UserID         string             `bson:"user_id" json:"user_id"`
+	OrgID          string             `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	RuleID         string             `bson:"rule_id" json:"rule_id"`
+	Severity       string             `bson:"severity" json:"severity"`
+	Status         string             `bson:"status" json:"status"` // open | acknowledged | resolved
+	Message        string             `bson:"message" json:"message"`
+	Value          float64            `bson:"value" json:"value"` // metric value that fired the rule
+	Date           time.Time          `bson:"date" json:"date"`   // score day that fired the rule
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+	AcknowledgedAt *time.Time         `bson:"acknowledged_at,omitempty" json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string             `bson:"acknowledged_by,omitempty" json:"acknowledged_by,omitempty"`
+	ResolvedAt     *time.Time         `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+	ResolvedBy     string             `bson:"resolved_by,omitempty" json:"resolved_by,omitempty"` // user ID, or "system" when the condition cleared
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// CalendarSettings holds a user's ICS feed token and the keywords that
+// pick study blocks out of an imported calendar. Only the SHA-256 of the
+// feed token is stored.
+type CalendarSettings struct {
+	UserID         string     `bson:"_id" json:"user_id"`
+	FeedTokenHash  string     `bson:"feed_token_hash,omitempty" json:"-"`
+	FeedCreatedAt  *time.Time `bson:"feed_created_at,omitempty" json:"feed_created_at,omitempty"`
+	ImportKeywords []string   `bson:"import_keywords" json:"import_keywords"`
+	UpdatedAt      time.Time  `bson:"updated_at" json:"updated_at"`
+}
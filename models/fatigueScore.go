@@ -10,11 +10,12 @@ import (
 type FatigueScore struct {
 	ID                primitive.ObjectID `bson:"_id,omitempty"`
 	UserID            string             `bson:"user_id" json:"user_id"`
-	Date              time.Time          `bson:"date" json:"date"` // day (UTC midnight)
+	Date              time.Time          `bson:"date" json:"date"` // user's local calendar day, as midnight UTC of that date
 	TotalStudyHours   float64            `bson:"total_study_hours" json:"total_study_hours"`
 	BreakFrequency    float64            `bson:"break_frequency" json:"break_frequency"`       // breaks per hour
 	FocusStability    float64            `bson:"focus_stability" json:"focus_stability"`       // 0-100, lower = more volatile
 	FatigueIndex      float64            `bson:"fatigue_index" json:"fatigue_index"`          // weighted composite
 	BurnoutProbability float64           `bson:"burnout_probability" json:"burnout_probability"` // 0-100
+	ModelVersion      string             `bson:"model_version,omitempty" json:"model_version,omitempty"` // scoring model behind the score
 	CreatedAt         time.Time         `bson:"created_at" json:"created_at"`
 }
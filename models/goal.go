@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Goal is an entry in a goals catalog. A goal belongs either to one user
+// (UserID) or to every member of an organization (OrgID).
+type Goal struct {
+	ID              primitive.ObjectID `bson:"_id" json:"id"`
+	UserID          string             `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	OrgID           string             `bson:"org_id,omitempty" json:"org_id,omitempty"`
+	Name            string             `bson:"name" json:"name"`
+	Category        string             `bson:"category,omitempty" json:"category,omitempty"` // e.g. work, study, creative
+	Color           string             `bson:"color,omitempty" json:"color,omitempty"`       // #RRGGBB
+	TargetMin       int                `bson:"target_min" json:"target_min"`                 // target session length
+	WeeklyTargetMin int                `bson:"weekly_target_min,omitempty" json:"weekly_target_min,omitempty"`
+	Aliases         []string           `bson:"aliases,omitempty" json:"aliases,omitempty"` // legacy free-text spellings, normalized
+	Archived        bool               `bson:"archived" json:"archived"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// GoalBaseline is a user's learned target duration for one goal: the median
+// of their recent sessions, shrunk toward the built-in default while their
+// history is thin.
+type GoalBaseline struct {
+	UserID      string    `bson:"user_id" json:"user_id"`
+	Goal        string    `bson:"goal" json:"goal"`                 // normalized goal name
+	BaselineMin int       `bson:"baseline_min" json:"baseline_min"` // target used for completion
+	DefaultMin  int       `bson:"default_min" json:"default_min"`   // built-in target for the goal
+	MedianMin   float64   `bson:"median_min" json:"median_min"`     // median of recent sessions
+	Samples     int       `bson:"samples" json:"samples"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"updated_at"`
+}
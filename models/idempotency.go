@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// IdempotencyRecord holds the response to a request sent with an
+// Idempotency-Key header, so a retry gets the same answer instead of
+// repeating the request.
+type IdempotencyRecord struct {
+	ID          string    `bson:"_id" json:"id"` // user ID + ":" + key
+	UserID      string    `bson:"user_id" json:"user_id"`
+	RequestHash string    `bson:"request_hash" json:"request_hash"` // SHA-256 of method, route and body
+	Status      int       `bson:"status" json:"status"`             // 0 while the first request is in flight
+	ContentType string    `bson:"content_type,omitempty" json:"content_type,omitempty"`
+	Body        []byte    `bson:"body,omitempty" json:"-"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time `bson:"expires_at" json:"expires_at"`
+	LockedUntil time.Time `bson:"locked_until" json:"locked_until"` // an in-flight claim may be taken over after this
+}
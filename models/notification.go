@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification channels.
+const (
+	ChannelInbox   = "inbox"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// Notification kinds; each has a message template.
+const (
+	NotifyAlert            = "alert"             // a burnout alert was raised
+	NotifySessionAbandoned = "session_abandoned" // an idle live session was auto-closed
+	NotifyWeeklyReport     = "weekly_report"     // last week's wellbeing report
+)
+
+// Delivery states.
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed" // gave up after the last retry
+)
+
+// Notification is an item in the user's in-app inbox.
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Kind      string             `bson:"kind" json:"kind"`
+	Title     string             `bson:"title" json:"title"`
+	Body      string             `bson:"body" json:"body"`
+	Data      map[string]string  `bson:"data,omitempty" json:"data,omitempty"`
+	ReadAt    *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// NotificationPrefs is how a user wants to hear about each kind of
+// notification. Quiet hours are "HH:MM" in the user's timezone; email and
+// webhook deliveries that fall inside them wait until they end.
+type NotificationPrefs struct {
+	UserID     string              `bson:"_id" json:"user_id"`
+	Channels   map[string][]string `bson:"channels" json:"channels"` // kind -> channels
+	WebhookURL string              `bson:"webhook_url,omitempty" json:"webhook_url,omitempty"`
+	QuietStart string              `bson:"quiet_start,omitempty" json:"quiet_start,omitempty"`
+	QuietEnd   string              `bson:"quiet_end,omitempty" json:"quiet_end,omitempty"`
+	UpdatedAt  time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// NotificationDelivery is a queued email or webhook send. It carries the
+// rendered message so it does not depend on the inbox item.
+type NotificationDelivery struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	UserID        string             `bson:"user_id" json:"user_id"`
+	Channel       string             `bson:"channel" json:"channel"` // email | webhook
+	Kind          string             `bson:"kind" json:"kind"`
+	Target        string             `bson:"target" json:"target"` // email address or URL
+	Subject       string             `bson:"subject" json:"subject"`
+	Body          string             `bson:"body" json:"body"`
+	Data          map[string]string  `bson:"data,omitempty" json:"data,omitempty"`
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	LastError     string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	SentAt        *time.Time         `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+}
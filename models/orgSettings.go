@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// OrgSettings holds per-organization overrides. Empty fields fall back to
+// the global defaults.
+type OrgSettings struct {
+	OrgID        string    `bson:"_id" json:"org_id"`
+	ScoringModel string    `bson:"scoring_model,omitempty" json:"scoring_model,omitempty"` // ScoringModel version
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxEntry records a unit of work that could not run in a transaction.
+// Ops are applied in order; Applied counts how many have completed so a
+// relay can resume the unit after a crash or transient failure.
+type OutboxEntry struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Name      string             `bson:"name" json:"name"` // e.g. signup, password_reset
+	Ops       []OutboxOp         `bson:"ops" json:"ops"`
+	Applied   int                `bson:"applied" json:"applied"`
+	Attempts  int                `bson:"attempts" json:"attempts"`
+	LastError string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// OutboxOp is one serialised write; Kind selects the registered handler.
+type OutboxOp struct {
+	Kind    string `bson:"kind" json:"kind"`
+	Payload []byte `bson:"payload" json:"payload"` // JSON
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RecomputeJob re-scores sessions and re-rolls daily fatigue scores for a
+// scope of users over [From, To). Users are processed in user_id order and
+// Checkpoint holds the highest user_id below which every user is done, so
+// an interrupted job resumes where it stopped.
+type RecomputeJob struct {
+	ID              primitive.ObjectID `bson:"_id" json:"id"`
+	UserID          string             `bson:"user_id,omitempty" json:"user_id,omitempty"` // scope: one user
+	OrgID           string             `bson:"org_id,omitempty" json:"org_id,omitempty"`   // scope: one organization
+	From            time.Time          `bson:"from" json:"from"`
+	To              time.Time          `bson:"to" json:"to"`
+	DryRun          bool               `bson:"dry_run" json:"dry_run"`
+	ModelVersion    string             `bson:"model_version,omitempty" json:"model_version,omitempty"` // pinned scoring model; empty = each user's own
+	Status          string             `bson:"status" json:"status"`                                   // see Recompute* constants
+	Checkpoint      string             `bson:"checkpoint,omitempty" json:"checkpoint,omitempty"`
+	UsersDone       int                `bson:"users_done" json:"users_done"`
+	SessionsChecked int                `bson:"sessions_checked" json:"sessions_checked"`
+	SessionsChanged int                `bson:"sessions_changed" json:"sessions_changed"`
+	DaysChecked     int                `bson:"days_checked" json:"days_checked"`
+	DaysChanged     int                `bson:"days_changed" json:"days_changed"`
+	Diffs           []RecomputeDiff    `bson:"diffs,omitempty" json:"diffs,omitempty"` // first MaxRecomputeDiffs changes
+	Error           string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+	Owner           string             `bson:"owner,omitempty" json:"-"` // the run holding the job
+	LockedUntil     time.Time          `bson:"locked_until" json:"-"`    // when another run may take it over
+}
+
+const (
+	RecomputePending   = "pending"
+	RecomputeRunning   = "running"
+	RecomputeCompleted = "completed"
+	RecomputeFailed    = "failed"
+)
+
+// MaxRecomputeDiffs caps the changes kept on a job; the counters stay exact.
+const MaxRecomputeDiffs = 500
+
+// RecomputeDiff is one changed value. SessionID is set for a re-scored
+// session, Date for a re-rolled day.
+type RecomputeDiff struct {
+	UserID    string     `bson:"user_id" json:"user_id"`
+	SessionID string     `bson:"session_id,omitempty" json:"session_id,omitempty"`
+	Date      *time.Time `bson:"date,omitempty" json:"date,omitempty"`
+	Field     string     `bson:"field" json:"field"`
+	Old       float64    `bson:"old" json:"old"`
+	New       float64    `bson:"new" json:"new"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// ScoringModel is a named, immutable choice of scoring formulas and their
+// parameters. One version is active globally and organizations may pin
+// another; every StudySession and FatigueScore records the version that
+// produced its score.
+type ScoringModel struct {
+	Version      string        `bson:"_id" json:"version"` // e.g. v1, 2026-03-tuned
+	Description  string        `bson:"description,omitempty" json:"description,omitempty"`
+	FocusScorer  string        `bson:"focus_scorer,omitempty" json:"focus_scorer,omitempty"`   // registered scoring.FocusScorer; empty = default
+	FatigueModel string        `bson:"fatigue_model,omitempty" json:"fatigue_model,omitempty"` // registered scoring.FatigueModel; empty = default
+	Params       ScoringParams `bson:"params" json:"params"`
+	Active       bool          `bson:"active" json:"active"`
+	CreatedAt    time.Time     `bson:"created_at" json:"created_at"`
+	ActivatedAt  *time.Time    `bson:"activated_at,omitempty" json:"activated_at,omitempty"`
+}
+
+// ScoringParams are the weights of the focus and fatigue formulas.
+type ScoringParams struct {
+	// FatigueIndex = (StudyHours * hours) - (BreakFreq * breaks/hour) + (FocusVolatility * volatility/100), times FatigueScale
+	FatigueStudyHours      float64 `bson:"fatigue_study_hours" json:"fatigue_study_hours"`
+	FatigueBreakFreq       float64 `bson:"fatigue_break_freq" json:"fatigue_break_freq"`
+	FatigueFocusVolatility float64 `bson:"fatigue_focus_volatility" json:"fatigue_focus_volatility"`
+	FatigueScale           float64 `bson:"fatigue_scale" json:"fatigue_scale"`
+
+	// BurnoutProbability = 100 / (1 + e^(-Steepness * (fatigueIndex - Midpoint)))
+	BurnoutSteepness float64 `bson:"burnout_steepness" json:"burnout_steepness"`
+	BurnoutMidpoint  float64 `bson:"burnout_midpoint" json:"burnout_midpoint"`
+
+	// FocusScore = Completion*completion + Stability*stability + Self*self + History*consistency
+	FocusCompletion float64 `bson:"focus_completion" json:"focus_completion"`
+	FocusStability  float64 `bson:"focus_stability" json:"focus_stability"`
+	FocusSelf       float64 `bson:"focus_self" json:"focus_self"`
+	FocusHistory    float64 `bson:"focus_history" json:"focus_history"`
+
+	// For planned sessions: FocusScore = (1-Plan)*FocusScore + Plan*adherence
+	FocusPlan float64 `bson:"focus_plan" json:"focus_plan"`
+}
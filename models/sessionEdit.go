@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SessionEdit records one change to a finished study session, keeping the
+// session as it was before the change.
+type SessionEdit struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SessionID string             `bson:"session_id" json:"session_id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	EditedBy  string             `bson:"edited_by" json:"edited_by"`
+	Action    string             `bson:"action" json:"action"`                     // see SessionEdit* constants
+	Fields    []string           `bson:"fields,omitempty" json:"fields,omitempty"` // changed fields, by JSON name
+	Original  StudySession       `bson:"original" json:"original"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+const (
+	SessionEditUpdate = "update"
+	SessionEditDelete = "delete"
+)
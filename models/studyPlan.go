@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StudyPlan is a session the user scheduled ahead of time: a one-off block
+// at StartAt, or with RRule every occurrence of a recurring block.
+type StudyPlan struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	UserID      string             `bson:"user_id" json:"user_id"`
+	Goal        string             `bson:"goal,omitempty" json:"goal,omitempty"` // empty = any goal
+	GoalID      string             `bson:"goal_id,omitempty" json:"goal_id,omitempty"`
+	StartAt     time.Time          `bson:"start_at" json:"start_at"` // first (or only) occurrence
+	PlannedMin  int                `bson:"planned_min" json:"planned_min"`
+	RRule       string             `bson:"rrule,omitempty" json:"rrule,omitempty"`     // RFC 5545 subset, e.g. FREQ=WEEKLY;BYDAY=MO,WE
+	ExDates     []time.Time        `bson:"exdates,omitempty" json:"exdates,omitempty"` // occurrences skipped
+	Timezone    string             `bson:"timezone" json:"timezone"`                   // IANA zone occurrences keep their wall clock in
+	Note        string             `bson:"note,omitempty" json:"note,omitempty"`
+	ExternalUID string             `bson:"external_uid,omitempty" json:"external_uid,omitempty"` // calendar event UID of an imported plan
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// PlanMatch links one occurrence of a plan to the session that fulfilled
+// it, with how closely the session kept to the plan. Its ID is
+// "<plan id>@<occurrence unix time>", so an occurrence matches at most once.
+type PlanMatch struct {
+	ID            string    `bson:"_id" json:"id"`
+	UserID        string    `bson:"user_id" json:"user_id"`
+	PlanID        string    `bson:"plan_id" json:"plan_id"`
+	OccurrenceAt  time.Time `bson:"occurrence_at" json:"occurrence_at"`
+	SessionID     string    `bson:"session_id" json:"session_id"`
+	PlannedMin    int       `bson:"planned_min" json:"planned_min"`
+	ActualMin     int       `bson:"actual_min" json:"actual_min"`
+	StartDelayMin int       `bson:"start_delay_min" json:"start_delay_min"` // negative = started early
+	OnTime        bool      `bson:"on_time" json:"on_time"`
+	MinutesRatio  float64   `bson:"minutes_ratio" json:"minutes_ratio"` // min(actual, planned) / planned
+	Adherence     float64   `bson:"adherence" json:"adherence"`         // 0-1
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+}
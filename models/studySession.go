@@ -7,24 +7,43 @@ import (
 )
 
 type StudySession struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID      string             `bson:"user_id" json:"user_id"`
-	Mode        string             `bson:"mode" json:"mode"`                         // "timer" or "stopwatch"
-	Goal        string             `bson:"goal" json:"goal"`                         // e.g. coding, studying
-	PlannedMin  int                `bson:"planned_min,omitempty" json:"planned_min,omitempty"`
-	StartedAt   time.Time          `bson:"started_at" json:"started_at"`
-	EndedAt     *time.Time         `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
-	DurationMin int                `bson:"duration_min" json:"duration_min"` // actual in minutes
-	FocusScore  int                `bson:"focus_score" json:"focus_score"`   // 0-100 AI-computed
-	PauseCount  int                `bson:"pause_count" json:"pause_count"`
-	SelfRating  int                `bson:"self_rating" json:"self_rating"`       // 1-5 self-assessed
-	SelfOnTask  string             `bson:"self_on_task" json:"self_on_task"`     // yes / somewhat / no
-	Breaks      []BreakInterval    `bson:"breaks,omitempty" json:"breaks,omitempty"`
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       string             `bson:"user_id" json:"user_id"`
+	Mode         string             `bson:"mode" json:"mode"`                           // "timer" or "stopwatch"
+	Goal         string             `bson:"goal" json:"goal"`                           // e.g. coding, studying
+	GoalID       string             `bson:"goal_id,omitempty" json:"goal_id,omitempty"` // catalog Goal; Goal then holds its name
+	PlannedMin   int                `bson:"planned_min,omitempty" json:"planned_min,omitempty"`
+	StartedAt    time.Time          `bson:"started_at" json:"started_at"`
+	EndedAt      *time.Time         `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	DurationMin  int                `bson:"duration_min" json:"duration_min"` // actual in minutes
+	FocusScore   int                `bson:"focus_score" json:"focus_score"`   // 0-100 AI-computed
+	PauseCount   int                `bson:"pause_count" json:"pause_count"`
+	SelfRating   int                `bson:"self_rating" json:"self_rating"`   // 1-5 self-assessed
+	SelfOnTask   string             `bson:"self_on_task" json:"self_on_task"` // yes / somewhat / no
+	Breaks       []BreakInterval    `bson:"breaks,omitempty" json:"breaks,omitempty"`
+	Status       string             `bson:"status,omitempty" json:"status,omitempty"`               // see Session* constants; empty = completed
+	PausedAt     *time.Time         `bson:"paused_at,omitempty" json:"paused_at,omitempty"`         // start of the open break while paused
+	UpdatedAt    *time.Time         `bson:"updated_at,omitempty" json:"updated_at,omitempty"`       // last start/pause/resume/heartbeat
+	ModelVersion string             `bson:"model_version,omitempty" json:"model_version,omitempty"` // scoring model behind FocusScore
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Live session states. Sessions submitted as a finished summary have no
+// status and count as completed.
+const (
+	SessionActive    = "active"
+	SessionPaused    = "paused"
+	SessionCompleted = "completed"
+	SessionAbandoned = "abandoned" // auto-closed after going idle
+)
+
+// InProgress reports whether the session is still running or paused.
+func (s *StudySession) InProgress() bool {
+	return s.Status == SessionActive || s.Status == SessionPaused
 }
 
 type BreakInterval struct {
 	StartedAt time.Time `bson:"started_at" json:"started_at"`
 	EndedAt   time.Time `bson:"ended_at" json:"ended_at"`
-	Minutes   int      `bson:"minutes" json:"minutes"`
+	Minutes   int       `bson:"minutes" json:"minutes"`
 }
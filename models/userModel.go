@@ -21,4 +21,6 @@ type User struct {
 	Created_at    time.Time          `json:"created_at"`
 	Updated_at    time.Time          `json:"updated_at"`
 	User_id       string             `json:"user_id"`
+	Org_id        string             `json:"org_id,omitempty" bson:"org_id,omitempty"`
+	Timezone      string             `json:"timezone,omitempty" bson:"timezone,omitempty"` // IANA name; days are bucketed in it (UTC when empty)
 }
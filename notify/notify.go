@@ -0,0 +1,91 @@
+// Package notify delivers notifications outside the app: email through a
+// pluggable EmailSender and JSON webhooks through a WebhookSender. Senders
+// are swapped with SetEmailSender / SetWebhookSender at startup.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrPermanent marks a failure that retrying will not fix, such as a
+// rejected address or a 4xx webhook response.
+var ErrPermanent = errors.New("permanent delivery failure")
+
+// Permanent wraps err with ErrPermanent.
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %v", ErrPermanent, err)
+}
+
+// Message is a rendered notification. HTML and Attachments are for email
+// only and are left out of webhook payloads.
+type Message struct {
+	ID          string            `json:"id"`
+	UserID      string            `json:"user_id"`
+	Kind        string            `json:"kind"`
+	Subject     string            `json:"subject"`
+	Body        string            `json:"body"`
+	Data        map[string]string `json:"data,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	HTML        string            `json:"-"` // optional HTML alternative to Body
+	Attachments []Attachment      `json:"-"`
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// EmailSender sends one email.
+type EmailSender interface {
+	SendEmail(ctx context.Context, to string, m Message) error
+}
+
+// WebhookSender posts one message to a user-configured URL.
+type WebhookSender interface {
+	PostWebhook(ctx context.Context, url string, m Message) error
+}
+
+var (
+	mu            sync.RWMutex
+	emailSender   EmailSender   = LogSender{}
+	webhookSender WebhookSender = NewHTTPWebhook("", false)
+)
+
+func SetEmailSender(s EmailSender) {
+	mu.Lock()
+	defer mu.Unlock()
+	emailSender = s
+}
+
+func SetWebhookSender(s WebhookSender) {
+	mu.Lock()
+	defer mu.Unlock()
+	webhookSender = s
+}
+
+func Email() EmailSender {
+	mu.RLock()
+	defer mu.RUnlock()
+	return emailSender
+}
+
+func Webhook() WebhookSender {
+	mu.RLock()
+	defer mu.RUnlock()
+	return webhookSender
+}
+
+// LogSender writes emails to the log instead of sending them. It is the
+// default until SMTP is configured.
+type LogSender struct{}
+
+func (LogSender) SendEmail(ctx context.Context, to string, m Message) error {
+	log.Printf("notify: email to %s: %s (%d attachment(s))", to, m.Subject, len(m.Attachments))
+	return nil
+}
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMTPSender sends plain-text email through an SMTP relay.
+type SMTPSender struct {
+	Addr string // host:port
+	From string
+	Auth smtp.Auth // nil for relays without authentication
+}
+
+// NewSMTPSender uses PLAIN auth when user is set.
+func NewSMTPSender(host, port, user, password, from string) *SMTPSender {
+	s := &SMTPSender{Addr: net.JoinHostPort(host, port), From: from}
+	if user != "" {
+		s.Auth = smtp.PlainAuth("", user, password, host)
+	}
+	return s
+}
+
+// EmailSenderFromEnv returns an SMTPSender when SMTP_HOST is set and a
+// LogSender otherwise. SMTP_PORT defaults to 587.
+func EmailSenderFromEnv() EmailSender {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogSender{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@" + host
+	}
+	return NewSMTPSender(host, port, os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASSWORD"), from)
+}
+
+func (s *SMTPSender) SendEmail(ctx context.Context, to string, m Message) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return Permanent(fmt.Errorf("bad recipient %q", to))
+	}
+	msg, err := buildEmail(s.From, to, m)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp takes no context; run it aside so a hung relay cannot
+	// outlive the caller's deadline.
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.Addr, s.Auth, s.From, []string{to}, msg) }()
+	select {
+	case err := <-done:
+		var perr *textproto.Error
+		if errors.As(err, &perr) && perr.Code >= 500 {
+			return Permanent(err)
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// buildEmail formats m as a MIME message: plain text alone, or
+// multipart/mixed holding a text/HTML alternative and any attachments.
+func buildEmail(from, to string, m Message) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.NewReplacer("\r", " ", "\n", " ").Replace(m.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	text := strings.ReplaceAll(m.Body, "\n", "\r\n")
+	if m.HTML == "" && len(m.Attachments) == 0 {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		b.WriteString(text)
+		return b.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	var alt bytes.Buffer
+	altW := multipart.NewWriter(&alt)
+	part, err := altW.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(text))
+	if m.HTML != "" {
+		part, err = altW.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+		if err != nil {
+			return nil, err
+		}
+		part.Write([]byte(m.HTML))
+	}
+	altW.Close()
+	part, err = mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + altW.Boundary()}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(alt.Bytes())
+
+	for _, a := range m.Attachments {
+		part, err = mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.StdEncoding.EncodeToString(a.Data)
+		for len(enc) > 76 {
+			part.Write([]byte(enc[:76] + "\r\n"))
+			enc = enc[76:]
+		}
+		part.Write([]byte(enc))
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// HTTPWebhook POSTs messages as JSON. When Secret is set each request
+// carries X-Signature-256: sha256=<hex HMAC of the body> so receivers can
+// verify it came from us.
+type HTTPWebhook struct {
+	Secret string
+	Client *http.Client
+}
+
+// NewHTTPWebhook builds a sender with a 10s timeout. Unless allowPrivate,
+// it refuses to connect to loopback, private and link-local addresses,
+// since webhook URLs are user supplied.
+func NewHTTPWebhook(secret string, allowPrivate bool) *HTTPWebhook {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &HTTPWebhook{
+		Secret: secret,
+		Client: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+}
+
+// refusePrivate runs after DNS resolution, so names that resolve to
+// internal addresses are caught too.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return Permanent(fmt.Errorf("webhook address %s is not public", host))
+	}
+	return nil
+}
+
+func (w *HTTPWebhook) PostWebhook(ctx context.Context, url string, m Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Notification-Kind", m.Kind)
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook %s: %s", url, resp.Status)
+	default:
+		return Permanent(fmt.Errorf("webhook %s: %s", url, resp.Status))
+	}
+}
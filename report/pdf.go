@@ -0,0 +1,211 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pdfPage is a minimal single-page PDF writer: Helvetica text, filled
+// rectangles and lines on an A4 page, which is all the reports need.
+// Coordinates are points from the top-left corner.
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+)
+
+// pdfText encodes s for a WinAnsi (Latin-1 compatible) string literal.
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case r == '–' || r == '—':
+			b.WriteByte('-')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func (p *pdfPage) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pageHeight-y, pdfText(s))
+}
+
+// textRight ends the text at x, using Helvetica's average glyph width as
+// an estimate since font metrics are not embedded.
+func (p *pdfPage) textRight(x, y, size float64, bold bool, s string) {
+	p.text(x-float64(len(s))*size*0.5, y, size, bold, s)
+}
+
+// rect fills a rectangle with an RGB colour (0-1 components).
+func (p *pdfPage) rect(x, y, w, h, r, g, b float64) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", r, g, b, x, pageHeight-y-h, w, h)
+}
+
+func (p *pdfPage) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.85 0.87 0.9 RG 0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, pageHeight-y1, x2, pageHeight-y2)
+}
+
+// write emits the document: catalog, page tree, two standard fonts, the
+// page and its content stream, then the xref table.
+func (p *pdfPage) write(out io.Writer) error {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pageWidth, pageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()),
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// maxPDFGoals keeps the goals table on the page.
+const maxPDFGoals = 12
+
+// RenderPDF writes w as a one-page A4 PDF.
+func RenderPDF(out io.Writer, w *Weekly) error {
+	p := &pdfPage{}
+	const left, right = 50.0, pageWidth - 50
+
+	p.text(left, 60, 20, true, "Weekly wellbeing report")
+	sub := w.Label() + " (" + w.ISOWeek() + ") - " + w.Timezone
+	if w.Name != "" {
+		sub = w.Name + " - " + sub
+	}
+	p.text(left, 80, 10, false, sub)
+
+	// Summary cards
+	cards := []struct{ label, value, note string }{
+		{"Study time", Hours(w.TotalMin), Change(float64(w.TotalMin), float64(w.PrevTotalMin)) + " vs last week"},
+		{"Sessions", fmt.Sprint(w.Sessions), Change(float64(w.Sessions), float64(w.PrevSessions)) + " vs last week"},
+		{"Average focus", fmt.Sprintf("%.0f", w.AvgFocus), Change(w.AvgFocus, w.PrevAvgFocus) + " vs last week"},
+		{"Average fatigue", fmt.Sprintf("%.0f", w.AvgFatigue), "trend: " + trendLabel(w.FatigueTrend)},
+	}
+	cardW := (right - left - 3*10) / 4
+	for i, c := range cards {
+		x := left + float64(i)*(cardW+10)
+		p.rect(x, 100, cardW, 62, 0.96, 0.97, 0.98)
+		p.text(x+8, 116, 9, false, c.label)
+		p.text(x+8, 138, 16, true, c.value)
+		p.text(x+8, 154, 8, false, c.note)
+	}
+
+	y := 190.0
+	if w.Peak != nil {
+		p.text(left, y, 11, false, fmt.Sprintf("Burnout risk peaked on %s at %.0f%%.", w.Peak.Date.Format("Mon 2 Jan"), w.Peak.BurnoutProbability))
+		y += 24
+	}
+
+	// Fatigue by day
+	p.text(left, y, 13, true, "Fatigue by day")
+	y += 8
+	p.line(left, y, right, y)
+	y += 18
+	const barX, barW = 190.0, 220.0
+	for _, d := range w.Days {
+		p.text(left, y, 10, false, d.Date.Format("Mon 2 Jan"))
+		studied := "-"
+		if d.Minutes > 0 {
+			studied = Hours(d.Minutes)
+		}
+		p.textRight(170, y, 10, false, studied)
+		if d.Scored {
+			p.rect(barX, y-8, barW, 8, 0.89, 0.91, 0.92)
+			r, g, b := 0.94, 0.71, 0.16
+			if d.FatigueIndex >= 70 {
+				r, g, b = 0.84, 0.27, 0.27
+			}
+			p.rect(barX, y-8, barW*clamp01(d.FatigueIndex/100), 8, r, g, b)
+			p.text(barX+barW+8, y, 9, false, fmt.Sprintf("%.0f", d.FatigueIndex))
+			p.textRight(right, y, 10, false, fmt.Sprintf("%.0f%% risk", d.BurnoutProbability))
+		} else {
+			p.text(barX, y, 9, false, "no score")
+		}
+		y += 20
+	}
+
+	// Hours by goal
+	y += 16
+	p.text(left, y, 13, true, "Hours by goal")
+	y += 8
+	p.line(left, y, right, y)
+	y += 18
+	if len(w.Goals) == 0 {
+		p.text(left, y, 10, false, "No study sessions this week or last.")
+	} else {
+		cols := []float64{330, 410, 480, right}
+		for i, h := range []string{"Sessions", "This week", "Last week", "Change"} {
+			p.textRight(cols[i], y, 9, true, h)
+		}
+		p.text(left, y, 9, true, "Goal")
+		y += 18
+		for i, g := range w.Goals {
+			if i == maxPDFGoals {
+				p.text(left, y, 9, false, fmt.Sprintf("and %d more", len(w.Goals)-maxPDFGoals))
+				break
+			}
+			name := g.Goal
+			if r := []rune(name); len(r) > 40 {
+				name = string(r[:39]) + "..."
+			}
+			p.text(left, y, 10, false, name)
+			p.textRight(cols[0], y, 10, false, fmt.Sprint(g.Sessions))
+			p.textRight(cols[1], y, 10, false, Hours(g.Minutes))
+			p.textRight(cols[2], y, 10, false, Hours(g.PrevMinutes))
+			p.textRight(cols[3], y, 10, false, Change(float64(g.Minutes), float64(g.PrevMinutes)))
+			y += 16
+		}
+	}
+
+	p.text(left, pageHeight-30, 8, false, "Generated "+w.GeneratedAt.Format("2 Jan 2006 15:04 MST"))
+	return p.write(out)
+}
+
+func trendLabel(t string) string {
+	if t == "" {
+		return "not enough data"
+	}
+	return t
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
@@ -0,0 +1,145 @@
+// Package report renders wellbeing reports. Services gather the numbers
+// into a Weekly; this package only formats it, as HTML from an embedded
+// template or as a one-page PDF.
+package report
+
+import (
+	"authentication/trend"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"time"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// Fatigue trends, from the slope of the week's daily fatigue index.
+const (
+	TrendRising  = trend.Rising
+	TrendFalling = trend.Falling
+	TrendSteady  = trend.Steady
+)
+
+// GoalHours is study time on one goal this week and last.
+type GoalHours struct {
+	Goal        string `json:"goal"`
+	Minutes     int    `json:"minutes"`
+	Sessions    int    `json:"sessions"`
+	PrevMinutes int    `json:"prev_minutes"`
+}
+
+// Day is one calendar day of the report week in the user's timezone.
+type Day struct {
+	Date               time.Time `json:"date"` // midnight UTC of the local date
+	Minutes            int       `json:"minutes"`
+	Sessions           int       `json:"sessions"`
+	Scored             bool      `json:"scored"` // has a daily fatigue score
+	FatigueIndex       float64   `json:"fatigue_index"`
+	BurnoutProbability float64   `json:"burnout_probability"`
+}
+
+// Weekly is a user's Monday-to-Sunday summary compared with the week before.
+type Weekly struct {
+	UserID         string      `json:"user_id"`
+	Name           string      `json:"name"`
+	Timezone       string      `json:"timezone"`
+	WeekStart      time.Time   `json:"week_start"` // Monday, midnight UTC of the local date
+	Days           []Day       `json:"days"`
+	Goals          []GoalHours `json:"goals"` // most time first; includes goals only studied last week
+	TotalMin       int         `json:"total_min"`
+	PrevTotalMin   int         `json:"prev_total_min"`
+	Sessions       int         `json:"sessions"`
+	PrevSessions   int         `json:"prev_sessions"`
+	AvgFocus       float64     `json:"avg_focus"` // 0 without sessions
+	PrevAvgFocus   float64     `json:"prev_avg_focus"`
+	AvgFatigue     float64     `json:"avg_fatigue"` // over scored days
+	PrevAvgFatigue float64     `json:"prev_avg_fatigue"`
+	FatigueTrend   string      `json:"fatigue_trend,omitempty"` // empty with fewer than 2 scored days
+	Peak           *Day        `json:"peak_burnout_day,omitempty"`
+	GeneratedAt    time.Time   `json:"generated_at"`
+}
+
+// ISOWeek names the week, e.g. 2026-W42.
+func (w *Weekly) ISOWeek() string {
+	y, n := w.WeekStart.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", y, n)
+}
+
+// Label is the week's date span, e.g. "12-18 Oct 2026".
+func (w *Weekly) Label() string {
+	end := w.WeekStart.AddDate(0, 0, 6)
+	switch {
+	case w.WeekStart.Year() != end.Year():
+		return w.WeekStart.Format("2 Jan 2006") + " - " + end.Format("2 Jan 2006")
+	case w.WeekStart.Month() != end.Month():
+		return w.WeekStart.Format("2 Jan") + " - " + end.Format("2 Jan 2006")
+	}
+	return w.WeekStart.Format("2") + "-" + end.Format("2 Jan 2006")
+}
+
+// FatigueTrendOf classifies the least-squares slope of the scored days'
+// fatigue index: more than a point a day either way is a trend.
+func FatigueTrendOf(days []Day) string {
+	var xs, ys []float64
+	for i, d := range days {
+		if d.Scored {
+			xs = append(xs, float64(i))
+			ys = append(ys, d.FatigueIndex)
+		}
+	}
+	slope, ok := trend.Slope(xs, ys)
+	if !ok {
+		return ""
+	}
+	return trend.Direction(slope, 1)
+}
+
+// Hours formats minutes as "3h 05m".
+func Hours(min int) string {
+	if min < 60 {
+		return fmt.Sprintf("%dm", min)
+	}
+	return fmt.Sprintf("%dh %02dm", min/60, min%60)
+}
+
+// Change formats cur against prev as a signed percentage, or "new" when
+// there was nothing to compare with.
+func Change(cur, prev float64) string {
+	if prev == 0 {
+		if cur == 0 {
+			return "no change"
+		}
+		return "new"
+	}
+	pct := (cur - prev) / prev * 100
+	if math.Abs(pct) < 0.5 {
+		return "no change"
+	}
+	return fmt.Sprintf("%+.0f%%", pct)
+}
+
+var htmlTemplate = template.Must(template.New("weekly.html").Funcs(template.FuncMap{
+	"hours":  Hours,
+	"change": func(cur, prev interface{}) string { return Change(toFloat(cur), toFloat(prev)) },
+	"day":    func(t time.Time) string { return t.Format("Mon 2 Jan") },
+	"pct":    func(v float64) string { return fmt.Sprintf("%.0f", v) },
+	"width":  func(v float64) string { return fmt.Sprintf("%.0f%%", math.Max(0, math.Min(100, v))) },
+}).ParseFS(templateFiles, "templates/weekly.html"))
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// RenderHTML writes w as a standalone HTML page.
+func RenderHTML(out io.Writer, w *Weekly) error {
+	return htmlTemplate.Execute(out, w)
+}
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"authentication/config"
 	"authentication/controllers"
 	"authentication/middleware"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,11 +14,17 @@ func SetupRoutes(router *gin.RouterGroup) {
 	router.POST("/login", controllers.Login())
 	router.POST("/forgot-password", controllers.ForgotPassword())
 	router.POST("/reset-password", controllers.ResetPassword())
+	// Secret-URL ICS feed for calendar subscriptions
+	router.GET("/calendar/feed/:token", controllers.GetCalendarFeed())
 	protected := router.Group("/")
 	protected.Use(middleware.Authenticate())
 	{
 		// Current user (all authenticated)
 		protected.GET("/me", controllers.GetMe())
+		protected.DELETE("/me", controllers.DeleteUser())
+		protected.PUT("/me/timezone", controllers.SetMyTimezone())
+		protected.GET("/me/notification-preferences", controllers.GetMyNotificationPrefs())
+		protected.PUT("/me/notification-preferences", controllers.SetMyNotificationPrefs())
 
 		// ADMIN only
 		protected.GET("/users",
@@ -27,16 +35,141 @@ func SetupRoutes(router *gin.RouterGroup) {
 			middleware.Authorize("ADMIN"),
 			controllers.GetHighRiskUsers(),
 		)
+		protected.GET("/admin/high-risk/projected",
+			middleware.Authorize("ADMIN"),
+			controllers.GetProjectedHighRiskUsers(),
+		)
+		protected.PUT("/admin/users/:id/org",
+			middleware.Authorize("ADMIN"),
+			controllers.SetUserOrg(),
+		)
+		protected.POST("/admin/recompute",
+			middleware.Authorize("ADMIN"),
+			controllers.StartRecompute(),
+		)
+		protected.GET("/admin/recompute/:id",
+			middleware.Authorize("ADMIN"),
+			controllers.GetRecomputeJob(),
+		)
+		protected.POST("/admin/recompute/:id/resume",
+			middleware.Authorize("ADMIN"),
+			controllers.ResumeRecompute(),
+		)
+		protected.GET("/admin/scoring-models",
+			middleware.Authorize("ADMIN"),
+			controllers.GetScoringModels(),
+		)
+		protected.POST("/admin/scoring-models",
+			middleware.Authorize("ADMIN"),
+			controllers.CreateScoringModel(),
+		)
+		protected.PUT("/admin/scoring-models/:version/activate",
+			middleware.Authorize("ADMIN"),
+			controllers.ActivateScoringModel(),
+		)
+		protected.GET("/admin/users/:id/baselines",
+			middleware.Authorize("ADMIN"),
+			controllers.GetUserBaselines(),
+		)
+		protected.GET("/admin/users/:id/fatigue-trend",
+			middleware.Authorize("ADMIN"),
+			controllers.GetUserFatigueTrend(),
+		)
+		protected.GET("/admin/users/:id/burnout-forecast",
+			middleware.Authorize("ADMIN"),
+			controllers.GetUserBurnoutForecast(),
+		)
+		protected.GET("/admin/orgs/:org/scoring-model",
+			middleware.Authorize("ADMIN"),
+			controllers.GetOrgScoringModel(),
+		)
+		protected.PUT("/admin/orgs/:org/scoring-model",
+			middleware.Authorize("ADMIN"),
+			controllers.SetOrgScoringModel(),
+		)
+		protected.GET("/admin/orgs/:org/goals",
+			middleware.Authorize("ADMIN"),
+			controllers.GetOrgGoals(),
+		)
+		protected.POST("/admin/orgs/:org/goals",
+			middleware.Authorize("ADMIN"),
+			controllers.CreateOrgGoal(),
+		)
+		protected.GET("/admin/alerts",
+			middleware.Authorize("ADMIN"),
+			controllers.GetAlerts(),
+		)
+		protected.GET("/admin/alert-rules",
+			middleware.Authorize("ADMIN"),
+			controllers.GetAlertRules(),
+		)
+		protected.POST("/admin/alert-rules",
+			middleware.Authorize("ADMIN"),
+			controllers.CreateAlertRule(),
+		)
+		protected.PUT("/admin/alert-rules/:id",
+			middleware.Authorize("ADMIN"),
+			controllers.UpdateAlertRule(),
+		)
 
 		// USER (self) + ADMIN
 		protected.GET("/user/:id",
 			middleware.Authorize("ADMIN", "USER"),
 			controllers.GetUser(),
 		)
+		protected.DELETE("/user/:id",
+			middleware.Authorize("ADMIN", "USER"),
+			controllers.DeleteUser(),
+		)
 
 		// Fatigue / study sessions (authenticated users)
-		protected.POST("/study-sessions", controllers.CreateStudySession())
+		// Retries with the same Idempotency-Key replay the first response
+		idempotent := middleware.Idempotency(config.DurationEnv("IDEMPOTENCY_TTL", 24*time.Hour))
+		protected.POST("/study-sessions", idempotent, controllers.CreateStudySession())
+		protected.POST("/study-sessions/batch", idempotent, controllers.CreateStudySessionsBatch())
 		protected.GET("/study-sessions", controllers.GetMySessions())
+		protected.POST("/study-sessions/import", controllers.ImportStudySessions())
+		protected.PATCH("/study-sessions/:id", controllers.UpdateStudySession())
+		protected.DELETE("/study-sessions/:id", controllers.DeleteStudySession())
+		protected.GET("/study-sessions/:id/history", controllers.GetStudySessionHistory())
+		protected.GET("/baselines", controllers.GetMyBaselines())
+		protected.GET("/goals", controllers.GetMyGoals())
+		protected.POST("/goals", controllers.CreateGoal())
+		protected.PUT("/goals/:id", controllers.UpdateGoal())
+		protected.DELETE("/goals/:id", controllers.ArchiveGoal())
+		protected.POST("/study-sessions/start", controllers.StartLiveSession())
+		protected.GET("/study-sessions/active", controllers.GetActiveSession())
+		protected.POST("/study-sessions/:id/pause", controllers.PauseLiveSession())
+		protected.POST("/study-sessions/:id/resume", controllers.ResumeLiveSession())
+		protected.POST("/study-sessions/:id/heartbeat", controllers.HeartbeatLiveSession())
+		protected.POST("/study-sessions/:id/end", controllers.EndLiveSession())
 		protected.GET("/fatigue-scores", controllers.GetMyFatigueScores())
+		protected.GET("/fatigue-scores/trend", controllers.GetMyFatigueTrend())
+		protected.GET("/fatigue-scores/forecast", controllers.GetMyBurnoutForecast())
+		protected.GET("/alerts", controllers.GetMyAlerts())
+		protected.POST("/alerts/:id/acknowledge", controllers.AcknowledgeAlert())
+		protected.POST("/alerts/:id/resolve", controllers.ResolveAlert())
+		protected.GET("/reports/weekly", controllers.GetWeeklyReport())
+		protected.GET("/recommendations/next-session", controllers.GetNextSessionRecommendation())
+		protected.GET("/planner/plans", controllers.GetMyStudyPlans())
+		protected.POST("/planner/plans", controllers.CreateStudyPlan())
+		protected.PUT("/planner/plans/:id", controllers.UpdateStudyPlan())
+		protected.DELETE("/planner/plans/:id", controllers.DeleteStudyPlan())
+		protected.GET("/planner/schedule", controllers.GetMyPlanSchedule())
+		protected.GET("/planner/adherence", controllers.GetMyPlanAdherence())
+		protected.GET("/calendar/settings", controllers.GetMyCalendarSettings())
+		protected.PUT("/calendar/settings", controllers.SetMyCalendarSettings())
+		protected.POST("/calendar/feed", controllers.RotateCalendarFeed())
+		protected.DELETE("/calendar/feed", controllers.DisableCalendarFeed())
+		protected.POST("/calendar/import", controllers.ImportCalendar())
+		protected.GET("/stats/streaks", controllers.GetMyStreaks())
+		protected.GET("/stats/totals", controllers.GetMyTotals())
+		protected.GET("/stats/heatmap", controllers.GetMyHeatmap())
+		protected.GET("/stats/focus-by-time", controllers.GetMyFocusByTime())
+		protected.GET("/stats/pause-rate", controllers.GetMyPauseRate())
+		protected.GET("/notifications", controllers.GetMyNotifications())
+		protected.GET("/notifications/unread-count", controllers.GetUnreadNotificationCount())
+		protected.POST("/notifications/read-all", controllers.MarkAllNotificationsRead())
+		protected.POST("/notifications/:id/read", controllers.MarkNotificationRead())
 	}
 }
@@ -0,0 +1,264 @@
+package routes_test
+
+import (
+	"authentication/helpers"
+	"authentication/routes"
+	"authentication/services"
+	"authentication/store"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The handler tests run once per backend against a scratch database:
+// TEST_MONGO_URI and TEST_POSTGRES_URL point at servers they may create
+// and drop databases and schemas on. A backend without one is skipped.
+
+func mongoTestStore(t *testing.T) store.Store {
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := client.Database("test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	s := store.NewMongoStore(db)
+	if err := s.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func postgresTestStore(t *testing.T) store.Store {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+	ctx := context.Background()
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + primitive.NewObjectID().Hex()
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE")
+		admin.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	db, err := sql.Open("pgx", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s, err := store.NewPostgresStore(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestHandlers(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(*testing.T) store.Store
+	}{
+		{"mongo", mongoTestStore},
+		{"postgres", postgresTestStore},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			store.Set(b.open(t))
+			helpers.SetJWTKey("test-secret")
+			if err := services.InitScoringModels(context.Background(), "", ""); err != nil {
+				t.Fatal(err)
+			}
+			if err := services.InitAlertRules(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			routes.SetupRoutes(r.Group("/api"))
+			h := &testAPI{r: r}
+
+			t.Run("signup and login", h.signupAndLogin)
+			t.Run("sessions", h.sessions)
+			t.Run("pagination", h.pagination)
+			t.Run("invalid cursor", h.invalidCursor)
+		})
+	}
+}
+
+type testAPI struct {
+	r     *gin.Engine
+	token string
+}
+
+// do sends a JSON request and decodes the JSON response into out.
+func (a *testAPI) do(t *testing.T, method, path string, body, out interface{}) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	w := httptest.NewRecorder()
+	a.r.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %d %s", method, path, w.Code, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+func (a *testAPI) signupAndLogin(t *testing.T) {
+	user := gin.H{
+		"first_name": "Ada",
+		"last_name":  "Lovelace",
+		"email":      "ada@example.com",
+		"password":   "secret123",
+	}
+	var signup struct {
+		Token string `json:"token"`
+	}
+	if code := a.do(t, http.MethodPost, "/api/signup", user, &signup); code != http.StatusOK || signup.Token == "" {
+		t.Fatalf("signup: %d", code)
+	}
+	if code := a.do(t, http.MethodPost, "/api/signup", user, nil); code != http.StatusBadRequest {
+		t.Fatalf("duplicate signup: got %d, want 400", code)
+	}
+
+	bad := gin.H{"email": "ada@example.com", "password": "wrong-password"}
+	if code := a.do(t, http.MethodPost, "/api/login", bad, nil); code != http.StatusUnauthorized {
+		t.Fatalf("login with wrong password: got %d, want 401", code)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	good := gin.H{"email": "ada@example.com", "password": "secret123"}
+	if code := a.do(t, http.MethodPost, "/api/login", good, &login); code != http.StatusOK || login.Token == "" {
+		t.Fatalf("login: %d", code)
+	}
+	a.token = login.Token
+}
+
+func (a *testAPI) sessions(t *testing.T) {
+	if a.token == "" {
+		t.Skip("not logged in")
+	}
+	for i := 0; i < 5; i++ {
+		var s struct {
+			ID         string `json:"id"`
+			FocusScore int    `json:"focus_score"`
+		}
+		body := gin.H{"mode": "timer", "goal": "studying", "planned_min": 30, "actual_min": 20 + i*5}
+		if code := a.do(t, http.MethodPost, "/api/study-sessions", body, &s); code != http.StatusOK && code != http.StatusCreated {
+			t.Fatalf("create session %d: %d", i, code)
+		}
+		if s.ID == "" {
+			t.Fatalf("create session %d: no id", i)
+		}
+	}
+	if code := a.do(t, http.MethodPost, "/api/study-sessions", gin.H{"actual_min": 0}, nil); code != http.StatusBadRequest {
+		t.Fatalf("session without actual_min: got %d, want 400", code)
+	}
+}
+
+func (a *testAPI) pagination(t *testing.T) {
+	if a.token == "" {
+		t.Skip("not logged in")
+	}
+	for _, sort := range []string{"", "created_at", "-started_at", "focus_score", "-duration_min"} {
+		seen := map[string]bool{}
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("sort %q: cursor never ran out", sort)
+			}
+			q := url.Values{"limit": {"2"}}
+			if sort != "" {
+				q.Set("sort", sort)
+			}
+			if cursor != "" {
+				q.Set("cursor", cursor)
+			}
+			var page struct {
+				Items []struct {
+					ID string `json:"id"`
+				} `json:"items"`
+				NextCursor string `json:"next_cursor"`
+			}
+			if code := a.do(t, http.MethodGet, "/api/study-sessions?"+q.Encode(), nil, &page); code != http.StatusOK {
+				t.Fatalf("sort %q page %d: %d", sort, pages, code)
+			}
+			if len(page.Items) > 2 {
+				t.Fatalf("sort %q: page of %d items, limit 2", sort, len(page.Items))
+			}
+			for _, s := range page.Items {
+				if seen[s.ID] {
+					t.Fatalf("sort %q: session %s on two pages", sort, s.ID)
+				}
+				seen[s.ID] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if len(seen) != 5 {
+			t.Fatalf("sort %q: paged through %d sessions, want 5", sort, len(seen))
+		}
+	}
+}
+
+func (a *testAPI) invalidCursor(t *testing.T) {
+	if a.token == "" {
+		t.Skip("not logged in")
+	}
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"v":"not a time","id":"x"}`))
+	for _, q := range []string{
+		"cursor=%25%25%25",
+		"cursor=" + tampered,
+		"sort=focus_score&cursor=" + base64.RawURLEncoding.EncodeToString([]byte(`{"v":"1e99","id":"x"}`)),
+		"sort=no_such_field",
+	} {
+		if code := a.do(t, http.MethodGet, "/api/study-sessions?"+q, nil, nil); code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d, want 400", q, code)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package rrule parses and expands the subset of RFC 5545 recurrence rules
+// the planner offers: FREQ=DAILY, WEEKLY or MONTHLY with INTERVAL, COUNT or
+// UNTIL, BYDAY (ordinals such as 1MO or -1FR in monthly rules only),
+// BYMONTHDAY (monthly) and WKST. Occurrences keep DTSTART's wall-clock time
+// in its location, so a 09:00 block stays at 09:00 across DST changes.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid RRULE")
+
+// Frequencies.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// maxPeriods bounds expansion so a rule that never matches cannot spin.
+const maxPeriods = 10000
+
+var dayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+var dayNames = [7]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// WeekdayNum is a BYDAY entry: a weekday, and in monthly rules an optional
+// ordinal (1 = first, -1 = last; 0 = every).
+type WeekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+type Rule struct {
+	Freq       string
+	Interval   int
+	Count      int       // 0 = unbounded
+	Until      time.Time // zero = unbounded; inclusive
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	WeekStart  time.Weekday
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", with or
+// without a leading "RRULE:". A floating or date-only UNTIL is read in loc.
+func Parse(s string, loc *time.Location) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "RRULE:"), "rrule:")
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.ToUpper(strings.TrimSpace(k))
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if !ok || v == "" {
+			return nil, invalid("%q is not NAME=VALUE", part)
+		}
+		if seen[k] {
+			return nil, invalid("%s given twice", k)
+		}
+		seen[k] = true
+		switch k {
+		case "FREQ":
+			if v != Daily && v != Weekly && v != Monthly {
+				return nil, invalid("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+			r.Freq = v
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 365 {
+				return nil, invalid("INTERVAL must be between 1 and 365")
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				return nil, invalid("COUNT must be between 1 and 1000")
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(v, loc)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				wd, err := parseWeekdayNum(d)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, invalid("BYMONTHDAY values must be 1 to 31 or -31 to -1")
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "WKST":
+			wd, ok := dayCodes[v]
+			if !ok {
+				return nil, invalid("WKST must be a day code such as MO")
+			}
+			r.WeekStart = wd
+		default:
+			return nil, invalid("%s is not supported", k)
+		}
+	}
+	switch {
+	case r.Freq == "":
+		return nil, invalid("FREQ is required")
+	case r.Count > 0 && !r.Until.IsZero():
+		return nil, invalid("COUNT and UNTIL cannot both be set")
+	case len(r.ByMonthDay) > 0 && r.Freq != Monthly:
+		return nil, invalid("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	for _, d := range r.ByDay {
+		if d.N != 0 && r.Freq != Monthly {
+			return nil, invalid("BYDAY ordinals are only supported with FREQ=MONTHLY")
+		}
+	}
+	return r, nil
+}
+
+func parseUntil(v string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", v); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", v, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", v, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, invalid("UNTIL must look like 20261231T235959Z or 20261231")
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 {
+		return WeekdayNum{}, invalid("BYDAY value %q", s)
+	}
+	wd, ok := dayCodes[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, invalid("BYDAY value %q", s)
+	}
+	out := WeekdayNum{Weekday: wd}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, invalid("BYDAY ordinal in %q must be 1 to 5 or -5 to -1", s)
+		}
+		out.N = n
+	}
+	return out, nil
+}
+
+// String formats r in canonical form, without the "RRULE:" prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = dayNames[d.Weekday]
+			if d.N != 0 {
+				days[i] = strconv.Itoa(d.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+dayNames[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of r starting at dtstart that fall in
+// [from, to), in order. dtstart's location sets the wall clock.
+func (r *Rule) Between(dtstart, from, to time.Time) []time.Time {
+	var out []time.Time
+	n := 0
+	for p := 0; p < maxPeriods; p++ {
+		for _, t := range r.period(dtstart, p) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if (!r.Until.IsZero() && t.After(r.Until)) || !t.Before(to) {
+				return out
+			}
+			n++
+			if !t.Before(from) {
+				out = append(out, t)
+			}
+			if r.Count > 0 && n >= r.Count {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// period returns the candidate occurrences in the p-th period after
+// dtstart's, in order.
+func (r *Rule) period(dtstart time.Time, p int) []time.Time {
+	y, m, d := dtstart.Date()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+	}
+	var out []time.Time
+	switch r.Freq {
+	case Daily:
+		t := at(y, m, d+p*r.Interval)
+		if r.matchesDay(t.Weekday()) {
+			out = append(out, t)
+		}
+	case Weekly:
+		offset := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := d - offset + 7*p*r.Interval
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []WeekdayNum{{Weekday: dtstart.Weekday()}}
+		}
+		for _, wd := range days {
+			out = append(out, at(y, m, weekStart+(int(wd.Weekday)-int(r.WeekStart)+7)%7))
+		}
+	case Monthly:
+		first := time.Date(y, m+time.Month(p*r.Interval), 1, 0, 0, 0, 0, time.UTC)
+		fy, fm := first.Year(), first.Month()
+		last := first.AddDate(0, 1, -1).Day()
+		for day := 1; day <= last; day++ {
+			if r.matchesMonthDay(day, last, dtstart.Day()) && r.matchesMonthWeekday(first.AddDate(0, 0, day-1), last) {
+				out = append(out, at(fy, fm, day))
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+func (r *Rule) matchesDay(wd time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, d := range r.ByDay {
+		if d.Weekday == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay applies BYMONTHDAY, or DTSTART's day of month when
+// neither BYMONTHDAY nor BYDAY is set.
+func (r *Rule) matchesMonthDay(day, last, startDay int) bool {
+	if len(r.ByMonthDay) == 0 {
+		return len(r.ByDay) > 0 || day == startDay
+	}
+	for _, md := range r.ByMonthDay {
+		if md == day || (md < 0 && last+md+1 == day) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthWeekday applies BYDAY within a month, ordinals included.
+func (r *Rule) matchesMonthWeekday(date time.Time, last int) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	day := date.Day()
+	for _, d := range r.ByDay {
+		if d.Weekday != date.Weekday() {
+			continue
+		}
+		switch {
+		case d.N == 0:
+			return true
+		case d.N > 0 && (day-1)/7+1 == d.N:
+			return true
+		case d.N < 0 && (last-day)/7+1 == -d.N:
+			return true
+		}
+	}
+	return false
+}
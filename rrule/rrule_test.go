@@ -0,0 +1,154 @@
+package rrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBetween(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(loc *time.Location, y int, m time.Month, d, h int) time.Time {
+		return time.Date(y, m, d, h, 0, 0, 0, loc)
+	}
+	utc := func(y int, m time.Month, d, h int) time.Time { return at(time.UTC, y, m, d, h) }
+	far := utc(2100, 1, 1, 0)
+
+	tests := []struct {
+		name     string
+		rule     string
+		dtstart  time.Time
+		from, to time.Time // zero from means dtstart, zero to means far
+		want     []time.Time
+	}{
+		{
+			name:    "daily keeps wall clock across spring forward",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: at(ny, 2026, 3, 7, 9),
+			want:    []time.Time{at(ny, 2026, 3, 7, 9), at(ny, 2026, 3, 8, 9), at(ny, 2026, 3, 9, 9)},
+		},
+		{
+			name:    "weekly keeps wall clock across fall back",
+			rule:    "FREQ=WEEKLY;COUNT=2",
+			dtstart: at(ny, 2026, 10, 26, 18),
+			want:    []time.Time{at(ny, 2026, 10, 26, 18), at(ny, 2026, 11, 2, 18)},
+		},
+		{
+			name:    "monthly last friday",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: utc(2026, 1, 1, 9),
+			want:    []time.Time{utc(2026, 1, 30, 9), utc(2026, 2, 27, 9), utc(2026, 3, 27, 9)},
+		},
+		{
+			name:    "monthly first monday",
+			rule:    "FREQ=MONTHLY;BYDAY=1MO;COUNT=3",
+			dtstart: utc(2026, 1, 1, 9),
+			want:    []time.Time{utc(2026, 1, 5, 9), utc(2026, 2, 2, 9), utc(2026, 3, 2, 9)},
+		},
+		{
+			name:    "last day of the month",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=4",
+			dtstart: utc(2026, 1, 31, 9),
+			want:    []time.Time{utc(2026, 1, 31, 9), utc(2026, 2, 28, 9), utc(2026, 3, 31, 9), utc(2026, 4, 30, 9)},
+		},
+		{
+			name:    "dtstart on the 31st skips shorter months",
+			rule:    "FREQ=MONTHLY;COUNT=3",
+			dtstart: utc(2026, 1, 31, 9),
+			want:    []time.Time{utc(2026, 1, 31, 9), utc(2026, 3, 31, 9), utc(2026, 5, 31, 9)},
+		},
+		{
+			name:    "count is spent by occurrences before the window",
+			rule:    "FREQ=DAILY;COUNT=5",
+			dtstart: utc(2026, 1, 1, 9),
+			from:    utc(2026, 1, 4, 0),
+			want:    []time.Time{utc(2026, 1, 4, 9), utc(2026, 1, 5, 9)},
+		},
+		{
+			name:    "date-only until includes that day",
+			rule:    "FREQ=DAILY;UNTIL=20260103",
+			dtstart: utc(2026, 1, 1, 9),
+			want:    []time.Time{utc(2026, 1, 1, 9), utc(2026, 1, 2, 9), utc(2026, 1, 3, 9)},
+		},
+		{
+			name:    "until stops before the window ends",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,TH;UNTIL=20260108T090000Z",
+			dtstart: utc(2026, 1, 1, 9),
+			to:      utc(2026, 2, 1, 0),
+			want:    []time.Time{utc(2026, 1, 1, 9), utc(2026, 1, 5, 9), utc(2026, 1, 8, 9)},
+		},
+		{
+			name:    "biweekly with WKST=MO",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO",
+			dtstart: utc(1997, 8, 5, 9),
+			want:    []time.Time{utc(1997, 8, 5, 9), utc(1997, 8, 10, 9), utc(1997, 8, 19, 9), utc(1997, 8, 24, 9)},
+		},
+		{
+			name:    "biweekly with WKST=SU",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU",
+			dtstart: utc(1997, 8, 5, 9),
+			want:    []time.Time{utc(1997, 8, 5, 9), utc(1997, 8, 17, 9), utc(1997, 8, 19, 9), utc(1997, 8, 31, 9)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rule, tt.dtstart.Location())
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, to := tt.from, tt.to
+			if from.IsZero() {
+				from = tt.dtstart
+			}
+			if to.IsZero() {
+				to = far
+			}
+			got := r.Between(tt.dtstart, from, to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) || got[i].Hour() != tt.want[i].Hour() {
+					t.Fatalf("occurrence %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string // canonical form; empty means Parse must fail
+	}{
+		{"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", "FREQ=WEEKLY;COUNT=10;BYDAY=MO,WE"},
+		{"freq=monthly;byday=-1fr", "FREQ=MONTHLY;BYDAY=-1FR"},
+		{"FREQ=WEEKLY;WKST=SU;INTERVAL=2", "FREQ=WEEKLY;INTERVAL=2;WKST=SU"},
+		{"FREQ=DAILY;COUNT=3;UNTIL=20260101", ""},
+		{"FREQ=WEEKLY;BYDAY=1MO", ""},
+		{"FREQ=DAILY;BYMONTHDAY=-1", ""},
+		{"FREQ=MONTHLY;BYMONTHDAY=0", ""},
+		{"FREQ=YEARLY", ""},
+		{"COUNT=3", ""},
+		{"FREQ=DAILY;FREQ=WEEKLY", ""},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule, time.UTC)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("%s: got %v, want ErrInvalid", tt.rule, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.rule, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.rule, got, tt.want)
+		}
+	}
+}
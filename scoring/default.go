@@ -0,0 +1,154 @@
+package scoring
+
+import (
+	"authentication/models"
+	"math"
+	"strings"
+)
+
+func init() {
+	RegisterFocusScorer(Default, weightedFocus{})
+	RegisterFatigueModel(Default, linearFatigue{})
+}
+
+// weightedFocus is a weighted sum of completion, pause stability, the
+// user's self-assessment and historical consistency.
+type weightedFocus struct{}
+
+// linearFatigue is a weighted sum of the day's metrics, with a logistic
+// curve for burnout.
+type linearFatigue struct{}
+
+// FatigueIndex = (w1 * totalStudyHours) - (w2 * breakFrequency) + (w3 * focusVolatility)
+// focusVolatility = 100 - focusStability (higher volatility = higher fatigue)
+func (linearFatigue) FatigueIndex(params models.ScoringParams, totalStudyHours, breakFreqPerHour, focusStability float64) float64 {
+	focusVolatility := 100 - focusStability
+	if focusVolatility < 0 {
+		focusVolatility = 0
+	}
+	idx := (params.FatigueStudyHours * totalStudyHours) - (params.FatigueBreakFreq * breakFreqPerHour) + (params.FatigueFocusVolatility * focusVolatility / 100)
+	return math.Max(0, math.Min(100, idx*params.FatigueScale)) // scale to rough 0-100
+}
+
+// BurnoutProbability: simple logistic-style from fatigue index
+func (linearFatigue) BurnoutProbability(params models.ScoringParams, fatigueIndex float64) float64 {
+	p := 100 / (1 + math.Exp(-params.BurnoutSteepness*(fatigueIndex-params.BurnoutMidpoint)))
+	return math.Round(p*10) / 10
+}
+
+// DefaultBaseline returns a reasonable target duration for a session, used
+// until a user has a personal baseline for the goal.
+func DefaultBaseline(goal, mode string) int {
+	g := strings.ToLower(strings.TrimSpace(goal))
+	switch g {
+	case "coding", "problem solving", "problem_solving":
+		return 45
+	case "studying", "reading", "research", "revision":
+		return 30
+	case "writing", "content creation", "content_creation", "video editing", "video_editing":
+		return 40
+	case "office work", "office_work", "admin":
+		return 20
+	default:
+		// Generic focus block
+		if mode == "stopwatch" {
+			return 25
+		}
+		return 25
+	}
+}
+
+func completionRatio(mode string, plannedMin, actualMin, baseline int) float64 {
+	if actualMin <= 0 {
+		return 0
+	}
+	var target float64
+	if mode == "timer" && plannedMin > 0 {
+		target = float64(plannedMin)
+	} else {
+		target = float64(baseline)
+	}
+	if target <= 0 {
+		target = float64(actualMin)
+	}
+	r := float64(actualMin) / target
+	if r < 0 {
+		r = 0
+	}
+	if r > 1.2 {
+		r = 1.2
+	}
+	return r / 1.2
+}
+
+func stabilityFromPauses(pauseCount int) float64 {
+	switch {
+	case pauseCount <= 0:
+		return 1
+	case pauseCount <= 2:
+		return 0.8
+	case pauseCount <= 4:
+		return 0.5
+	default:
+		return 0.3
+	}
+}
+
+func selfComponent(selfRating int, selfOnTask string) float64 {
+	if selfRating < 1 {
+		selfRating = 1
+	}
+	if selfRating > 5 {
+		selfRating = 5
+	}
+	base := float64(selfRating) / 5.0
+	mult := 0.8
+	switch strings.ToLower(strings.TrimSpace(selfOnTask)) {
+	case "yes", "y", "on_task":
+		mult = 1
+	case "somewhat":
+		mult = 0.7
+	case "no", "n":
+		mult = 0.4
+	}
+	v := base * mult
+	if v > 1 {
+		v = 1
+	}
+	if v < 0 {
+		v = 0
+	}
+	return v
+}
+
+// FocusScore combines multiple factors into a 0–100 score.
+func (weightedFocus) FocusScore(params models.ScoringParams, s Session) int {
+	mode := strings.ToLower(s.Mode)
+	baseline := s.BaselineMin
+	if baseline <= 0 {
+		baseline = DefaultBaseline(s.Goal, mode)
+	}
+	comp := completionRatio(mode, s.PlannedMin, s.ActualMin, baseline)
+	stab := stabilityFromPauses(s.PauseCount)
+	self := selfComponent(s.SelfRating, s.SelfOnTask)
+	hc := s.HistConsistency
+	if hc < 0 {
+		hc = 0
+	}
+	if hc > 1 {
+		hc = 1
+	}
+	// FocusScore = 0.4 × CompletionRatio + 0.2 × StabilityScore + 0.2 × SelfRating + 0.2 × HistoricalConsistency
+	// (v1 weights; other model versions set their own)
+	score01 := params.FocusCompletion*comp + params.FocusStability*stab + params.FocusSelf*self + params.FocusHistory*hc
+	if s.Planned && params.FocusPlan > 0 {
+		score01 = (1-params.FocusPlan)*score01 + params.FocusPlan*s.PlanAdherence
+	}
+	if score01 < 0 {
+		score01 = 0
+	}
+	if score01 > 1 {
+		score01 = 1
+	}
+	return int(math.Round(score01 * 100))
+}
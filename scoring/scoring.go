@@ -0,0 +1,111 @@
+// Package scoring holds the focus and fatigue formulas behind study session
+// and daily scores. Formulas implement FocusScorer or FatigueModel and are
+// registered by name from an init function; a ScoringModel version picks
+// one of each by name and supplies their params.
+package scoring
+
+import (
+	"authentication/models"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Default names the built-in formulas, used when a model names none.
+const Default = "default"
+
+// Session is what a FocusScorer sees of a finished study session.
+type Session struct {
+	Mode            string // timer | stopwatch
+	Goal            string
+	PlannedMin      int
+	ActualMin       int
+	BaselineMin     int // the user's learned target for the goal; 0 = DefaultBaseline
+	PauseCount      int
+	SelfRating      int     // 1-5
+	SelfOnTask      string  // yes / somewhat / no
+	HistConsistency float64 // 0-1, how regularly the user has studied lately
+	Planned         bool    // the session fulfilled a study plan occurrence
+	PlanAdherence   float64 // 0-1, how closely it kept to the plan; set when Planned
+}
+
+// FocusScorer scores one session from 0 to 100.
+type FocusScorer interface {
+	FocusScore(p models.ScoringParams, s Session) int
+}
+
+// FatigueModel turns a day's metrics into a fatigue index (0-100) and the
+// index into a burnout probability (0-100).
+type FatigueModel interface {
+	FatigueIndex(p models.ScoringParams, totalStudyHours, breakFreqPerHour, focusStability float64) float64
+	BurnoutProbability(p models.ScoringParams, fatigueIndex float64) float64
+}
+
+var (
+	mu            sync.RWMutex
+	focusScorers  = map[string]FocusScorer{}
+	fatigueModels = map[string]FatigueModel{}
+)
+
+// RegisterFocusScorer makes f selectable by name. Call it from init.
+func RegisterFocusScorer(name string, f FocusScorer) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := focusScorers[name]; dup {
+		panic("scoring: focus scorer registered twice: " + name)
+	}
+	focusScorers[name] = f
+}
+
+// RegisterFatigueModel makes f selectable by name. Call it from init.
+func RegisterFatigueModel(name string, f FatigueModel) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := fatigueModels[name]; dup {
+		panic("scoring: fatigue model registered twice: " + name)
+	}
+	fatigueModels[name] = f
+}
+
+// Focus returns the scorer registered under name ("" means Default).
+func Focus(name string) (FocusScorer, error) {
+	if name == "" {
+		name = Default
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := focusScorers[name]
+	if !ok {
+		return nil, fmt.Errorf("scoring: no focus scorer %q", name)
+	}
+	return f, nil
+}
+
+// Fatigue returns the model registered under name ("" means Default).
+func Fatigue(name string) (FatigueModel, error) {
+	if name == "" {
+		name = Default
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := fatigueModels[name]
+	if !ok {
+		return nil, fmt.Errorf("scoring: no fatigue model %q", name)
+	}
+	return f, nil
+}
+
+// Names lists the registered focus scorers and fatigue models.
+func Names() (focus, fatigue []string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for name := range focusScorers {
+		focus = append(focus, name)
+	}
+	for name := range fatigueModels {
+		fatigue = append(fatigue, name)
+	}
+	sort.Strings(focus)
+	sort.Strings(fatigue)
+	return focus, fatigue
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Unit-of-work ops for account changes. Each handler is idempotent so the
+// outbox relay can safely replay it.
+const (
+	opCreateUser         = "user.create"
+	opSetPassword        = "user.set_password"
+	opRevokeTokens       = "user.revoke_tokens"
+	opDeleteUser         = "user.delete"
+	opDeleteUserSessions = "study_sessions.delete_by_user"
+	opDeleteUserScores   = "fatigue_scores.delete_by_user"
+	opDeleteUserBaseline = "goal_baselines.delete_by_user"
+	opDeleteUserGoals    = "goals.delete_by_user"
+	opDeleteUserAlerts   = "alerts.delete_by_user"
+	opDeleteUserNotify   = "notifications.delete_by_user"
+	opDeleteUserRuns     = "scheduled_runs.delete_by_user"
+	opDeleteUserPlans    = "study_plans.delete_by_user"
+	opDeleteUserCalendar = "calendar_settings.delete_by_user"
+	opDeleteUserEdits    = "session_edits.delete_by_user"
+	opDeleteUserIdemKeys = "idempotency_keys.delete_by_user"
+)
+
+type userIDPayload struct {
+	UserID string `json:"user_id"`
+}
+
+type setPasswordPayload struct {
+	UserID         string `json:"user_id"`
+	HashedPassword string `json:"hashed_password"`
+}
+
+func init() {
+	store.RegisterOp(opCreateUser, func(ctx context.Context, st store.Store, payload []byte) error {
+		var u models.User
+		if err := json.Unmarshal(payload, &u); err != nil {
+			return err
+		}
+		return st.ReplaceUser(ctx, &u)
+	})
+	store.RegisterOp(opSetPassword, func(ctx context.Context, st store.Store, payload []byte) error {
+		var p setPasswordPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		return st.UpdatePassword(ctx, p.UserID, p.HashedPassword)
+	})
+	registerUserOp(opRevokeTokens, func(ctx context.Context, st store.Store, userID string) error {
+		return st.UpdateUserTokens(ctx, userID, "", "")
+	})
+	registerUserOp(opDeleteUser, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserSessions, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteSessionsByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserScores, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteFatigueScoresByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserBaseline, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteGoalBaselinesByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserGoals, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteGoalsByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserAlerts, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteAlertsByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserNotify, func(ctx context.Context, st store.Store, userID string) error {
+		if err := st.DeleteDeliveriesByUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := st.DeleteNotificationPrefs(ctx, userID); err != nil {
+			return err
+		}
+		return st.DeleteNotificationsByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserRuns, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteScheduledRunsByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserPlans, func(ctx context.Context, st store.Store, userID string) error {
+		if err := st.DeletePlanMatchesByUser(ctx, userID); err != nil {
+			return err
+		}
+		return st.DeleteStudyPlansByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserCalendar, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteCalendarSettings(ctx, userID)
+	})
+	registerUserOp(opDeleteUserEdits, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteSessionEditsByUser(ctx, userID)
+	})
+	registerUserOp(opDeleteUserIdemKeys, func(ctx context.Context, st store.Store, userID string) error {
+		return st.DeleteIdempotencyKeysByUser(ctx, userID)
+	})
+}
+
+func registerUserOp(kind string, fn func(ctx context.Context, st store.Store, userID string) error) {
+	store.RegisterOp(kind, func(ctx context.Context, st store.Store, payload []byte) error {
+		var p userIDPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		return fn(ctx, st, p.UserID)
+	})
+}
+
+// runUnit serialises ops and runs them as one unit of work.
+func runUnit(ctx context.Context, name string, ops ...func() (models.OutboxOp, error)) error {
+	built := make([]models.OutboxOp, 0, len(ops))
+	for _, op := range ops {
+		o, err := op()
+		if err != nil {
+			return err
+		}
+		built = append(built, o)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	return store.RunUnit(ctx, name, built...)
+}
+
+func op(kind string, payload interface{}) func() (models.OutboxOp, error) {
+	return func() (models.OutboxOp, error) { return store.NewOp(kind, payload) }
+}
+
+// RegisterUser stores a new account as one unit of work.
+func RegisterUser(ctx context.Context, u *models.User) error {
+	return runUnit(ctx, "signup",
+		op(opCreateUser, u),
+	)
+}
+
+// ResetUserPassword stores the new hash, clears the reset token and revokes
+// the stored session tokens together.
+func ResetUserPassword(ctx context.Context, userID, hashedPassword string) error {
+	return runUnit(ctx, "password_reset",
+		op(opSetPassword, setPasswordPayload{UserID: userID, HashedPassword: hashedPassword}),
+		op(opRevokeTokens, userIDPayload{UserID: userID}),
+	)
+}
+
+// DeleteAccount removes the user and everything recorded for them. The user
+// record goes last so a partially applied deletion can still be retried.
+func DeleteAccount(ctx context.Context, userID string) error {
+	p := userIDPayload{UserID: userID}
+	return runUnit(ctx, "account_deletion",
+		op(opDeleteUserBaseline, p),
+		op(opDeleteUserGoals, p),
+		op(opDeleteUserAlerts, p),
+		op(opDeleteUserNotify, p),
+		op(opDeleteUserRuns, p),
+		op(opDeleteUserPlans, p),
+		op(opDeleteUserCalendar, p),
+		op(opDeleteUserEdits, p),
+		op(opDeleteUserIdemKeys, p),
+		op(opDeleteUserScores, p),
+		op(opDeleteUserSessions, p),
+		op(opDeleteUser, p),
+	)
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"authentication/trend"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrAlertNotFound    = errors.New("alert not found")
+	ErrAlertState       = errors.New("alert cannot change state that way")
+	ErrInvalidAlertRule = errors.New("invalid alert rule")
+)
+
+// alertSystem marks alerts resolved because their condition cleared.
+const alertSystem = "system"
+
+// Week-over-week rules need this many scored days in each week.
+const minWeekDays = 2
+
+// alertHistoryDays of scores cover two weeks and an anomaly baseline.
+const alertHistoryDays = 1 + trend.HistoryDays
+
+var alertRuleIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// DefaultAlertRules are seeded at startup. Admins can tune or disable them.
+var DefaultAlertRules = []models.AlertRule{
+	{
+		ID:            "burnout-3d",
+		Name:          "Burnout risk high for 3 days",
+		Kind:          models.RuleThreshold,
+		Metric:        "burnout_probability",
+		Threshold:     70,
+		Days:          3,
+		Severity:      "critical",
+		CooldownHours: 72,
+		Enabled:       true,
+	},
+	{
+		ID:            "fatigue-wow",
+		Name:          "Fatigue rising week over week",
+		Kind:          models.RuleWeekOverWeek,
+		Metric:        "fatigue_index",
+		Threshold:     20,
+		Severity:      "warning",
+		CooldownHours: 7 * 24,
+		Enabled:       true,
+	},
+}
+
+// InitAlertRules seeds DefaultAlertRules. Rules that already exist are left
+// as they are, so admin changes survive restarts.
+func InitAlertRules(ctx context.Context) error {
+	for i := range DefaultAlertRules {
+		r := DefaultAlertRules[i]
+		r.CreatedAt = time.Now()
+		r.UpdatedAt = r.CreatedAt
+		if err := store.Get().CreateAlertRule(ctx, &r); err != nil && !errors.Is(err, store.ErrDuplicate) {
+			return fmt.Errorf("alert rule %s: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+func metricValue(fs *models.FatigueScore, metric string) float64 {
+	if metric == "fatigue_index" {
+		return fs.FatigueIndex
+	}
+	return fs.BurnoutProbability
+}
+
+func metricLabel(metric string) string {
+	if metric == "fatigue_index" {
+		return "Fatigue index"
+	}
+	return "Burnout probability"
+}
+
+func validateAlertRule(r *models.AlertRule) error {
+	r.ID = strings.ToLower(strings.TrimSpace(r.ID))
+	r.Name = strings.TrimSpace(r.Name)
+	r.OrgID = strings.TrimSpace(r.OrgID)
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	if r.Kind == models.RuleThreshold && r.Days == 0 {
+		r.Days = 1
+	}
+	switch {
+	case !alertRuleIDPattern.MatchString(r.ID):
+		return fmt.Errorf("%w: id must be lowercase letters, digits, '-' or '_'", ErrInvalidAlertRule)
+	case r.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidAlertRule)
+	case r.Kind != models.RuleThreshold && r.Kind != models.RuleWeekOverWeek && r.Kind != models.RuleAnomaly:
+		return fmt.Errorf("%w: kind must be %s, %s or %s", ErrInvalidAlertRule, models.RuleThreshold, models.RuleWeekOverWeek, models.RuleAnomaly)
+	case r.Metric != "burnout_probability" && r.Metric != "fatigue_index":
+		return fmt.Errorf("%w: metric must be burnout_probability or fatigue_index", ErrInvalidAlertRule)
+	case r.Threshold <= 0:
+		return fmt.Errorf("%w: threshold must be greater than 0", ErrInvalidAlertRule)
+	case r.Kind == models.RuleAnomaly && r.Threshold > 10:
+		return fmt.Errorf("%w: anomaly threshold is a z-score and must be at most 10", ErrInvalidAlertRule)
+	case r.Kind == models.RuleThreshold && (r.Days < 1 || r.Days > 14):
+		return fmt.Errorf("%w: days must be between 1 and 14", ErrInvalidAlertRule)
+	case r.Severity != "warning" && r.Severity != "critical":
+		return fmt.Errorf("%w: severity must be warning or critical", ErrInvalidAlertRule)
+	case r.CooldownHours < 0 || r.CooldownHours > 90*24:
+		return fmt.Errorf("%w: cooldown_hours must be between 0 and %d", ErrInvalidAlertRule, 90*24)
+	}
+	if r.Kind != models.RuleThreshold {
+		r.Days = 0
+	}
+	return nil
+}
+
+// matchRule checks r against the user's newest-first daily scores. It
+// returns the value that fired the rule and a message for the user.
+func matchRule(r *models.AlertRule, scores []models.FatigueScore) (bool, float64, string) {
+	if len(scores) == 0 {
+		return false, 0, ""
+	}
+	latest := scores[0].Date.UTC()
+	switch r.Kind {
+	case models.RuleThreshold:
+		if len(scores) < r.Days {
+			return false, 0, ""
+		}
+		for i := 0; i < r.Days; i++ {
+			if !scores[i].Date.Equal(latest.AddDate(0, 0, -i)) || metricValue(&scores[i], r.Metric) < r.Threshold {
+				return false, 0, ""
+			}
+		}
+		v := metricValue(&scores[0], r.Metric)
+		days := "today"
+		if r.Days > 1 {
+			days = fmt.Sprintf("for %d days in a row", r.Days)
+		}
+		return true, v, fmt.Sprintf("%s has been at or above %g %s (now %.1f).", metricLabel(r.Metric), r.Threshold, days, v)
+
+	case models.RuleWeekOverWeek:
+		var cur, prev float64
+		var nCur, nPrev int
+		for i := range scores {
+			age := int(latest.Sub(scores[i].Date).Hours() / 24)
+			switch {
+			case age < 7:
+				cur += metricValue(&scores[i], r.Metric)
+				nCur++
+			case age < 14:
+				prev += metricValue(&scores[i], r.Metric)
+				nPrev++
+			}
+		}
+		if nCur < minWeekDays || nPrev < minWeekDays || prev <= 0 {
+			return false, 0, ""
+		}
+		cur, prev = cur/float64(nCur), prev/float64(nPrev)
+		rise := (cur - prev) / prev * 100
+		if rise <= r.Threshold {
+			return false, 0, ""
+		}
+		return true, rise, fmt.Sprintf("%s is up %.0f%% on the previous week (%.1f vs %.1f).", metricLabel(r.Metric), rise, cur, prev)
+
+	case models.RuleAnomaly:
+		day := trend.Analyze(scores, latest, latest, r.Threshold).Latest()
+		if day == nil {
+			return false, 0, ""
+		}
+		p := day.Metric(r.Metric)
+		if p.Z == nil || *p.Z < r.Threshold {
+			return false, 0, ""
+		}
+		return true, *p.Z, fmt.Sprintf("%s is unusually high (%.1f against your usual %.1f).", metricLabel(r.Metric), p.Value, *p.Baseline)
+	}
+	return false, 0, ""
+}
+
+// EvaluateAlerts checks the user's latest daily scores against every
+// enabled rule that applies to them. A matching rule raises an alert unless
+// one from the same rule is still unresolved or was raised within the
+// rule's cooldown; an unresolved alert whose rule no longer matches is
+// resolved.
+func EvaluateAlerts(ctx context.Context, userID string) error {
+	st := store.Get()
+	rules, err := st.ListAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+	orgID := userOrg(ctx, userID)
+	scores, err := st.RecentFatigueScores(ctx, userID, alertHistoryDays)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range rules {
+		r := &rules[i]
+		if !r.Enabled || (r.OrgID != "" && r.OrgID != orgID) {
+			continue
+		}
+		fired, value, msg := matchRule(r, scores)
+		last, err := st.LatestAlert(ctx, userID, r.ID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		unresolved := last != nil && last.Status != models.AlertResolved
+
+		if !fired {
+			if unresolved {
+				last.Status = models.AlertResolved
+				last.ResolvedAt = &now
+				last.ResolvedBy = alertSystem
+				if err := st.UpdateAlert(ctx, last); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if unresolved || (last != nil && now.Sub(last.CreatedAt) < time.Duration(r.CooldownHours)*time.Hour) {
+			continue
+		}
+		a := &models.Alert{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			OrgID:     orgID,
+			RuleID:    r.ID,
+			Severity:  r.Severity,
+			Status:    models.AlertOpen,
+			Message:   msg,
+			Value:     value,
+			Date:      scores[0].Date,
+			CreatedAt: now,
+		}
+		if err := st.CreateAlert(ctx, a); err != nil {
+			return err
+		}
+		if err := Notify(ctx, userID, models.NotifyAlert, map[string]string{
+			"alert_id":  a.ID.Hex(),
+			"rule_id":   r.ID,
+			"rule_name": r.Name,
+			"severity":  r.Severity,
+			"message":   msg,
+			"date":      a.Date.Format("2006-01-02"),
+		}); err != nil {
+			log.Printf("alerts: notify %s about %s: %v", userID, r.ID, err)
+		}
+	}
+	return nil
+}
+
+func ListAlerts(ctx context.Context, f store.AlertFilter, opts store.ListOptions) ([]models.Alert, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListAlerts(ctx, f, opts)
+}
+
+// UpdateAlertStatus acknowledges or resolves an alert on behalf of userID.
+// Users act on their own alerts; admins on anyone's.
+func UpdateAlertStatus(ctx context.Context, userID string, admin bool, alertID, status string) (*models.Alert, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	a, err := store.Get().FindAlert(ctx, alertID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !admin && a.UserID != userID) {
+		return nil, ErrAlertNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	switch {
+	case status == models.AlertAcknowledged && a.Status == models.AlertOpen:
+		a.AcknowledgedAt = &now
+		a.AcknowledgedBy = userID
+	case status == models.AlertResolved && a.Status != models.AlertResolved:
+		a.ResolvedAt = &now
+		a.ResolvedBy = userID
+	default:
+		return a, ErrAlertState
+	}
+	a.Status = status
+	if err := store.Get().UpdateAlert(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListAlertRules(ctx)
+}
+
+func CreateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := validateAlertRule(r); err != nil {
+		return err
+	}
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = r.CreatedAt
+	return store.Get().CreateAlertRule(ctx, r)
+}
+
+// UpdateAlertRule replaces a rule's settings. Alerts already raised keep
+// the values they were raised with.
+func UpdateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := validateAlertRule(r); err != nil {
+		return err
+	}
+	old, err := store.Get().FindAlertRule(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+	r.CreatedAt = old.CreatedAt
+	r.UpdatedAt = time.Now()
+	return store.Get().UpdateAlertRule(ctx, r)
+}
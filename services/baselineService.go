@@ -0,0 +1,138 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/scoring"
+	"authentication/store"
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	baselineWindowDays = 90
+	baselineMaxSamples = 50
+	// baselinePriorWeight is how many sessions the built-in default counts
+	// as: with n sessions the baseline is (n*median + k*default) / (n + k).
+	baselinePriorWeight = 5.0
+	baselineMinMinutes  = 10
+	baselineMaxMinutes  = 240
+)
+
+// goalKey normalizes a goal name for baseline lookups.
+func goalKey(goal string) string {
+	return strings.ToLower(strings.TrimSpace(goal))
+}
+
+// baselineKey is what s's baseline is stored under: its catalog goal ID, or
+// the normalized free-text goal for sessions that predate the catalog.
+func baselineKey(s *models.StudySession) string {
+	if s.GoalID != "" {
+		return s.GoalID
+	}
+	return goalKey(s.Goal)
+}
+
+// goalDefault is the target a new baseline for s's goal starts from: the
+// catalog goal's target, else the built-in default for the goal name.
+func goalDefault(ctx context.Context, s *models.StudySession) int {
+	if s.GoalID != "" {
+		if g, err := store.Get().FindGoal(ctx, s.GoalID); err == nil && g.TargetMin > 0 {
+			return g.TargetMin
+		}
+	}
+	return scoring.DefaultBaseline(goalKey(s.Goal), "stopwatch")
+}
+
+// countsTowardBaseline reports whether s reflects a natural study block.
+// Sessions still running or auto-closed after going idle do not.
+func countsTowardBaseline(s *models.StudySession) bool {
+	return !s.InProgress() && s.Status != models.SessionAbandoned && s.DurationMin > 0
+}
+
+// computeGoalBaseline learns the user's baseline for the goal stored under
+// key from the sessions in history that started in the baselineWindowDays
+// before at, shrunk toward defaultMin.
+func computeGoalBaseline(userID, key string, defaultMin int, history []models.StudySession, at time.Time) models.GoalBaseline {
+	b := models.GoalBaseline{
+		UserID:     userID,
+		Goal:       key,
+		DefaultMin: defaultMin,
+		UpdatedAt:  time.Now(),
+	}
+	since := at.AddDate(0, 0, -baselineWindowDays)
+	var recent []models.StudySession
+	for i := range history {
+		s := &history[i]
+		if baselineKey(s) != key || !countsTowardBaseline(s) || s.StartedAt.Before(since) || !s.StartedAt.Before(at) {
+			continue
+		}
+		recent = append(recent, *s)
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].StartedAt.After(recent[j].StartedAt) })
+	if len(recent) > baselineMaxSamples {
+		recent = recent[:baselineMaxSamples]
+	}
+	b.Samples = len(recent)
+	if b.Samples == 0 {
+		b.BaselineMin = b.DefaultMin
+		return b
+	}
+
+	durations := make([]float64, len(recent))
+	for i, s := range recent {
+		durations[i] = float64(s.DurationMin)
+	}
+	sort.Float64s(durations)
+	mid := len(durations) / 2
+	b.MedianMin = durations[mid]
+	if len(durations)%2 == 0 {
+		b.MedianMin = (durations[mid-1] + durations[mid]) / 2
+	}
+
+	n := float64(b.Samples)
+	shrunk := (n*b.MedianMin + baselinePriorWeight*float64(b.DefaultMin)) / (n + baselinePriorWeight)
+	b.BaselineMin = int(math.Round(math.Max(baselineMinMinutes, math.Min(baselineMaxMinutes, shrunk))))
+	return b
+}
+
+// personalBaseline returns the stored baseline for s's goal. Without one it
+// returns the catalog goal's target, or 0 so the scorer falls back to the
+// built-in default.
+func personalBaseline(ctx context.Context, s *models.StudySession) int {
+	b, err := store.Get().FindGoalBaseline(ctx, s.UserID, baselineKey(s))
+	if err == nil {
+		return b.BaselineMin
+	}
+	if s.GoalID != "" {
+		if g, err := store.Get().FindGoal(ctx, s.GoalID); err == nil {
+			return g.TargetMin
+		}
+	}
+	return 0
+}
+
+// RefreshGoalBaseline relearns and stores the user's baseline for s's goal.
+func RefreshGoalBaseline(ctx context.Context, s *models.StudySession) (*models.GoalBaseline, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	history, err := store.Get().SessionsBetween(ctx, s.UserID, now.AddDate(0, 0, -baselineWindowDays), now.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	b := computeGoalBaseline(s.UserID, baselineKey(s), goalDefault(ctx, s), history, now.Add(time.Second))
+	if err := store.Get().UpsertGoalBaseline(ctx, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetGoalBaselines lists the user's learned baselines.
+func GetGoalBaselines(ctx context.Context, userID string) ([]models.GoalBaseline, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListGoalBaselines(ctx, userID)
+}
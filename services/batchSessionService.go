@@ -0,0 +1,225 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	maxBatchSessions = 100
+	maxBatchSpan     = 24 * time.Hour
+	batchClockSkew   = 5 * time.Minute // allowed for client clocks running ahead
+)
+
+var ErrInvalidBatch = errors.New("a batch holds 1-100 sessions")
+
+// BatchSessionInput is a session a client recorded while offline, timed by
+// its own clock.
+type BatchSessionInput struct {
+	ClientID   string // echoed back to match results to items
+	Mode       string
+	GoalID     string
+	Goal       string
+	PlannedMin int
+	StartedAt  time.Time
+	EndedAt    time.Time
+	ActualMin  int // active minutes; defaults to the time from start to end
+	PauseCount int
+	SelfRating int
+	SelfOnTask string
+}
+
+// Batch item outcomes.
+const (
+	BatchCreated   = "created"
+	BatchDuplicate = "duplicate" // already stored; Session is the stored one
+	BatchInvalid   = "invalid"
+)
+
+// BatchSessionResult is the outcome for the item at Index.
+type BatchSessionResult struct {
+	Index    int                  `json:"index"`
+	ClientID string               `json:"client_id,omitempty"`
+	Status   string               `json:"status"`
+	Session  *models.StudySession `json:"session,omitempty"`
+	Error    string               `json:"error,omitempty"`
+}
+
+// batchSession validates in and builds the session it describes.
+func batchSession(userID string, in BatchSessionInput, now time.Time) (*models.StudySession, error) {
+	switch {
+	case in.StartedAt.IsZero() || in.EndedAt.IsZero():
+		return nil, errors.New("started_at and ended_at are required")
+	case !in.EndedAt.After(in.StartedAt):
+		return nil, errors.New("ended_at must be after started_at")
+	case in.EndedAt.Sub(in.StartedAt) > maxBatchSpan:
+		return nil, errors.New("a session lasts at most 24 hours")
+	case in.EndedAt.After(now.Add(batchClockSkew)):
+		return nil, errors.New("ended_at is in the future")
+	}
+	spanMin := int((in.EndedAt.Sub(in.StartedAt) + 30*time.Second) / time.Minute)
+	if in.ActualMin == 0 {
+		in.ActualMin = spanMin
+	}
+	switch {
+	case in.ActualMin <= 0:
+		return nil, errors.New("actual_min must be greater than 0")
+	case in.ActualMin > spanMin+1:
+		return nil, errors.New("actual_min is longer than the time from started_at to ended_at")
+	case in.PlannedMin < 0:
+		return nil, errors.New("planned_min must not be negative")
+	case in.SelfRating > 5:
+		return nil, errors.New("self_rating must be 1-5")
+	}
+	mode := strings.ToLower(strings.TrimSpace(in.Mode))
+	if mode != "timer" && mode != "stopwatch" {
+		mode = "stopwatch"
+	}
+	onTask := strings.ToLower(strings.TrimSpace(in.SelfOnTask))
+	if onTask != "" && onTask != "yes" && onTask != "somewhat" && onTask != "no" {
+		return nil, errors.New("self_on_task must be yes, somewhat or no")
+	}
+	if in.SelfRating <= 0 {
+		in.SelfRating = 3
+	}
+	if in.PauseCount < 0 {
+		in.PauseCount = 0
+	}
+	goal := strings.TrimSpace(in.Goal)
+	if goal == "" {
+		goal = "unspecified"
+	}
+	end := in.EndedAt
+	return &models.StudySession{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		Mode:        mode,
+		Goal:        goal,
+		PlannedMin:  in.PlannedMin,
+		StartedAt:   in.StartedAt,
+		EndedAt:     &end,
+		DurationMin: in.ActualMin,
+		PauseCount:  in.PauseCount,
+		SelfRating:  in.SelfRating,
+		SelfOnTask:  onTask,
+		Status:      models.SessionCompleted,
+		CreatedAt:   end,
+	}, nil
+}
+
+// CreateStudySessionsBatch stores sessions a client recorded while offline
+// and reports on each one. A session with the same start and length as a
+// stored one is a duplicate, so resending a batch after a lost response is
+// safe, and scores any the lost attempt stored without scoring. New
+// sessions are scored in chronological order with those around them, and
+// their days re-rolled.
+func CreateStudySessionsBatch(ctx context.Context, userID string, items []BatchSessionInput) ([]BatchSessionResult, error) {
+	if len(items) == 0 || len(items) > maxBatchSessions {
+		return nil, ErrInvalidBatch
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	st := store.Get()
+	now := time.Now()
+
+	catalog, err := st.ListGoals(ctx, userID, userOrg(ctx, userID), false)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]BatchSessionResult, len(items))
+	pending := make([]int, 0, len(items))
+	sessions := make([]*models.StudySession, len(items))
+	for i, in := range items {
+		results[i] = BatchSessionResult{Index: i, ClientID: in.ClientID}
+		s, err := batchSession(userID, in, now)
+		if err == nil {
+			if goalID := strings.TrimSpace(in.GoalID); goalID != "" {
+				if err = applyGoal(ctx, s, goalID); errors.Is(err, ErrGoalNotFound) {
+					err = errors.New("unknown goal_id")
+				} else if err != nil {
+					return nil, err
+				}
+			} else if g := findGoalByName(catalog, s.Goal); g != nil {
+				s.GoalID, s.Goal = g.ID.Hex(), g.Name
+			}
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = BatchInvalid, err.Error()
+			continue
+		}
+		sessions[i] = s
+		pending = append(pending, i)
+	}
+	if len(pending) == 0 {
+		return results, nil
+	}
+	sort.SliceStable(pending, func(a, b int) bool {
+		return sessions[pending[a]].StartedAt.Before(sessions[pending[b]].StartedAt)
+	})
+
+	first, last := sessions[pending[0]].StartedAt, sessions[pending[len(pending)-1]].StartedAt
+	existing, err := st.SessionsBetween(ctx, userID, first, last.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	type sessionKey struct {
+		start       int64
+		durationMin int
+	}
+	stored := make(map[sessionKey]*models.StudySession, len(existing))
+	for i := range existing {
+		stored[sessionKey{existing[i].StartedAt.Unix(), existing[i].DurationMin}] = &existing[i]
+	}
+	// Scored below: new sessions, and duplicates an earlier attempt stored
+	// but failed to score before its client gave up.
+	var toScore []int
+	for _, i := range pending {
+		s := sessions[i]
+		k := sessionKey{s.StartedAt.Unix(), s.DurationMin}
+		if prev, ok := stored[k]; ok {
+			results[i].Status, results[i].Session = BatchDuplicate, prev
+			if unscored(prev) {
+				sessions[i] = prev
+				toScore = append(toScore, i)
+			}
+			continue
+		}
+		if err := st.CreateSession(ctx, s); err != nil {
+			return nil, err
+		}
+		savePlanMatch(ctx, matchPlannedSession(ctx, s))
+		stored[k] = s
+		results[i].Status, results[i].Session = BatchCreated, s
+		toScore = append(toScore, i)
+	}
+	if len(toScore) == 0 {
+		return results, nil
+	}
+
+	if _, _, rc := rescoreBackfill(ctx, userID, sessions[toScore[0]].StartedAt); rc.err != nil {
+		return nil, fmt.Errorf("sessions stored but scoring failed: %w", rc.err)
+	}
+	// Pick up the scores the recompute wrote.
+	scored, err := st.SessionsBetween(ctx, userID, first, last.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]*models.StudySession, len(scored))
+	for i := range scored {
+		byID[scored[i].ID] = &scored[i]
+	}
+	for _, i := range toScore {
+		if s, ok := byID[sessions[i].ID]; ok {
+			results[i].Session = s
+		}
+	}
+	return results, nil
+}
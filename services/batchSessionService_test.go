@@ -0,0 +1,161 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// batchStore keeps sessions in memory; the user has no goals or plans.
+type batchStore struct {
+	store.Store
+	sessions []models.StudySession
+	created  int
+}
+
+func (s *batchStore) FindUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return nil, store.ErrNotFound
+}
+
+func (s *batchStore) ListGoals(ctx context.Context, userID, orgID string, includeArchived bool) ([]models.Goal, error) {
+	return nil, nil
+}
+
+func (s *batchStore) ListStudyPlans(ctx context.Context, userID string) ([]models.StudyPlan, error) {
+	return nil, nil
+}
+
+func (s *batchStore) SessionsBetween(ctx context.Context, userID string, from, to time.Time) ([]models.StudySession, error) {
+	var out []models.StudySession
+	for _, sess := range s.sessions {
+		if sess.UserID == userID && !sess.StartedAt.Before(from) && sess.StartedAt.Before(to) {
+			out = append(out, sess)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out, nil
+}
+
+func (s *batchStore) CreateSession(ctx context.Context, sess *models.StudySession) error {
+	s.sessions = append(s.sessions, *sess)
+	s.created++
+	return nil
+}
+
+func (s *batchStore) ReplaceSession(ctx context.Context, sess *models.StudySession) error {
+	for i := range s.sessions {
+		if s.sessions[i].ID == sess.ID {
+			s.sessions[i] = *sess
+		}
+	}
+	return nil
+}
+
+func (s *batchStore) ActiveScoringModel(ctx context.Context) (*models.ScoringModel, error) {
+	return nil, store.ErrNotFound
+}
+
+func (s *batchStore) ListPlanMatches(ctx context.Context, userID string, from, to *time.Time) ([]models.PlanMatch, error) {
+	return nil, nil
+}
+
+func (s *batchStore) ListFatigueScores(ctx context.Context, userID string, from, to *time.Time, opts store.ListOptions) ([]models.FatigueScore, string, error) {
+	return nil, "", nil
+}
+
+func (s *batchStore) UpsertFatigueScore(ctx context.Context, fs *models.FatigueScore) error {
+	return nil
+}
+
+func (s *batchStore) UpsertGoalBaseline(ctx context.Context, b *models.GoalBaseline) error {
+	return nil
+}
+
+func (s *batchStore) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	return nil, nil
+}
+
+func (s *batchStore) RecentFatigueScores(ctx context.Context, userID string, limit int64) ([]models.FatigueScore, error) {
+	return nil, nil
+}
+
+func TestBatchDuplicates(t *testing.T) {
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	at := func(h int) time.Time { return day.Add(time.Duration(h) * time.Hour) }
+	stored := models.StudySession{
+		ID:           primitive.NewObjectID(),
+		UserID:       "u1",
+		Goal:         "maths",
+		StartedAt:    at(9),
+		DurationMin:  60,
+		Status:       models.SessionCompleted,
+		FocusScore:   70,
+		ModelVersion: "v1",
+	}
+	fs := &batchStore{sessions: []models.StudySession{stored}}
+	store.Set(fs)
+
+	items := []BatchSessionInput{
+		{ClientID: "a", StartedAt: at(9), EndedAt: at(10)},                        // already stored
+		{ClientID: "b", StartedAt: at(14), EndedAt: at(14).Add(30 * time.Minute)}, // new
+		{ClientID: "c", StartedAt: at(14), EndedAt: at(14).Add(30 * time.Minute)}, // repeats b
+		{ClientID: "d", StartedAt: at(9), EndedAt: at(10), ActualMin: 50},         // same start, other length
+		{ClientID: "e", StartedAt: at(11), EndedAt: at(10)},                       // invalid
+	}
+	results, err := CreateStudySessionsBatch(context.Background(), "u1", items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": BatchDuplicate, "b": BatchCreated, "c": BatchDuplicate, "d": BatchCreated, "e": BatchInvalid}
+	for _, r := range results {
+		if r.Status != want[r.ClientID] {
+			t.Errorf("item %s: %s (%s), want %s", r.ClientID, r.Status, r.Error, want[r.ClientID])
+		}
+	}
+	if results[0].Session == nil || results[0].Session.ID != stored.ID {
+		t.Errorf("duplicate of a stored session reports %+v, want the stored one", results[0].Session)
+	}
+	if results[2].Session == nil || results[1].Session == nil || results[2].Session.ID != results[1].Session.ID {
+		t.Errorf("repeated item reports %+v, want the session created for b", results[2].Session)
+	}
+	if fs.created != 2 {
+		t.Errorf("created %d sessions, want 2", fs.created)
+	}
+}
+
+// TestBatchScoresUnscoredDuplicate resends a batch whose first attempt
+// stored its session but failed before scoring it.
+func TestBatchScoresUnscoredDuplicate(t *testing.T) {
+	start := time.Now().UTC().Truncate(time.Hour).Add(-5 * time.Hour)
+	left := models.StudySession{
+		ID:          primitive.NewObjectID(),
+		UserID:      "u1",
+		Goal:        "unspecified",
+		Mode:        "stopwatch",
+		StartedAt:   start,
+		DurationMin: 40,
+		SelfRating:  3,
+		Status:      models.SessionCompleted,
+	}
+	fs := &batchStore{sessions: []models.StudySession{left}}
+	store.Set(fs)
+
+	results, err := CreateStudySessionsBatch(context.Background(), "u1", []BatchSessionInput{
+		{StartedAt: start, EndedAt: start.Add(40 * time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := results[0]
+	if r.Status != BatchDuplicate || r.Session == nil || r.Session.ID != left.ID {
+		t.Fatalf("result %+v, want the stored session as a duplicate", r)
+	}
+	if r.Session.ModelVersion == "" || fs.created != 0 {
+		t.Fatalf("duplicate left unscored (model %q), %d created", r.Session.ModelVersion, fs.created)
+	}
+}
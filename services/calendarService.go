@@ -0,0 +1,460 @@
+package services
+
+import (
+	"authentication/helpers"
+	"authentication/ical"
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrCalendarFeedNotFound    = errors.New("calendar feed not found")
+	ErrInvalidCalendarSettings = errors.New("invalid calendar settings")
+	ErrNoImportKeywords        = errors.New("set import_keywords before importing a calendar")
+	ErrInvalidCalendar         = ical.ErrInvalid
+)
+
+const (
+	calendarProdID     = "-//Study Sessions//Calendar Feed//EN"
+	feedSessionDays    = 180
+	feedZoneYears      = 2 // VTIMEZONE rules reach this many years past now
+	maxImportKeywords  = 50
+	maxImportKeywordSz = 64
+)
+
+func feedTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CalendarSettings returns the user's calendar settings; a user who never
+// set any gets empty ones.
+func CalendarSettings(ctx context.Context, userID string) (*models.CalendarSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return calendarSettings(ctx, userID)
+}
+
+func calendarSettings(ctx context.Context, userID string) (*models.CalendarSettings, error) {
+	cs, err := store.Get().FindCalendarSettings(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return &models.CalendarSettings{UserID: userID, ImportKeywords: []string{}}, nil
+	}
+	return cs, err
+}
+
+// SetCalendarImportKeywords replaces the keywords that select events on
+// import. Matching ignores case.
+func SetCalendarImportKeywords(ctx context.Context, userID string, keywords []string) (*models.CalendarSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if len(keywords) > maxImportKeywords {
+		return nil, fmt.Errorf("%w: at most %d import_keywords", ErrInvalidCalendarSettings, maxImportKeywords)
+	}
+	cs, err := calendarSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	cs.ImportKeywords = []string{}
+	for _, k := range keywords {
+		k = strings.TrimSpace(k)
+		if len(k) > maxImportKeywordSz {
+			return nil, fmt.Errorf("%w: import keywords must be at most %d characters", ErrInvalidCalendarSettings, maxImportKeywordSz)
+		}
+		if k == "" || seen[strings.ToLower(k)] {
+			continue
+		}
+		seen[strings.ToLower(k)] = true
+		cs.ImportKeywords = append(cs.ImportKeywords, k)
+	}
+	cs.UpdatedAt = time.Now()
+	if err := store.Get().SaveCalendarSettings(ctx, cs); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// RotateCalendarFeedToken issues a new feed token, revoking the old one.
+// The token is only returned here; the store keeps its hash.
+func RotateCalendarFeedToken(ctx context.Context, userID string) (string, *models.CalendarSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cs, err := calendarSettings(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := helpers.GenerateResetToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	cs.FeedTokenHash = feedTokenHash(token)
+	cs.FeedCreatedAt = &now
+	cs.UpdatedAt = now
+	if err := store.Get().SaveCalendarSettings(ctx, cs); err != nil {
+		return "", nil, err
+	}
+	return token, cs, nil
+}
+
+// DisableCalendarFeed revokes the user's feed token.
+func DisableCalendarFeed(ctx context.Context, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cs, err := calendarSettings(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if cs.FeedTokenHash == "" {
+		return ErrCalendarFeedNotFound
+	}
+	cs.FeedTokenHash = ""
+	cs.FeedCreatedAt = nil
+	cs.UpdatedAt = time.Now()
+	return store.Get().SaveCalendarSettings(ctx, cs)
+}
+
+// CalendarFeed renders the ICS feed the token belongs to: the owner's
+// completed sessions from the last feedSessionDays and all their plans.
+func CalendarFeed(ctx context.Context, token string) (*ical.Component, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if token == "" {
+		return nil, ErrCalendarFeedNotFound
+	}
+	cs, err := store.Get().FindCalendarSettingsByFeedToken(ctx, feedTokenHash(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrCalendarFeedNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buildCalendarFeed(ctx, cs.UserID)
+}
+
+func buildCalendarFeed(ctx context.Context, userID string) (*ical.Component, error) {
+	st := store.Get()
+	now := time.Now()
+	sessions, err := st.SessionsBetween(ctx, userID, now.AddDate(0, 0, -feedSessionDays), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	plans, err := st.ListStudyPlans(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := ical.NewComponent("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", calendarProdID)
+	cal.Add("CALSCALE", "GREGORIAN")
+	cal.Add("METHOD", "PUBLISH")
+	cal.AddText("X-WR-CALNAME", "Study sessions")
+	cal.Add("X-WR-TIMEZONE", UserLocation(ctx, userID).String())
+	cal.Add("REFRESH-INTERVAL", "PT1H", "VALUE", "DURATION")
+	cal.Add("X-PUBLISHED-TTL", "PT1H")
+
+	// Each zone a plan uses needs a VTIMEZONE covering its earliest start
+	// through feedZoneYears ahead.
+	zoneYears := make(map[string]int)
+	var zoneOrder []string
+	for _, p := range plans {
+		if p.Timezone == "" || p.Timezone == "UTC" {
+			continue
+		}
+		y, ok := zoneYears[p.Timezone]
+		if !ok {
+			zoneOrder = append(zoneOrder, p.Timezone)
+		}
+		if !ok || p.StartAt.Year() < y {
+			zoneYears[p.Timezone] = p.StartAt.Year()
+		}
+	}
+	for _, name := range zoneOrder {
+		if loc, err := loadLocation(name); err == nil {
+			from := zoneYears[name]
+			cal.Append(ical.Timezone(loc, from, max(from, now.Year()+feedZoneYears)))
+		}
+	}
+
+	stamp := ical.FormatUTC(now)
+	for i := range sessions {
+		s := &sessions[i]
+		if s.InProgress() || s.Status == models.SessionAbandoned {
+			continue
+		}
+		cal.Append(sessionEvent(s, stamp))
+	}
+	for i := range plans {
+		cal.Append(planEvent(&plans[i], stamp))
+	}
+	return cal, nil
+}
+
+func sessionEvent(s *models.StudySession, stamp string) *ical.Component {
+	end := s.StartedAt.Add(time.Duration(s.DurationMin) * time.Minute)
+	if s.EndedAt != nil {
+		end = *s.EndedAt
+	}
+	summary := "Study session"
+	if s.Goal != "" {
+		summary = "Study: " + s.Goal
+	}
+	desc := []string{
+		"Studied " + strconv.Itoa(s.DurationMin) + " min",
+		"Focus score: " + strconv.Itoa(s.FocusScore),
+	}
+	if s.PlannedMin > 0 {
+		desc = append(desc, "Planned: "+strconv.Itoa(s.PlannedMin)+" min")
+	}
+	if s.PauseCount > 0 {
+		desc = append(desc, "Pauses: "+strconv.Itoa(s.PauseCount))
+	}
+	e := ical.NewComponent("VEVENT")
+	e.Add("UID", s.ID.Hex()+"@study-sessions")
+	e.Add("DTSTAMP", stamp)
+	e.Add("DTSTART", ical.FormatUTC(s.StartedAt))
+	e.Add("DTEND", ical.FormatUTC(end))
+	e.AddText("SUMMARY", summary)
+	e.AddText("DESCRIPTION", strings.Join(desc, "\n"))
+	if s.Goal != "" {
+		e.AddText("CATEGORIES", s.Goal)
+	}
+	e.Add("STATUS", "CONFIRMED")
+	return e
+}
+
+func planEvent(p *models.StudyPlan, stamp string) *ical.Component {
+	summary := "Planned study session"
+	if p.Goal != "" {
+		summary = "Planned: " + p.Goal
+	}
+	e := ical.NewComponent("VEVENT")
+	e.Add("UID", p.ID.Hex()+"@study-plans")
+	e.Add("DTSTAMP", stamp)
+	e.Add("LAST-MODIFIED", ical.FormatUTC(p.UpdatedAt))
+	loc, err := loadLocation(p.Timezone)
+	if err != nil || loc == time.UTC {
+		e.Add("DTSTART", ical.FormatUTC(p.StartAt))
+		loc = nil
+	} else {
+		e.Add("DTSTART", ical.FormatLocal(p.StartAt.In(loc)), "TZID", loc.String())
+	}
+	e.Add("DURATION", ical.FormatDuration(time.Duration(p.PlannedMin)*time.Minute))
+	e.AddText("SUMMARY", summary)
+	if p.Note != "" {
+		e.AddText("DESCRIPTION", p.Note)
+	}
+	if p.Goal != "" {
+		e.AddText("CATEGORIES", p.Goal)
+	}
+	if p.RRule != "" {
+		e.Add("RRULE", p.RRule)
+	}
+	if len(p.ExDates) > 0 {
+		dates := make([]string, len(p.ExDates))
+		for i, t := range p.ExDates {
+			if loc == nil {
+				dates[i] = ical.FormatUTC(t)
+			} else {
+				dates[i] = ical.FormatLocal(t.In(loc))
+			}
+		}
+		if loc == nil {
+			e.Add("EXDATE", strings.Join(dates, ","))
+		} else {
+			e.Add("EXDATE", strings.Join(dates, ","), "TZID", loc.String())
+		}
+	}
+	e.Add("STATUS", "CONFIRMED")
+	return e
+}
+
+// CalendarImportSkip is an event that matched a keyword but was not
+// imported.
+type CalendarImportSkip struct {
+	UID     string `json:"uid,omitempty"`
+	Summary string `json:"summary,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// CalendarImport reports what ImportCalendar did.
+type CalendarImport struct {
+	Events   int                  `json:"events"`  // VEVENTs in the file
+	Matched  int                  `json:"matched"` // events matching an import keyword
+	Created  int                  `json:"created"`
+	Updated  int                  `json:"updated"`
+	Removed  int                  `json:"removed"` // plans whose event is now cancelled
+	Skipped  []CalendarImportSkip `json:"skipped"`
+	Warnings []string             `json:"warnings"`
+}
+
+// ImportCalendar turns the events of an ICS file whose summary or
+// categories contain one of the user's import keywords into study plans.
+// Recurring events become recurring plans with their EXDATEs; a moved or
+// cancelled instance (RECURRENCE-ID) is skipped on its series and, unless
+// cancelled, imported as a one-off plan. Plans are keyed by event UID, so
+// importing the file again updates them. Times in a TZID keep their wall
+// clock in that zone; floating times are read in the user's timezone.
+func ImportCalendar(ctx context.Context, userID string, r io.Reader) (*CalendarImport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	st := store.Get()
+	cs, err := calendarSettings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cs.ImportKeywords) == 0 {
+		return nil, ErrNoImportKeywords
+	}
+	cal, err := ical.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	events, bad := ical.Events(cal, UserLocation(ctx, userID))
+	res := &CalendarImport{Events: len(events) + len(bad), Skipped: []CalendarImportSkip{}, Warnings: []string{}}
+	for _, b := range bad {
+		res.Skipped = append(res.Skipped, CalendarImportSkip{UID: b.UID, Summary: b.Summary, Reason: b.Err.Error()})
+	}
+
+	existing, err := st.ListStudyPlans(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	byUID := make(map[string]*models.StudyPlan)
+	for i := range existing {
+		if existing[i].ExternalUID != "" {
+			byUID[existing[i].ExternalUID] = &existing[i]
+		}
+	}
+	catalog, err := st.ListGoals(ctx, userID, userOrg(ctx, userID), false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Overridden instances are left out of their series.
+	masters := make(map[string]bool)
+	exdates := make(map[string][]time.Time)
+	for _, e := range events {
+		if e.RecurrenceID != nil {
+			exdates[e.UID] = append(exdates[e.UID], *e.RecurrenceID)
+		} else {
+			masters[e.UID] = importKeyword(&e, cs.ImportKeywords) != ""
+		}
+	}
+
+	for i := range events {
+		e := &events[i]
+		keyword := importKeyword(e, cs.ImportKeywords)
+		if keyword == "" && !(e.RecurrenceID != nil && masters[e.UID]) {
+			continue
+		}
+		res.Matched++
+		uid := e.UID
+		if e.RecurrenceID != nil {
+			uid += "#" + ical.FormatUTC(*e.RecurrenceID)
+		}
+		skip := func(reason string) {
+			res.Skipped = append(res.Skipped, CalendarImportSkip{UID: uid, Summary: e.Summary, Reason: reason})
+		}
+		switch {
+		case e.Status == "CANCELLED":
+			if p := byUID[uid]; p != nil {
+				if err := st.DeleteStudyPlan(ctx, p.ID.Hex()); err != nil && !errors.Is(err, store.ErrNotFound) {
+					return nil, err
+				}
+				res.Removed++
+			}
+			continue
+		case e.AllDay:
+			skip("all-day events are not study sessions")
+			continue
+		}
+		if e.RDates > 0 {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("%s: RDATE is not supported; only the RRULE occurrences were imported", uid))
+		}
+
+		in := PlanInput{
+			StartAt:     e.Start,
+			PlannedMin:  int(e.End.Sub(e.Start).Minutes()),
+			Note:        e.Summary,
+			Timezone:    e.Start.Location().String(),
+			ExternalUID: uid,
+		}
+		if e.RecurrenceID == nil {
+			in.RRule = e.RRule
+			in.ExDates = append(e.ExDates, exdates[e.UID]...)
+		}
+		if e.Zone != nil {
+			if name := e.Zone.Name(); name != "" {
+				in.Timezone = name
+			} else {
+				in.Timezone = "UTC"
+				if in.RRule != "" {
+					res.Warnings = append(res.Warnings, fmt.Sprintf("%s: timezone %q is not a known zone; occurrences keep the first one's UTC time", uid, e.Zone.TZID))
+				}
+			}
+		}
+		if g := findGoalByName(catalog, e.Summary); g != nil {
+			in.GoalID = g.ID.Hex()
+		} else if g := findGoalByName(catalog, keyword); g != nil {
+			in.GoalID = g.ID.Hex()
+		}
+
+		created, err := saveImportedPlan(ctx, userID, byUID[uid], in)
+		switch {
+		case errors.Is(err, ErrInvalidPlan) || errors.Is(err, ErrGoalNotFound):
+			skip(err.Error())
+		case err != nil:
+			return nil, err
+		case created:
+			res.Created++
+		default:
+			res.Updated++
+		}
+	}
+	return res, nil
+}
+
+// importKeyword returns the first keyword found in the event's summary or
+// categories, ignoring case, or "".
+func importKeyword(e *ical.Event, keywords []string) string {
+	fields := append([]string{e.Summary}, e.Categories...)
+	for _, k := range keywords {
+		lk := strings.ToLower(k)
+		for _, f := range fields {
+			if strings.Contains(strings.ToLower(f), lk) {
+				return k
+			}
+		}
+	}
+	return ""
+}
+
+func saveImportedPlan(ctx context.Context, userID string, existing *models.StudyPlan, in PlanInput) (bool, error) {
+	if err := validatePlan(ctx, userID, &in); err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if existing == nil {
+		p := &models.StudyPlan{ID: primitive.NewObjectID(), UserID: userID, CreatedAt: now}
+		setPlan(p, in)
+		p.UpdatedAt = now
+		return true, store.Get().CreateStudyPlan(ctx, p)
+	}
+	setPlan(existing, in)
+	existing.UpdatedAt = now
+	return false, store.Get().UpdateStudyPlan(ctx, existing)
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"authentication/ical"
+	"authentication/models"
+	"authentication/store"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type feedStore struct {
+	store.Store
+	sessions []models.StudySession
+	plans    []models.StudyPlan
+}
+
+func (s *feedStore) FindUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return &models.User{User_id: userID, Timezone: "Europe/Berlin"}, nil
+}
+
+func (s *feedStore) SessionsBetween(ctx context.Context, userID string, from, to time.Time) ([]models.StudySession, error) {
+	return s.sessions, nil
+}
+
+func (s *feedStore) ListStudyPlans(ctx context.Context, userID string) ([]models.StudyPlan, error) {
+	return s.plans, nil
+}
+
+// TestCalendarFeedRoundTrip reads the generated feed back with the ical
+// parser. The plan's TZID is renamed to one no zone database knows, so
+// its times can only come out right through the feed's own VTIMEZONE.
+func TestCalendarFeedRoundTrip(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skip(err)
+	}
+	now := time.Now().UTC().Truncate(time.Minute)
+	ended := now.Add(-2 * time.Hour)
+	session := models.StudySession{
+		ID:          primitive.NewObjectID(),
+		UserID:      "u1",
+		Goal:        "maths",
+		StartedAt:   ended.Add(-50 * time.Minute),
+		EndedAt:     &ended,
+		DurationMin: 45,
+		FocusScore:  80,
+	}
+	plan := models.StudyPlan{
+		ID:         primitive.NewObjectID(),
+		UserID:     "u1",
+		StartAt:    time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC), // Monday 09:00 in Berlin
+		PlannedMin: 90,
+		RRule:      "FREQ=WEEKLY;BYDAY=MO",
+		ExDates:    []time.Time{time.Date(2026, 3, 30, 7, 0, 0, 0, time.UTC)}, // 09:00 summer time
+		Timezone:   "Europe/Berlin",
+		Note:       "Chapter 4, exercises; bring notes",
+	}
+	store.Set(&feedStore{
+		sessions: []models.StudySession{session, {ID: primitive.NewObjectID(), Status: models.SessionActive, StartedAt: now}},
+		plans:    []models.StudyPlan{plan},
+	})
+
+	cal, err := buildCalendarFeed(context.Background(), "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cal.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	feed := strings.ReplaceAll(buf.String(), "Europe/Berlin", "Study Zone")
+	back, err := ical.Parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, bad := ical.Events(back, time.UTC)
+	if len(bad) > 0 {
+		t.Fatalf("bad events: %+v", bad)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want the finished session and the plan", len(events))
+	}
+
+	for _, e := range events {
+		switch e.UID {
+		case session.ID.Hex() + "@study-sessions":
+			if !e.Start.Equal(session.StartedAt) || !e.End.Equal(ended) || e.Summary != "Study: maths" {
+				t.Errorf("session event %+v", e)
+			}
+		case plan.ID.Hex() + "@study-plans":
+			if e.Zone == nil || e.Zone.Name() != "" {
+				t.Fatalf("plan zone %+v, want the feed's VTIMEZONE only", e.Zone)
+			}
+			if !e.Start.Equal(plan.StartAt) || e.End.Sub(e.Start) != 90*time.Minute {
+				t.Errorf("plan starts %v ends %v", e.Start, e.End)
+			}
+			if e.RRule != plan.RRule || e.Description != plan.Note {
+				t.Errorf("plan rule %q description %q", e.RRule, e.Description)
+			}
+			if len(e.ExDates) != 1 || !e.ExDates[0].Equal(plan.ExDates[0]) {
+				t.Errorf("plan exdates %v, want %v", e.ExDates, plan.ExDates)
+			}
+		default:
+			t.Errorf("unexpected event %s", e.UID)
+		}
+	}
+}
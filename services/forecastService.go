@@ -0,0 +1,124 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"authentication/trend"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrNotEnoughHistory = trend.ErrNotEnoughHistory
+
+// forecastHorizon is how many days ahead burnout forecasts reach.
+const forecastHorizon = 7
+
+// BurnoutForecast projects the user's fatigue index and burnout probability
+// over the next forecastHorizon days from their daily scores.
+func BurnoutForecast(ctx context.Context, userID string) (*trend.FatigueForecast, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	asOf := localDay(time.Now(), UserLocation(ctx, userID))
+	from := asOf.AddDate(0, 0, -(trend.ForecastHistoryDays - 1))
+	scores, err := fatigueScoresBetween(ctx, userID, from, asOf.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	model := scoringModelFor(ctx, userID)
+	_, fatigue := scorers(model)
+	return trend.Forecast(scores, asOf, forecastHorizon, func(fatigueIndex float64) float64 {
+		return fatigue.BurnoutProbability(model.Params, fatigueIndex)
+	})
+}
+
+// ProjectedRisk is a user whose forecast burnout reaches the threshold.
+type ProjectedRisk struct {
+	UserID      string     `json:"user_id"`
+	OrgID       string     `json:"org_id,omitempty"`
+	LastBurnout float64    `json:"last_burnout_probability"`
+	PeakDate    time.Time  `json:"peak_date"`
+	PeakBurnout trend.Band `json:"peak_burnout"`
+}
+
+// Projected-risk listings forecast one page of users per request on a
+// small worker pool, and give up when the request's deadline passes.
+const (
+	forecastUserPage = 200
+	forecastWorkers  = 8
+	forecastDeadline = 30 * time.Second
+)
+
+// ProjectedHighRiskUsers forecasts one page of users (in orgID when set,
+// after cursor) and returns those whose projected burnout reaches
+// threshold within the horizon, highest first and at most limit of them,
+// with the cursor of the next page of users. Users without enough recent
+// scores are skipped.
+func ProjectedHighRiskUsers(ctx context.Context, orgID string, threshold float64, limit int, cursor string) ([]ProjectedRisk, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, forecastDeadline)
+	defer cancel()
+	users, next, err := store.Get().ListUsers(ctx, store.UserFilter{OrgID: orgID}, store.ListOptions{Limit: forecastUserPage, Cursor: cursor})
+	if err != nil {
+		return nil, "", err
+	}
+
+	work := make(chan *models.User)
+	var (
+		mu       sync.Mutex
+		out      = []ProjectedRisk{}
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < forecastWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range work {
+				f, err := BurnoutForecast(ctx, u.User_id)
+				if errors.Is(err, ErrNotEnoughHistory) {
+					continue
+				}
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				} else if f.PeakBurnout.Value >= threshold {
+					out = append(out, ProjectedRisk{
+						UserID:      u.User_id,
+						OrgID:       u.Org_id,
+						LastBurnout: f.LastBurnout,
+						PeakDate:    f.PeakDate,
+						PeakBurnout: f.PeakBurnout,
+					})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range users {
+		select {
+		case work <- &users[i]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return nil, "", firstErr
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].PeakBurnout.Value > out[j].PeakBurnout.Value })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, next, nil
+}
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/scoring"
+	"authentication/store"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrGoalNotFound = errors.New("goal not found")
+	ErrInvalidGoal  = errors.New("invalid goal")
+	ErrGoalExists   = errors.New("a goal with that name already exists")
+	ErrGoalReadOnly = errors.New("organization goals can only be changed by an admin")
+)
+
+const (
+	goalMinTargetMin    = 5
+	goalMaxTargetMin    = 480
+	goalMaxWeeklyMin    = 7 * 24 * 60
+	unspecifiedGoalName = "unspecified"
+)
+
+var goalColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// GoalInput is the editable part of a Goal.
+type GoalInput struct {
+	Name            string
+	Category        string
+	Color           string
+	TargetMin       int
+	WeeklyTargetMin int
+	Aliases         []string
+	Archived        bool
+}
+
+// normalizeGoal folds a free-text goal so spellings like "Problem-Solving"
+// and "problem_solving" compare equal.
+func normalizeGoal(goal string) string {
+	goal = strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(goal))
+	return strings.Join(strings.Fields(goal), " ")
+}
+
+func validateGoal(in *GoalInput) error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Category = strings.ToLower(strings.TrimSpace(in.Category))
+	in.Color = strings.ToUpper(strings.TrimSpace(in.Color))
+	switch {
+	case in.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidGoal)
+	case len(in.Name) > 64:
+		return fmt.Errorf("%w: name must be at most 64 characters", ErrInvalidGoal)
+	case normalizeGoal(in.Name) == unspecifiedGoalName:
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidGoal, in.Name)
+	case in.Color != "" && !goalColorPattern.MatchString(in.Color):
+		return fmt.Errorf("%w: color must look like #RRGGBB", ErrInvalidGoal)
+	case in.TargetMin < goalMinTargetMin || in.TargetMin > goalMaxTargetMin:
+		return fmt.Errorf("%w: target_min must be between %d and %d", ErrInvalidGoal, goalMinTargetMin, goalMaxTargetMin)
+	case in.WeeklyTargetMin < 0 || in.WeeklyTargetMin > goalMaxWeeklyMin:
+		return fmt.Errorf("%w: weekly_target_min must be between 0 and %d", ErrInvalidGoal, goalMaxWeeklyMin)
+	}
+	seen := make(map[string]bool)
+	aliases := in.Aliases[:0]
+	for _, a := range in.Aliases {
+		a = normalizeGoal(a)
+		if a == "" || seen[a] {
+			continue
+		}
+		seen[a] = true
+		aliases = append(aliases, a)
+	}
+	in.Aliases = aliases
+	return nil
+}
+
+// userOrg returns the user's organization, or "" if they have none.
+func userOrg(ctx context.Context, userID string) string {
+	u, err := store.Get().FindUserByID(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	return u.Org_id
+}
+
+// ListGoals returns the goals userID can use: their own and their
+// organization's.
+func ListGoals(ctx context.Context, userID string, includeArchived bool) ([]models.Goal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListGoals(ctx, userID, userOrg(ctx, userID), includeArchived)
+}
+
+// ListOrgGoals returns the goals shared with orgID.
+func ListOrgGoals(ctx context.Context, orgID string, includeArchived bool) ([]models.Goal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListGoals(ctx, "", orgID, includeArchived)
+}
+
+// checkGoalName rejects a name (or alias) already used by another unarchived
+// goal of the same owner.
+func checkGoalName(ctx context.Context, g *models.Goal) error {
+	existing, err := store.Get().ListGoals(ctx, g.UserID, g.OrgID, false)
+	if err != nil {
+		return err
+	}
+	names := append([]string{normalizeGoal(g.Name)}, g.Aliases...)
+	for _, other := range existing {
+		if other.ID == g.ID || other.UserID != g.UserID || other.OrgID != g.OrgID {
+			continue
+		}
+		for _, n := range names {
+			if goalMatches(&other, n) {
+				return fmt.Errorf("%w: %q", ErrGoalExists, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func goalMatches(g *models.Goal, normalized string) bool {
+	if normalizeGoal(g.Name) == normalized {
+		return true
+	}
+	for _, a := range g.Aliases {
+		if a == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateGoal adds a goal owned by userID, or shared with orgID when userID
+// is empty.
+func CreateGoal(ctx context.Context, userID, orgID string, in GoalInput) (*models.Goal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := validateGoal(&in); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	g := &models.Goal{
+		ID:              primitive.NewObjectID(),
+		Name:            in.Name,
+		Category:        in.Category,
+		Color:           in.Color,
+		TargetMin:       in.TargetMin,
+		WeeklyTargetMin: in.WeeklyTargetMin,
+		Aliases:         in.Aliases,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if userID != "" {
+		g.UserID = userID
+	} else {
+		g.OrgID = orgID
+	}
+	if err := checkGoalName(ctx, g); err != nil {
+		return nil, err
+	}
+	if err := store.Get().CreateGoal(ctx, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// editableGoal loads goalID for a change by userID. Users change their own
+// goals; organization goals need an admin.
+func editableGoal(ctx context.Context, userID string, admin bool, goalID string) (*models.Goal, error) {
+	g, err := store.Get().FindGoal(ctx, goalID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrGoalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if g.UserID != "" {
+		if g.UserID != userID {
+			return nil, ErrGoalNotFound
+		}
+		return g, nil
+	}
+	if !admin {
+		if g.OrgID != userOrg(ctx, userID) {
+			return nil, ErrGoalNotFound
+		}
+		return nil, ErrGoalReadOnly
+	}
+	return g, nil
+}
+
+// UpdateGoal replaces the goal's editable fields. Sessions keep the name
+// they were recorded under; they are matched to the goal by ID.
+func UpdateGoal(ctx context.Context, userID string, admin bool, goalID string, in GoalInput) (*models.Goal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	g, err := editableGoal(ctx, userID, admin, goalID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateGoal(&in); err != nil {
+		return nil, err
+	}
+	g.Name = in.Name
+	g.Category = in.Category
+	g.Color = in.Color
+	g.TargetMin = in.TargetMin
+	g.WeeklyTargetMin = in.WeeklyTargetMin
+	g.Aliases = in.Aliases
+	g.Archived = in.Archived
+	g.UpdatedAt = time.Now()
+	if !g.Archived {
+		if err := checkGoalName(ctx, g); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.Get().UpdateGoal(ctx, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ArchiveGoal hides the goal from new sessions. Goals are never deleted so
+// existing sessions keep their reference.
+func ArchiveGoal(ctx context.Context, userID string, admin bool, goalID string) (*models.Goal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	g, err := editableGoal(ctx, userID, admin, goalID)
+	if err != nil {
+		return nil, err
+	}
+	g.Archived = true
+	g.UpdatedAt = time.Now()
+	if err := store.Get().UpdateGoal(ctx, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// findGoalByName matches name against the goals in catalog, preferring the
+// user's own goals over their organization's.
+func findGoalByName(catalog []models.Goal, name string) *models.Goal {
+	n := normalizeGoal(name)
+	if n == "" {
+		return nil
+	}
+	var shared *models.Goal
+	for i := range catalog {
+		g := &catalog[i]
+		if !goalMatches(g, n) {
+			continue
+		}
+		if g.UserID != "" {
+			return g
+		}
+		if shared == nil {
+			shared = g
+		}
+	}
+	return shared
+}
+
+// applyGoal links s to a catalog goal: goalID if given, otherwise the goal
+// s.Goal names. A name that matches nothing stays free text.
+func applyGoal(ctx context.Context, s *models.StudySession, goalID string) error {
+	if goalID != "" {
+		g, err := store.Get().FindGoal(ctx, goalID)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrGoalNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if g.Archived || (g.UserID != s.UserID && (g.OrgID == "" || g.OrgID != userOrg(ctx, s.UserID))) {
+			return ErrGoalNotFound
+		}
+		s.GoalID, s.Goal = g.ID.Hex(), g.Name
+		return nil
+	}
+	catalog, err := store.Get().ListGoals(ctx, s.UserID, userOrg(ctx, s.UserID), false)
+	if err != nil {
+		return err
+	}
+	if g := findGoalByName(catalog, s.Goal); g != nil {
+		s.GoalID, s.Goal = g.ID.Hex(), g.Name
+	}
+	return nil
+}
+
+// GoalMigration counts what MigrateLegacyGoals did for one user.
+type GoalMigration struct {
+	UserID          string `json:"user_id"`
+	GoalsCreated    int    `json:"goals_created"`
+	SessionsLinked  int    `json:"sessions_linked"`
+	SessionsSkipped int    `json:"sessions_skipped"`
+}
+
+// MigrateLegacyGoals moves the user's free-text goals into the catalog.
+// Each distinct spelling is matched to an existing goal by name or alias,
+// or else a user goal is created for it with the spelling as an alias and
+// the old built-in default as its target. Sessions are then linked by ID
+// and baselines relearned under the goal. Sessions still in progress and
+// "unspecified" ones are left alone. Running it again is a no-op.
+func MigrateLegacyGoals(ctx context.Context, userID string) (GoalMigration, error) {
+	r := GoalMigration{UserID: userID}
+	st := store.Get()
+	sessions, err := st.SessionsBetween(ctx, userID, time.Time{}, time.Now().Add(time.Minute))
+	if err != nil {
+		return r, err
+	}
+	catalog, err := st.ListGoals(ctx, userID, userOrg(ctx, userID), false)
+	if err != nil {
+		return r, err
+	}
+
+	oldKeys := make(map[string]bool)
+	linked := make(map[string]*models.StudySession)
+	for i := range sessions {
+		s := &sessions[i]
+		if s.GoalID != "" {
+			continue
+		}
+		name := normalizeGoal(s.Goal)
+		if name == "" || name == unspecifiedGoalName || s.InProgress() {
+			r.SessionsSkipped++
+			continue
+		}
+		g := findGoalByName(catalog, name)
+		if g == nil {
+			now := time.Now()
+			catalog = append(catalog, models.Goal{
+				ID:        primitive.NewObjectID(),
+				UserID:    userID,
+				Name:      goalDisplayName(name),
+				TargetMin: scoring.DefaultBaseline(goalKey(s.Goal), "stopwatch"),
+				Aliases:   []string{name},
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+			g = &catalog[len(catalog)-1]
+			if err := st.CreateGoal(ctx, g); err != nil {
+				return r, err
+			}
+			r.GoalsCreated++
+		}
+		oldKeys[goalKey(s.Goal)] = true
+		s.GoalID, s.Goal = g.ID.Hex(), g.Name
+		if err := st.ReplaceSession(ctx, s); err != nil {
+			return r, err
+		}
+		r.SessionsLinked++
+		linked[s.GoalID] = s
+	}
+
+	for key := range oldKeys {
+		if err := st.DeleteGoalBaseline(ctx, userID, key); err != nil {
+			return r, err
+		}
+	}
+	for _, s := range linked {
+		if _, err := RefreshGoalBaseline(ctx, s); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// goalDisplayName turns a normalized legacy goal into a catalog name,
+// e.g. "problem solving" -> "Problem solving".
+func goalDisplayName(normalized string) string {
+	if normalized == "" {
+		return normalized
+	}
+	return strings.ToUpper(normalized[:1]) + normalized[1:]
+}
+
+// MigrateAllLegacyGoals runs MigrateLegacyGoals for every user in orgID
+// (all users when empty), reporting each result to progress.
+func MigrateAllLegacyGoals(ctx context.Context, orgID string, progress func(GoalMigration)) error {
+	return store.Get().EachUser(ctx, orgID, "", func(u *models.User) error {
+		r, err := MigrateLegacyGoals(ctx, u.User_id)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", u.User_id, err)
+		}
+		progress(r)
+		return nil
+	})
+}
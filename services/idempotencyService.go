@@ -0,0 +1,119 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrIdempotencyInFlight = errors.New("a request with this Idempotency-Key is still being processed")
+	ErrIdempotencyMismatch = errors.New("this Idempotency-Key was already used for a different request")
+)
+
+func idempotencyID(userID, key string) string {
+	return userID + ":" + key
+}
+
+// idempotencyLease is how long a claim stays locked to the request that
+// made it. A request still unfinished by then is taken to have died with
+// its server, and a retry may claim the key again.
+const idempotencyLease = 2 * time.Minute
+
+// BeginIdempotentRequest claims key for the user's request, identified by
+// requestHash, until ttl from now. It returns nil when the request should
+// go ahead, or the stored response when the key was already used for the
+// same request.
+func BeginIdempotentRequest(ctx context.Context, userID, key, requestHash string, ttl time.Duration) (*models.IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	st := store.Get()
+	now := time.Now()
+	r := &models.IdempotencyRecord{
+		ID:          idempotencyID(userID, key),
+		UserID:      userID,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+		LockedUntil: now.Add(idempotencyLease),
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		err := st.ClaimIdempotencyKey(ctx, r)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, store.ErrDuplicate) {
+			return nil, err
+		}
+		prev, err := st.FindIdempotencyKey(ctx, r.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// A key may be claimed again once it has expired, even if the
+		// purge has not removed it yet, or once the request holding it
+		// has outlived its lease.
+		switch {
+		case !prev.ExpiresAt.After(now):
+		case prev.RequestHash != requestHash:
+			return nil, ErrIdempotencyMismatch
+		case prev.Status == 0 && prev.LockedUntil.After(now):
+			return nil, ErrIdempotencyInFlight
+		case prev.Status != 0:
+			return prev, nil
+		}
+		err = st.TakeOverIdempotencyKey(ctx, r, now)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, store.ErrDuplicate) {
+			return nil, err
+		}
+	}
+	return nil, ErrIdempotencyInFlight
+}
+
+// FinishIdempotentRequest stores the response to a claimed key. Server
+// errors release the key instead so the client can retry.
+func FinishIdempotentRequest(ctx context.Context, userID, key string, status int, contentType string, body []byte) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	id := idempotencyID(userID, key)
+	var err error
+	if status >= 500 {
+		err = store.Get().DeleteIdempotencyKey(ctx, id)
+	} else {
+		err = store.Get().SaveIdempotencyResponse(ctx, &models.IdempotencyRecord{
+			ID: id, Status: status, ContentType: contentType, Body: body,
+		})
+	}
+	if err != nil {
+		log.Printf("idempotency key %s: %v", id, err)
+	}
+}
+
+// StartIdempotencyPurgeJob removes expired idempotency keys every interval.
+func StartIdempotencyPurgeJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := store.Get().DeleteExpiredIdempotencyKeys(ctx, time.Now())
+				if err != nil {
+					log.Printf("idempotency keys: %v", err)
+				} else if n > 0 {
+					log.Printf("idempotency keys: purged %d expired key(s)", n)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"authentication/importer"
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidImport = importer.ErrInvalid
+
+// SessionImportOptions says how to read an import. A Mapping wins over
+// the Preset; Timezone, if set, is used for times without an offset
+// instead of the user's own zone.
+type SessionImportOptions struct {
+	Format   string
+	Preset   string
+	Mapping  *importer.Mapping
+	Timezone string
+	DryRun   bool
+}
+
+// SessionImport reports what ImportSessions did, or would do on a dry run.
+type SessionImport struct {
+	Rows             int                 `json:"rows"`
+	Valid            int                 `json:"valid"`
+	Duplicates       int                 `json:"duplicates"`
+	Created          int                 `json:"created"`
+	Resumed          int                 `json:"resumed"` // stored but left unscored by an earlier import
+	SessionsRescored int                 `json:"sessions_rescored"`
+	DaysRolled       int                 `json:"days_rolled"`
+	From             *time.Time          `json:"from,omitempty"`
+	To               *time.Time          `json:"to,omitempty"`
+	Errors           []importer.RowError `json:"errors"`
+	DryRun           bool                `json:"dry_run"`
+}
+
+// ImportSessions creates finished sessions from another tracker's export,
+// keeping their original times. Rows that duplicate each other or a
+// stored session (same start minute, length within a minute) are skipped.
+// Once stored, the imported sessions and everything after them are scored
+// in chronological order and the daily fatigue scores re-rolled. Sessions
+// are stored before they are scored, so if an import fails part way the
+// report says how many were created, and importing the same file again
+// scores the ones it left unscored.
+func ImportSessions(ctx context.Context, userID string, r io.Reader, opts SessionImportOptions) (*SessionImport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	m, ok := importer.Presets[opts.Preset]
+	switch {
+	case opts.Mapping != nil:
+		m = *opts.Mapping
+	case opts.Preset == "":
+		m = importer.Presets["generic"]
+	case !ok:
+		return nil, fmt.Errorf("%w: unknown preset %q, use one of %v", ErrInvalidImport, opts.Preset, importer.PresetNames())
+	}
+	loc := UserLocation(ctx, userID)
+	if opts.Timezone != "" {
+		var err error
+		if loc, err = loadLocation(opts.Timezone); err != nil {
+			return nil, err
+		}
+	}
+	rows, bad, err := importer.Read(r, opts.Format, m, loc)
+	if err != nil {
+		return nil, err
+	}
+	res := &SessionImport{Rows: len(rows) + len(bad), Errors: bad, DryRun: opts.DryRun}
+	if res.Errors == nil {
+		res.Errors = []importer.RowError{}
+	}
+
+	now := time.Now()
+	valid := rows[:0]
+	for _, row := range rows {
+		if row.StartedAt.Add(time.Duration(row.DurationMin) * time.Minute).After(now) {
+			res.Errors = append(res.Errors, importer.RowError{Line: row.Line, Error: "ends in the future"})
+			continue
+		}
+		valid = append(valid, row)
+	}
+	sort.SliceStable(valid, func(i, j int) bool { return valid[i].StartedAt.Before(valid[j].StartedAt) })
+	sort.SliceStable(res.Errors, func(i, j int) bool { return res.Errors[i].Line < res.Errors[j].Line })
+	res.Valid = len(valid)
+	if len(valid) == 0 {
+		return res, nil
+	}
+
+	st := store.Get()
+	first, last := valid[0].StartedAt, valid[len(valid)-1].StartedAt
+	existing, err := st.SessionsBetween(ctx, userID, first.Add(-time.Minute), last.Add(time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64][]int)
+	isDuplicate := func(start time.Time, durationMin int) bool {
+		for _, d := range seen[start.Unix()/60] {
+			if d-durationMin <= 1 && durationMin-d <= 1 {
+				return true
+			}
+		}
+		return false
+	}
+	var resumeFrom *time.Time
+	for i, s := range existing {
+		k := s.StartedAt.Unix() / 60
+		seen[k] = append(seen[k], s.DurationMin)
+		if unscored(&existing[i]) {
+			res.Resumed++
+			if resumeFrom == nil {
+				resumeFrom = &existing[i].StartedAt
+			}
+		}
+	}
+	fresh := valid[:0]
+	for _, row := range valid {
+		if isDuplicate(row.StartedAt, row.DurationMin) {
+			res.Duplicates++
+			continue
+		}
+		k := row.StartedAt.Unix() / 60
+		seen[k] = append(seen[k], row.DurationMin)
+		fresh = append(fresh, row)
+	}
+	if (len(fresh) == 0 && resumeFrom == nil) || opts.DryRun {
+		return res, nil
+	}
+
+	catalog, err := st.ListGoals(ctx, userID, userOrg(ctx, userID), false)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range fresh {
+		end := row.StartedAt.Add(time.Duration(row.DurationMin) * time.Minute)
+		s := &models.StudySession{
+			ID:          primitive.NewObjectID(),
+			UserID:      userID,
+			Mode:        row.Mode,
+			Goal:        row.Goal,
+			PlannedMin:  row.PlannedMin,
+			StartedAt:   row.StartedAt,
+			EndedAt:     &end,
+			DurationMin: row.DurationMin,
+			PauseCount:  row.PauseCount,
+			SelfRating:  row.SelfRating,
+			SelfOnTask:  row.SelfOnTask,
+			Status:      models.SessionCompleted,
+			CreatedAt:   end,
+		}
+		if g := findGoalByName(catalog, s.Goal); g != nil {
+			s.GoalID, s.Goal = g.ID.Hex(), g.Name
+		}
+		if s.Goal == "" {
+			s.Goal = "unspecified"
+		}
+		if err := st.CreateSession(ctx, s); err != nil {
+			return res, err
+		}
+		res.Created++
+		savePlanMatch(ctx, matchPlannedSession(ctx, s))
+	}
+
+	var rescoreFrom time.Time
+	if len(fresh) > 0 {
+		rescoreFrom = fresh[0].StartedAt
+	}
+	if resumeFrom != nil && (rescoreFrom.IsZero() || resumeFrom.Before(rescoreFrom)) {
+		rescoreFrom = *resumeFrom
+	}
+	from, to, rc := rescoreBackfill(ctx, userID, rescoreFrom)
+	res.From, res.To = &from, &to
+	res.SessionsRescored, res.DaysRolled = rc.sessionsChecked, rc.daysChecked
+	if rc.err != nil {
+		return res, fmt.Errorf("sessions imported but scoring failed: %w", rc.err)
+	}
+	return res, nil
+}
+
+// unscored reports whether s is a finished session stored by an import or
+// batch upload that failed before scoring it.
+func unscored(s *models.StudySession) bool {
+	return !s.InProgress() && s.ModelVersion == ""
+}
+
+// rescoreBackfill runs after sessions older than some of the user's were
+// stored. New history changes the consistency and baselines of every later
+// session, so sessions from the day of first up to today are scored in
+// chronological order and their days re-rolled. Each keeps the model it
+// was scored with; new sessions get the user's current one.
+func rescoreBackfill(ctx context.Context, userID string, first time.Time) (from, to time.Time, r userRecompute) {
+	loc := UserLocation(ctx, userID)
+	from = localDay(first, loc).AddDate(0, 0, -1)
+	to = localDay(time.Now(), loc).AddDate(0, 0, 2)
+	return from, to, recomputeUser(ctx, keepingModels(ctx, userID), userID, from, to, false)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type importStore struct {
+	store.Store
+	existing []models.StudySession
+}
+
+func (s *importStore) FindUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return nil, store.ErrNotFound
+}
+
+func (s *importStore) SessionsBetween(ctx context.Context, userID string, from, to time.Time) ([]models.StudySession, error) {
+	var out []models.StudySession
+	for _, sess := range s.existing {
+		if !sess.StartedAt.Before(from) && sess.StartedAt.Before(to) {
+			out = append(out, sess)
+		}
+	}
+	return out, nil
+}
+
+// TestImportDuplicates runs dry imports: a row is a duplicate when another
+// row or a stored session starts in the same minute and its length is
+// within a minute of it.
+func TestImportDuplicates(t *testing.T) {
+	stored := models.StudySession{
+		StartedAt:    time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+		DurationMin:  60,
+		Status:       models.SessionCompleted,
+		ModelVersion: "v1",
+	}
+	tests := []struct {
+		name string
+		rows []string // started_at,duration_min
+		want int
+	}{
+		{"same start, one minute longer than stored", []string{"2026-03-02T09:00:30Z,61"}, 1},
+		{"same start, two minutes shorter than stored", []string{"2026-03-02T09:00:00Z,58"}, 0},
+		{"next minute as stored", []string{"2026-03-02T09:01:00Z,60"}, 0},
+		{"repeated within the file", []string{"2026-03-03T18:00:00Z,30", "2026-03-03T18:00:45Z,31"}, 1},
+		{"same start in the file, other length", []string{"2026-03-03T18:00:00Z,30", "2026-03-03T18:00:00Z,45"}, 0},
+		{"both stored and repeated", []string{"2026-03-02T09:00:00Z,60", "2026-03-02T09:00:10Z,60"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.Set(&importStore{existing: []models.StudySession{stored}})
+			csv := "started_at,duration_min\n" + strings.Join(tt.rows, "\n") + "\n"
+			res, err := ImportSessions(context.Background(), "u1", strings.NewReader(csv), SessionImportOptions{DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Valid != len(tt.rows) || res.Duplicates != tt.want {
+				t.Fatalf("valid %d duplicates %d (errors %+v), want %d and %d", res.Valid, res.Duplicates, res.Errors, len(tt.rows), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"authentication/helpers"
+	"authentication/models"
+	"authentication/scoring"
+	"authentication/store"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrSessionNotFound   = errors.New("study session not found")
+	ErrSessionInProgress = errors.New("another study session is already in progress")
+	ErrSessionState      = errors.New("study session cannot change state that way")
+)
+
+// StartLiveSession opens a server-tracked session for the user. Only one
+// session may be active or paused at a time.
+func StartLiveSession(ctx context.Context, userID, mode, goalID, goal string, plannedMin int) (*models.StudySession, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	open, err := store.Get().FindOpenSession(ctx, userID)
+	if err == nil {
+		return open, ErrSessionInProgress
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	now := time.Now()
+	s := &models.StudySession{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		Mode:       strings.ToLower(mode),
+		Goal:       goal,
+		PlannedMin: plannedMin,
+		StartedAt:  now,
+		Status:     models.SessionActive,
+		UpdatedAt:  &now,
+		CreatedAt:  now,
+	}
+	if err := applyGoal(ctx, s, goalID); err != nil {
+		return nil, err
+	}
+	// Another start may have won the race since the check above.
+	if err := store.Get().StartSession(ctx, s); errors.Is(err, store.ErrDuplicate) {
+		open, _ := store.Get().FindOpenSession(ctx, userID)
+		return open, ErrSessionInProgress
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetOpenSession returns the user's active or paused session.
+func GetOpenSession(ctx context.Context, userID string) (*models.StudySession, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	s, err := store.Get().FindOpenSession(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	return s, err
+}
+
+// updateOwnedSession loads the user's in-progress session, applies change
+// and saves it, provided nothing else changed the session in between. On
+// such a race it starts over from the stored session, so change always
+// sees the current state.
+func updateOwnedSession(ctx context.Context, userID, sessionID string, change func(s *models.StudySession, now time.Time) error) (*models.StudySession, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for attempt := 0; ; attempt++ {
+		s, err := store.Get().FindSession(ctx, sessionID)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && s.UserID != userID) {
+			return nil, ErrSessionNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !s.InProgress() {
+			return s, ErrSessionState
+		}
+		status, updatedAt := s.Status, s.UpdatedAt
+		now := time.Now()
+		if err := change(s, now); err != nil {
+			return s, err
+		}
+		s.UpdatedAt = &now
+		err = store.Get().ReplaceSessionIf(ctx, s, status, updatedAt)
+		if errors.Is(err, store.ErrStale) {
+			if attempt < 2 {
+				continue
+			}
+			// Still racing after a few tries: let the client retry.
+			return nil, ErrSessionState
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+// PauseLiveSession starts a break.
+func PauseLiveSession(ctx context.Context, userID, sessionID string) (*models.StudySession, error) {
+	return updateOwnedSession(ctx, userID, sessionID, func(s *models.StudySession, now time.Time) error {
+		if s.Status != models.SessionActive {
+			return ErrSessionState
+		}
+		s.Status = models.SessionPaused
+		s.PausedAt = &now
+		return nil
+	})
+}
+
+// ResumeLiveSession ends the open break and records it.
+func ResumeLiveSession(ctx context.Context, userID, sessionID string) (*models.StudySession, error) {
+	return updateOwnedSession(ctx, userID, sessionID, func(s *models.StudySession, now time.Time) error {
+		if s.Status != models.SessionPaused {
+			return ErrSessionState
+		}
+		closeBreak(s, now)
+		s.Status = models.SessionActive
+		return nil
+	})
+}
+
+// HeartbeatLiveSession marks the session as still in use so it is not
+// auto-closed as abandoned.
+func HeartbeatLiveSession(ctx context.Context, userID, sessionID string) (*models.StudySession, error) {
+	return updateOwnedSession(ctx, userID, sessionID, func(s *models.StudySession, now time.Time) error {
+		return nil
+	})
+}
+
+// EndLiveSession closes the session with the user's reflection, scores it
+// and refreshes the day's FatigueScore.
+func EndLiveSession(ctx context.Context, userID, sessionID string, selfRating int, selfOnTask string) (*models.StudySession, error) {
+	var plan *models.PlanMatch
+	s, err := updateOwnedSession(ctx, userID, sessionID, func(s *models.StudySession, now time.Time) error {
+		if s.Status == models.SessionPaused {
+			closeBreak(s, now)
+		}
+		plan = finishSession(ctx, s, now, models.SessionCompleted, selfRating, selfOnTask)
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+	savePlanMatch(ctx, plan)
+	if _, err := RefreshGoalBaseline(ctx, s); err != nil {
+		helpers.Logf(ctx, "refresh %q baseline: %v", s.Goal, err)
+	}
+	if _, err := RollupDay(ctx, userID, s.StartedAt); err != nil {
+		helpers.Logf(ctx, "rollup after session %s: %v", s.ID.Hex(), err)
+	}
+	return s, nil
+}
+
+func closeBreak(s *models.StudySession, now time.Time) {
+	if s.PausedAt == nil {
+		return
+	}
+	s.Breaks = append(s.Breaks, models.BreakInterval{
+		StartedAt: *s.PausedAt,
+		EndedAt:   now,
+		Minutes:   int(math.Round(now.Sub(*s.PausedAt).Minutes())),
+	})
+	s.PausedAt = nil
+}
+
+// finishSession derives DurationMin and PauseCount from the recorded
+// timestamps and computes the focus score. It returns the plan occurrence
+// the session fulfils, to be saved once the session is.
+func finishSession(ctx context.Context, s *models.StudySession, endedAt time.Time, status string, selfRating int, selfOnTask string) *models.PlanMatch {
+	active := endedAt.Sub(s.StartedAt)
+	for _, b := range s.Breaks {
+		active -= b.EndedAt.Sub(b.StartedAt)
+	}
+	s.DurationMin = int(math.Round(active.Minutes()))
+	if s.DurationMin < 1 {
+		s.DurationMin = 1
+	}
+	s.PauseCount = len(s.Breaks)
+	if selfRating <= 0 {
+		selfRating = 3
+	}
+	s.SelfRating = selfRating
+	s.SelfOnTask = selfOnTask
+	s.EndedAt = &endedAt
+	s.Status = status
+	plan := matchPlannedSession(ctx, s)
+	hist := historicalConsistency(ctx, s.UserID, s.StartedAt)
+	model := scoringModelFor(ctx, s.UserID)
+	s.FocusScore = focusScore(model, sessionInput(s, hist, personalBaseline(ctx, s), plan))
+	s.ModelVersion = model.Version
+	return plan
+}
+
+// CloseIdleSessions auto-closes sessions with no activity since idleTimeout
+// ago. A running session ends at its last activity; a paused one ends when
+// the break began, since the user never came back from it.
+func CloseIdleSessions(ctx context.Context, idleTimeout time.Duration) (int, error) {
+	idle, err := store.Get().IdleOpenSessions(ctx, time.Now().Add(-idleTimeout), 200)
+	if err != nil {
+		return 0, err
+	}
+	closed := 0
+	for i := range idle {
+		s := &idle[i]
+		endAt := s.StartedAt
+		if s.UpdatedAt != nil {
+			endAt = *s.UpdatedAt
+		}
+		if s.Status == models.SessionPaused && s.PausedAt != nil {
+			endAt = *s.PausedAt
+			s.PausedAt = nil
+		}
+		status, updatedAt := s.Status, s.UpdatedAt
+		plan := finishSession(ctx, s, endAt, models.SessionAbandoned, 0, "")
+		now := time.Now()
+		s.UpdatedAt = &now
+		// A session the user touched since the query is no longer idle.
+		if err := store.Get().ReplaceSessionIf(ctx, s, status, updatedAt); errors.Is(err, store.ErrStale) {
+			continue
+		} else if err != nil {
+			log.Printf("idle sessions: close %s: %v", s.ID.Hex(), err)
+			continue
+		}
+		savePlanMatch(ctx, plan)
+		if _, err := RollupDay(ctx, s.UserID, s.StartedAt); err != nil {
+			log.Printf("idle sessions: rollup for %s: %v", s.UserID, err)
+		}
+		if err := Notify(ctx, s.UserID, models.NotifySessionAbandoned, map[string]string{
+			"session_id":   s.ID.Hex(),
+			"goal":         s.Goal,
+			"started_at":   s.StartedAt.In(UserLocation(ctx, s.UserID)).Format("Mon 2 Jan 15:04"),
+			"duration_min": strconv.Itoa(s.DurationMin),
+		}); err != nil {
+			log.Printf("idle sessions: notify %s: %v", s.UserID, err)
+		}
+		closed++
+	}
+	return closed, nil
+}
+
+// StartIdleSessionJob runs CloseIdleSessions every interval.
+func StartIdleSessionJob(ctx context.Context, interval, idleTimeout time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := CloseIdleSessions(ctx, idleTimeout); err != nil {
+					log.Printf("idle sessions: %v", err)
+				} else if n > 0 {
+					log.Printf("idle sessions: auto-closed %d abandoned session(s)", n)
+				}
+			}
+		}
+	}()
+}
+
+// sessionInput describes a stored session to a FocusScorer. plan is the
+// study plan occurrence the session fulfilled, if any.
+func sessionInput(s *models.StudySession, hist float64, baselineMin int, plan *models.PlanMatch) scoring.Session {
+	in := scoring.Session{
+		Mode:            s.Mode,
+		Goal:            s.Goal,
+		PlannedMin:      s.PlannedMin,
+		ActualMin:       s.DurationMin,
+		BaselineMin:     baselineMin,
+		PauseCount:      s.PauseCount,
+		SelfRating:      s.SelfRating,
+		SelfOnTask:      s.SelfOnTask,
+		HistConsistency: hist,
+	}
+	if plan != nil {
+		in.Planned = true
+		in.PlanAdherence = plan.Adherence
+	}
+	return in
+}
@@ -0,0 +1,421 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/notify"
+	"authentication/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotificationNotFound = errors.New("notification not found")
+	ErrInvalidNotifyPrefs   = errors.New("invalid notification preferences")
+)
+
+// Delivery queue tuning. A claimed delivery is invisible to other workers
+// for deliveryLease; if the worker dies it is retried after that.
+const (
+	deliveryBatch       = 50
+	deliveryLease       = 5 * time.Minute
+	maxDeliveryAttempts = 8
+	maxDeliveryBackoff  = 6 * time.Hour
+)
+
+type messageTemplate struct {
+	subject, body *template.Template
+}
+
+func newMessageTemplate(kind, subject, body string) messageTemplate {
+	return messageTemplate{
+		subject: template.Must(template.New(kind + ".subject").Option("missingkey=zero").Parse(subject)),
+		body:    template.Must(template.New(kind + ".body").Option("missingkey=zero").Parse(body)),
+	}
+}
+
+func (t messageTemplate) render(data map[string]string) (string, string, error) {
+	var subject, body strings.Builder
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subject.String()), strings.TrimSpace(body.String()), nil
+}
+
+// notificationTemplates renders each kind from its string data.
+var notificationTemplates = map[string]messageTemplate{
+	models.NotifyAlert: newMessageTemplate(models.NotifyAlert,
+		`{{if eq .severity "critical"}}Critical: {{end}}{{.rule_name}}`,
+		`{{.message}}
+
+Take a look at your recent sessions and plan some lighter days. This alert
+stays open until you acknowledge it or your scores recover.`),
+	models.NotifySessionAbandoned: newMessageTemplate(models.NotifySessionAbandoned,
+		`Your {{if .goal}}{{.goal}} {{end}}session was closed`,
+		`Your study session started at {{.started_at}} had no activity, so we ended it
+and saved {{.duration_min}} minute(s) as abandoned.`),
+	models.NotifyWeeklyReport: newMessageTemplate(models.NotifyWeeklyReport,
+		`Your week: {{.week_label}}`,
+		`You studied {{.hours}} over {{.sessions}} session(s) ({{.change}} on the week before),
+with an average focus score of {{.avg_focus}}.{{if .peak_day}} Burnout risk peaked on
+{{.peak_day}} at {{.peak_burnout}}%.{{end}}
+
+The full report is at /api/reports/weekly?week={{.week}}`),
+}
+
+// messageEnrichers add extras, such as attachments, to a kind's emails as
+// they are sent.
+var messageEnrichers = map[string]func(ctx context.Context, d *models.NotificationDelivery, m *notify.Message) error{}
+
+// DefaultNotifyChannels apply to kinds a user has not set channels for.
+var DefaultNotifyChannels = map[string][]string{
+	models.NotifyAlert:            {models.ChannelInbox, models.ChannelEmail},
+	models.NotifySessionAbandoned: {models.ChannelInbox},
+	models.NotifyWeeklyReport:     {models.ChannelInbox, models.ChannelEmail},
+}
+
+// notifyPrefs returns the user's preferences with defaults filled in.
+func notifyPrefs(ctx context.Context, userID string) (*models.NotificationPrefs, error) {
+	p, err := store.Get().FindNotificationPrefs(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		p = &models.NotificationPrefs{UserID: userID}
+	} else if err != nil {
+		return nil, err
+	}
+	if p.Channels == nil {
+		p.Channels = map[string][]string{}
+	}
+	for kind, chans := range DefaultNotifyChannels {
+		if _, ok := p.Channels[kind]; !ok {
+			p.Channels[kind] = chans
+		}
+	}
+	return p, nil
+}
+
+// clockMinutes parses "HH:MM" into minutes after midnight.
+func clockMinutes(v string) (int, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// afterQuietHours returns t, or when the user's quiet hours end if t falls
+// inside them. Quiet hours may wrap midnight (22:00-07:00).
+func afterQuietHours(p *models.NotificationPrefs, loc *time.Location, t time.Time) time.Time {
+	if p.QuietStart == "" || p.QuietStart == p.QuietEnd {
+		return t
+	}
+	start, err1 := clockMinutes(p.QuietStart)
+	end, err2 := clockMinutes(p.QuietEnd)
+	if err1 != nil || err2 != nil {
+		return t
+	}
+	lt := t.In(loc)
+	m := lt.Hour()*60 + lt.Minute()
+	quiet := m >= start && m < end
+	if start > end {
+		quiet = m >= start || m < end
+	}
+	if !quiet {
+		return t
+	}
+	y, mo, d := lt.Date()
+	resume := time.Date(y, mo, d, end/60, end%60, 0, 0, loc)
+	if !resume.After(lt) {
+		resume = resume.AddDate(0, 0, 1)
+	}
+	return resume
+}
+
+// Notify renders kind for the user and sends it on each channel they chose
+// for it: straight into the inbox, or onto the delivery queue for email and
+// webhooks, held back until quiet hours end.
+func Notify(ctx context.Context, userID, kind string, data map[string]string) error {
+	tpl, ok := notificationTemplates[kind]
+	if !ok {
+		return fmt.Errorf("notify: unknown kind %q", kind)
+	}
+	subject, body, err := tpl.render(data)
+	if err != nil {
+		return fmt.Errorf("notify: render %s: %w", kind, err)
+	}
+	p, err := notifyPrefs(ctx, userID)
+	if err != nil {
+		return err
+	}
+	st := store.Get()
+	now := time.Now()
+	var sendAt *time.Time
+	for _, ch := range p.Channels[kind] {
+		var target string
+		switch ch {
+		case models.ChannelInbox:
+			n := &models.Notification{
+				ID:        primitive.NewObjectID(),
+				UserID:    userID,
+				Kind:      kind,
+				Title:     subject,
+				Body:      body,
+				Data:      data,
+				CreatedAt: now,
+			}
+			if err := st.CreateNotification(ctx, n); err != nil {
+				return err
+			}
+			continue
+		case models.ChannelEmail:
+			u, err := st.FindUserByID(ctx, userID)
+			if err != nil {
+				return err
+			}
+			if u.Email == nil || *u.Email == "" {
+				continue
+			}
+			target = *u.Email
+		case models.ChannelWebhook:
+			if p.WebhookURL == "" {
+				continue
+			}
+			target = p.WebhookURL
+		default:
+			continue
+		}
+		if sendAt == nil {
+			t := afterQuietHours(p, UserLocation(ctx, userID), now)
+			sendAt = &t
+		}
+		d := &models.NotificationDelivery{
+			ID:            primitive.NewObjectID(),
+			UserID:        userID,
+			Channel:       ch,
+			Kind:          kind,
+			Target:        target,
+			Subject:       subject,
+			Body:          body,
+			Data:          data,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: *sendAt,
+			CreatedAt:     now,
+		}
+		if err := st.EnqueueDelivery(ctx, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliveryBackoff is 1m, 2m, 4m, ... capped at maxDeliveryBackoff.
+func deliveryBackoff(attempts int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempts && d < maxDeliveryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxDeliveryBackoff {
+		d = maxDeliveryBackoff
+	}
+	return d
+}
+
+func sendDelivery(ctx context.Context, d *models.NotificationDelivery) error {
+	m := notify.Message{
+		ID:        d.ID.Hex(),
+		UserID:    d.UserID,
+		Kind:      d.Kind,
+		Subject:   d.Subject,
+		Body:      d.Body,
+		Data:      d.Data,
+		CreatedAt: d.CreatedAt,
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	switch d.Channel {
+	case models.ChannelEmail:
+		if enrich, ok := messageEnrichers[d.Kind]; ok {
+			if err := enrich(ctx, d, &m); err != nil {
+				return err
+			}
+		}
+		return notify.Email().SendEmail(ctx, d.Target, m)
+	case models.ChannelWebhook:
+		return notify.Webhook().PostWebhook(ctx, d.Target, m)
+	}
+	return notify.Permanent(fmt.Errorf("unknown channel %q", d.Channel))
+}
+
+// ProcessDeliveries sends due deliveries. Failures are retried with
+// exponential backoff (outside quiet hours) until maxDeliveryAttempts, or
+// given up at once when the sender reports a permanent error.
+func ProcessDeliveries(ctx context.Context) (sent, failed int, err error) {
+	st := store.Get()
+	now := time.Now()
+	batch, err := st.ClaimDeliveries(ctx, now, now.Add(deliveryLease), deliveryBatch)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := range batch {
+		d := &batch[i]
+		d.Attempts++
+		sendErr := sendDelivery(ctx, d)
+		at := time.Now()
+		switch {
+		case sendErr == nil:
+			d.Status = models.DeliverySent
+			d.SentAt = &at
+			d.LastError = ""
+			sent++
+		case errors.Is(sendErr, notify.ErrPermanent) || d.Attempts >= maxDeliveryAttempts:
+			d.Status = models.DeliveryFailed
+			d.LastError = sendErr.Error()
+			failed++
+		default:
+			d.LastError = sendErr.Error()
+			d.NextAttemptAt = at.Add(deliveryBackoff(d.Attempts))
+			if p, err := notifyPrefs(ctx, d.UserID); err == nil {
+				d.NextAttemptAt = afterQuietHours(p, UserLocation(ctx, d.UserID), d.NextAttemptAt)
+			}
+		}
+		if sendErr != nil {
+			log.Printf("notify: %s %s to user %s (attempt %d): %v", d.Channel, d.ID.Hex(), d.UserID, d.Attempts, sendErr)
+		}
+		if err := st.UpdateDelivery(ctx, d); err != nil {
+			log.Printf("notify: save delivery %s: %v", d.ID.Hex(), err)
+		}
+	}
+	return sent, failed, nil
+}
+
+// StartNotificationWorker runs ProcessDeliveries every interval.
+func StartNotificationWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if sent, failed, err := ProcessDeliveries(ctx); err != nil {
+					log.Printf("notify: %v", err)
+				} else if sent > 0 || failed > 0 {
+					log.Printf("notify: sent %d, gave up on %d delivery(ies)", sent, failed)
+				}
+			}
+		}
+	}()
+}
+
+// ===================== INBOX =====================
+
+func ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts store.ListOptions) ([]models.Notification, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListNotifications(ctx, userID, unreadOnly, opts)
+}
+
+func CountUnreadNotifications(ctx context.Context, userID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().CountUnreadNotifications(ctx, userID)
+}
+
+func MarkNotificationRead(ctx context.Context, userID, notificationID string) (*models.Notification, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	n, err := store.Get().MarkNotificationRead(ctx, userID, notificationID, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrNotificationNotFound
+	}
+	return n, err
+}
+
+func MarkAllNotificationsRead(ctx context.Context, userID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().MarkAllNotificationsRead(ctx, userID, time.Now())
+}
+
+// ===================== PREFERENCES =====================
+
+func GetNotificationPrefs(ctx context.Context, userID string) (*models.NotificationPrefs, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return notifyPrefs(ctx, userID)
+}
+
+func validateNotifyPrefs(p *models.NotificationPrefs) error {
+	for kind, chans := range p.Channels {
+		if _, ok := notificationTemplates[kind]; !ok {
+			return fmt.Errorf("%w: unknown notification kind %q", ErrInvalidNotifyPrefs, kind)
+		}
+		seen := map[string]bool{}
+		out := []string{}
+		for _, ch := range chans {
+			switch ch {
+			case models.ChannelInbox, models.ChannelEmail, models.ChannelWebhook:
+			default:
+				return fmt.Errorf("%w: channel must be inbox, email or webhook", ErrInvalidNotifyPrefs)
+			}
+			if ch == models.ChannelWebhook && p.WebhookURL == "" {
+				return fmt.Errorf("%w: webhook_url is required for the webhook channel", ErrInvalidNotifyPrefs)
+			}
+			if !seen[ch] {
+				seen[ch] = true
+				out = append(out, ch)
+			}
+		}
+		p.Channels[kind] = out
+	}
+	if p.WebhookURL != "" {
+		u, err := url.Parse(p.WebhookURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: webhook_url must be an absolute http(s) URL", ErrInvalidNotifyPrefs)
+		}
+	}
+	if (p.QuietStart == "") != (p.QuietEnd == "") {
+		return fmt.Errorf("%w: set both quiet_start and quiet_end, or neither", ErrInvalidNotifyPrefs)
+	}
+	if p.QuietStart != "" {
+		if _, err := clockMinutes(p.QuietStart); err != nil {
+			return fmt.Errorf("%w: quiet_start must be HH:MM", ErrInvalidNotifyPrefs)
+		}
+		if _, err := clockMinutes(p.QuietEnd); err != nil {
+			return fmt.Errorf("%w: quiet_end must be HH:MM", ErrInvalidNotifyPrefs)
+		}
+	}
+	return nil
+}
+
+// SetNotificationPrefs replaces the user's preferences. Kinds left out of
+// Channels keep their defaults; an empty list turns a kind off.
+func SetNotificationPrefs(ctx context.Context, userID string, p *models.NotificationPrefs) (*models.NotificationPrefs, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	p.UserID = userID
+	p.WebhookURL = strings.TrimSpace(p.WebhookURL)
+	p.QuietStart = strings.TrimSpace(p.QuietStart)
+	p.QuietEnd = strings.TrimSpace(p.QuietEnd)
+	if p.Channels == nil {
+		p.Channels = map[string][]string{}
+	}
+	if err := validateNotifyPrefs(p); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = time.Now()
+	if err := store.Get().SaveNotificationPrefs(ctx, p); err != nil {
+		return nil, err
+	}
+	return notifyPrefs(ctx, userID)
+}
@@ -0,0 +1,494 @@
+package services
+
+import (
+	"authentication/helpers"
+	"authentication/models"
+	"authentication/rrule"
+	"authentication/store"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrPlanNotFound     = errors.New("study plan not found")
+	ErrInvalidPlan      = errors.New("invalid study plan")
+	ErrInvalidPlanRange = errors.New("from must be before to, and the range is at most a year")
+)
+
+const (
+	planMinMin     = 5
+	planMaxMin     = 480
+	planMaxExDates = 500
+
+	// A session fulfils an occurrence if it starts from planEarlyStart
+	// before it until its planned end.
+	planEarlyStart = 30 * time.Minute
+	// Starts within planOnTimeMin of the occurrence are on time; timeliness
+	// then falls linearly to 0 at planLateMin.
+	planOnTimeMin = 10
+	planLateMin   = 60
+
+	defaultScheduleDays  = 7
+	defaultAdherenceDays = 28
+	maxPlanRangeDays     = 366
+)
+
+// Occurrence statuses.
+const (
+	PlanUpcoming = "upcoming"
+	PlanMatched  = "matched"
+	PlanMissed   = "missed"
+)
+
+// PlanInput is the editable part of a StudyPlan. Goal and GoalID are both
+// optional; a plan without a goal is fulfilled by a session of any goal.
+type PlanInput struct {
+	Goal       string
+	GoalID     string
+	StartAt    time.Time
+	PlannedMin int
+	RRule      string
+	ExDates    []time.Time // occurrences to skip
+	Timezone   string      // defaults to the user's timezone
+	Note       string
+
+	ExternalUID string // set by calendar import
+}
+
+// validatePlan normalizes in and resolves its goal against the catalog.
+func validatePlan(ctx context.Context, userID string, in *PlanInput) error {
+	in.Goal = strings.TrimSpace(in.Goal)
+	in.Note = strings.TrimSpace(in.Note)
+	in.Timezone = strings.TrimSpace(in.Timezone)
+	switch {
+	case in.StartAt.IsZero():
+		return fmt.Errorf("%w: start_at is required", ErrInvalidPlan)
+	case in.PlannedMin < planMinMin || in.PlannedMin > planMaxMin:
+		return fmt.Errorf("%w: planned_min must be between %d and %d", ErrInvalidPlan, planMinMin, planMaxMin)
+	case len(in.Note) > 500:
+		return fmt.Errorf("%w: note must be at most 500 characters", ErrInvalidPlan)
+	case len(in.ExDates) > planMaxExDates:
+		return fmt.Errorf("%w: at most %d exdates", ErrInvalidPlan, planMaxExDates)
+	}
+	if in.Timezone == "" {
+		in.Timezone = UserLocation(ctx, userID).String()
+	}
+	loc, err := loadLocation(in.Timezone)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	if in.RRule = strings.TrimSpace(in.RRule); in.RRule != "" {
+		r, err := rrule.Parse(in.RRule, loc)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+		}
+		in.RRule = r.String()
+	}
+	if in.Goal == "" && in.GoalID == "" {
+		return nil
+	}
+	stub := &models.StudySession{UserID: userID, Goal: in.Goal}
+	if err := applyGoal(ctx, stub, in.GoalID); err != nil {
+		return err
+	}
+	in.Goal, in.GoalID = stub.Goal, stub.GoalID
+	return nil
+}
+
+// ListStudyPlans returns the user's plans, oldest first.
+func ListStudyPlans(ctx context.Context, userID string) ([]models.StudyPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListStudyPlans(ctx, userID)
+}
+
+func CreateStudyPlan(ctx context.Context, userID string, in PlanInput) (*models.StudyPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := validatePlan(ctx, userID, &in); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	p := &models.StudyPlan{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	setPlan(p, in)
+	if err := store.Get().CreateStudyPlan(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateStudyPlan replaces a plan's fields. Sessions already matched to
+// occurrences that the new schedule drops no longer count towards it.
+func UpdateStudyPlan(ctx context.Context, userID, planID string, in PlanInput) (*models.StudyPlan, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	p, err := ownedPlan(ctx, userID, planID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePlan(ctx, userID, &in); err != nil {
+		return nil, err
+	}
+	in.ExternalUID = p.ExternalUID
+	setPlan(p, in)
+	p.UpdatedAt = time.Now()
+	if err := store.Get().UpdateStudyPlan(ctx, p); errors.Is(err, store.ErrNotFound) {
+		return nil, ErrPlanNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DeleteStudyPlan removes the plan and its matches. Matched sessions keep
+// their focus scores until the next recompute.
+func DeleteStudyPlan(ctx context.Context, userID, planID string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := ownedPlan(ctx, userID, planID); err != nil {
+		return err
+	}
+	err := store.Get().DeleteStudyPlan(ctx, planID)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrPlanNotFound
+	}
+	return err
+}
+
+func ownedPlan(ctx context.Context, userID, planID string) (*models.StudyPlan, error) {
+	p, err := store.Get().FindStudyPlan(ctx, planID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && p.UserID != userID) {
+		return nil, ErrPlanNotFound
+	}
+	return p, err
+}
+
+func setPlan(p *models.StudyPlan, in PlanInput) {
+	p.Goal = in.Goal
+	p.GoalID = in.GoalID
+	p.StartAt = in.StartAt.UTC()
+	p.PlannedMin = in.PlannedMin
+	p.RRule = in.RRule
+	p.ExDates = nil
+	for _, t := range in.ExDates {
+		p.ExDates = append(p.ExDates, t.UTC())
+	}
+	p.Timezone = in.Timezone
+	p.Note = in.Note
+	p.ExternalUID = in.ExternalUID
+}
+
+// planOccurrences returns the start times of p's occurrences in [from, to),
+// leaving out its exdates.
+func planOccurrences(p *models.StudyPlan, from, to time.Time) []time.Time {
+	loc, err := loadLocation(p.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	start := p.StartAt.In(loc)
+	var occs []time.Time
+	if p.RRule == "" {
+		if !start.Before(from) && start.Before(to) {
+			occs = []time.Time{start}
+		}
+	} else if r, err := rrule.Parse(p.RRule, loc); err == nil {
+		occs = r.Between(start, from, to)
+	}
+	if len(p.ExDates) == 0 {
+		return occs
+	}
+	out := occs[:0]
+	for _, t := range occs {
+		skip := false
+		for _, ex := range p.ExDates {
+			if ex.Equal(t) {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func planMatchID(planID string, occurrence time.Time) string {
+	return fmt.Sprintf("%s@%d", planID, occurrence.Unix())
+}
+
+// planFitsGoal reports whether a session of s's goal fulfils p.
+func planFitsGoal(p *models.StudyPlan, s *models.StudySession) bool {
+	switch {
+	case p.GoalID != "":
+		return p.GoalID == s.GoalID
+	case p.Goal != "":
+		return goalKey(p.Goal) == goalKey(s.Goal)
+	}
+	return true
+}
+
+// matchPlannedSession finds the plan occurrence s fulfils: the closest one
+// whose window holds s's start, fits its goal and is not yet taken by
+// another session. It returns nil if there is none. s must be finished.
+func matchPlannedSession(ctx context.Context, s *models.StudySession) *models.PlanMatch {
+	st := store.Get()
+	plans, err := st.ListStudyPlans(ctx, s.UserID)
+	if err != nil {
+		helpers.Logf(ctx, "match session %s to plans: %v", s.ID.Hex(), err)
+		return nil
+	}
+	if len(plans) == 0 {
+		return nil
+	}
+	// Occurrences at most planMaxMin before or planEarlyStart after the
+	// start can hold it.
+	from := s.StartedAt.Add(-planMaxMin * time.Minute)
+	to := s.StartedAt.Add(planEarlyStart + time.Second)
+	existing, err := st.ListPlanMatches(ctx, s.UserID, &from, &to)
+	if err != nil {
+		helpers.Logf(ctx, "match session %s to plans: %v", s.ID.Hex(), err)
+		return nil
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, m := range existing {
+		taken[m.ID] = m.SessionID != s.ID.Hex()
+	}
+
+	var best *models.PlanMatch
+	var bestGap time.Duration
+	for i := range plans {
+		p := &plans[i]
+		if !planFitsGoal(p, s) {
+			continue
+		}
+		for _, occ := range planOccurrences(p, from, to) {
+			if s.StartedAt.Before(occ.Add(-planEarlyStart)) || !s.StartedAt.Before(occ.Add(time.Duration(p.PlannedMin)*time.Minute)) {
+				continue
+			}
+			id := planMatchID(p.ID.Hex(), occ)
+			if taken[id] {
+				continue
+			}
+			gap := s.StartedAt.Sub(occ)
+			if gap < 0 {
+				gap = -gap
+			}
+			if best == nil || gap < bestGap {
+				best, bestGap = newPlanMatch(id, p, occ, s), gap
+			}
+		}
+	}
+	return best
+}
+
+// newPlanMatch scores how closely s kept to the occurrence: adherence is
+// the mean of the minutes ratio and the timeliness of the start.
+func newPlanMatch(id string, p *models.StudyPlan, occ time.Time, s *models.StudySession) *models.PlanMatch {
+	ratio := math.Min(float64(s.DurationMin), float64(p.PlannedMin)) / float64(p.PlannedMin)
+	delay := int(math.Round(s.StartedAt.Sub(occ).Minutes()))
+	late := math.Abs(float64(delay))
+	timeliness := 1.0
+	if late > planOnTimeMin {
+		timeliness = math.Max(0, 1-(late-planOnTimeMin)/(planLateMin-planOnTimeMin))
+	}
+	return &models.PlanMatch{
+		ID:            id,
+		UserID:        s.UserID,
+		PlanID:        p.ID.Hex(),
+		OccurrenceAt:  occ.UTC(),
+		SessionID:     s.ID.Hex(),
+		PlannedMin:    p.PlannedMin,
+		ActualMin:     s.DurationMin,
+		StartDelayMin: delay,
+		OnTime:        late <= planOnTimeMin,
+		MinutesRatio:  round3(ratio),
+		Adherence:     round3((ratio + timeliness) / 2),
+		CreatedAt:     time.Now(),
+	}
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// savePlanMatch records m once its session is stored. Losing a race for
+// the occurrence to another session is not an error.
+func savePlanMatch(ctx context.Context, m *models.PlanMatch) {
+	if m == nil {
+		return
+	}
+	if err := store.Get().CreatePlanMatch(ctx, m); err != nil && !errors.Is(err, store.ErrDuplicate) {
+		helpers.Logf(ctx, "save plan match %s: %v", m.ID, err)
+	}
+}
+
+// PlannedOccurrence is one scheduled block of a plan.
+type PlannedOccurrence struct {
+	PlanID     string    `json:"plan_id"`
+	Goal       string    `json:"goal,omitempty"`
+	GoalID     string    `json:"goal_id,omitempty"`
+	StartAt    time.Time `json:"start_at"`
+	PlannedMin int       `json:"planned_min"`
+	Note       string    `json:"note,omitempty"`
+	Status     string    `json:"status"` // upcoming | matched | missed
+	SessionID  string    `json:"session_id,omitempty"`
+	ActualMin  int       `json:"actual_min,omitempty"`
+	OnTime     bool      `json:"on_time,omitempty"`
+	Adherence  *float64  `json:"adherence,omitempty"`
+}
+
+// planRange applies defaults and the size cap to a schedule or adherence
+// range.
+func planRange(from, to *time.Time, defFrom time.Time, defDays int) (time.Time, time.Time, error) {
+	start, end := defFrom, defFrom.AddDate(0, 0, defDays)
+	if from != nil {
+		start = *from
+		if to == nil {
+			end = start.AddDate(0, 0, defDays)
+		}
+	}
+	if to != nil {
+		end = *to
+		if from == nil {
+			start = end.AddDate(0, 0, -defDays)
+		}
+	}
+	if !start.Before(end) || end.Sub(start) > maxPlanRangeDays*24*time.Hour {
+		return start, end, ErrInvalidPlanRange
+	}
+	return start, end, nil
+}
+
+// planSchedule expands every plan of the user in [from, to) and marks each
+// occurrence matched, missed (its planned end has passed) or upcoming.
+func planSchedule(ctx context.Context, userID string, from, to time.Time) ([]PlannedOccurrence, error) {
+	st := store.Get()
+	plans, err := st.ListStudyPlans(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := st.ListPlanMatches(ctx, userID, &from, &to)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.PlanMatch, len(matches))
+	for i := range matches {
+		byID[matches[i].ID] = &matches[i]
+	}
+	now := time.Now()
+	out := []PlannedOccurrence{}
+	for i := range plans {
+		p := &plans[i]
+		for _, occ := range planOccurrences(p, from, to) {
+			o := PlannedOccurrence{
+				PlanID:     p.ID.Hex(),
+				Goal:       p.Goal,
+				GoalID:     p.GoalID,
+				StartAt:    occ,
+				PlannedMin: p.PlannedMin,
+				Note:       p.Note,
+				Status:     PlanUpcoming,
+			}
+			if m, ok := byID[planMatchID(o.PlanID, occ)]; ok {
+				o.Status = PlanMatched
+				o.SessionID = m.SessionID
+				o.ActualMin = m.ActualMin
+				o.OnTime = m.OnTime
+				o.Adherence = &m.Adherence
+			} else if !occ.Add(time.Duration(p.PlannedMin) * time.Minute).After(now) {
+				o.Status = PlanMissed
+			}
+			out = append(out, o)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartAt.Before(out[j].StartAt) })
+	return out, nil
+}
+
+// PlanSchedule lists the user's planned sessions in [from, to), the next
+// defaultScheduleDays by default.
+func PlanSchedule(ctx context.Context, userID string, from, to *time.Time) ([]PlannedOccurrence, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start, end, err := planRange(from, to, time.Now(), defaultScheduleDays)
+	if err != nil {
+		return nil, err
+	}
+	return planSchedule(ctx, userID, start, end)
+}
+
+// PlanAdherenceSummary measures how closely the user kept to their plans.
+// Only occurrences that are matched or already over count; a missed one
+// counts as adherence 0 in Score.
+type PlanAdherenceSummary struct {
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Planned      int       `json:"planned"`
+	Matched      int       `json:"matched"`
+	Missed       int       `json:"missed"`
+	PlannedMin   int       `json:"planned_min"`
+	ActualMin    int       `json:"actual_min"`
+	MinutesRatio float64   `json:"minutes_ratio"` // planned minutes studied, 0-1
+	OnTimeStarts int       `json:"on_time_starts"`
+	OnTimeRate   float64   `json:"on_time_rate"` // of matched occurrences, 0-1
+	Score        float64   `json:"score"`        // mean adherence, 0-100
+}
+
+// PlanAdherence summarizes the user's plan adherence over [from, to), the
+// last defaultAdherenceDays by default.
+func PlanAdherence(ctx context.Context, userID string, from, to *time.Time) (*PlanAdherenceSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	start, end, err := planRange(from, to, now.AddDate(0, 0, -defaultAdherenceDays), defaultAdherenceDays)
+	if err != nil {
+		return nil, err
+	}
+	occs, err := planSchedule(ctx, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	sum := &PlanAdherenceSummary{From: start, To: end}
+	var studied, adherence float64
+	for _, o := range occs {
+		if o.Status == PlanUpcoming {
+			continue
+		}
+		sum.Planned++
+		sum.PlannedMin += o.PlannedMin
+		if o.Status == PlanMissed {
+			sum.Missed++
+			continue
+		}
+		sum.Matched++
+		sum.ActualMin += o.ActualMin
+		studied += math.Min(float64(o.ActualMin), float64(o.PlannedMin))
+		adherence += *o.Adherence
+		if o.OnTime {
+			sum.OnTimeStarts++
+		}
+	}
+	if sum.PlannedMin > 0 {
+		sum.MinutesRatio = round3(studied / float64(sum.PlannedMin))
+	}
+	if sum.Matched > 0 {
+		sum.OnTimeRate = round3(float64(sum.OnTimeStarts) / float64(sum.Matched))
+	}
+	if sum.Planned > 0 {
+		sum.Score = math.Round(adherence/float64(sum.Planned)*1000) / 10
+	}
+	return sum, nil
+}
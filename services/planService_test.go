@@ -0,0 +1,50 @@
+package services
+
+import (
+	"authentication/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewPlanMatch(t *testing.T) {
+	occ := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	plan := &models.StudyPlan{ID: primitive.NewObjectID(), PlannedMin: 60}
+	tests := []struct {
+		name          string
+		delayMin      int
+		actualMin     int
+		wantDelay     int
+		wantOnTime    bool
+		wantRatio     float64
+		wantAdherence float64
+	}{
+		{"on time and full length", 0, 60, 0, true, 1, 1},
+		{"late within grace, half length", 10, 30, 10, true, 0.5, 0.75},
+		{"halfway to the late cutoff", 35, 60, 35, false, 1, 0.75},
+		{"early counts like late, overrun is capped", -20, 90, -20, false, 1, 0.9},
+		{"past the late cutoff", 90, 45, 90, false, 0.75, 0.375},
+		{"rounded to three places", 40, 20, 40, false, 0.333, 0.367},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &models.StudySession{
+				ID:          primitive.NewObjectID(),
+				UserID:      "u1",
+				StartedAt:   occ.Add(time.Duration(tt.delayMin) * time.Minute),
+				DurationMin: tt.actualMin,
+			}
+			m := newPlanMatch("m1", plan, occ, s)
+			if m.StartDelayMin != tt.wantDelay || m.OnTime != tt.wantOnTime ||
+				m.MinutesRatio != tt.wantRatio || m.Adherence != tt.wantAdherence {
+				t.Fatalf("got delay %d on time %v ratio %v adherence %v, want %d %v %v %v",
+					m.StartDelayMin, m.OnTime, m.MinutesRatio, m.Adherence,
+					tt.wantDelay, tt.wantOnTime, tt.wantRatio, tt.wantAdherence)
+			}
+			if m.PlannedMin != 60 || m.ActualMin != tt.actualMin || m.SessionID != s.ID.Hex() || m.PlanID != plan.ID.Hex() {
+				t.Fatalf("match does not describe the session and plan: %+v", m)
+			}
+		})
+	}
+}
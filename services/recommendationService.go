@@ -0,0 +1,297 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	recommendHistoryDays  = 28 // sessions behind focus and pause patterns
+	recommendTimeDays     = 60 // sessions behind time-of-day performance
+	recommendFocusSamples = 10 // latest sessions of the goal whose focus counts
+	recommendMinSamples   = 3
+	recommendMinMin       = 15
+	recommendMaxMin       = 120
+	defaultFocusBlockMin  = 25
+)
+
+// SessionRecommendation is advice for the user's next study session,
+// with the reasons for it and the numbers it was worked out from.
+type SessionRecommendation struct {
+	Goal        string               `json:"goal"`
+	GoalID      string               `json:"goal_id,omitempty"`
+	DurationMin int                  `json:"duration_min"`
+	Breaks      BreakPlan            `json:"breaks"`
+	Window      *TimeWindow          `json:"window,omitempty"` // nil when today has no good hour left
+	Rationale   []string             `json:"rationale"`
+	Inputs      RecommendationInputs `json:"inputs"`
+}
+
+// BreakPlan splits the session into WorkMin blocks with Count breaks.
+type BreakPlan struct {
+	WorkMin  int `json:"work_min"`
+	BreakMin int `json:"break_min"`
+	Count    int `json:"count"`
+}
+
+// TimeWindow is when today to start, from the user's best remaining hour.
+type TimeWindow struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	AvgFocus float64   `json:"avg_focus"` // past sessions started in that hour
+	Sessions int       `json:"sessions"`
+}
+
+type RecommendationInputs struct {
+	BaselineMin        int         `json:"baseline_min"`
+	BaselineSource     string      `json:"baseline_source"` // personal | goal_target | default
+	RecentSessions     int         `json:"recent_sessions"`
+	FocusSessions      int         `json:"focus_sessions"` // sessions behind avg_focus
+	AvgFocus           *float64    `json:"avg_focus,omitempty"`
+	LongSessionFocus   *float64    `json:"long_session_focus,omitempty"`  // sessions over the baseline
+	ShortSessionFocus  *float64    `json:"short_session_focus,omitempty"` // sessions at or under it
+	PausesPerHour      float64     `json:"pauses_per_hour"`
+	FocusBlockMin      *float64    `json:"focus_block_min,omitempty"` // median minutes between pauses
+	FatigueDate        *time.Time  `json:"fatigue_date,omitempty"`
+	FatigueIndex       *float64    `json:"fatigue_index,omitempty"`
+	BurnoutProbability *float64    `json:"burnout_probability,omitempty"`
+	BestHours          []HourFocus `json:"best_hours"`
+	Timezone           string      `json:"timezone"`
+}
+
+func sessionPauses(s *models.StudySession) int {
+	if len(s.Breaks) > s.PauseCount {
+		return len(s.Breaks)
+	}
+	return s.PauseCount
+}
+
+func roundTo5(v float64) int {
+	return int(math.Round(v/5) * 5)
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func meanFocus(sessions []models.StudySession) *float64 {
+	if len(sessions) < recommendMinSamples {
+		return nil
+	}
+	sum := 0
+	for i := range sessions {
+		sum += sessions[i].FocusScore
+	}
+	v := math.Round(float64(sum)/float64(len(sessions))*10) / 10
+	return &v
+}
+
+// RecommendNextSession suggests a length, break cadence and time today for
+// the user's next session on a goal (goalID or goal name; by default the
+// goal of their latest session). It weighs the goal baseline, recent focus
+// scores, how long they usually go between pauses, their best hours and
+// their latest fatigue score.
+func RecommendNextSession(ctx context.Context, userID, goalID, goal string) (*SessionRecommendation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	st := store.Get()
+	loc := UserLocation(ctx, userID)
+	now := time.Now().In(loc)
+
+	history, err := st.SessionsBetween(ctx, userID, now.AddDate(0, 0, -recommendHistoryDays), now)
+	if err != nil {
+		return nil, err
+	}
+	recent := make([]models.StudySession, 0, len(history))
+	for i := range history {
+		if countsTowardBaseline(&history[i]) {
+			recent = append(recent, history[i])
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool { return recent[i].StartedAt.After(recent[j].StartedAt) })
+
+	target := &models.StudySession{UserID: userID, Goal: goal}
+	if goalID == "" && goal == "" && len(recent) > 0 {
+		target.Goal = recent[0].Goal // by name, in case its goal was archived since
+	}
+	if err := applyGoal(ctx, target, goalID); err != nil {
+		return nil, err
+	}
+
+	rec := &SessionRecommendation{Goal: target.Goal, GoalID: target.GoalID, Rationale: []string{}}
+	in := &rec.Inputs
+	in.Timezone = loc.String()
+	in.RecentSessions = len(recent)
+	in.BaselineMin, in.BaselineSource = goalDefault(ctx, target), "default"
+	if target.GoalID != "" {
+		if g, err := st.FindGoal(ctx, target.GoalID); err == nil && g.TargetMin > 0 {
+			in.BaselineSource = "goal_target"
+		}
+	}
+	if b, err := st.FindGoalBaseline(ctx, userID, baselineKey(target)); err == nil && b.Samples > 0 {
+		in.BaselineMin, in.BaselineSource = b.BaselineMin, "personal"
+	}
+	goalName := target.Goal
+	if goalName == "" {
+		goalName = "this goal"
+	}
+	switch in.BaselineSource {
+	case "personal":
+		rec.Rationale = append(rec.Rationale, fmt.Sprintf("Your sessions on %s usually run about %d minutes.", goalName, in.BaselineMin))
+	default:
+		rec.Rationale = append(rec.Rationale, fmt.Sprintf("Starting from the %d-minute target for %s; there is not enough history yet to learn your own.", in.BaselineMin, goalName))
+	}
+
+	// Focus on this goal lately, falling back to all goals.
+	var focusSet, long, short []models.StudySession
+	key := baselineKey(target)
+	for i := range recent {
+		if baselineKey(&recent[i]) == key && len(focusSet) < recommendFocusSamples {
+			focusSet = append(focusSet, recent[i])
+		}
+	}
+	if len(focusSet) < recommendMinSamples {
+		focusSet = recent
+		if len(focusSet) > recommendFocusSamples {
+			focusSet = focusSet[:recommendFocusSamples]
+		}
+	}
+	in.FocusSessions = len(focusSet)
+	in.AvgFocus = meanFocus(focusSet)
+	for i := range recent {
+		if recent[i].DurationMin > in.BaselineMin {
+			long = append(long, recent[i])
+		} else {
+			short = append(short, recent[i])
+		}
+	}
+	in.LongSessionFocus, in.ShortSessionFocus = meanFocus(long), meanFocus(short)
+
+	duration := float64(in.BaselineMin)
+	if in.AvgFocus != nil {
+		switch {
+		case *in.AvgFocus < 50:
+			duration *= 0.85
+			rec.Rationale = append(rec.Rationale, fmt.Sprintf("Recent focus has been low (%.0f/100), so a slightly shorter session is easier to sustain.", *in.AvgFocus))
+		case *in.AvgFocus >= 80:
+			duration *= 1.1
+			rec.Rationale = append(rec.Rationale, fmt.Sprintf("Recent focus has been strong (%.0f/100), so you can stretch a little longer.", *in.AvgFocus))
+		}
+	}
+	if in.LongSessionFocus != nil && in.ShortSessionFocus != nil && *in.LongSessionFocus+10 <= *in.ShortSessionFocus {
+		duration = math.Min(duration, float64(in.BaselineMin)) * 0.9
+		rec.Rationale = append(rec.Rationale, fmt.Sprintf("Your focus drops in sessions longer than %d minutes (%.0f vs %.0f).", in.BaselineMin, *in.LongSessionFocus, *in.ShortSessionFocus))
+	}
+
+	// Latest fatigue score, if it is from today or yesterday.
+	fatigueLevel := 0 // 0 normal, 1 elevated, 2 high
+	scores, err := st.RecentFatigueScores(ctx, userID, 1)
+	if err != nil {
+		return nil, err
+	}
+	today := localDay(now, loc)
+	if len(scores) > 0 && !scores[0].Date.UTC().Before(today.AddDate(0, 0, -1)) {
+		fs := scores[0]
+		date := fs.Date.UTC()
+		in.FatigueDate, in.FatigueIndex, in.BurnoutProbability = &date, &fs.FatigueIndex, &fs.BurnoutProbability
+		switch {
+		case fs.FatigueIndex >= 70 || fs.BurnoutProbability >= 70:
+			fatigueLevel = 2
+			duration *= 0.6
+			rec.Rationale = append(rec.Rationale, fmt.Sprintf("Your fatigue is high (index %.0f, burnout risk %.0f%%), so keep it short and rest more.", fs.FatigueIndex, fs.BurnoutProbability))
+		case fs.FatigueIndex >= 50 || fs.BurnoutProbability >= 50:
+			fatigueLevel = 1
+			duration *= 0.8
+			rec.Rationale = append(rec.Rationale, fmt.Sprintf("Your fatigue is elevated (index %.0f), so the session is trimmed.", fs.FatigueIndex))
+		}
+	}
+	rec.DurationMin = clampInt(roundTo5(duration), recommendMinMin, recommendMaxMin)
+
+	// Break cadence from how long the user usually works between pauses.
+	var blocks []float64
+	totalMin, totalPauses := 0, 0
+	for i := range recent {
+		s := &recent[i]
+		totalMin += s.DurationMin
+		totalPauses += sessionPauses(s)
+		if s.DurationMin >= recommendMinMin {
+			blocks = append(blocks, float64(s.DurationMin)/float64(sessionPauses(s)+1))
+		}
+	}
+	if totalMin > 0 {
+		in.PausesPerHour = math.Round(float64(totalPauses)/(float64(totalMin)/60)*100) / 100
+	}
+	block := defaultFocusBlockMin
+	if len(blocks) >= recommendMinSamples {
+		sort.Float64s(blocks)
+		median := math.Round(blocks[len(blocks)/2]*10) / 10
+		in.FocusBlockMin = &median
+		block = clampInt(roundTo5(median), 20, 60)
+		rec.Rationale = append(rec.Rationale, fmt.Sprintf("You typically work about %.0f minutes before pausing, so breaks are planned every %d minutes.", median, block))
+	}
+	block = clampInt(block-5*fatigueLevel, 20, 60)
+	plan := BreakPlan{WorkMin: block, BreakMin: clampInt(roundTo5(float64(block)/5), 5, 15) + 5*fatigueLevel}
+	if rec.DurationMin <= block+5 {
+		plan = BreakPlan{WorkMin: rec.DurationMin}
+	} else {
+		plan.Count = (rec.DurationMin+block-1)/block - 1
+	}
+	rec.Breaks = plan
+
+	// Best hour still ahead today.
+	ft, err := FocusByTimeOfDay(ctx, userID, StatsRange{From: timePtr(now.AddDate(0, 0, -recommendTimeDays))})
+	if err != nil {
+		return nil, err
+	}
+	var ranked []HourFocus
+	for _, h := range ft.ByHour {
+		if h.Sessions >= minSlotSessions {
+			ranked = append(ranked, h)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].AvgFocus > ranked[j].AvgFocus })
+	in.BestHours = ranked
+	if len(in.BestHours) > 3 {
+		in.BestHours = in.BestHours[:3]
+	}
+	for _, h := range ranked {
+		start := time.Date(now.Year(), now.Month(), now.Day(), h.Hour, 0, 0, 0, loc)
+		if start.Add(time.Hour).Before(now) || (h.Hour == now.Hour() && now.Minute() >= 30) {
+			continue
+		}
+		if start.Before(now) {
+			start = now.Truncate(time.Minute)
+		}
+		rec.Window = &TimeWindow{
+			Start:    start,
+			End:      start.Add(time.Duration(rec.DurationMin+plan.Count*plan.BreakMin) * time.Minute),
+			AvgFocus: h.AvgFocus,
+			Sessions: h.Sessions,
+		}
+		rec.Rationale = append(rec.Rationale, fmt.Sprintf("Sessions you start around %02d:00 average %.0f focus, your best hour left today.", h.Hour, h.AvgFocus))
+		break
+	}
+	if rec.Window == nil {
+		if len(ranked) == 0 {
+			rec.Rationale = append(rec.Rationale, "There is not enough history yet to pick a best time of day.")
+		} else {
+			rec.Rationale = append(rec.Rationale, fmt.Sprintf("Your best hours have passed for today; around %02d:00 tends to work best.", ranked[0].Hour))
+		}
+	}
+	return rec, nil
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
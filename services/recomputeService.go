@@ -0,0 +1,508 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrRecomputeRunning = errors.New("recompute job is already running")
+	ErrRecomputeDone    = errors.New("recompute job has already completed")
+	ErrRecomputeRange   = errors.New("recompute range must have from before to")
+)
+
+// RecomputeScope selects the users and the [From, To) range to recompute.
+// With neither UserID nor OrgID set every user is included. ModelVersion
+// pins one scoring model for everyone; by default each user is scored with
+// their organization's model or the active one.
+type RecomputeScope struct {
+	UserID       string
+	OrgID        string
+	From         time.Time
+	To           time.Time
+	DryRun       bool
+	ModelVersion string
+}
+
+const (
+	defaultRecomputeWorkers = 4
+	maxRecomputeWorkers     = 32
+	// Progress is saved, and the run's claim on the job renewed, this often.
+	recomputeSaveEvery = 2 * time.Second
+	// A job whose run has not renewed its claim for this long is taken to
+	// have died with its server, and may be resumed elsewhere.
+	recomputeLease = 30 * time.Second
+)
+
+// NewRecomputeJob validates scope and saves a pending job for it. The range
+// is widened to whole UTC days so every touched day is re-rolled completely.
+func NewRecomputeJob(ctx context.Context, scope RecomputeScope) (*models.RecomputeJob, error) {
+	from, to := utcDay(scope.From), utcDay(scope.To)
+	if !to.Equal(scope.To) {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return nil, ErrRecomputeRange
+	}
+	if scope.ModelVersion != "" {
+		if _, err := scoringModel(ctx, scope.ModelVersion); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	j := &models.RecomputeJob{
+		ID:           primitive.NewObjectID(),
+		UserID:       scope.UserID,
+		OrgID:        scope.OrgID,
+		From:         from,
+		To:           to,
+		DryRun:       scope.DryRun,
+		ModelVersion: scope.ModelVersion,
+		Status:       models.RecomputePending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := store.Get().SaveRecomputeJob(ctx, j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func GetRecomputeJob(ctx context.Context, jobID string) (*models.RecomputeJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().FindRecomputeJob(ctx, jobID)
+}
+
+// StartRecompute claims job, updates it to the claimed state and runs it
+// in the background.
+func StartRecompute(job *models.RecomputeJob, workers int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	claimed, err := claimRecompute(ctx, job)
+	if err != nil {
+		return err
+	}
+	*job = *claimed
+	go func() {
+		if err := runRecompute(context.Background(), claimed, workers); err != nil {
+			log.Printf("recompute %s: %v", claimed.ID.Hex(), err)
+		}
+	}()
+	return nil
+}
+
+// RunRecompute runs or resumes job to completion in the calling goroutine.
+func RunRecompute(ctx context.Context, job *models.RecomputeJob, workers int) error {
+	claimed, err := claimRecompute(ctx, job)
+	if err != nil {
+		return err
+	}
+	*job = *claimed
+	return runRecompute(ctx, job, workers)
+}
+
+// ResumableRecomputeJob loads a job that can be resumed from its checkpoint.
+func ResumableRecomputeJob(ctx context.Context, jobID string) (*models.RecomputeJob, error) {
+	job, err := GetRecomputeJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == models.RecomputeCompleted {
+		return job, ErrRecomputeDone
+	}
+	return job, nil
+}
+
+// claimRecompute claims job in the store for a new run, so only one run
+// works on it at a time across every server, and returns it as stored.
+func claimRecompute(ctx context.Context, job *models.RecomputeJob) (*models.RecomputeJob, error) {
+	owner := primitive.NewObjectID().Hex()
+	now := time.Now()
+	err := store.Get().ClaimRecomputeJob(ctx, job.ID.Hex(), owner, now, now.Add(recomputeLease))
+	if errors.Is(err, store.ErrStale) {
+		return nil, ErrRecomputeRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := store.Get().FindRecomputeJob(ctx, job.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if claimed.Owner != owner {
+		return nil, ErrRecomputeRunning
+	}
+	return claimed, nil
+}
+
+// saveRecompute stores the job's progress, renewing the run's claim while
+// it is running. It returns store.ErrStale if another run took the job.
+func saveRecompute(ctx context.Context, job *models.RecomputeJob) error {
+	job.UpdatedAt = time.Now()
+	job.LockedUntil = time.Time{}
+	if job.Status == models.RecomputeRunning {
+		job.LockedUntil = job.UpdatedAt.Add(recomputeLease)
+	}
+	return store.Get().UpdateRecomputeJob(ctx, job)
+}
+
+// userRecompute is the outcome of recomputing one user.
+type userRecompute struct {
+	index           int
+	userID          string
+	sessionsChecked int
+	sessionsChanged int
+	daysChecked     int
+	daysChanged     int
+	diffs           []models.RecomputeDiff
+	err             error
+}
+
+// runRecompute fans the job's users out to a bounded worker pool. Results
+// arrive out of order, so the checkpoint only advances past a user once
+// every user before it has finished too.
+func runRecompute(ctx context.Context, job *models.RecomputeJob, workers int) error {
+	if workers <= 0 {
+		workers = defaultRecomputeWorkers
+	}
+	if workers > maxRecomputeWorkers {
+		workers = maxRecomputeWorkers
+	}
+	job.Status = models.RecomputeRunning
+	job.Error = ""
+	var pinned *models.ScoringModel
+	if job.ModelVersion != "" {
+		m, err := scoringModel(ctx, job.ModelVersion)
+		if err != nil {
+			return failRecompute(ctx, job, fmt.Errorf("scoring model %q: %w", job.ModelVersion, err))
+		}
+		pinned = &m
+	}
+
+	var userIDs []string
+	err := store.Get().EachUser(ctx, job.OrgID, job.UserID, func(u *models.User) error {
+		if u.User_id > job.Checkpoint {
+			userIDs = append(userIDs, u.User_id)
+		}
+		return nil
+	})
+	if err != nil {
+		return failRecompute(ctx, job, err)
+	}
+	sort.Strings(userIDs)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	work := make(chan int)
+	results := make(chan userRecompute)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				model := pinned
+				if model == nil {
+					m := scoringModelFor(ctx, userIDs[i])
+					model = &m
+				}
+				r := recomputeUser(ctx, withModel(*model), userIDs[i], job.From, job.To, job.DryRun)
+				r.index = i
+				results <- r
+			}
+		}()
+	}
+	go func() {
+		defer close(work)
+		for i := range userIDs {
+			select {
+			case work <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results are folded into the job only as the checkpoint passes them,
+	// so a resumed job never counts a user twice. Progress is saved on a
+	// timer rather than per result, which also renews the claim while a
+	// slow user is being recomputed.
+	pending := make(map[int]userRecompute)
+	next := 0 // first user not yet folded in
+	tick := time.NewTicker(recomputeSaveEvery)
+	defer tick.Stop()
+	var firstErr error
+	for open := true; open; {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				open = false
+				break
+			}
+			if r.err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("user %s: %w", r.userID, r.err)
+					cancel()
+				}
+				continue
+			}
+			pending[r.index] = r
+			for {
+				done, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				foldRecompute(job, done)
+				next++
+			}
+		case <-tick.C:
+			if err := saveRecompute(ctx, job); err != nil && firstErr == nil {
+				firstErr = err
+				cancel()
+			}
+		}
+	}
+	if errors.Is(firstErr, store.ErrStale) {
+		return ErrRecomputeRunning
+	}
+	if firstErr == nil && next < len(userIDs) {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return failRecompute(ctx, job, firstErr)
+	}
+	job.Status = models.RecomputeCompleted
+	return saveRecompute(context.WithoutCancel(ctx), job)
+}
+
+func foldRecompute(job *models.RecomputeJob, r userRecompute) {
+	job.Checkpoint = r.userID
+	job.UsersDone++
+	job.SessionsChecked += r.sessionsChecked
+	job.SessionsChanged += r.sessionsChanged
+	job.DaysChecked += r.daysChecked
+	job.DaysChanged += r.daysChanged
+	for _, d := range r.diffs {
+		if len(job.Diffs) >= models.MaxRecomputeDiffs {
+			break
+		}
+		job.Diffs = append(job.Diffs, d)
+	}
+}
+
+func failRecompute(ctx context.Context, job *models.RecomputeJob, err error) error {
+	job.Status = models.RecomputeFailed
+	job.Error = err.Error()
+	if serr := saveRecompute(context.WithoutCancel(ctx), job); serr != nil {
+		log.Printf("recompute %s: save failed state: %v", job.ID.Hex(), serr)
+	}
+	return err
+}
+
+// modelPicker chooses the model to score a session or day with, given the
+// version it was last scored with ("" if it never was).
+type modelPicker func(version string) models.ScoringModel
+
+// withModel scores everything with model, as a recompute job does.
+func withModel(model models.ScoringModel) modelPicker {
+	return func(string) models.ScoringModel { return model }
+}
+
+// keepingModels re-scores each record with the model it was scored with,
+// and records never scored with the user's current model. It is for
+// re-scoring after the user's data changed, which must not upgrade their
+// history to a newer model behind their back.
+func keepingModels(ctx context.Context, userID string) modelPicker {
+	current := scoringModelFor(ctx, userID)
+	return func(version string) models.ScoringModel {
+		if version == "" || version == current.Version {
+			return current
+		}
+		m, err := scoringModel(ctx, version)
+		if err != nil {
+			log.Printf("scoring models: %q: %v", version, err)
+			return current
+		}
+		return m
+	}
+}
+
+// recomputeUser re-scores the user's finished sessions in [from, to) with
+// the models pick chooses and re-rolls the user's local days in the range,
+// comparing against what is stored. Unless dryRun is set, records whose
+// score or model version changed are written back and scores for days that
+// no longer have any sessions, e.g. after a timezone change, are removed.
+func recomputeUser(ctx context.Context, pick modelPicker, userID string, from, to time.Time, dryRun bool) userRecompute {
+	r := userRecompute{userID: userID}
+	st := store.Get()
+
+	// Earlier history feeds the consistency factor and the goal baseline
+	// of the first sessions in range. A day either side of the range holds
+	// the parts of the first and last local days that lie outside it.
+	loc := UserLocation(ctx, userID)
+	all, err := st.SessionsBetween(ctx, userID, from.AddDate(0, 0, -baselineWindowDays), to.AddDate(0, 0, 1))
+	if err != nil {
+		r.err = err
+		return r
+	}
+	matches, err := st.ListPlanMatches(ctx, userID, nil, nil)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	plans := make(map[string]*models.PlanMatch, len(matches))
+	for i := range matches {
+		plans[matches[i].SessionID] = &matches[i]
+	}
+	defaults := make(map[string]int)
+	byDay := make(map[time.Time][]models.StudySession)
+	var days []time.Time
+	for i := range all {
+		s := &all[i]
+		if !s.InProgress() && !s.StartedAt.Before(from) && s.StartedAt.Before(to) {
+			r.sessionsChecked++
+			hist := consistencyAt(priorSessions(all[:i], s.StartedAt), s.StartedAt, loc)
+			key := baselineKey(s)
+			if _, ok := defaults[key]; !ok {
+				defaults[key] = goalDefault(ctx, s)
+			}
+			baseline := computeGoalBaseline(userID, key, defaults[key], all[:i], s.StartedAt)
+			model := pick(s.ModelVersion)
+			score := focusScore(model, sessionInput(s, hist, baseline.BaselineMin, plans[s.ID.Hex()]))
+			if score != s.FocusScore {
+				r.sessionsChanged++
+				r.diffs = append(r.diffs, models.RecomputeDiff{
+					UserID: userID, SessionID: s.ID.Hex(), Field: "focus_score",
+					Old: float64(s.FocusScore), New: float64(score),
+				})
+			}
+			if score != s.FocusScore || s.ModelVersion != model.Version {
+				s.FocusScore = score
+				s.ModelVersion = model.Version
+				if !dryRun {
+					if err := st.ReplaceSession(ctx, s); err != nil {
+						r.err = err
+						return r
+					}
+				}
+			}
+		}
+		day := localDay(s.StartedAt, loc)
+		if day.Before(from) || !day.Before(to) {
+			continue
+		}
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], *s)
+	}
+	if !dryRun {
+		goals := make(map[string]*models.StudySession)
+		for _, d := range days {
+			for i := range byDay[d] {
+				goals[baselineKey(&byDay[d][i])] = &byDay[d][i]
+			}
+		}
+		for _, s := range goals {
+			if _, err := RefreshGoalBaseline(ctx, s); err != nil {
+				r.err = err
+				return r
+			}
+		}
+	}
+
+	stored, err := fatigueScoresBetween(ctx, userID, from, to)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	existing := make(map[time.Time]models.FatigueScore, len(stored))
+	for _, fs := range stored {
+		existing[fs.Date.UTC()] = fs
+	}
+	rolled := make(map[time.Time]bool)
+
+	for _, day := range days {
+		m := ComputeDayMetrics(byDay[day])
+		if m.TotalStudyHours == 0 {
+			continue
+		}
+		r.daysChecked++
+		rolled[day] = true
+		old, found := existing[day]
+		model := pick(old.ModelVersion)
+		score := newFatigueScore(model, userID, day, m.TotalStudyHours, m.BreakFrequency, m.FocusStability)
+		changed := !found || old.FatigueIndex != score.FatigueIndex || old.BurnoutProbability != score.BurnoutProbability
+		if changed {
+			r.daysChanged++
+			d := day
+			r.diffs = append(r.diffs,
+				models.RecomputeDiff{UserID: userID, Date: &d, Field: "fatigue_index", Old: old.FatigueIndex, New: score.FatigueIndex},
+				models.RecomputeDiff{UserID: userID, Date: &d, Field: "burnout_probability", Old: old.BurnoutProbability, New: score.BurnoutProbability},
+			)
+		}
+		if (changed || old.ModelVersion != model.Version) && !dryRun {
+			if err := st.UpsertFatigueScore(ctx, score); err != nil {
+				r.err = err
+				return r
+			}
+		}
+	}
+	var stale []time.Time
+	for day := range existing {
+		if !rolled[day] {
+			stale = append(stale, day)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Before(stale[j]) })
+	for _, day := range stale {
+		old := existing[day]
+		r.daysChecked++
+		r.daysChanged++
+		d := day
+		r.diffs = append(r.diffs,
+			models.RecomputeDiff{UserID: userID, Date: &d, Field: "fatigue_index", Old: old.FatigueIndex, New: 0},
+			models.RecomputeDiff{UserID: userID, Date: &d, Field: "burnout_probability", Old: old.BurnoutProbability, New: 0},
+		)
+		if !dryRun {
+			if err := st.DeleteFatigueScore(ctx, userID, day); err != nil {
+				r.err = err
+				return r
+			}
+		}
+	}
+	if r.daysChanged > 0 && !dryRun {
+		if err := EvaluateAlerts(ctx, userID); err != nil {
+			r.err = err
+		}
+	}
+	return r
+}
+
+// priorSessions returns, newest first, up to 20 of the oldest-first
+// finished sessions that started before at. Sessions are scored live and
+// recomputed from this same history.
+func priorSessions(oldestFirst []models.StudySession, at time.Time) []models.StudySession {
+	var out []models.StudySession
+	for i := len(oldestFirst) - 1; i >= 0 && len(out) < 20; i-- {
+		if oldestFirst[i].StartedAt.Before(at) && !oldestFirst[i].InProgress() {
+			out = append(out, oldestFirst[i])
+		}
+	}
+	return out
+}
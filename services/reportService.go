@@ -0,0 +1,295 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/notify"
+	"authentication/report"
+	"authentication/store"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidWeek = errors.New("week must be YYYY-Www (ISO week) or YYYY-MM-DD")
+
+// weekStart returns the Monday of the week containing day (a date key).
+func weekStart(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// ParseReportWeek reads "2026-W42" or any date in the week, and returns its
+// Monday as a date key. An empty value is the current week in loc.
+func ParseReportWeek(v string, loc *time.Location) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return weekStart(localDay(time.Now(), loc)), nil
+	}
+	if y, w, ok := strings.Cut(v, "-W"); ok {
+		year, err1 := strconv.Atoi(y)
+		week, err2 := strconv.Atoi(w)
+		if err1 != nil || err2 != nil || week < 1 || week > 53 {
+			return time.Time{}, ErrInvalidWeek
+		}
+		// 4 January is always in ISO week 1.
+		monday := weekStart(time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC)).AddDate(0, 0, 7*(week-1))
+		if _, got := monday.ISOWeek(); got != week {
+			return time.Time{}, ErrInvalidWeek
+		}
+		return monday, nil
+	}
+	d, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, ErrInvalidWeek
+	}
+	return weekStart(d), nil
+}
+
+// WeeklyReport summarizes the user's week starting on the Monday keyed by
+// week, in their timezone, against the week before.
+func WeeklyReport(ctx context.Context, userID string, week time.Time) (*report.Weekly, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	st := store.Get()
+	u, err := st.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	loc := UserLocation(ctx, userID)
+	week = weekStart(week)
+	prevWeek := week.AddDate(0, 0, -7)
+	nextWeek := week.AddDate(0, 0, 7)
+	from, _ := dayBounds(prevWeek, loc)
+	to, _ := dayBounds(nextWeek, loc)
+
+	sessions, err := st.SessionsBetween(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	scores, _, err := st.ListFatigueScores(ctx, userID, &prevWeek, &nextWeek, store.ListOptions{Limit: 14, Sort: "date"})
+	if err != nil {
+		return nil, err
+	}
+
+	w := &report.Weekly{
+		UserID:      userID,
+		Name:        strings.TrimSpace(deref(u.First_name) + " " + deref(u.Last_name)),
+		Timezone:    loc.String(),
+		WeekStart:   week,
+		Days:        make([]report.Day, 7),
+		GeneratedAt: time.Now().In(loc),
+	}
+	for i := range w.Days {
+		w.Days[i].Date = week.AddDate(0, 0, i)
+	}
+
+	goals := map[string]*report.GoalHours{}
+	var focus, prevFocus float64
+	for i := range sessions {
+		s := &sessions[i]
+		if s.InProgress() {
+			continue
+		}
+		day := localDay(s.StartedAt, loc)
+		name := s.Goal
+		if name == "" {
+			name = "(no goal)"
+		}
+		g := goals[name]
+		if g == nil {
+			g = &report.GoalHours{Goal: name}
+			goals[name] = g
+		}
+		if day.Before(week) {
+			w.PrevTotalMin += s.DurationMin
+			w.PrevSessions++
+			prevFocus += float64(s.FocusScore)
+			g.PrevMinutes += s.DurationMin
+			continue
+		}
+		d := &w.Days[int(day.Sub(week).Hours()/24)]
+		d.Minutes += s.DurationMin
+		d.Sessions++
+		w.TotalMin += s.DurationMin
+		w.Sessions++
+		focus += float64(s.FocusScore)
+		g.Minutes += s.DurationMin
+		g.Sessions++
+	}
+	if w.Sessions > 0 {
+		w.AvgFocus = math.Round(focus/float64(w.Sessions)*10) / 10
+	}
+	if w.PrevSessions > 0 {
+		w.PrevAvgFocus = math.Round(prevFocus/float64(w.PrevSessions)*10) / 10
+	}
+	for _, g := range goals {
+		w.Goals = append(w.Goals, *g)
+	}
+	sort.Slice(w.Goals, func(i, j int) bool {
+		if w.Goals[i].Minutes != w.Goals[j].Minutes {
+			return w.Goals[i].Minutes > w.Goals[j].Minutes
+		}
+		if w.Goals[i].PrevMinutes != w.Goals[j].PrevMinutes {
+			return w.Goals[i].PrevMinutes > w.Goals[j].PrevMinutes
+		}
+		return w.Goals[i].Goal < w.Goals[j].Goal
+	})
+
+	var fatigue, prevFatigue float64
+	var nScored, nPrevScored int
+	for _, fs := range scores {
+		day := fs.Date.UTC()
+		if day.Before(week) {
+			prevFatigue += fs.FatigueIndex
+			nPrevScored++
+			continue
+		}
+		d := &w.Days[int(day.Sub(week).Hours()/24)]
+		d.Scored = true
+		d.FatigueIndex = fs.FatigueIndex
+		d.BurnoutProbability = fs.BurnoutProbability
+		fatigue += fs.FatigueIndex
+		nScored++
+		if w.Peak == nil || d.BurnoutProbability > w.Peak.BurnoutProbability {
+			w.Peak = d
+		}
+	}
+	if nScored > 0 {
+		w.AvgFatigue = math.Round(fatigue/float64(nScored)*10) / 10
+	}
+	if nPrevScored > 0 {
+		w.PrevAvgFatigue = math.Round(prevFatigue/float64(nPrevScored)*10) / 10
+	}
+	w.FatigueTrend = report.FatigueTrendOf(w.Days)
+	if w.Peak != nil {
+		peak := *w.Peak
+		w.Peak = &peak
+	}
+	return w, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// ===================== SCHEDULED DELIVERY =====================
+
+func init() {
+	messageEnrichers[models.NotifyWeeklyReport] = attachWeeklyReport
+}
+
+// attachWeeklyReport renders the report when its email is sent, so the
+// queue only carries the week.
+func attachWeeklyReport(ctx context.Context, d *models.NotificationDelivery, m *notify.Message) error {
+	week, err := ParseReportWeek(d.Data["week"], time.UTC)
+	if err != nil {
+		return notify.Permanent(err)
+	}
+	w, err := WeeklyReport(ctx, d.UserID, week)
+	if err != nil {
+		return err
+	}
+	var html, pdf bytes.Buffer
+	if err := report.RenderHTML(&html, w); err != nil {
+		return err
+	}
+	if err := report.RenderPDF(&pdf, w); err != nil {
+		return err
+	}
+	m.HTML = html.String()
+	m.Attachments = append(m.Attachments, notify.Attachment{
+		Filename:    "weekly-report-" + w.ISOWeek() + ".pdf",
+		ContentType: "application/pdf",
+		Data:        pdf.Bytes(),
+	})
+	return nil
+}
+
+// SendWeeklyReports notifies every user whose last week has ended (it is
+// past sendHour on Monday in their timezone) about that week, once per
+// user and week. Users with no sessions that week are skipped.
+func SendWeeklyReports(ctx context.Context, sendHour int) (int, error) {
+	sent := 0
+	err := store.Get().EachUser(ctx, "", "", func(u *models.User) error {
+		loc := UserLocation(ctx, u.User_id)
+		now := time.Now().In(loc)
+		thisWeek := weekStart(localDay(now, loc))
+		due := time.Date(thisWeek.Year(), thisWeek.Month(), thisWeek.Day(), sendHour, 0, 0, 0, loc)
+		if now.Before(due) {
+			thisWeek = thisWeek.AddDate(0, 0, -7)
+		}
+		week := thisWeek.AddDate(0, 0, -7)
+		y, n := week.ISOWeek()
+		key := fmt.Sprintf("weekly_report:%s:%d-W%02d", u.User_id, y, n)
+		if err := store.Get().ClaimScheduledRun(ctx, key, u.User_id, time.Now()); errors.Is(err, store.ErrDuplicate) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		ok, err := sendWeeklyReport(ctx, u.User_id, week)
+		if err != nil {
+			log.Printf("weekly report: %s: %v", u.User_id, err)
+			if err := store.Get().ReleaseScheduledRun(ctx, key); err != nil {
+				log.Printf("weekly report: release %s: %v", key, err)
+			}
+			return nil
+		}
+		if ok {
+			sent++
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// sendWeeklyReport notifies the user about week, reporting false when
+// there was nothing to report.
+func sendWeeklyReport(ctx context.Context, userID string, week time.Time) (bool, error) {
+	w, err := WeeklyReport(ctx, userID, week)
+	if err != nil || w.Sessions == 0 {
+		return false, err
+	}
+	data := map[string]string{
+		"week":       w.ISOWeek(),
+		"week_label": w.Label(),
+		"hours":      report.Hours(w.TotalMin),
+		"sessions":   strconv.Itoa(w.Sessions),
+		"change":     report.Change(float64(w.TotalMin), float64(w.PrevTotalMin)),
+		"avg_focus":  fmt.Sprintf("%.0f", w.AvgFocus),
+	}
+	if w.Peak != nil {
+		data["peak_day"] = w.Peak.Date.Format("Monday")
+		data["peak_burnout"] = fmt.Sprintf("%.0f", w.Peak.BurnoutProbability)
+	}
+	return true, Notify(ctx, userID, models.NotifyWeeklyReport, data)
+}
+
+// StartWeeklyReportJob runs SendWeeklyReports every interval.
+func StartWeeklyReportJob(ctx context.Context, interval time.Duration, sendHour int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := SendWeeklyReports(ctx, sendHour); err != nil {
+					log.Printf("weekly report: %v", err)
+				} else if n > 0 {
+					log.Printf("weekly report: sent %d report(s)", n)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"authentication/helpers"
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+// DayMetrics are the daily inputs to the fatigue model.
+type DayMetrics struct {
+	TotalStudyHours float64
+	BreakFrequency  float64 // breaks per study hour
+	FocusStability  float64 // 0-100, lower = more volatile
+}
+
+// utcDay truncates t to midnight UTC.
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// localDay returns the calendar day t falls on in loc, keyed the way
+// FatigueScore.Date is: midnight UTC of that date.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// dayBounds returns when the calendar day keyed by day starts and ends in
+// loc. Days around a DST change are 23 or 25 hours long.
+func dayBounds(day time.Time, loc *time.Location) (start, end time.Time) {
+	start = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	end = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+	return start, end
+}
+
+// ComputeDayMetrics aggregates one day's finished sessions. Focus stability
+// is 100 minus the population standard deviation of the sessions' focus
+// scores, so a day of evenly focused sessions scores 100 and erratic days
+// score lower. Sessions still in progress are ignored.
+func ComputeDayMetrics(all []models.StudySession) DayMetrics {
+	var m DayMetrics
+	sessions := make([]models.StudySession, 0, len(all))
+	for _, s := range all {
+		if !s.InProgress() {
+			sessions = append(sessions, s)
+		}
+	}
+	if len(sessions) == 0 {
+		return m
+	}
+	totalMin, breaks := 0, 0
+	var sum, sumSq float64
+	for _, s := range sessions {
+		totalMin += s.DurationMin
+		b := s.PauseCount
+		if len(s.Breaks) > b {
+			b = len(s.Breaks)
+		}
+		breaks += b
+		f := float64(s.FocusScore)
+		sum += f
+		sumSq += f * f
+	}
+	m.TotalStudyHours = float64(totalMin) / 60
+	if m.TotalStudyHours > 0 {
+		m.BreakFrequency = float64(breaks) / m.TotalStudyHours
+	}
+	n := float64(len(sessions))
+	mean := sum / n
+	variance := math.Max(0, sumSq/n-mean*mean)
+	m.FocusStability = math.Max(0, math.Min(100, 100-math.Sqrt(variance)))
+
+	m.TotalStudyHours = math.Round(m.TotalStudyHours*100) / 100
+	m.BreakFrequency = math.Round(m.BreakFrequency*100) / 100
+	m.FocusStability = math.Round(m.FocusStability*10) / 10
+	return m
+}
+
+// RollupDay recomputes and upserts the user's FatigueScore for the day
+// containing at in the user's timezone, then re-evaluates their alerts.
+// When the user has no finished sessions that day any stored score is
+// removed and nil is returned.
+func RollupDay(ctx context.Context, userID string, at time.Time) (*models.FatigueScore, error) {
+	score, err := rollupDay(ctx, userID, at)
+	if err != nil {
+		return nil, err
+	}
+	if err := EvaluateAlerts(ctx, userID); err != nil {
+		helpers.Logf(ctx, "evaluate alerts: %v", err)
+	}
+	return score, nil
+}
+
+// rollupDay is RollupDay without the alert evaluation, for callers rolling
+// several days that evaluate once at the end.
+func rollupDay(ctx context.Context, userID string, at time.Time) (*models.FatigueScore, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	loc := UserLocation(ctx, userID)
+	day := localDay(at, loc)
+	start, end := dayBounds(day, loc)
+	sessions, err := store.Get().SessionsBetween(ctx, userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var score *models.FatigueScore
+	m := ComputeDayMetrics(sessions)
+	if m.TotalStudyHours == 0 {
+		err = store.Get().DeleteFatigueScore(ctx, userID, day)
+	} else {
+		score, err = RecomputeAndUpsertFatigueScore(ctx, userID, day, m.TotalStudyHours, m.BreakFrequency, m.FocusStability)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return score, nil
+}
+
+// RollupSince re-rolls every (user, day) that has sessions started at or
+// after since, then evaluates each rolled user's alerts once, so catching
+// up on many days does not notify once per day. Upserts are idempotent,
+// so overlapping runs are harmless.
+func RollupSince(ctx context.Context, since time.Time) (int, error) {
+	days, err := store.Get().SessionDays(ctx, utcDay(since))
+	if err != nil {
+		return 0, err
+	}
+	// SessionDays groups by UTC day, which overlaps up to two of the user's
+	// local days, so both ends are rolled and repeats skipped.
+	type userDay struct {
+		userID string
+		day    time.Time
+	}
+	seen := make(map[userDay]bool)
+	locs := make(map[string]*time.Location)
+	var rolled []string
+	rolledUser := make(map[string]bool)
+	done := 0
+	for _, d := range days {
+		loc, ok := locs[d.UserID]
+		if !ok {
+			loc = UserLocation(ctx, d.UserID)
+			locs[d.UserID] = loc
+		}
+		for _, at := range []time.Time{d.Day, d.Day.Add(24*time.Hour - time.Nanosecond)} {
+			if ctx.Err() != nil {
+				return done, ctx.Err()
+			}
+			key := userDay{d.UserID, localDay(at, loc)}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if _, err := rollupDay(ctx, d.UserID, at); err != nil {
+				helpers.Logf(helpers.WithUserID(ctx, d.UserID), "rollup %s: %v", key.day.Format("2006-01-02"), err)
+				continue
+			}
+			if !rolledUser[d.UserID] {
+				rolledUser[d.UserID] = true
+				rolled = append(rolled, d.UserID)
+			}
+			done++
+		}
+	}
+	for _, userID := range rolled {
+		if ctx.Err() != nil {
+			return done, ctx.Err()
+		}
+		if err := EvaluateAlerts(ctx, userID); err != nil {
+			helpers.Logf(helpers.WithUserID(ctx, userID), "evaluate alerts: %v", err)
+		}
+	}
+	return done, nil
+}
+
+// StartRollupJob re-rolls the last lookbackDays days every interval, catching
+// up on any day whose incremental rollup was missed.
+func StartRollupJob(ctx context.Context, interval time.Duration, lookbackDays int) {
+	run := func() {
+		since := time.Now().AddDate(0, 0, -lookbackDays)
+		n, err := RollupSince(ctx, since)
+		if err != nil {
+			log.Printf("rollup job: %v", err)
+			return
+		}
+		log.Printf("rollup job: refreshed %d user-day score(s)", n)
+	}
+	go func() {
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/scoring"
+	"authentication/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidScoringModel = errors.New("invalid scoring model")
+
+// DefaultScoringModel is the built-in v1 model: the weights the scorers
+// used before models were versioned, so existing scores stay reproducible.
+var DefaultScoringModel = models.ScoringModel{
+	Version:     "v1",
+	Description: "built-in default",
+	Params: models.ScoringParams{
+		FatigueStudyHours:      0.4,
+		FatigueBreakFreq:       -0.3,
+		FatigueFocusVolatility: 0.3,
+		FatigueScale:           25,
+		BurnoutSteepness:       0.1,
+		BurnoutMidpoint:        50,
+		FocusCompletion:        0.4,
+		FocusStability:         0.2,
+		FocusSelf:              0.2,
+		FocusHistory:           0.2,
+	},
+}
+
+// The active model is cached briefly so an activation made on another
+// instance is picked up without a restart.
+const scoringModelTTL = 30 * time.Second
+
+var (
+	scoringMu     sync.Mutex
+	scoringActive *models.ScoringModel
+	scoringAt     time.Time
+
+	// Org overrides are cached the same way; versions never change once
+	// created, so models looked up by version are kept for good.
+	orgModels    = map[string]orgModelEntry{}
+	modelsByName = map[string]models.ScoringModel{}
+)
+
+type orgModelEntry struct {
+	version string
+	at      time.Time
+}
+
+// InitScoringModels seeds the built-in model and any models listed in the
+// JSON file at path (skipped when empty), then activates defaultVersion if
+// no model is active yet. Seeded versions that already exist are left as
+// they are, since versions are immutable.
+func InitScoringModels(ctx context.Context, path, defaultVersion string) error {
+	seed := []models.ScoringModel{DefaultScoringModel}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("scoring models: %w", err)
+		}
+		var fromFile []models.ScoringModel
+		if err := json.Unmarshal(b, &fromFile); err != nil {
+			return fmt.Errorf("scoring models %s: %w", path, err)
+		}
+		seed = append(seed, fromFile...)
+	}
+	for i := range seed {
+		m := seed[i]
+		if err := validateScoringModel(&m); err != nil {
+			return fmt.Errorf("scoring model %q: %w", m.Version, err)
+		}
+		m.Active = false
+		m.ActivatedAt = nil
+		m.CreatedAt = time.Now()
+		if err := store.Get().CreateScoringModel(ctx, &m); err != nil && !errors.Is(err, store.ErrDuplicate) {
+			return err
+		}
+	}
+
+	if _, err := store.Get().ActiveScoringModel(ctx); !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if defaultVersion == "" {
+		defaultVersion = DefaultScoringModel.Version
+	}
+	log.Printf("scoring models: activating %s", defaultVersion)
+	return store.Get().ActivateScoringModel(ctx, defaultVersion, time.Now())
+}
+
+func validateScoringModel(m *models.ScoringModel) error {
+	m.Version = strings.TrimSpace(m.Version)
+	p := m.Params
+	switch {
+	case m.Version == "":
+		return fmt.Errorf("%w: version is required", ErrInvalidScoringModel)
+	case p.FocusCompletion < 0 || p.FocusStability < 0 || p.FocusSelf < 0 || p.FocusHistory < 0:
+		return fmt.Errorf("%w: focus weights must not be negative", ErrInvalidScoringModel)
+	case p.FocusCompletion+p.FocusStability+p.FocusSelf+p.FocusHistory <= 0:
+		return fmt.Errorf("%w: focus weights must not all be zero", ErrInvalidScoringModel)
+	case p.FocusPlan < 0 || p.FocusPlan > 1:
+		return fmt.Errorf("%w: focus_plan must be between 0 and 1", ErrInvalidScoringModel)
+	case p.FatigueScale <= 0:
+		return fmt.Errorf("%w: fatigue_scale must be greater than 0", ErrInvalidScoringModel)
+	case p.BurnoutSteepness <= 0:
+		return fmt.Errorf("%w: burnout_steepness must be greater than 0", ErrInvalidScoringModel)
+	}
+	focus, fatigue := scoring.Names()
+	if _, err := scoring.Focus(m.FocusScorer); err != nil {
+		return fmt.Errorf("%w: unknown focus_scorer %q (have %s)", ErrInvalidScoringModel, m.FocusScorer, strings.Join(focus, ", "))
+	}
+	if _, err := scoring.Fatigue(m.FatigueModel); err != nil {
+		return fmt.Errorf("%w: unknown fatigue_model %q (have %s)", ErrInvalidScoringModel, m.FatigueModel, strings.Join(fatigue, ", "))
+	}
+	return nil
+}
+
+// scorers resolves the formulas a model names. A formula that is no longer
+// registered falls back to the default so scoring never stops.
+func scorers(m models.ScoringModel) (scoring.FocusScorer, scoring.FatigueModel) {
+	focus, err := scoring.Focus(m.FocusScorer)
+	if err != nil {
+		log.Printf("scoring model %s: %v; using default", m.Version, err)
+		focus, _ = scoring.Focus(scoring.Default)
+	}
+	fatigue, err := scoring.Fatigue(m.FatigueModel)
+	if err != nil {
+		log.Printf("scoring model %s: %v; using default", m.Version, err)
+		fatigue, _ = scoring.Fatigue(scoring.Default)
+	}
+	return focus, fatigue
+}
+
+// focusScore scores one session with model.
+func focusScore(m models.ScoringModel, s scoring.Session) int {
+	focus, _ := scorers(m)
+	return focus.FocusScore(m.Params, s)
+}
+
+// activeScoringModel returns the model new scores are computed with. If the
+// store cannot be read it keeps using the last known model, or v1.
+func activeScoringModel(ctx context.Context) models.ScoringModel {
+	scoringMu.Lock()
+	defer scoringMu.Unlock()
+	if scoringActive != nil && time.Since(scoringAt) < scoringModelTTL {
+		return *scoringActive
+	}
+	m, err := store.Get().ActiveScoringModel(ctx)
+	if err != nil {
+		log.Printf("scoring models: load active model: %v", err)
+		if scoringActive != nil {
+			return *scoringActive
+		}
+		return DefaultScoringModel
+	}
+	scoringActive, scoringAt = m, time.Now()
+	return *m
+}
+
+// scoringModel returns a specific version, e.g. to resume a recompute job.
+func scoringModel(ctx context.Context, version string) (models.ScoringModel, error) {
+	scoringMu.Lock()
+	m, ok := modelsByName[version]
+	scoringMu.Unlock()
+	if ok {
+		return m, nil
+	}
+	found, err := store.Get().FindScoringModel(ctx, version)
+	if err != nil {
+		return models.ScoringModel{}, err
+	}
+	scoringMu.Lock()
+	modelsByName[version] = *found
+	scoringMu.Unlock()
+	return *found, nil
+}
+
+// scoringModelFor returns the model that scores userID's data: their
+// organization's pinned version if it has one, otherwise the active model.
+func scoringModelFor(ctx context.Context, userID string) models.ScoringModel {
+	u, err := store.Get().FindUserByID(ctx, userID)
+	if err != nil || u.Org_id == "" {
+		return activeScoringModel(ctx)
+	}
+	version := orgScoringVersion(ctx, u.Org_id)
+	if version == "" {
+		return activeScoringModel(ctx)
+	}
+	m, err := scoringModel(ctx, version)
+	if err != nil {
+		log.Printf("scoring models: org %s pins %q: %v", u.Org_id, version, err)
+		return activeScoringModel(ctx)
+	}
+	return m
+}
+
+func orgScoringVersion(ctx context.Context, orgID string) string {
+	scoringMu.Lock()
+	e, ok := orgModels[orgID]
+	scoringMu.Unlock()
+	if ok && time.Since(e.at) < scoringModelTTL {
+		return e.version
+	}
+	version := ""
+	o, err := store.Get().FindOrgSettings(ctx, orgID)
+	switch {
+	case err == nil:
+		version = o.ScoringModel
+	case !errors.Is(err, store.ErrNotFound):
+		log.Printf("scoring models: org %s settings: %v", orgID, err)
+		if ok {
+			return e.version
+		}
+	}
+	scoringMu.Lock()
+	orgModels[orgID] = orgModelEntry{version: version, at: time.Now()}
+	scoringMu.Unlock()
+	return version
+}
+
+// OrgScoringModel returns the version orgID pins ("" when it follows the
+// active model).
+func OrgScoringModel(ctx context.Context, orgID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	o, err := store.Get().FindOrgSettings(ctx, orgID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return o.ScoringModel, nil
+}
+
+// SetOrgScoringModel pins orgID to version, or back to the active model
+// when version is empty.
+func SetOrgScoringModel(ctx context.Context, orgID, version string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if version != "" {
+		if _, err := scoringModel(ctx, version); err != nil {
+			return err
+		}
+	}
+	o, err := store.Get().FindOrgSettings(ctx, orgID)
+	if errors.Is(err, store.ErrNotFound) {
+		o, err = &models.OrgSettings{OrgID: orgID}, nil
+	}
+	if err != nil {
+		return err
+	}
+	o.ScoringModel = version
+	o.UpdatedAt = time.Now()
+	if err := store.Get().SaveOrgSettings(ctx, o); err != nil {
+		return err
+	}
+	scoringMu.Lock()
+	orgModels[orgID] = orgModelEntry{version: version, at: time.Now()}
+	scoringMu.Unlock()
+	return nil
+}
+
+func ListScoringModels(ctx context.Context) ([]models.ScoringModel, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListScoringModels(ctx)
+}
+
+// CreateScoringModel stores a new, inactive model version.
+func CreateScoringModel(ctx context.Context, m *models.ScoringModel) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := validateScoringModel(m); err != nil {
+		return err
+	}
+	m.Active = false
+	m.ActivatedAt = nil
+	m.CreatedAt = time.Now()
+	return store.Get().CreateScoringModel(ctx, m)
+}
+
+// ActivateScoringModel switches new scores to version, except for
+// organizations that pin their own. Stored scores keep
+// their old version until they are recomputed.
+func ActivateScoringModel(ctx context.Context, version string) (*models.ScoringModel, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := store.Get().ActivateScoringModel(ctx, version, time.Now()); err != nil {
+		return nil, err
+	}
+	m, err := store.Get().FindScoringModel(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	scoringMu.Lock()
+	scoringActive, scoringAt = m, time.Now()
+	scoringMu.Unlock()
+	return m, nil
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidSessionEdit = errors.New("invalid session edit")
+
+// Unit-of-work ops for session edits. Like the account ops they are
+// idempotent, so the outbox relay can replay them.
+const (
+	opCreateSessionEdit    = "session_edits.create"
+	opReplaceSession       = "study_sessions.replace"
+	opDeleteSession        = "study_sessions.delete"
+	opDeleteSessionMatches = "plan_matches.delete_by_session"
+)
+
+type sessionIDPayload struct {
+	SessionID string `json:"session_id"`
+}
+
+func init() {
+	store.RegisterOp(opCreateSessionEdit, func(ctx context.Context, st store.Store, payload []byte) error {
+		var e models.SessionEdit
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		edits, err := st.ListSessionEdits(ctx, e.SessionID)
+		if err != nil {
+			return err
+		}
+		for _, done := range edits {
+			if done.ID == e.ID {
+				return nil
+			}
+		}
+		return st.CreateSessionEdit(ctx, &e)
+	})
+	store.RegisterOp(opReplaceSession, func(ctx context.Context, st store.Store, payload []byte) error {
+		var s models.StudySession
+		if err := json.Unmarshal(payload, &s); err != nil {
+			return err
+		}
+		return st.ReplaceSession(ctx, &s)
+	})
+	store.RegisterOp(opDeleteSession, func(ctx context.Context, st store.Store, payload []byte) error {
+		var p sessionIDPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		if err := st.DeleteSession(ctx, p.SessionID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+	store.RegisterOp(opDeleteSessionMatches, func(ctx context.Context, st store.Store, payload []byte) error {
+		var p sessionIDPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		return st.DeletePlanMatchesBySession(ctx, p.SessionID)
+	})
+}
+
+// SessionPatch holds corrections to a finished session. Nil fields are
+// left as they are.
+type SessionPatch struct {
+	Mode       *string
+	Goal       *string
+	GoalID     *string // "" unlinks the catalog goal
+	PlannedMin *int
+	ActualMin  *int
+	StartedAt  *time.Time
+	PauseCount *int
+	SelfRating *int
+	SelfOnTask *string
+}
+
+// ownedFinishedSession loads one of the user's finished sessions. Sessions
+// still in progress change through the live session routes instead.
+func ownedFinishedSession(ctx context.Context, userID, sessionID string) (*models.StudySession, error) {
+	s, err := store.Get().FindSession(ctx, sessionID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && s.UserID != userID) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.InProgress() {
+		return s, ErrSessionState
+	}
+	return s, nil
+}
+
+// applyPatch changes s and returns the JSON names of the fields that
+// changed.
+func applyPatch(ctx context.Context, s *models.StudySession, p SessionPatch) ([]string, error) {
+	var fields []string
+	if p.Mode != nil {
+		mode := strings.ToLower(*p.Mode)
+		if mode != "timer" && mode != "stopwatch" {
+			return nil, fmt.Errorf("%w: mode must be timer or stopwatch", ErrInvalidSessionEdit)
+		}
+		if mode != s.Mode {
+			s.Mode = mode
+			fields = append(fields, "mode")
+		}
+	}
+	if p.GoalID != nil || p.Goal != nil {
+		goalID, goal := s.GoalID, s.Goal
+		switch {
+		case p.GoalID != nil && *p.GoalID != "":
+			if err := applyGoal(ctx, s, *p.GoalID); err != nil {
+				return nil, err
+			}
+		default:
+			if p.Goal != nil {
+				s.Goal = strings.TrimSpace(*p.Goal)
+			}
+			if s.Goal == "" {
+				s.Goal = "unspecified"
+			}
+			s.GoalID = ""
+			if err := applyGoal(ctx, s, ""); err != nil {
+				return nil, err
+			}
+		}
+		if s.GoalID != goalID || s.Goal != goal {
+			fields = append(fields, "goal")
+		}
+	}
+	if p.PlannedMin != nil && *p.PlannedMin != s.PlannedMin {
+		if *p.PlannedMin < 0 {
+			return nil, fmt.Errorf("%w: planned_min must not be negative", ErrInvalidSessionEdit)
+		}
+		s.PlannedMin = *p.PlannedMin
+		fields = append(fields, "planned_min")
+	}
+	if p.StartedAt != nil && !p.StartedAt.Equal(s.StartedAt) {
+		if p.StartedAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: started_at is in the future", ErrInvalidSessionEdit)
+		}
+		// The whole session moves: its end and its breaks with it. Breaks
+		// are copied since the original is kept for the edit history.
+		shift := p.StartedAt.Sub(s.StartedAt)
+		if s.EndedAt != nil {
+			end := s.EndedAt.Add(shift)
+			s.EndedAt = &end
+		}
+		if len(s.Breaks) > 0 {
+			breaks := make([]models.BreakInterval, len(s.Breaks))
+			for i, br := range s.Breaks {
+				br.StartedAt, br.EndedAt = br.StartedAt.Add(shift), br.EndedAt.Add(shift)
+				breaks[i] = br
+			}
+			s.Breaks = breaks
+		}
+		s.StartedAt = *p.StartedAt
+		fields = append(fields, "started_at")
+	}
+	if p.ActualMin != nil && *p.ActualMin != s.DurationMin {
+		if *p.ActualMin <= 0 {
+			return nil, fmt.Errorf("%w: actual_min must be greater than 0", ErrInvalidSessionEdit)
+		}
+		if s.EndedAt != nil {
+			end := s.EndedAt.Add(time.Duration(*p.ActualMin-s.DurationMin) * time.Minute)
+			s.EndedAt = &end
+		}
+		s.DurationMin = *p.ActualMin
+		fields = append(fields, "actual_min")
+	}
+	if p.PauseCount != nil && *p.PauseCount != s.PauseCount {
+		if *p.PauseCount < 0 {
+			return nil, fmt.Errorf("%w: pause_count must not be negative", ErrInvalidSessionEdit)
+		}
+		s.PauseCount = *p.PauseCount
+		fields = append(fields, "pause_count")
+	}
+	if p.SelfRating != nil && *p.SelfRating != s.SelfRating {
+		if *p.SelfRating < 1 || *p.SelfRating > 5 {
+			return nil, fmt.Errorf("%w: self_rating must be 1-5", ErrInvalidSessionEdit)
+		}
+		s.SelfRating = *p.SelfRating
+		fields = append(fields, "self_rating")
+	}
+	if p.SelfOnTask != nil && *p.SelfOnTask != s.SelfOnTask {
+		v := strings.ToLower(*p.SelfOnTask)
+		if v != "" && v != "yes" && v != "somewhat" && v != "no" {
+			return nil, fmt.Errorf("%w: self_on_task must be yes, somewhat or no", ErrInvalidSessionEdit)
+		}
+		s.SelfOnTask = v
+		fields = append(fields, "self_on_task")
+	}
+	return fields, nil
+}
+
+// UpdateStudySession corrects one of the user's finished sessions, records
+// the original in its edit history and re-scores it along with everything
+// the change affects. The history entry, the session and its dropped plan
+// match are written as one unit; scoring follows once it has committed.
+func UpdateStudySession(ctx context.Context, userID, sessionID string, p SessionPatch) (*models.StudySession, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	s, err := ownedFinishedSession(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	original := *s
+	fields, err := applyPatch(ctx, s, p)
+	if err != nil || len(fields) == 0 {
+		return s, err
+	}
+	err = runUnit(ctx, "session_update",
+		op(opCreateSessionEdit, newSessionEdit(userID, models.SessionEditUpdate, fields, &original)),
+		op(opReplaceSession, s),
+		op(opDeleteSessionMatches, sessionIDPayload{SessionID: sessionID}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	savePlanMatch(ctx, matchPlannedSession(ctx, s))
+	if err := rescoreAfterEdit(ctx, &original, s); err != nil {
+		return nil, err
+	}
+	return store.Get().FindSession(ctx, sessionID)
+}
+
+// DeleteStudySession removes one of the user's finished sessions, keeping
+// it in the edit history, and re-scores what it affected once the removal
+// has committed.
+func DeleteStudySession(ctx context.Context, userID, sessionID string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	s, err := ownedFinishedSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	p := sessionIDPayload{SessionID: sessionID}
+	err = runUnit(ctx, "session_delete",
+		op(opCreateSessionEdit, newSessionEdit(userID, models.SessionEditDelete, nil, s)),
+		op(opDeleteSessionMatches, p),
+		op(opDeleteSession, p),
+	)
+	if err != nil {
+		return err
+	}
+	return rescoreAfterEdit(ctx, s, nil)
+}
+
+// SessionHistory returns the edits of one of the user's sessions, which
+// may since have been deleted.
+func SessionHistory(ctx context.Context, userID, sessionID string) ([]models.SessionEdit, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	edits, err := store.Get().ListSessionEdits(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(edits) == 0 {
+		if _, err := ownedFinishedSession(ctx, userID, sessionID); err != nil && !errors.Is(err, ErrSessionState) {
+			return nil, err
+		}
+		return []models.SessionEdit{}, nil
+	}
+	if edits[0].UserID != userID {
+		return nil, ErrSessionNotFound
+	}
+	return edits, nil
+}
+
+func newSessionEdit(userID, action string, fields []string, original *models.StudySession) *models.SessionEdit {
+	return &models.SessionEdit{
+		ID:        primitive.NewObjectID(),
+		SessionID: original.ID.Hex(),
+		UserID:    original.UserID,
+		EditedBy:  userID,
+		Action:    action,
+		Fields:    fields,
+		Original:  *original,
+		CreatedAt: time.Now(),
+	}
+}
+
+// rescoreAfterEdit re-scores the sessions and re-rolls the days a changed
+// session touches: its old and new days, and the sessions after it whose
+// consistency or goal baseline looked back at it. Each keeps the model it
+// was scored with. updated is nil after a delete.
+func rescoreAfterEdit(ctx context.Context, original, updated *models.StudySession) error {
+	userID := original.UserID
+	loc := UserLocation(ctx, userID)
+	first, last := original.StartedAt, original.StartedAt
+	if updated != nil {
+		if updated.StartedAt.Before(first) {
+			first = updated.StartedAt
+		}
+		if updated.StartedAt.After(last) {
+			last = updated.StartedAt
+		}
+	}
+	from := localDay(first, loc).AddDate(0, 0, -1)
+	to := localDay(last, loc).AddDate(0, 0, baselineWindowDays+2)
+	if end := localDay(time.Now(), loc).AddDate(0, 0, 2); to.After(end) {
+		to = end
+	}
+	r := recomputeUser(ctx, keepingModels(ctx, userID), userID, from, to, false)
+	if r.err != nil {
+		return r.err
+	}
+	// The old goal may have no sessions left in range to refresh it.
+	if updated == nil || baselineKey(updated) != baselineKey(original) {
+		if _, err := RefreshGoalBaseline(ctx, original); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// editStore keeps sessions, edits and plan matches in memory and has no
+// transactions, so units of work apply their ops one by one.
+type editStore struct {
+	store.Store
+	sessions map[string]models.StudySession
+	edits    []models.SessionEdit
+	matches  map[string]string // plan match ID -> session ID
+}
+
+func (s *editStore) SupportsTransactions(ctx context.Context) bool { return false }
+
+func (s *editStore) ListSessionEdits(ctx context.Context, sessionID string) ([]models.SessionEdit, error) {
+	var out []models.SessionEdit
+	for _, e := range s.edits {
+		if e.SessionID == sessionID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *editStore) CreateSessionEdit(ctx context.Context, e *models.SessionEdit) error {
+	s.edits = append(s.edits, *e)
+	return nil
+}
+
+func (s *editStore) ReplaceSession(ctx context.Context, sess *models.StudySession) error {
+	s.sessions[sess.ID.Hex()] = *sess
+	return nil
+}
+
+func (s *editStore) DeleteSession(ctx context.Context, sessionID string) error {
+	if _, ok := s.sessions[sessionID]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+func (s *editStore) DeletePlanMatchesBySession(ctx context.Context, sessionID string) error {
+	for id, sid := range s.matches {
+		if sid == sessionID {
+			delete(s.matches, id)
+		}
+	}
+	return nil
+}
+
+// TestSessionEditOpsReplay applies an edit's unit twice, as the outbox
+// relay may after a crash, and expects the same end state as once.
+func TestSessionEditOpsReplay(t *testing.T) {
+	sess := models.StudySession{
+		ID:          primitive.NewObjectID(),
+		UserID:      "u1",
+		Goal:        "maths",
+		StartedAt:   time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+		DurationMin: 45,
+	}
+	id := sess.ID.Hex()
+	updated := sess
+	updated.DurationMin = 50
+	edit := newSessionEdit("u1", models.SessionEditUpdate, []string{"actual_min"}, &sess)
+
+	fs := &editStore{
+		sessions: map[string]models.StudySession{id: sess},
+		matches:  map[string]string{"plan@1": id, "plan@2": "other"},
+	}
+	store.Set(fs)
+	update := func() error {
+		return runUnit(context.Background(), "session_update",
+			op(opCreateSessionEdit, edit),
+			op(opReplaceSession, &updated),
+			op(opDeleteSessionMatches, sessionIDPayload{SessionID: id}),
+		)
+	}
+	for i := 0; i < 2; i++ {
+		if err := update(); err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+	if len(fs.edits) != 1 || fs.edits[0].Original.DurationMin != 45 || !fs.edits[0].Original.StartedAt.Equal(sess.StartedAt) {
+		t.Fatalf("edits %+v, want one holding the original", fs.edits)
+	}
+	if got := fs.sessions[id]; got.DurationMin != 50 || got.ID != sess.ID {
+		t.Fatalf("session %+v, want the corrected one", got)
+	}
+	if _, ok := fs.matches["plan@1"]; ok || len(fs.matches) != 1 {
+		t.Fatalf("plan matches %v, want only the other session's", fs.matches)
+	}
+
+	p := sessionIDPayload{SessionID: id}
+	for i := 0; i < 2; i++ {
+		err := runUnit(context.Background(), "session_delete",
+			op(opCreateSessionEdit, newSessionEdit("u1", models.SessionEditDelete, nil, &updated)),
+			op(opDeleteSessionMatches, p),
+			op(opDeleteSession, p),
+		)
+		if err != nil {
+			t.Fatalf("delete %d: %v", i, err)
+		}
+	}
+	if _, ok := fs.sessions[id]; ok {
+		t.Fatal("session still stored after delete")
+	}
+}
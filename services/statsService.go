@@ -0,0 +1,351 @@
+package services
+
+import (
+	"authentication/store"
+	"authentication/trend"
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+var ErrInvalidBucket = errors.New("bucket must be day or week")
+
+// Default windows for stats that would otherwise cover all history.
+const (
+	heatmapDays   = 365
+	pauseRateDays = 90
+)
+
+// StatsRange is a stats query window; nil bounds are open.
+type StatsRange struct {
+	From *time.Time
+	To   *time.Time
+}
+
+func (r StatsRange) store(loc *time.Location) store.StatsRange {
+	return store.StatsRange{From: r.From, To: r.To, Timezone: loc.String()}
+}
+
+// withDefaultDays fills an open start with days before the end (or today).
+func (r StatsRange) withDefaultDays(days int, loc *time.Location) StatsRange {
+	if r.From != nil {
+		return r
+	}
+	end := time.Now()
+	if r.To != nil {
+		end = *r.To
+	}
+	start, _ := dayBounds(localDay(end, loc).AddDate(0, 0, -(days-1)), loc)
+	r.From = &start
+	return r
+}
+
+func avg(sum float64, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return math.Round(sum/float64(n)*10) / 10
+}
+
+// ===================== STREAKS =====================
+
+type Streaks struct {
+	Current       int        `json:"current"`
+	Longest       int        `json:"longest"`
+	LongestStart  *time.Time `json:"longest_start,omitempty"`
+	LongestEnd    *time.Time `json:"longest_end,omitempty"`
+	ActiveDays    int        `json:"active_days"`
+	LastActiveDay *time.Time `json:"last_active_day,omitempty"`
+}
+
+// SessionStreaks counts runs of consecutive local days with a finished
+// session. The current streak ends today, or yesterday while today has no
+// session yet; with a past upper bound it ends on the range's last day.
+func SessionStreaks(ctx context.Context, userID string, r StatsRange) (*Streaks, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	loc := UserLocation(ctx, userID)
+	days, err := store.Get().SessionDayTotals(ctx, userID, r.store(loc))
+	if err != nil {
+		return nil, err
+	}
+	out := &Streaks{ActiveDays: len(days)}
+	if len(days) == 0 {
+		return out, nil
+	}
+	run := 0
+	var runStart time.Time
+	for i, d := range days {
+		if i > 0 && d.Day.Equal(days[i-1].Day.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run, runStart = 1, d.Day
+		}
+		if run > out.Longest {
+			start, end := runStart, d.Day
+			out.Longest, out.LongestStart, out.LongestEnd = run, &start, &end
+		}
+	}
+	last := days[len(days)-1].Day
+	out.LastActiveDay = &last
+
+	end := localDay(time.Now(), loc)
+	if r.To != nil {
+		if rangeEnd := localDay(r.To.Add(-time.Nanosecond), loc); rangeEnd.Before(end) {
+			end = rangeEnd
+		}
+	}
+	if last.Equal(end) || last.Equal(end.AddDate(0, 0, -1)) {
+		out.Current = run
+	}
+	return out, nil
+}
+
+// ===================== TOTALS =====================
+
+type GoalTotal struct {
+	Goal     string  `json:"goal"`
+	Minutes  int     `json:"minutes"`
+	Sessions int     `json:"sessions"`
+	AvgFocus float64 `json:"avg_focus"`
+}
+
+type ModeTotal struct {
+	Mode     string  `json:"mode"`
+	Minutes  int     `json:"minutes"`
+	Sessions int     `json:"sessions"`
+	AvgFocus float64 `json:"avg_focus"`
+}
+
+type SessionTotals struct {
+	Minutes  int         `json:"minutes"`
+	Sessions int         `json:"sessions"`
+	ByGoal   []GoalTotal `json:"by_goal"`
+	ByMode   []ModeTotal `json:"by_mode"`
+}
+
+// SessionTotalsByGoalAndMode sums finished sessions per goal and per mode,
+// most minutes first.
+func SessionTotalsByGoalAndMode(ctx context.Context, userID string, r StatsRange) (*SessionTotals, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	rows, err := store.Get().SessionGroupTotals(ctx, userID, r.store(UserLocation(ctx, userID)))
+	if err != nil {
+		return nil, err
+	}
+	type sum struct {
+		minutes, sessions int
+		focus             float64
+	}
+	goals, modes := map[string]*sum{}, map[string]*sum{}
+	add := func(m map[string]*sum, key string, g store.GroupTotal) {
+		s := m[key]
+		if s == nil {
+			s = &sum{}
+			m[key] = s
+		}
+		s.minutes += g.Minutes
+		s.sessions += g.Sessions
+		s.focus += g.FocusSum
+	}
+	out := &SessionTotals{ByGoal: []GoalTotal{}, ByMode: []ModeTotal{}}
+	for _, g := range rows {
+		add(goals, g.Goal, g)
+		add(modes, g.Mode, g)
+		out.Minutes += g.Minutes
+		out.Sessions += g.Sessions
+	}
+	for goal, s := range goals {
+		out.ByGoal = append(out.ByGoal, GoalTotal{Goal: goal, Minutes: s.minutes, Sessions: s.sessions, AvgFocus: avg(s.focus, s.sessions)})
+	}
+	for mode, s := range modes {
+		out.ByMode = append(out.ByMode, ModeTotal{Mode: mode, Minutes: s.minutes, Sessions: s.sessions, AvgFocus: avg(s.focus, s.sessions)})
+	}
+	sort.Slice(out.ByGoal, func(i, j int) bool {
+		if out.ByGoal[i].Minutes != out.ByGoal[j].Minutes {
+			return out.ByGoal[i].Minutes > out.ByGoal[j].Minutes
+		}
+		return out.ByGoal[i].Goal < out.ByGoal[j].Goal
+	})
+	sort.Slice(out.ByMode, func(i, j int) bool {
+		if out.ByMode[i].Minutes != out.ByMode[j].Minutes {
+			return out.ByMode[i].Minutes > out.ByMode[j].Minutes
+		}
+		return out.ByMode[i].Mode < out.ByMode[j].Mode
+	})
+	return out, nil
+}
+
+// ===================== HEATMAP =====================
+
+type HeatmapDay struct {
+	Date     string `json:"date"` // YYYY-MM-DD in the user's timezone
+	Minutes  int    `json:"minutes"`
+	Sessions int    `json:"sessions"`
+}
+
+type Heatmap struct {
+	From       string       `json:"from"`
+	To         string       `json:"to"` // inclusive
+	MaxMinutes int          `json:"max_minutes"`
+	Days       []HeatmapDay `json:"days"` // every day in range, oldest first
+}
+
+// MinutesHeatmap returns minutes studied on every local day in the range,
+// zeros included, defaulting to the last heatmapDays days.
+func MinutesHeatmap(ctx context.Context, userID string, r StatsRange) (*Heatmap, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	loc := UserLocation(ctx, userID)
+	r = r.withDefaultDays(heatmapDays, loc)
+	totals, err := store.Get().SessionDayTotals(ctx, userID, r.store(loc))
+	if err != nil {
+		return nil, err
+	}
+	first := localDay(*r.From, loc)
+	last := localDay(time.Now(), loc)
+	if r.To != nil {
+		last = localDay(r.To.Add(-time.Nanosecond), loc)
+	}
+	if len(totals) > 0 && totals[len(totals)-1].Day.After(last) {
+		last = totals[len(totals)-1].Day
+	}
+	byDay := make(map[time.Time]store.DayTotal, len(totals))
+	for _, t := range totals {
+		byDay[t.Day] = t
+	}
+	out := &Heatmap{From: first.Format("2006-01-02"), To: last.Format("2006-01-02"), Days: []HeatmapDay{}}
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		t := byDay[d]
+		out.Days = append(out.Days, HeatmapDay{Date: d.Format("2006-01-02"), Minutes: t.Minutes, Sessions: t.Sessions})
+		if t.Minutes > out.MaxMinutes {
+			out.MaxMinutes = t.Minutes
+		}
+	}
+	return out, nil
+}
+
+// ===================== FOCUS BY TIME =====================
+
+type HourFocus struct {
+	Hour     int     `json:"hour"`
+	Sessions int     `json:"sessions"`
+	AvgFocus float64 `json:"avg_focus"`
+}
+
+type WeekdayFocus struct {
+	Weekday  string  `json:"weekday"`
+	Sessions int     `json:"sessions"`
+	AvgFocus float64 `json:"avg_focus"`
+}
+
+type FocusByTime struct {
+	ByHour    []HourFocus    `json:"by_hour"`    // 0-23, local start hour
+	ByWeekday []WeekdayFocus `json:"by_weekday"` // Monday first
+	BestHour  *int           `json:"best_hour,omitempty"`
+}
+
+// minSlotSessions keeps a single lucky session from being the best hour.
+const minSlotSessions = 3
+
+// FocusByTimeOfDay averages focus scores by the local hour and weekday the
+// sessions started.
+func FocusByTimeOfDay(ctx context.Context, userID string, r StatsRange) (*FocusByTime, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	slots, err := store.Get().SessionTimeSlots(ctx, userID, r.store(UserLocation(ctx, userID)))
+	if err != nil {
+		return nil, err
+	}
+	var hourN, dayN [24]int
+	var hourSum, daySum [24]float64
+	for _, s := range slots {
+		hourN[s.Hour] += s.Sessions
+		hourSum[s.Hour] += s.FocusSum
+		dayN[s.Weekday] += s.Sessions
+		daySum[s.Weekday] += s.FocusSum
+	}
+	out := &FocusByTime{ByHour: make([]HourFocus, 24), ByWeekday: make([]WeekdayFocus, 7)}
+	for h := 0; h < 24; h++ {
+		out.ByHour[h] = HourFocus{Hour: h, Sessions: hourN[h], AvgFocus: avg(hourSum[h], hourN[h])}
+		if hourN[h] >= minSlotSessions && (out.BestHour == nil || out.ByHour[h].AvgFocus > out.ByHour[*out.BestHour].AvgFocus) {
+			best := h
+			out.BestHour = &best
+		}
+	}
+	for i := 0; i < 7; i++ {
+		wd := time.Weekday((i + 1) % 7)
+		out.ByWeekday[i] = WeekdayFocus{Weekday: wd.String(), Sessions: dayN[wd], AvgFocus: avg(daySum[wd], dayN[wd])}
+	}
+	return out, nil
+}
+
+// ===================== PAUSE RATE =====================
+
+type PauseRateBucket struct {
+	Start            string  `json:"start"` // YYYY-MM-DD; weeks start on Monday
+	Sessions         int     `json:"sessions"`
+	Minutes          int     `json:"minutes"`
+	Pauses           int     `json:"pauses"`
+	PausesPerHour    float64 `json:"pauses_per_hour"`
+	PausesPerSession float64 `json:"pauses_per_session"`
+}
+
+type PauseRateTrend struct {
+	Bucket  string            `json:"bucket"`
+	Buckets []PauseRateBucket `json:"buckets"` // only buckets with sessions
+	// Slope is the least-squares change in pauses per hour per bucket.
+	Slope float64 `json:"slope"`
+	Trend string  `json:"trend,omitempty"` // rising | falling | steady; empty with fewer than 2 buckets
+}
+
+// PauseRateTrends buckets pauses per study hour by day or week, defaulting
+// to the last pauseRateDays days.
+func PauseRateTrends(ctx context.Context, userID string, r StatsRange, bucket string) (*PauseRateTrend, error) {
+	if bucket == "" {
+		bucket = "week"
+	}
+	if bucket != "day" && bucket != "week" {
+		return nil, ErrInvalidBucket
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	loc := UserLocation(ctx, userID)
+	r = r.withDefaultDays(pauseRateDays, loc)
+	totals, err := store.Get().SessionDayTotals(ctx, userID, r.store(loc))
+	if err != nil {
+		return nil, err
+	}
+	out := &PauseRateTrend{Bucket: bucket, Buckets: []PauseRateBucket{}}
+	for _, t := range totals {
+		start := t.Day
+		if bucket == "week" {
+			start = weekStart(t.Day)
+		}
+		key := start.Format("2006-01-02")
+		if n := len(out.Buckets); n == 0 || out.Buckets[n-1].Start != key {
+			out.Buckets = append(out.Buckets, PauseRateBucket{Start: key})
+		}
+		b := &out.Buckets[len(out.Buckets)-1]
+		b.Sessions += t.Sessions
+		b.Minutes += t.Minutes
+		b.Pauses += t.Pauses
+	}
+	var xs, ys []float64
+	for i := range out.Buckets {
+		b := &out.Buckets[i]
+		if b.Minutes > 0 {
+			b.PausesPerHour = math.Round(float64(b.Pauses)/(float64(b.Minutes)/60)*100) / 100
+		}
+		b.PausesPerSession = math.Round(float64(b.Pauses)/float64(b.Sessions)*100) / 100
+		xs = append(xs, float64(i))
+		ys = append(ys, b.PausesPerHour)
+	}
+	if slope, ok := trend.Slope(xs, ys); ok {
+		out.Slope = math.Round(slope*100) / 100
+		out.Trend = trend.Direction(slope, 0.1)
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+// Parsed zones are kept; time.LoadLocation reads the zoneinfo database on
+// every call.
+var locations sync.Map // IANA name -> *time.Location
+
+// loadLocation parses an IANA timezone name. "" is UTC; "Local" is refused
+// since it would follow the server's zone.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "UTC" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	if name == "Local" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// UserLocation returns the timezone the user's days are counted in, UTC if
+// they have not set one.
+func UserLocation(ctx context.Context, userID string) *time.Location {
+	u, err := store.Get().FindUserByID(ctx, userID)
+	if err != nil || u.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := loadLocation(u.Timezone)
+	if err != nil {
+		log.Printf("user %s: %v; using UTC", userID, err)
+		return time.UTC
+	}
+	return loc
+}
+
+// SetUserTimezone stores the user's timezone and, if it changed, starts a
+// recompute of their whole history so days, consistency and fatigue scores
+// are bucketed in the new zone. The recompute job is returned (nil when
+// there was nothing to redo).
+func SetUserTimezone(ctx context.Context, userID, timezone string) (*models.RecomputeJob, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	timezone = strings.TrimSpace(timezone)
+	if _, err := loadLocation(timezone); err != nil {
+		return nil, err
+	}
+	if timezone == "UTC" {
+		timezone = ""
+	}
+	u, err := store.Get().FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Timezone == timezone {
+		return nil, nil
+	}
+	if err := store.Get().SetUserTimezone(ctx, userID, timezone); err != nil {
+		return nil, err
+	}
+
+	first, _, err := store.Get().ListSessions(ctx, userID, store.SessionFilter{}, store.ListOptions{Limit: 1, Sort: "started_at"})
+	if err != nil {
+		return nil, err
+	}
+	if len(first) == 0 {
+		return nil, nil
+	}
+	// Local days can start up to a day either side of the UTC day.
+	job, err := NewRecomputeJob(ctx, RecomputeScope{
+		UserID: userID,
+		From:   first[0].StartedAt.AddDate(0, 0, -1),
+		To:     time.Now().AddDate(0, 0, 2),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := StartRecompute(job, 1); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"authentication/trend"
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidTrendRange = errors.New("from must not be after to, and the range is at most a year")
+
+// Trend windows default to the last 28 days and are capped at a year.
+const (
+	defaultTrendDays = 28
+	maxTrendDays     = 366
+)
+
+// FatigueTrend analyzes the user's daily scores between the days from and
+// to, both included. to defaults to today in the user's timezone and from
+// to defaultTrendDays before it. zThreshold 0 uses trend.DefaultZThreshold.
+func FatigueTrend(ctx context.Context, userID string, from, to *time.Time, zThreshold float64) (*trend.Fatigue, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	end := localDay(time.Now(), UserLocation(ctx, userID))
+	if to != nil {
+		end = to.UTC().Truncate(24 * time.Hour)
+	}
+	start := end.AddDate(0, 0, -(defaultTrendDays - 1))
+	if from != nil {
+		start = from.UTC().Truncate(24 * time.Hour)
+	}
+	if start.After(end) || end.Sub(start) >= maxTrendDays*24*time.Hour {
+		return nil, ErrInvalidTrendRange
+	}
+
+	histFrom := start.AddDate(0, 0, -trend.HistoryDays)
+	scores, err := fatigueScoresBetween(ctx, userID, histFrom, end.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	return trend.Analyze(scores, start, end, zThreshold), nil
+}
+
+// fatigueScoresBetween returns every daily score of the user's in
+// [from, to), oldest first. Store pages are capped, so it follows the
+// cursor until the range is exhausted.
+func fatigueScoresBetween(ctx context.Context, userID string, from, to time.Time) ([]models.FatigueScore, error) {
+	var out []models.FatigueScore
+	opts := store.ListOptions{Limit: 100, Sort: "date"}
+	for {
+		page, next, err := store.Get().ListFatigueScores(ctx, userID, &from, &to, opts)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page...)
+		if next == "" {
+			return out, nil
+		}
+		opts.Cursor = next
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// scoreStore serves fatigue scores in pages of at most 100, like the real
+// backends, with the cursor being the next index.
+type scoreStore struct {
+	store.Store
+	scores []models.FatigueScore // oldest first
+}
+
+func (s *scoreStore) ListFatigueScores(ctx context.Context, userID string, from, to *time.Time, opts store.ListOptions) ([]models.FatigueScore, string, error) {
+	var in []models.FatigueScore
+	for _, fs := range s.scores {
+		if fs.UserID == userID && !fs.Date.Before(*from) && fs.Date.Before(*to) {
+			in = append(in, fs)
+		}
+	}
+	start := 0
+	if opts.Cursor != "" {
+		n, err := strconv.Atoi(opts.Cursor)
+		if err != nil {
+			return nil, "", store.ErrInvalidCursor
+		}
+		start = n
+	}
+	limit := int(opts.Limit)
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	end := start + limit
+	if end >= len(in) {
+		return in[start:], "", nil
+	}
+	return in[start:end], strconv.Itoa(end), nil
+}
+
+func (s *scoreStore) FindUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return nil, store.ErrNotFound
+}
+
+func TestFatigueTrendLongRange(t *testing.T) {
+	first := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fs := &scoreStore{}
+	for i := 0; i < 300; i++ {
+		fs.scores = append(fs.scores, models.FatigueScore{
+			UserID:             "u1",
+			Date:               first.AddDate(0, 0, i),
+			FatigueIndex:       float64(40 + i%7),
+			BurnoutProbability: float64(30 + i%5),
+		})
+	}
+	store.Set(fs)
+
+	from := first.AddDate(0, 0, 100)
+	to := first.AddDate(0, 0, 299)
+	f, err := FatigueTrend(context.Background(), "u1", &from, &to, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Days) != 200 {
+		t.Fatalf("got %d days, want 200", len(f.Days))
+	}
+	if latest := f.Latest(); latest == nil || !latest.Date.Equal(to) {
+		t.Fatalf("latest day %v, want %v", latest, to)
+	}
+}
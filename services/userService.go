@@ -0,0 +1,15 @@
+package services
+
+import (
+	"authentication/models"
+	"authentication/store"
+	"context"
+	"time"
+)
+
+// ListUsers returns one page of users matching f.
+func ListUsers(ctx context.Context, f store.UserFilter, opts store.ListOptions) ([]models.User, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return store.Get().ListUsers(ctx, f, opts)
+}
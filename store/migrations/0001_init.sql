@@ -0,0 +1,57 @@
+-- Core tables mirroring the users, study_sessions and fatigue_scores collections.
+-- IDs are ObjectID hex strings so records keep the same identity across backends.
+
+CREATE TABLE IF NOT EXISTS users (
+    id            TEXT PRIMARY KEY,
+    first_name    TEXT,
+    last_name     TEXT,
+    password      TEXT,
+    email         TEXT NOT NULL UNIQUE,
+    phone         TEXT,
+    token         TEXT,
+    role          TEXT NOT NULL DEFAULT 'USER',
+    refresh_token TEXT,
+    reset_token   TEXT,
+    reset_expires TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS users_phone_idx ON users (phone) WHERE phone IS NOT NULL AND phone <> '';
+CREATE INDEX IF NOT EXISTS users_reset_token_idx ON users (reset_token) WHERE reset_token IS NOT NULL;
+CREATE INDEX IF NOT EXISTS users_created_at_idx ON users (created_at, id);
+
+CREATE TABLE IF NOT EXISTS study_sessions (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL,
+    mode         TEXT NOT NULL,
+    goal         TEXT NOT NULL,
+    planned_min  INTEGER NOT NULL DEFAULT 0,
+    started_at   TIMESTAMPTZ NOT NULL,
+    ended_at     TIMESTAMPTZ,
+    duration_min INTEGER NOT NULL,
+    focus_score  INTEGER NOT NULL,
+    pause_count  INTEGER NOT NULL DEFAULT 0,
+    self_rating  INTEGER NOT NULL DEFAULT 0,
+    self_on_task TEXT NOT NULL DEFAULT '',
+    breaks       JSONB,
+    created_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS study_sessions_user_created_idx ON study_sessions (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS study_sessions_user_started_idx ON study_sessions (user_id, started_at);
+
+CREATE TABLE IF NOT EXISTS fatigue_scores (
+    id                  TEXT PRIMARY KEY,
+    user_id             TEXT NOT NULL,
+    date                TIMESTAMPTZ NOT NULL,
+    total_study_hours   DOUBLE PRECISION NOT NULL,
+    break_frequency     DOUBLE PRECISION NOT NULL,
+    focus_stability     DOUBLE PRECISION NOT NULL,
+    fatigue_index       DOUBLE PRECISION NOT NULL,
+    burnout_probability DOUBLE PRECISION NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL,
+    UNIQUE (user_id, date)
+);
+
+CREATE INDEX IF NOT EXISTS fatigue_scores_user_date_idx ON fatigue_scores (user_id, date DESC);
@@ -0,0 +1,5 @@
+-- Users can belong to an organization.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id TEXT;
+
+CREATE INDEX IF NOT EXISTS users_org_idx ON users (org_id) WHERE org_id IS NOT NULL;
@@ -0,0 +1,12 @@
+-- Server-side live sessions: status, the open break and last activity.
+
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT '';
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS paused_at TIMESTAMPTZ;
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+
+-- At most one running or paused session per user.
+CREATE UNIQUE INDEX IF NOT EXISTS study_sessions_open_per_user_idx
+    ON study_sessions (user_id) WHERE status IN ('active', 'paused');
+
+CREATE INDEX IF NOT EXISTS study_sessions_open_updated_idx
+    ON study_sessions (updated_at) WHERE status IN ('active', 'paused');
@@ -0,0 +1,21 @@
+-- Checkpointed recompute/backfill jobs.
+
+CREATE TABLE IF NOT EXISTS recompute_jobs (
+    id               TEXT PRIMARY KEY,
+    user_id          TEXT NOT NULL DEFAULT '',
+    org_id           TEXT NOT NULL DEFAULT '',
+    date_from        TIMESTAMPTZ NOT NULL,
+    date_to          TIMESTAMPTZ NOT NULL,
+    dry_run          BOOLEAN NOT NULL DEFAULT FALSE,
+    status           TEXT NOT NULL,
+    checkpoint       TEXT NOT NULL DEFAULT '',
+    users_done       INTEGER NOT NULL DEFAULT 0,
+    sessions_checked INTEGER NOT NULL DEFAULT 0,
+    sessions_changed INTEGER NOT NULL DEFAULT 0,
+    days_checked     INTEGER NOT NULL DEFAULT 0,
+    days_changed     INTEGER NOT NULL DEFAULT 0,
+    diffs            JSONB,
+    error            TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,14 @@
+-- Versioned scoring models, and the version stamped on each score.
+
+CREATE TABLE IF NOT EXISTS scoring_models (
+    version      TEXT PRIMARY KEY,
+    description  TEXT NOT NULL DEFAULT '',
+    params       JSONB NOT NULL,
+    active       BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at   TIMESTAMPTZ NOT NULL,
+    activated_at TIMESTAMPTZ
+);
+
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS model_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE fatigue_scores ADD COLUMN IF NOT EXISTS model_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE recompute_jobs ADD COLUMN IF NOT EXISTS model_version TEXT NOT NULL DEFAULT '';
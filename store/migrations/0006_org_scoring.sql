@@ -0,0 +1,10 @@
+-- Pluggable scoring formulas and per-organization settings.
+
+ALTER TABLE scoring_models ADD COLUMN IF NOT EXISTS focus_scorer TEXT NOT NULL DEFAULT '';
+ALTER TABLE scoring_models ADD COLUMN IF NOT EXISTS fatigue_model TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS org_settings (
+    org_id        TEXT PRIMARY KEY,
+    scoring_model TEXT NOT NULL DEFAULT '',
+    updated_at    TIMESTAMPTZ NOT NULL
+);
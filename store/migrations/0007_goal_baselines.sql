@@ -0,0 +1,12 @@
+-- Per-user, per-goal learned session baselines.
+
+CREATE TABLE IF NOT EXISTS goal_baselines (
+    user_id      TEXT NOT NULL,
+    goal         TEXT NOT NULL,
+    baseline_min INTEGER NOT NULL,
+    default_min  INTEGER NOT NULL,
+    median_min   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    samples      INTEGER NOT NULL DEFAULT 0,
+    updated_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, goal)
+);
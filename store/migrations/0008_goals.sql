@@ -0,0 +1,22 @@
+-- Goals catalog per user and organization; sessions reference goals by ID.
+
+CREATE TABLE IF NOT EXISTS goals (
+    id                TEXT PRIMARY KEY,
+    user_id           TEXT NOT NULL DEFAULT '',
+    org_id            TEXT NOT NULL DEFAULT '',
+    name              TEXT NOT NULL,
+    category          TEXT NOT NULL DEFAULT '',
+    color             TEXT NOT NULL DEFAULT '',
+    target_min        INTEGER NOT NULL DEFAULT 0,
+    weekly_target_min INTEGER NOT NULL DEFAULT 0,
+    aliases           JSONB,
+    archived          BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at        TIMESTAMPTZ NOT NULL,
+    updated_at        TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS goals_user_idx ON goals (user_id) WHERE user_id <> '';
+CREATE INDEX IF NOT EXISTS goals_org_idx ON goals (org_id) WHERE org_id <> '';
+
+ALTER TABLE study_sessions ADD COLUMN IF NOT EXISTS goal_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS study_sessions_goal_idx ON study_sessions (user_id, goal_id);
@@ -0,0 +1,3 @@
+-- Per-user IANA timezone used to bucket sessions into calendar days.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT '';
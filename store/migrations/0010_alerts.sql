@@ -0,0 +1,36 @@
+-- Burnout early-warning rules and the alerts they raise.
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id             TEXT PRIMARY KEY,
+    org_id         TEXT NOT NULL DEFAULT '',
+    name           TEXT NOT NULL,
+    kind           TEXT NOT NULL,
+    metric         TEXT NOT NULL,
+    threshold      DOUBLE PRECISION NOT NULL,
+    days           INTEGER NOT NULL DEFAULT 0,
+    severity       TEXT NOT NULL,
+    cooldown_hours INTEGER NOT NULL DEFAULT 0,
+    enabled        BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMPTZ NOT NULL,
+    updated_at     TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id              TEXT PRIMARY KEY,
+    user_id         TEXT NOT NULL,
+    org_id          TEXT NOT NULL DEFAULT '',
+    rule_id         TEXT NOT NULL,
+    severity        TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    message         TEXT NOT NULL,
+    value           DOUBLE PRECISION NOT NULL,
+    date            TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL,
+    acknowledged_at TIMESTAMPTZ,
+    acknowledged_by TEXT NOT NULL DEFAULT '',
+    resolved_at     TIMESTAMPTZ,
+    resolved_by     TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS alerts_user_rule_idx ON alerts (user_id, rule_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS alerts_org_status_idx ON alerts (org_id, status, created_at DESC);
@@ -0,0 +1,43 @@
+-- In-app inbox, notification preferences and the email/webhook delivery queue.
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL,
+    kind       TEXT NOT NULL,
+    title      TEXT NOT NULL,
+    body       TEXT NOT NULL,
+    data       JSONB,
+    read_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS notification_prefs (
+    user_id     TEXT PRIMARY KEY,
+    channels    JSONB NOT NULL,
+    webhook_url TEXT NOT NULL DEFAULT '',
+    quiet_start TEXT NOT NULL DEFAULT '',
+    quiet_end   TEXT NOT NULL DEFAULT '',
+    updated_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notification_queue (
+    id              TEXT PRIMARY KEY,
+    user_id         TEXT NOT NULL,
+    channel         TEXT NOT NULL,
+    kind            TEXT NOT NULL,
+    target          TEXT NOT NULL,
+    subject         TEXT NOT NULL,
+    body            TEXT NOT NULL,
+    data            JSONB,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL,
+    sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS notification_queue_due_idx ON notification_queue (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS notification_queue_user_idx ON notification_queue (user_id);
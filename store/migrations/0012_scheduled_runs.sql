@@ -0,0 +1,9 @@
+-- Scheduled per-user jobs (e.g. weekly report emails) that have already run.
+
+CREATE TABLE IF NOT EXISTS scheduled_runs (
+    key     TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    ran_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_runs_user_idx ON scheduled_runs (user_id);
@@ -0,0 +1,37 @@
+-- Planned study sessions (one-off or recurring via RRULE) and the sessions
+-- matched to their occurrences.
+
+CREATE TABLE IF NOT EXISTS study_plans (
+    id          TEXT PRIMARY KEY,
+    user_id     TEXT NOT NULL,
+    goal        TEXT NOT NULL DEFAULT '',
+    goal_id     TEXT NOT NULL DEFAULT '',
+    start_at    TIMESTAMPTZ NOT NULL,
+    planned_min INTEGER NOT NULL,
+    rrule       TEXT NOT NULL DEFAULT '',
+    timezone    TEXT NOT NULL DEFAULT 'UTC',
+    note        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS study_plans_user_idx ON study_plans (user_id);
+
+CREATE TABLE IF NOT EXISTS plan_matches (
+    id              TEXT PRIMARY KEY,
+    user_id         TEXT NOT NULL,
+    plan_id         TEXT NOT NULL,
+    occurrence_at   TIMESTAMPTZ NOT NULL,
+    session_id      TEXT NOT NULL,
+    planned_min     INTEGER NOT NULL,
+    actual_min      INTEGER NOT NULL,
+    start_delay_min INTEGER NOT NULL,
+    on_time         BOOLEAN NOT NULL,
+    minutes_ratio   DOUBLE PRECISION NOT NULL,
+    adherence       DOUBLE PRECISION NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS plan_matches_user_idx ON plan_matches (user_id, occurrence_at);
+CREATE INDEX IF NOT EXISTS plan_matches_plan_idx ON plan_matches (plan_id);
+CREATE INDEX IF NOT EXISTS plan_matches_session_idx ON plan_matches (session_id);
@@ -0,0 +1,19 @@
+-- ICS feed tokens and import keywords; imported plans keep their event UID
+-- and skipped occurrences.
+
+ALTER TABLE study_plans ADD COLUMN IF NOT EXISTS exdates JSONB;
+ALTER TABLE study_plans ADD COLUMN IF NOT EXISTS external_uid TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS study_plans_external_uid_idx ON study_plans (user_id, external_uid)
+    WHERE external_uid <> '';
+
+CREATE TABLE IF NOT EXISTS calendar_settings (
+    user_id         TEXT PRIMARY KEY,
+    feed_token_hash TEXT NOT NULL DEFAULT '',
+    feed_created_at TIMESTAMPTZ,
+    import_keywords JSONB NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS calendar_settings_feed_token_idx ON calendar_settings (feed_token_hash)
+    WHERE feed_token_hash <> '';
@@ -0,0 +1,16 @@
+-- History of edits to and deletions of finished study sessions, each with
+-- the session as it was before.
+
+CREATE TABLE IF NOT EXISTS session_edits (
+    id         TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    user_id    TEXT NOT NULL,
+    edited_by  TEXT NOT NULL,
+    action     TEXT NOT NULL,
+    fields     JSONB,
+    original   JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS session_edits_session_idx ON session_edits (session_id, created_at);
+CREATE INDEX IF NOT EXISTS session_edits_user_idx ON session_edits (user_id);
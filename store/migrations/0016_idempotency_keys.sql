@@ -0,0 +1,15 @@
+-- Stored responses to requests sent with an Idempotency-Key header.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status       INTEGER NOT NULL DEFAULT 0,
+    content_type TEXT NOT NULL DEFAULT '',
+    body         BYTEA,
+    created_at   TIMESTAMPTZ NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_user_idx ON idempotency_keys (user_id);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,6 @@
+-- An in-flight Idempotency-Key claim can be taken over once its lease runs
+-- out, so a request that died mid-way does not lock the key until it expires.
+
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+UPDATE idempotency_keys SET locked_until = created_at WHERE locked_until IS NULL;
+ALTER TABLE idempotency_keys ALTER COLUMN locked_until SET NOT NULL;
@@ -0,0 +1,5 @@
+-- A recompute job is claimed by one run at a time. The run renews its
+-- lease as it saves progress; a job whose lease ran out may be resumed.
+
+ALTER TABLE recompute_jobs ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE recompute_jobs ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00';
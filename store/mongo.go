@@ -0,0 +1,1589 @@
+package store
+
+import (
+	"authentication/models"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps users, study_sessions and fatigue_scores in MongoDB.
+type MongoStore struct {
+	db *mongo.Database
+
+	txMu        sync.Mutex
+	txProbed    bool      // txSupported holds a successful probe's answer
+	txRetryAt   time.Time // after a failed probe, when to ask again
+	txSupported bool
+}
+
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{db: db}
+}
+
+// EnsureIndexes creates the indexes the store relies on for correctness,
+// such as one open session per user. It is safe to call on every start.
+func (m *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := m.sessions().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().
+			SetName("open_per_user").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"status": bson.M{"$in": bson.A{models.SessionActive, models.SessionPaused}}}),
+	})
+	return err
+}
+
+// Database exposes the underlying database for Mongo-only features.
+func (m *MongoStore) Database() *mongo.Database {
+	return m.db
+}
+
+func (m *MongoStore) users() *mongo.Collection    { return m.db.Collection("users") }
+func (m *MongoStore) sessions() *mongo.Collection { return m.db.Collection("study_sessions") }
+func (m *MongoStore) scores() *mongo.Collection   { return m.db.Collection("fatigue_scores") }
+
+func findOneUser(ctx context.Context, coll *mongo.Collection, filter bson.M) (*models.User, error) {
+	var u models.User
+	err := coll.FindOne(ctx, filter).Decode(&u)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ---------------- users ----------------
+
+func (m *MongoStore) CreateUser(ctx context.Context, u *models.User) error {
+	_, err := m.users().InsertOne(ctx, u)
+	return err
+}
+
+func (m *MongoStore) CountUsersWithContact(ctx context.Context, email, phone string) (int64, error) {
+	orConditions := []bson.M{{"email": email}}
+	if phone != "" {
+		orConditions = append(orConditions, bson.M{"phone": phone})
+	}
+	return m.users().CountDocuments(ctx, bson.M{"$or": orConditions})
+}
+
+func (m *MongoStore) FindUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return findOneUser(ctx, m.users(), bson.M{"user_id": userID})
+}
+
+func (m *MongoStore) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return findOneUser(ctx, m.users(), bson.M{"email": email})
+}
+
+func (m *MongoStore) FindUserByResetToken(ctx context.Context, token string) (*models.User, error) {
+	return findOneUser(ctx, m.users(), bson.M{"reset_token": token})
+}
+
+func (m *MongoStore) updateUser(ctx context.Context, userID string, set bson.M) error {
+	set["updated_at"] = time.Now()
+	_, err := m.users().UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{"$set": set})
+	return err
+}
+
+func (m *MongoStore) UpdateUserTokens(ctx context.Context, userID, token, refreshToken string) error {
+	return m.updateUser(ctx, userID, bson.M{"token": token, "refresh_token": refreshToken})
+}
+
+func (m *MongoStore) SetResetToken(ctx context.Context, userID, token string, expires time.Time) error {
+	return m.updateUser(ctx, userID, bson.M{"reset_token": token, "reset_expires": expires})
+}
+
+func (m *MongoStore) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	return m.updateUser(ctx, userID, bson.M{
+		"password":      hashedPassword,
+		"reset_token":   nil,
+		"reset_expires": nil,
+	})
+}
+
+func (m *MongoStore) ListUsers(ctx context.Context, f UserFilter, opts ListOptions) ([]models.User, string, error) {
+	filter := bson.M{}
+	if f.OrgID != "" {
+		filter["org_id"] = f.OrgID
+	}
+	if f.Role != "" {
+		filter["role"] = f.Role
+	}
+	if f.Search != "" {
+		re := bson.M{"$regex": regexp.QuoteMeta(f.Search), "$options": "i"}
+		filter["$or"] = []bson.M{
+			{"first_name": re},
+			{"last_name": re},
+			{"email": re},
+		}
+	}
+	if r := timeRange(f.CreatedFrom, f.CreatedTo); r != nil {
+		filter["created_at"] = r
+	}
+	return findPage[models.User](ctx, m.users(), filter, opts, userSortFields, "-created_at")
+}
+
+func (m *MongoStore) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	if timezone == "" {
+		_, err := m.users().UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$unset": bson.M{"timezone": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		})
+		return err
+	}
+	return m.updateUser(ctx, userID, bson.M{"timezone": timezone})
+}
+
+func (m *MongoStore) SetUserOrg(ctx context.Context, userID, orgID string) error {
+	if orgID == "" {
+		_, err := m.users().UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$unset": bson.M{"org_id": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		})
+		return err
+	}
+	return m.updateUser(ctx, userID, bson.M{"org_id": orgID})
+}
+
+// ---------------- study sessions ----------------
+
+func (m *MongoStore) CreateSession(ctx context.Context, s *models.StudySession) error {
+	_, err := m.sessions().InsertOne(ctx, s)
+	return err
+}
+
+func (m *MongoStore) StartSession(ctx context.Context, s *models.StudySession) error {
+	_, err := m.sessions().InsertOne(ctx, s)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+func (m *MongoStore) ReplaceSessionIf(ctx context.Context, s *models.StudySession, status string, updatedAt *time.Time) error {
+	filter := bson.M{"_id": s.ID, "status": status, "updated_at": nil}
+	if updatedAt != nil {
+		filter["updated_at"] = *updatedAt
+	}
+	res, err := m.sessions().ReplaceOne(ctx, filter, s)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrStale
+	}
+	return nil
+}
+
+func (m *MongoStore) RecentSessions(ctx context.Context, userID string, limit int64) ([]models.StudySession, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := m.sessions().Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.StudySession
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) ListSessions(ctx context.Context, userID string, f SessionFilter, opts ListOptions) ([]models.StudySession, string, error) {
+	filter := bson.M{"user_id": userID}
+	if f.Goal != "" {
+		filter["goal"] = f.Goal
+	}
+	if f.GoalID != "" {
+		filter["goal_id"] = f.GoalID
+	}
+	if f.Mode != "" {
+		filter["mode"] = f.Mode
+	}
+	if r := timeRange(f.From, f.To); r != nil {
+		filter["started_at"] = r
+	}
+	return findPage[models.StudySession](ctx, m.sessions(), filter, opts, sessionSortFields, "-created_at")
+}
+
+var openStatuses = bson.M{"$in": []string{models.SessionActive, models.SessionPaused}}
+
+func findOneSession(ctx context.Context, coll *mongo.Collection, filter bson.M) (*models.StudySession, error) {
+	var s models.StudySession
+	err := coll.FindOne(ctx, filter).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *MongoStore) FindSession(ctx context.Context, sessionID string) (*models.StudySession, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return findOneSession(ctx, m.sessions(), bson.M{"_id": id})
+}
+
+func (m *MongoStore) FindOpenSession(ctx context.Context, userID string) (*models.StudySession, error) {
+	return findOneSession(ctx, m.sessions(), bson.M{"user_id": userID, "status": openStatuses})
+}
+
+func (m *MongoStore) IdleOpenSessions(ctx context.Context, idleSince time.Time, limit int64) ([]models.StudySession, error) {
+	filter := bson.M{"status": openStatuses, "updated_at": bson.M{"$lt": idleSince}}
+	cursor, err := m.sessions().Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.StudySession
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) SessionsBetween(ctx context.Context, userID string, from, to time.Time) ([]models.StudySession, error) {
+	filter := bson.M{"user_id": userID, "started_at": bson.M{"$gte": from, "$lt": to}}
+	opts := options.Find().SetSort(bson.D{{Key: "started_at", Value: 1}})
+	cursor, err := m.sessions().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.StudySession
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) SessionDays(ctx context.Context, since time.Time) ([]UserDay, error) {
+	pipe := []bson.M{
+		{"$match": bson.M{"started_at": bson.M{"$gte": since}}},
+		{"$group": bson.M{"_id": bson.M{
+			"user_id": "$user_id",
+			"day":     bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$started_at"}},
+		}}},
+		{"$sort": bson.M{"_id.day": 1}},
+	}
+	cursor, err := m.sessions().Aggregate(ctx, pipe)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []struct {
+		ID struct {
+			UserID string `bson:"user_id"`
+			Day    string `bson:"day"`
+		} `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make([]UserDay, 0, len(rows))
+	for _, r := range rows {
+		day, err := time.Parse("2006-01-02", r.ID.Day)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, UserDay{UserID: r.ID.UserID, Day: day})
+	}
+	return out, nil
+}
+
+// ---------------- fatigue scores ----------------
+
+func (m *MongoStore) UpsertFatigueScore(ctx context.Context, s *models.FatigueScore) error {
+	filter := bson.M{"user_id": s.UserID, "date": s.Date}
+	update := bson.M{
+		"$set": bson.M{
+			"total_study_hours":   s.TotalStudyHours,
+			"break_frequency":     s.BreakFrequency,
+			"focus_stability":     s.FocusStability,
+			"fatigue_index":       s.FatigueIndex,
+			"burnout_probability": s.BurnoutProbability,
+			"created_at":          s.CreatedAt,
+			"model_version":       s.ModelVersion,
+		},
+		"$setOnInsert": bson.M{"_id": s.ID},
+	}
+	_, err := m.scores().UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) RecentFatigueScores(ctx context.Context, userID string, limit int64) ([]models.FatigueScore, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}}).SetLimit(limit)
+	cursor, err := m.scores().Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.FatigueScore
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) ListFatigueScores(ctx context.Context, userID string, from, to *time.Time, opts ListOptions) ([]models.FatigueScore, string, error) {
+	filter := bson.M{"user_id": userID}
+	if r := timeRange(from, to); r != nil {
+		filter["date"] = r
+	}
+	return findPage[models.FatigueScore](ctx, m.scores(), filter, opts, fatigueScoreSortFields, "-date")
+}
+
+func (m *MongoStore) LatestScorePerUser(ctx context.Context, limit int64) ([]models.FatigueScore, error) {
+	// Get latest score per user, then sort by burnout_probability desc
+	pipe := []bson.M{
+		{"$sort": bson.M{"date": -1}},
+		{"$group": bson.M{
+			"_id": "$user_id",
+			"doc": bson.M{"$first": "$$ROOT"},
+		}},
+		{"$replaceRoot": bson.M{"newRoot": "$doc"}},
+		{"$sort": bson.M{"burnout_probability": -1}},
+		{"$limit": limit},
+	}
+	cursor, err := m.scores().Aggregate(ctx, pipe)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.FatigueScore
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+// ---------------- account deletion ----------------
+
+func (m *MongoStore) DeleteUser(ctx context.Context, userID string) error {
+	_, err := m.users().DeleteOne(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (m *MongoStore) DeleteSessionsByUser(ctx context.Context, userID string) error {
+	_, err := m.sessions().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (m *MongoStore) DeleteSession(ctx context.Context, sessionID string) error {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrNotFound
+	}
+	res, err := m.sessions().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) DeleteFatigueScore(ctx context.Context, userID string, date time.Time) error {
+	_, err := m.scores().DeleteOne(ctx, bson.M{"user_id": userID, "date": date})
+	return err
+}
+
+func (m *MongoStore) DeleteFatigueScoresByUser(ctx context.Context, userID string) error {
+	_, err := m.scores().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- transactions / outbox ----------------
+
+// txProbeRetry is how long a failed transaction probe is trusted for.
+const txProbeRetry = 30 * time.Second
+
+// SupportsTransactions asks the server whether it is a replica set member
+// or mongos; only those accept multi-document transactions. The answer is
+// kept once the server gives one; a failed probe falls back to the outbox
+// and is retried after txProbeRetry.
+func (m *MongoStore) SupportsTransactions(ctx context.Context) bool {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	if m.txProbed || time.Now().Before(m.txRetryAt) {
+		return m.txSupported
+	}
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := m.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		log.Printf("mongo: could not detect transaction support, using outbox: %v", err)
+		m.txRetryAt = time.Now().Add(txProbeRetry)
+		return false
+	}
+	m.txProbed = true
+	m.txSupported = hello.SetName != "" || hello.Msg == "isdbgrid"
+	log.Printf("mongo: multi-document transactions supported: %v", m.txSupported)
+	return m.txSupported
+}
+
+// RunInTx runs fn inside a session transaction. Operations join the
+// transaction through the session context passed to fn.
+func (m *MongoStore) RunInTx(ctx context.Context, fn func(ctx context.Context, tx Store) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx, m)
+	}
+	sess, err := m.db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc, m)
+	})
+	return err
+}
+
+func (m *MongoStore) outbox() *mongo.Collection { return m.db.Collection("outbox") }
+
+func (m *MongoStore) InsertOutbox(ctx context.Context, e *models.OutboxEntry) error {
+	_, err := m.outbox().InsertOne(ctx, e)
+	return err
+}
+
+func (m *MongoStore) UpdateOutbox(ctx context.Context, e *models.OutboxEntry) error {
+	_, err := m.outbox().UpdateOne(ctx, bson.M{"_id": e.ID}, bson.M{"$set": bson.M{
+		"applied":    e.Applied,
+		"attempts":   e.Attempts,
+		"last_error": e.LastError,
+		"updated_at": e.UpdatedAt,
+	}})
+	return err
+}
+
+func (m *MongoStore) DeleteOutbox(ctx context.Context, id primitive.ObjectID) error {
+	_, err := m.outbox().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (m *MongoStore) PendingOutbox(ctx context.Context, olderThan time.Time, limit int64) ([]models.OutboxEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(limit)
+	cursor, err := m.outbox().Find(ctx, bson.M{"updated_at": bson.M{"$lt": olderThan}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.OutboxEntry
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+// ---------------- backup / restore ----------------
+
+func eachDoc[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, fn func(*T) error) error {
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(&doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func userIDFilter(userIDs []string) bson.M {
+	if userIDs == nil {
+		return bson.M{}
+	}
+	return bson.M{"user_id": bson.M{"$in": userIDs}}
+}
+
+func (m *MongoStore) EachUser(ctx context.Context, orgID, userID string, fn func(*models.User) error) error {
+	filter := bson.M{}
+	if orgID != "" {
+		filter["org_id"] = orgID
+	}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	return eachDoc(ctx, m.users(), filter, fn)
+}
+
+func (m *MongoStore) EachSession(ctx context.Context, userIDs []string, fn func(*models.StudySession) error) error {
+	return eachDoc(ctx, m.sessions(), userIDFilter(userIDs), fn)
+}
+
+func (m *MongoStore) EachFatigueScore(ctx context.Context, userIDs []string, fn func(*models.FatigueScore) error) error {
+	return eachDoc(ctx, m.scores(), userIDFilter(userIDs), fn)
+}
+
+func (m *MongoStore) EachGoal(ctx context.Context, userIDs []string, fn func(*models.Goal) error) error {
+	return eachDoc(ctx, m.goals(), userIDFilter(userIDs), fn)
+}
+
+func exists(ctx context.Context, coll *mongo.Collection, filter bson.M) (bool, error) {
+	n, err := coll.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (m *MongoStore) UserExists(ctx context.Context, userID string) (bool, error) {
+	return exists(ctx, m.users(), bson.M{"user_id": userID})
+}
+
+func (m *MongoStore) SessionExists(ctx context.Context, sessionID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return false, nil
+	}
+	return exists(ctx, m.sessions(), bson.M{"_id": id})
+}
+
+func (m *MongoStore) FatigueScoreExists(ctx context.Context, userID string, date time.Time) (bool, error) {
+	return exists(ctx, m.scores(), bson.M{"user_id": userID, "date": date})
+}
+
+func (m *MongoStore) ReplaceUser(ctx context.Context, u *models.User) error {
+	_, err := m.users().ReplaceOne(ctx, bson.M{"_id": u.ID}, u, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) ReplaceSession(ctx context.Context, s *models.StudySession) error {
+	_, err := m.sessions().ReplaceOne(ctx, bson.M{"_id": s.ID}, s, options.Replace().SetUpsert(true))
+	return err
+}
+
+// ---------------- recompute jobs ----------------
+
+func (m *MongoStore) recomputeJobs() *mongo.Collection { return m.db.Collection("recompute_jobs") }
+
+func (m *MongoStore) SaveRecomputeJob(ctx context.Context, j *models.RecomputeJob) error {
+	_, err := m.recomputeJobs().ReplaceOne(ctx, bson.M{"_id": j.ID}, j, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) ClaimRecomputeJob(ctx context.Context, jobID, owner string, now, lockedUntil time.Time) error {
+	id, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return ErrNotFound
+	}
+	res, err := m.recomputeJobs().UpdateOne(ctx, bson.M{
+		"_id":    id,
+		"status": bson.M{"$ne": models.RecomputeCompleted},
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"locked_until": bson.M{"$not": bson.M{"$gt": now}}},
+		},
+	}, bson.M{"$set": bson.M{"status": models.RecomputeRunning, "owner": owner, "locked_until": lockedUntil}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrStale
+	}
+	return nil
+}
+
+func (m *MongoStore) UpdateRecomputeJob(ctx context.Context, j *models.RecomputeJob) error {
+	res, err := m.recomputeJobs().ReplaceOne(ctx, bson.M{"_id": j.ID, "owner": j.Owner}, j)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrStale
+	}
+	return nil
+}
+
+func (m *MongoStore) FindRecomputeJob(ctx context.Context, jobID string) (*models.RecomputeJob, error) {
+	id, err := primitive.ObjectIDFromHex(jobID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var j models.RecomputeJob
+	err = m.recomputeJobs().FindOne(ctx, bson.M{"_id": id}).Decode(&j)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// ---------------- scoring models ----------------
+
+func (m *MongoStore) scoringModels() *mongo.Collection { return m.db.Collection("scoring_models") }
+
+func (m *MongoStore) ListScoringModels(ctx context.Context) ([]models.ScoringModel, error) {
+	cursor, err := m.scoringModels().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.ScoringModel
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) findScoringModel(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*models.ScoringModel, error) {
+	var sm models.ScoringModel
+	err := m.scoringModels().FindOne(ctx, filter, opts...).Decode(&sm)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
+
+func (m *MongoStore) FindScoringModel(ctx context.Context, version string) (*models.ScoringModel, error) {
+	return m.findScoringModel(ctx, bson.M{"_id": version})
+}
+
+func (m *MongoStore) ActiveScoringModel(ctx context.Context) (*models.ScoringModel, error) {
+	return m.findScoringModel(ctx, bson.M{"active": true},
+		options.FindOne().SetSort(bson.D{{Key: "activated_at", Value: -1}}))
+}
+
+func (m *MongoStore) CreateScoringModel(ctx context.Context, sm *models.ScoringModel) error {
+	res, err := m.scoringModels().UpdateOne(ctx, bson.M{"_id": sm.Version},
+		bson.M{"$setOnInsert": sm}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if res.UpsertedCount == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// ActivateScoringModel marks the new version active before clearing the
+// others, so there is never a moment with no active model; readers pick the
+// latest activation if they briefly see two.
+func (m *MongoStore) ActivateScoringModel(ctx context.Context, version string, at time.Time) error {
+	res, err := m.scoringModels().UpdateOne(ctx, bson.M{"_id": version},
+		bson.M{"$set": bson.M{"active": true, "activated_at": at}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = m.scoringModels().UpdateMany(ctx, bson.M{"_id": bson.M{"$ne": version}, "active": true},
+		bson.M{"$set": bson.M{"active": false}})
+	return err
+}
+
+// ---------------- organization settings ----------------
+
+func (m *MongoStore) orgSettings() *mongo.Collection { return m.db.Collection("org_settings") }
+
+func (m *MongoStore) FindOrgSettings(ctx context.Context, orgID string) (*models.OrgSettings, error) {
+	var o models.OrgSettings
+	err := m.orgSettings().FindOne(ctx, bson.M{"_id": orgID}).Decode(&o)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (m *MongoStore) SaveOrgSettings(ctx context.Context, o *models.OrgSettings) error {
+	_, err := m.orgSettings().ReplaceOne(ctx, bson.M{"_id": o.OrgID}, o, options.Replace().SetUpsert(true))
+	return err
+}
+
+// ---------------- goal baselines ----------------
+
+func (m *MongoStore) baselines() *mongo.Collection { return m.db.Collection("goal_baselines") }
+
+func (m *MongoStore) UpsertGoalBaseline(ctx context.Context, b *models.GoalBaseline) error {
+	_, err := m.baselines().ReplaceOne(ctx, bson.M{"user_id": b.UserID, "goal": b.Goal}, b, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) FindGoalBaseline(ctx context.Context, userID, goal string) (*models.GoalBaseline, error) {
+	var b models.GoalBaseline
+	err := m.baselines().FindOne(ctx, bson.M{"user_id": userID, "goal": goal}).Decode(&b)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (m *MongoStore) ListGoalBaselines(ctx context.Context, userID string) ([]models.GoalBaseline, error) {
+	cursor, err := m.baselines().Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "goal", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.GoalBaseline
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) DeleteGoalBaseline(ctx context.Context, userID, goal string) error {
+	_, err := m.baselines().DeleteOne(ctx, bson.M{"user_id": userID, "goal": goal})
+	return err
+}
+
+func (m *MongoStore) DeleteGoalBaselinesByUser(ctx context.Context, userID string) error {
+	_, err := m.baselines().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- goals ----------------
+
+func (m *MongoStore) goals() *mongo.Collection { return m.db.Collection("goals") }
+
+func (m *MongoStore) CreateGoal(ctx context.Context, g *models.Goal) error {
+	_, err := m.goals().InsertOne(ctx, g)
+	return err
+}
+
+func (m *MongoStore) UpdateGoal(ctx context.Context, g *models.Goal) error {
+	res, err := m.goals().ReplaceOne(ctx, bson.M{"_id": g.ID}, g)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) FindGoal(ctx context.Context, goalID string) (*models.Goal, error) {
+	id, err := primitive.ObjectIDFromHex(goalID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var g models.Goal
+	err = m.goals().FindOne(ctx, bson.M{"_id": id}).Decode(&g)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (m *MongoStore) ListGoals(ctx context.Context, userID, orgID string, includeArchived bool) ([]models.Goal, error) {
+	owners := bson.A{}
+	if userID != "" {
+		owners = append(owners, bson.M{"user_id": userID})
+	}
+	if orgID != "" {
+		owners = append(owners, bson.M{"org_id": orgID})
+	}
+	if len(owners) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{"$or": owners}
+	if !includeArchived {
+		filter["archived"] = false
+	}
+	cursor, err := m.goals().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.Goal
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) ReplaceGoal(ctx context.Context, g *models.Goal) error {
+	_, err := m.goals().ReplaceOne(ctx, bson.M{"_id": g.ID}, g, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) DeleteGoalsByUser(ctx context.Context, userID string) error {
+	_, err := m.goals().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- alerts ----------------
+
+func (m *MongoStore) alertRules() *mongo.Collection { return m.db.Collection("alert_rules") }
+func (m *MongoStore) alerts() *mongo.Collection     { return m.db.Collection("alerts") }
+
+func (m *MongoStore) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	cursor, err := m.alertRules().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.AlertRule
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) FindAlertRule(ctx context.Context, ruleID string) (*models.AlertRule, error) {
+	var r models.AlertRule
+	err := m.alertRules().FindOne(ctx, bson.M{"_id": ruleID}).Decode(&r)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (m *MongoStore) CreateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	res, err := m.alertRules().UpdateOne(ctx, bson.M{"_id": r.ID},
+		bson.M{"$setOnInsert": r}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if res.UpsertedCount == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (m *MongoStore) UpdateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	res, err := m.alertRules().ReplaceOne(ctx, bson.M{"_id": r.ID}, r)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) CreateAlert(ctx context.Context, a *models.Alert) error {
+	_, err := m.alerts().InsertOne(ctx, a)
+	return err
+}
+
+func (m *MongoStore) UpdateAlert(ctx context.Context, a *models.Alert) error {
+	res, err := m.alerts().ReplaceOne(ctx, bson.M{"_id": a.ID}, a)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) findAlert(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*models.Alert, error) {
+	var a models.Alert
+	err := m.alerts().FindOne(ctx, filter, opts...).Decode(&a)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (m *MongoStore) FindAlert(ctx context.Context, alertID string) (*models.Alert, error) {
+	id, err := primitive.ObjectIDFromHex(alertID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return m.findAlert(ctx, bson.M{"_id": id})
+}
+
+func (m *MongoStore) LatestAlert(ctx context.Context, userID, ruleID string) (*models.Alert, error) {
+	return m.findAlert(ctx, bson.M{"user_id": userID, "rule_id": ruleID},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+}
+
+func (m *MongoStore) ListAlerts(ctx context.Context, f AlertFilter, opts ListOptions) ([]models.Alert, string, error) {
+	filter := bson.M{}
+	if f.UserID != "" {
+		filter["user_id"] = f.UserID
+	}
+	if f.OrgID != "" {
+		filter["org_id"] = f.OrgID
+	}
+	if f.RuleID != "" {
+		filter["rule_id"] = f.RuleID
+	}
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+	return findPage[models.Alert](ctx, m.alerts(), filter, opts, alertSortFields, "-created_at")
+}
+
+func (m *MongoStore) DeleteAlertsByUser(ctx context.Context, userID string) error {
+	_, err := m.alerts().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- notifications ----------------
+
+func (m *MongoStore) notifications() *mongo.Collection { return m.db.Collection("notifications") }
+func (m *MongoStore) notifyPrefs() *mongo.Collection   { return m.db.Collection("notification_prefs") }
+func (m *MongoStore) deliveries() *mongo.Collection    { return m.db.Collection("notification_queue") }
+
+func (m *MongoStore) CreateNotification(ctx context.Context, n *models.Notification) error {
+	_, err := m.notifications().InsertOne(ctx, n)
+	return err
+}
+
+func (m *MongoStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts ListOptions) ([]models.Notification, string, error) {
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read_at"] = bson.M{"$exists": false}
+	}
+	return findPage[models.Notification](ctx, m.notifications(), filter, opts, notificationSortFields, "-created_at")
+}
+
+func (m *MongoStore) MarkNotificationRead(ctx context.Context, userID, notificationID string, at time.Time) (*models.Notification, error) {
+	id, err := primitive.ObjectIDFromHex(notificationID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	filter := bson.M{"_id": id, "user_id": userID}
+	if _, err := m.notifications().UpdateOne(ctx, bson.M{"_id": id, "user_id": userID, "read_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"read_at": at}}); err != nil {
+		return nil, err
+	}
+	var n models.Notification
+	err = m.notifications().FindOne(ctx, filter).Decode(&n)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (m *MongoStore) MarkAllNotificationsRead(ctx context.Context, userID string, at time.Time) (int64, error) {
+	res, err := m.notifications().UpdateMany(ctx, bson.M{"user_id": userID, "read_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"read_at": at}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+func (m *MongoStore) CountUnreadNotifications(ctx context.Context, userID string) (int64, error) {
+	return m.notifications().CountDocuments(ctx, bson.M{"user_id": userID, "read_at": bson.M{"$exists": false}})
+}
+
+func (m *MongoStore) DeleteNotificationsByUser(ctx context.Context, userID string) error {
+	_, err := m.notifications().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (m *MongoStore) FindNotificationPrefs(ctx context.Context, userID string) (*models.NotificationPrefs, error) {
+	var p models.NotificationPrefs
+	err := m.notifyPrefs().FindOne(ctx, bson.M{"_id": userID}).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (m *MongoStore) SaveNotificationPrefs(ctx context.Context, p *models.NotificationPrefs) error {
+	_, err := m.notifyPrefs().ReplaceOne(ctx, bson.M{"_id": p.UserID}, p, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) DeleteNotificationPrefs(ctx context.Context, userID string) error {
+	_, err := m.notifyPrefs().DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+func (m *MongoStore) EnqueueDelivery(ctx context.Context, d *models.NotificationDelivery) error {
+	_, err := m.deliveries().InsertOne(ctx, d)
+	return err
+}
+
+// ClaimDeliveries takes deliveries one at a time; each FindOneAndUpdate is
+// atomic, so two workers never claim the same one.
+func (m *MongoStore) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.NotificationDelivery, error) {
+	filter := bson.M{"status": models.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+	var out []models.NotificationDelivery
+	for len(out) < limit {
+		var d models.NotificationDelivery
+		err := m.deliveries().FindOneAndUpdate(ctx, filter,
+			bson.M{"$set": bson.M{"next_attempt_at": leaseUntil}}, opts).Decode(&d)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func (m *MongoStore) UpdateDelivery(ctx context.Context, d *models.NotificationDelivery) error {
+	res, err := m.deliveries().ReplaceOne(ctx, bson.M{"_id": d.ID}, d)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) DeleteDeliveriesByUser(ctx context.Context, userID string) error {
+	_, err := m.deliveries().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- scheduled runs ----------------
+
+func (m *MongoStore) scheduledRuns() *mongo.Collection { return m.db.Collection("scheduled_runs") }
+
+func (m *MongoStore) ClaimScheduledRun(ctx context.Context, key, userID string, at time.Time) error {
+	res, err := m.scheduledRuns().UpdateOne(ctx, bson.M{"_id": key},
+		bson.M{"$setOnInsert": bson.M{"user_id": userID, "ran_at": at}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if res.UpsertedCount == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (m *MongoStore) ReleaseScheduledRun(ctx context.Context, key string) error {
+	_, err := m.scheduledRuns().DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+func (m *MongoStore) DeleteScheduledRunsByUser(ctx context.Context, userID string) error {
+	_, err := m.scheduledRuns().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- stats ----------------
+
+// statsMatch selects the user's finished sessions in r.
+func statsMatch(userID string, r StatsRange) bson.M {
+	match := bson.M{
+		"user_id": userID,
+		"status":  bson.M{"$nin": []string{models.SessionActive, models.SessionPaused}},
+	}
+	if tr := timeRange(r.From, r.To); tr != nil {
+		match["started_at"] = tr
+	}
+	return match
+}
+
+func statsTimezone(r StatsRange) string {
+	if r.Timezone == "" {
+		return "UTC"
+	}
+	return r.Timezone
+}
+
+// sessionPauses counts a session's pauses the way ComputeDayMetrics does:
+// the larger of pause_count and the recorded breaks.
+var sessionPauses = bson.M{"$max": bson.A{
+	bson.M{"$ifNull": bson.A{"$pause_count", 0}},
+	bson.M{"$size": bson.M{"$ifNull": bson.A{"$breaks", bson.A{}}}},
+}}
+
+func (m *MongoStore) SessionDayTotals(ctx context.Context, userID string, r StatsRange) ([]DayTotal, error) {
+	pipe := []bson.M{
+		{"$match": statsMatch(userID, r)},
+		{"$group": bson.M{
+			"_id": bson.M{"$dateToString": bson.M{
+				"format": "%Y-%m-%d", "date": "$started_at", "timezone": statsTimezone(r),
+			}},
+			"sessions":  bson.M{"$sum": 1},
+			"minutes":   bson.M{"$sum": "$duration_min"},
+			"pauses":    bson.M{"$sum": sessionPauses},
+			"focus_sum": bson.M{"$sum": "$focus_score"},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+	cursor, err := m.sessions().Aggregate(ctx, pipe)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []struct {
+		Day      string  `bson:"_id"`
+		Sessions int     `bson:"sessions"`
+		Minutes  int     `bson:"minutes"`
+		Pauses   int     `bson:"pauses"`
+		FocusSum float64 `bson:"focus_sum"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make([]DayTotal, 0, len(rows))
+	for _, row := range rows {
+		day, err := time.Parse("2006-01-02", row.Day)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, DayTotal{Day: day, Sessions: row.Sessions, Minutes: row.Minutes, Pauses: row.Pauses, FocusSum: row.FocusSum})
+	}
+	return out, nil
+}
+
+func (m *MongoStore) SessionGroupTotals(ctx context.Context, userID string, r StatsRange) ([]GroupTotal, error) {
+	pipe := []bson.M{
+		{"$match": statsMatch(userID, r)},
+		{"$group": bson.M{
+			"_id":       bson.M{"goal": "$goal", "mode": "$mode"},
+			"sessions":  bson.M{"$sum": 1},
+			"minutes":   bson.M{"$sum": "$duration_min"},
+			"focus_sum": bson.M{"$sum": "$focus_score"},
+		}},
+		{"$sort": bson.D{{Key: "minutes", Value: -1}, {Key: "_id.goal", Value: 1}, {Key: "_id.mode", Value: 1}}},
+	}
+	cursor, err := m.sessions().Aggregate(ctx, pipe)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []struct {
+		ID struct {
+			Goal string `bson:"goal"`
+			Mode string `bson:"mode"`
+		} `bson:"_id"`
+		Sessions int     `bson:"sessions"`
+		Minutes  int     `bson:"minutes"`
+		FocusSum float64 `bson:"focus_sum"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make([]GroupTotal, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, GroupTotal{Goal: row.ID.Goal, Mode: row.ID.Mode, Sessions: row.Sessions, Minutes: row.Minutes, FocusSum: row.FocusSum})
+	}
+	return out, nil
+}
+
+func (m *MongoStore) SessionTimeSlots(ctx context.Context, userID string, r StatsRange) ([]TimeSlot, error) {
+	tz := statsTimezone(r)
+	pipe := []bson.M{
+		{"$match": statsMatch(userID, r)},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"dow":  bson.M{"$dayOfWeek": bson.M{"date": "$started_at", "timezone": tz}},
+				"hour": bson.M{"$hour": bson.M{"date": "$started_at", "timezone": tz}},
+			},
+			"sessions":  bson.M{"$sum": 1},
+			"focus_sum": bson.M{"$sum": "$focus_score"},
+		}},
+		{"$sort": bson.D{{Key: "_id.dow", Value: 1}, {Key: "_id.hour", Value: 1}}},
+	}
+	cursor, err := m.sessions().Aggregate(ctx, pipe)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var rows []struct {
+		ID struct {
+			DayOfWeek int `bson:"dow"` // 1 = Sunday
+			Hour      int `bson:"hour"`
+		} `bson:"_id"`
+		Sessions int     `bson:"sessions"`
+		FocusSum float64 `bson:"focus_sum"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	out := make([]TimeSlot, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, TimeSlot{Weekday: time.Weekday(row.ID.DayOfWeek - 1), Hour: row.ID.Hour, Sessions: row.Sessions, FocusSum: row.FocusSum})
+	}
+	return out, nil
+}
+
+// ---------------- study plans ----------------
+
+func (m *MongoStore) studyPlans() *mongo.Collection  { return m.db.Collection("study_plans") }
+func (m *MongoStore) planMatches() *mongo.Collection { return m.db.Collection("plan_matches") }
+
+func (m *MongoStore) CreateStudyPlan(ctx context.Context, p *models.StudyPlan) error {
+	_, err := m.studyPlans().InsertOne(ctx, p)
+	return err
+}
+
+func (m *MongoStore) UpdateStudyPlan(ctx context.Context, p *models.StudyPlan) error {
+	res, err := m.studyPlans().ReplaceOne(ctx, bson.M{"_id": p.ID}, p)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) FindStudyPlan(ctx context.Context, planID string) (*models.StudyPlan, error) {
+	id, err := primitive.ObjectIDFromHex(planID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	var p models.StudyPlan
+	err = m.studyPlans().FindOne(ctx, bson.M{"_id": id}).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (m *MongoStore) ListStudyPlans(ctx context.Context, userID string) ([]models.StudyPlan, error) {
+	cursor, err := m.studyPlans().Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.StudyPlan
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) DeleteStudyPlan(ctx context.Context, planID string) error {
+	id, err := primitive.ObjectIDFromHex(planID)
+	if err != nil {
+		return ErrNotFound
+	}
+	res, err := m.studyPlans().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = m.planMatches().DeleteMany(ctx, bson.M{"plan_id": planID})
+	return err
+}
+
+func (m *MongoStore) DeleteStudyPlansByUser(ctx context.Context, userID string) error {
+	_, err := m.studyPlans().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (m *MongoStore) CreatePlanMatch(ctx context.Context, pm *models.PlanMatch) error {
+	res, err := m.planMatches().UpdateOne(ctx, bson.M{"_id": pm.ID},
+		bson.M{"$setOnInsert": pm}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if res.UpsertedCount == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (m *MongoStore) ListPlanMatches(ctx context.Context, userID string, from, to *time.Time) ([]models.PlanMatch, error) {
+	filter := bson.M{"user_id": userID}
+	if r := timeRange(from, to); r != nil {
+		filter["occurrence_at"] = r
+	}
+	cursor, err := m.planMatches().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "occurrence_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.PlanMatch
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) DeletePlanMatchesByUser(ctx context.Context, userID string) error {
+	_, err := m.planMatches().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+func (m *MongoStore) DeletePlanMatchesBySession(ctx context.Context, sessionID string) error {
+	_, err := m.planMatches().DeleteMany(ctx, bson.M{"session_id": sessionID})
+	return err
+}
+
+// ---------------- session edits ----------------
+
+func (m *MongoStore) sessionEdits() *mongo.Collection { return m.db.Collection("session_edits") }
+
+func (m *MongoStore) CreateSessionEdit(ctx context.Context, e *models.SessionEdit) error {
+	_, err := m.sessionEdits().InsertOne(ctx, e)
+	return err
+}
+
+func (m *MongoStore) ListSessionEdits(ctx context.Context, sessionID string) ([]models.SessionEdit, error) {
+	cursor, err := m.sessionEdits().Find(ctx, bson.M{"session_id": sessionID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var out []models.SessionEdit
+	err = cursor.All(ctx, &out)
+	return out, err
+}
+
+func (m *MongoStore) DeleteSessionEditsByUser(ctx context.Context, userID string) error {
+	_, err := m.sessionEdits().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- idempotency keys ----------------
+
+func (m *MongoStore) idempotencyKeys() *mongo.Collection { return m.db.Collection("idempotency_keys") }
+
+func (m *MongoStore) ClaimIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord) error {
+	res, err := m.idempotencyKeys().UpdateOne(ctx, bson.M{"_id": r.ID},
+		bson.M{"$setOnInsert": r}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if res.UpsertedCount == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (m *MongoStore) TakeOverIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord, now time.Time) error {
+	res, err := m.idempotencyKeys().ReplaceOne(ctx, bson.M{"_id": r.ID, "$or": bson.A{
+		bson.M{"expires_at": bson.M{"$lte": now}},
+		bson.M{"status": 0, "locked_until": bson.M{"$not": bson.M{"$gt": now}}},
+	}}, r)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (m *MongoStore) FindIdempotencyKey(ctx context.Context, id string) (*models.IdempotencyRecord, error) {
+	var r models.IdempotencyRecord
+	err := m.idempotencyKeys().FindOne(ctx, bson.M{"_id": id}).Decode(&r)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (m *MongoStore) SaveIdempotencyResponse(ctx context.Context, r *models.IdempotencyRecord) error {
+	res, err := m.idempotencyKeys().UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": bson.M{
+		"status":       r.Status,
+		"content_type": r.ContentType,
+		"body":         r.Body,
+	}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoStore) DeleteIdempotencyKey(ctx context.Context, id string) error {
+	_, err := m.idempotencyKeys().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (m *MongoStore) DeleteExpiredIdempotencyKeys(ctx context.Context, t time.Time) (int64, error) {
+	res, err := m.idempotencyKeys().DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": t}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (m *MongoStore) DeleteIdempotencyKeysByUser(ctx context.Context, userID string) error {
+	_, err := m.idempotencyKeys().DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// ---------------- calendar ----------------
+
+func (m *MongoStore) calendarSettings() *mongo.Collection {
+	return m.db.Collection("calendar_settings")
+}
+
+func (m *MongoStore) findCalendarSettings(ctx context.Context, filter bson.M) (*models.CalendarSettings, error) {
+	var cs models.CalendarSettings
+	err := m.calendarSettings().FindOne(ctx, filter).Decode(&cs)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+func (m *MongoStore) FindCalendarSettings(ctx context.Context, userID string) (*models.CalendarSettings, error) {
+	return m.findCalendarSettings(ctx, bson.M{"_id": userID})
+}
+
+func (m *MongoStore) FindCalendarSettingsByFeedToken(ctx context.Context, tokenHash string) (*models.CalendarSettings, error) {
+	if tokenHash == "" {
+		return nil, ErrNotFound
+	}
+	return m.findCalendarSettings(ctx, bson.M{"feed_token_hash": tokenHash})
+}
+
+func (m *MongoStore) SaveCalendarSettings(ctx context.Context, cs *models.CalendarSettings) error {
+	_, err := m.calendarSettings().ReplaceOne(ctx, bson.M{"_id": cs.UserID}, cs, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *MongoStore) DeleteCalendarSettings(ctx context.Context, userID string) error {
+	_, err := m.calendarSettings().DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
+
+// ---------------- pagination ----------------
+
+// mongoCursor is the decoded form of an opaque next_cursor: the sort value
+// and _id of the last item on the previous page.
+type mongoCursor struct {
+	Value bson.RawValue      `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+func encodeMongoCursor(value bson.RawValue, id primitive.ObjectID) (string, error) {
+	b, err := bson.Marshal(mongoCursor{Value: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeMongoCursor(s string) (*mongoCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var pc mongoCursor
+	if err := bson.Unmarshal(b, &pc); err != nil || pc.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &pc, nil
+}
+
+// findPage runs a keyset-paginated Find. The sort field must be in allowed;
+// _id is used as a tie-breaker so pages are stable when sort values repeat.
+// It returns the decoded items and the cursor for the next page ("" when done).
+func findPage[T any](ctx context.Context, coll *mongo.Collection, filter bson.M, opts ListOptions, allowed map[string]bool, defaultSort string) ([]T, string, error) {
+	field, dir, err := parseSort(opts.Sort, defaultSort, allowed)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := pageLimit(opts.Limit)
+
+	query := filter
+	if opts.Cursor != "" {
+		pc, err := decodeMongoCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		op := "$gt"
+		if dir < 0 {
+			op = "$lt"
+		}
+		after := bson.M{"$or": []bson.M{
+			{field: bson.M{op: pc.Value}},
+			{field: pc.Value, "_id": bson.M{op: pc.ID}},
+		}}
+		query = bson.M{"$and": []bson.M{filter, after}}
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: field, Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(limit + 1)
+	cursor, err := coll.Find(ctx, query, findOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cursor.Close(ctx)
+
+	var raws []bson.Raw
+	for cursor.Next(ctx) {
+		raws = append(raws, append(bson.Raw(nil), cursor.Current...))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if int64(len(raws)) > limit {
+		raws = raws[:limit]
+		last := raws[len(raws)-1]
+		id, ok := last.Lookup("_id").ObjectIDOK()
+		if !ok {
+			return nil, "", errors.New("paginated document has no ObjectID _id")
+		}
+		value, err := last.LookupErr(field)
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		next, err = encodeMongoCursor(value, id)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	out := make([]T, 0, len(raws))
+	for _, raw := range raws {
+		var item T
+		if err := bson.Unmarshal(raw, &item); err != nil {
+			return nil, "", err
+		}
+		out = append(out, item)
+	}
+	return out, next, nil
+}
+
+// timeRange builds a {$gte, $lt} filter for the optional bounds, or nil.
+func timeRange(from, to *time.Time) bson.M {
+	if from == nil && to == nil {
+		return nil
+	}
+	r := bson.M{}
+	if from != nil {
+		r["$gte"] = *from
+	}
+	if to != nil {
+		r["$lt"] = *to
+	}
+	return r
+}
@@ -0,0 +1,2030 @@
+package store
+
+import (
+	"authentication/models"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// querier is satisfied by both *sql.DB and *sql.Tx, so the same store code
+// runs inside and outside a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// PostgresStore keeps users, study_sessions and fatigue_scores in PostgreSQL.
+type PostgresStore struct {
+	pool *sql.DB
+	db   querier // pool, or the open transaction inside RunInTx
+}
+
+// NewPostgresStore applies pending migrations and returns the store.
+func NewPostgresStore(ctx context.Context, db *sql.DB) (*PostgresStore, error) {
+	s := &PostgresStore{pool: db, db: db}
+	if err := s.migrate(ctx); err != nil {
+		return nil, fmt.Errorf("postgres migrations: %w", err)
+	}
+	return s, nil
+}
+
+// DB exposes the underlying pool for Postgres-only features.
+func (p *PostgresStore) DB() *sql.DB {
+	return p.pool
+}
+
+// SupportsTransactions is always true for Postgres.
+func (p *PostgresStore) SupportsTransactions(ctx context.Context) bool {
+	return true
+}
+
+// RunInTx runs fn in a transaction, committing only if fn returns nil.
+// Nested calls join the outer transaction.
+func (p *PostgresStore) RunInTx(ctx context.Context, fn func(ctx context.Context, tx Store) error) error {
+	if _, inTx := p.db.(*sql.Tx); inTx {
+		return fn(ctx, p)
+	}
+	tx, err := p.pool.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(ctx, &PostgresStore{pool: p.pool, db: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrate runs every embedded migrations/*.sql file not yet recorded in
+// schema_migrations, in lexical order, each inside its own transaction.
+func (p *PostgresStore) migrate(ctx context.Context) error {
+	if _, err := p.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		version := strings.TrimSuffix(strings.TrimPrefix(name, "migrations/"), ".sql")
+		var exists bool
+		if err := p.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version,
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		body, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tx, err := p.pool.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(body)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func stringPtr(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	s := ns.String
+	return &s
+}
+
+func timePtr(nt sql.NullTime) *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	t := nt.Time
+	return &t
+}
+
+// ---------------- users ----------------
+
+const userColumns = `id, first_name, last_name, password, email, phone, token, role,
+	refresh_token, reset_token, reset_expires, created_at, updated_at, org_id, timezone`
+
+func scanUser(row rowScanner, extra ...interface{}) (models.User, error) {
+	var (
+		u                                  models.User
+		id                                 string
+		first, last, pwd, phone, tok, role sql.NullString
+		refresh, reset, org                sql.NullString
+		email                              string
+		resetExpires                       sql.NullTime
+	)
+	dest := []interface{}{&id, &first, &last, &pwd, &email, &phone, &tok, &role,
+		&refresh, &reset, &resetExpires, &u.Created_at, &u.Updated_at, &org, &u.Timezone}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return u, err
+	}
+	u.ID, _ = primitive.ObjectIDFromHex(id)
+	u.User_id = id
+	u.First_name = stringPtr(first)
+	u.Last_name = stringPtr(last)
+	u.Password = stringPtr(pwd)
+	u.Email = &email
+	u.Phone = stringPtr(phone)
+	u.Token = stringPtr(tok)
+	u.Role = stringPtr(role)
+	u.Refresh_token = stringPtr(refresh)
+	u.Reset_token = stringPtr(reset)
+	u.Reset_expires = timePtr(resetExpires)
+	u.Org_id = org.String
+	return u, nil
+}
+
+func (p *PostgresStore) findUser(ctx context.Context, where string, arg interface{}) (*models.User, error) {
+	row := p.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE `+where, arg)
+	u, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func userArgs(u *models.User) []interface{} {
+	var email string
+	if u.Email != nil {
+		email = *u.Email
+	}
+	role := "USER"
+	if u.Role != nil {
+		role = *u.Role
+	}
+	id := u.User_id
+	if id == "" {
+		id = u.ID.Hex()
+	}
+	var org sql.NullString
+	if u.Org_id != "" {
+		org = sql.NullString{String: u.Org_id, Valid: true}
+	}
+	return []interface{}{id, nullString(u.First_name), nullString(u.Last_name), nullString(u.Password),
+		email, nullString(u.Phone), nullString(u.Token), role,
+		nullString(u.Refresh_token), nullString(u.Reset_token), u.Reset_expires,
+		u.Created_at, u.Updated_at, org, u.Timezone}
+}
+
+func (p *PostgresStore) CreateUser(ctx context.Context, u *models.User) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`, userArgs(u)...)
+	return err
+}
+
+func (p *PostgresStore) CountUsersWithContact(ctx context.Context, email, phone string) (int64, error) {
+	var n int64
+	err := p.db.QueryRowContext(ctx,
+		`SELECT count(*) FROM users WHERE email = $1 OR ($2 <> '' AND phone = $2)`,
+		email, phone,
+	).Scan(&n)
+	return n, err
+}
+
+func (p *PostgresStore) FindUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return p.findUser(ctx, "id = $1", userID)
+}
+
+func (p *PostgresStore) FindUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return p.findUser(ctx, "email = $1", email)
+}
+
+func (p *PostgresStore) FindUserByResetToken(ctx context.Context, token string) (*models.User, error) {
+	return p.findUser(ctx, "reset_token = $1", token)
+}
+
+func (p *PostgresStore) UpdateUserTokens(ctx context.Context, userID, token, refreshToken string) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE users SET token = $2, refresh_token = $3, updated_at = now() WHERE id = $1`,
+		userID, token, refreshToken)
+	return err
+}
+
+func (p *PostgresStore) SetResetToken(ctx context.Context, userID, token string, expires time.Time) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE users SET reset_token = $2, reset_expires = $3, updated_at = now() WHERE id = $1`,
+		userID, token, expires)
+	return err
+}
+
+func (p *PostgresStore) UpdatePassword(ctx context.Context, userID, hashedPassword string) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE users SET password = $2, reset_token = NULL, reset_expires = NULL, updated_at = now() WHERE id = $1`,
+		userID, hashedPassword)
+	return err
+}
+
+func (p *PostgresStore) ListUsers(ctx context.Context, f UserFilter, opts ListOptions) ([]models.User, string, error) {
+	q := newPgQuery()
+	if f.OrgID != "" {
+		q.where("org_id = " + q.arg(f.OrgID))
+	}
+	if f.Role != "" {
+		q.where("role = " + q.arg(f.Role))
+	}
+	if f.Search != "" {
+		like := q.arg("%" + escapeLike(f.Search) + "%")
+		q.where("(first_name ILIKE " + like + " OR last_name ILIKE " + like + " OR email ILIKE " + like + ")")
+	}
+	q.timeRange("created_at", f.CreatedFrom, f.CreatedTo)
+	return queryPage(ctx, p.db, q, "users", userColumns, opts, userSortFields, "-created_at", scanUser)
+}
+
+func (p *PostgresStore) SetUserTimezone(ctx context.Context, userID, timezone string) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE users SET timezone = $2, updated_at = now() WHERE id = $1`,
+		userID, timezone)
+	return err
+}
+
+func (p *PostgresStore) SetUserOrg(ctx context.Context, userID, orgID string) error {
+	_, err := p.db.ExecContext(ctx,
+		`UPDATE users SET org_id = NULLIF($2, ''), updated_at = now() WHERE id = $1`,
+		userID, orgID)
+	return err
+}
+
+// ---------------- study sessions ----------------
+
+const sessionColumns = `id, user_id, mode, goal, planned_min, started_at, ended_at, duration_min,
+	focus_score, pause_count, self_rating, self_on_task, breaks, created_at, status, paused_at, updated_at,
+	model_version, goal_id`
+
+const sessionPlaceholders = `$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19`
+
+func scanSession(row rowScanner, extra ...interface{}) (models.StudySession, error) {
+	var (
+		s      models.StudySession
+		id     string
+		ended  sql.NullTime
+		breaks []byte
+		paused sql.NullTime
+		upd    sql.NullTime
+	)
+	dest := []interface{}{&id, &s.UserID, &s.Mode, &s.Goal, &s.PlannedMin, &s.StartedAt, &ended,
+		&s.DurationMin, &s.FocusScore, &s.PauseCount, &s.SelfRating, &s.SelfOnTask, &breaks, &s.CreatedAt,
+		&s.Status, &paused, &upd, &s.ModelVersion, &s.GoalID}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return s, err
+	}
+	s.ID, _ = primitive.ObjectIDFromHex(id)
+	s.EndedAt = timePtr(ended)
+	s.PausedAt = timePtr(paused)
+	s.UpdatedAt = timePtr(upd)
+	if len(breaks) > 0 {
+		if err := json.Unmarshal(breaks, &s.Breaks); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+func sessionArgs(s *models.StudySession) ([]interface{}, error) {
+	var breaks []byte
+	if len(s.Breaks) > 0 {
+		b, err := json.Marshal(s.Breaks)
+		if err != nil {
+			return nil, err
+		}
+		breaks = b
+	}
+	return []interface{}{s.ID.Hex(), s.UserID, s.Mode, s.Goal, s.PlannedMin, s.StartedAt, s.EndedAt,
+		s.DurationMin, s.FocusScore, s.PauseCount, s.SelfRating, s.SelfOnTask, breaks, s.CreatedAt,
+		s.Status, s.PausedAt, s.UpdatedAt, s.ModelVersion, s.GoalID}, nil
+}
+
+func (p *PostgresStore) CreateSession(ctx context.Context, s *models.StudySession) error {
+	args, err := sessionArgs(s)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO study_sessions (`+sessionColumns+`)
+		VALUES (`+sessionPlaceholders+`)`, args...)
+	return err
+}
+
+func (p *PostgresStore) StartSession(ctx context.Context, s *models.StudySession) error {
+	args, err := sessionArgs(s)
+	if err != nil {
+		return err
+	}
+	// study_sessions_open_per_user_idx allows one open session per user.
+	res, err := p.db.ExecContext(ctx, `INSERT INTO study_sessions (`+sessionColumns+`)
+		VALUES (`+sessionPlaceholders+`) ON CONFLICT DO NOTHING`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (p *PostgresStore) ReplaceSessionIf(ctx context.Context, s *models.StudySession, status string, updatedAt *time.Time) error {
+	args, err := sessionArgs(s)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE study_sessions SET (`+sessionColumns+`) = (`+sessionPlaceholders+`)
+		WHERE id = $1 AND status = $20 AND updated_at IS NOT DISTINCT FROM $21`,
+		append(args, status, updatedAt)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStale
+	}
+	return nil
+}
+
+func (p *PostgresStore) RecentSessions(ctx context.Context, userID string, limit int64) ([]models.StudySession, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM study_sessions
+		WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanSession)
+}
+
+func (p *PostgresStore) ListSessions(ctx context.Context, userID string, f SessionFilter, opts ListOptions) ([]models.StudySession, string, error) {
+	q := newPgQuery()
+	q.where("user_id = " + q.arg(userID))
+	if f.Goal != "" {
+		q.where("goal = " + q.arg(f.Goal))
+	}
+	if f.GoalID != "" {
+		q.where("goal_id = " + q.arg(f.GoalID))
+	}
+	if f.Mode != "" {
+		q.where("mode = " + q.arg(f.Mode))
+	}
+	q.timeRange("started_at", f.From, f.To)
+	return queryPage(ctx, p.db, q, "study_sessions", sessionColumns, opts, sessionSortFields, "-created_at", scanSession)
+}
+
+func (p *PostgresStore) findSession(ctx context.Context, where string, arg interface{}) (*models.StudySession, error) {
+	row := p.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM study_sessions WHERE `+where, arg)
+	s, err := scanSession(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (p *PostgresStore) FindSession(ctx context.Context, sessionID string) (*models.StudySession, error) {
+	return p.findSession(ctx, "id = $1", sessionID)
+}
+
+func (p *PostgresStore) FindOpenSession(ctx context.Context, userID string) (*models.StudySession, error) {
+	return p.findSession(ctx, "user_id = $1 AND status IN ('active', 'paused')", userID)
+}
+
+func (p *PostgresStore) IdleOpenSessions(ctx context.Context, idleSince time.Time, limit int64) ([]models.StudySession, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM study_sessions
+		WHERE status IN ('active', 'paused') AND updated_at < $1 LIMIT $2`, idleSince, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanSession)
+}
+
+func (p *PostgresStore) SessionsBetween(ctx context.Context, userID string, from, to time.Time) ([]models.StudySession, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+sessionColumns+` FROM study_sessions
+		WHERE user_id = $1 AND started_at >= $2 AND started_at < $3
+		ORDER BY started_at`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanSession)
+}
+
+func (p *PostgresStore) SessionDays(ctx context.Context, since time.Time) ([]UserDay, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT DISTINCT user_id, date_trunc('day', started_at AT TIME ZONE 'UTC') AS day
+		FROM study_sessions WHERE started_at >= $1 ORDER BY day`, since)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, func(row rowScanner, _ ...interface{}) (UserDay, error) {
+		var d UserDay
+		err := row.Scan(&d.UserID, &d.Day)
+		d.Day = time.Date(d.Day.Year(), d.Day.Month(), d.Day.Day(), 0, 0, 0, 0, time.UTC)
+		return d, err
+	})
+}
+
+// ---------------- fatigue scores ----------------
+
+const fatigueScoreColumns = `id, user_id, date, total_study_hours, break_frequency, focus_stability,
+	fatigue_index, burnout_probability, created_at, model_version`
+
+func scanFatigueScore(row rowScanner, extra ...interface{}) (models.FatigueScore, error) {
+	var (
+		s  models.FatigueScore
+		id string
+	)
+	dest := []interface{}{&id, &s.UserID, &s.Date, &s.TotalStudyHours, &s.BreakFrequency,
+		&s.FocusStability, &s.FatigueIndex, &s.BurnoutProbability, &s.CreatedAt, &s.ModelVersion}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return s, err
+	}
+	s.ID, _ = primitive.ObjectIDFromHex(id)
+	return s, nil
+}
+
+func (p *PostgresStore) UpsertFatigueScore(ctx context.Context, s *models.FatigueScore) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO fatigue_scores (`+fatigueScoreColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id, date) DO UPDATE SET
+			total_study_hours = EXCLUDED.total_study_hours,
+			break_frequency = EXCLUDED.break_frequency,
+			focus_stability = EXCLUDED.focus_stability,
+			fatigue_index = EXCLUDED.fatigue_index,
+			burnout_probability = EXCLUDED.burnout_probability,
+			created_at = EXCLUDED.created_at,
+			model_version = EXCLUDED.model_version`,
+		s.ID.Hex(), s.UserID, s.Date, s.TotalStudyHours, s.BreakFrequency, s.FocusStability,
+		s.FatigueIndex, s.BurnoutProbability, s.CreatedAt, s.ModelVersion)
+	return err
+}
+
+func (p *PostgresStore) RecentFatigueScores(ctx context.Context, userID string, limit int64) ([]models.FatigueScore, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+fatigueScoreColumns+` FROM fatigue_scores
+		WHERE user_id = $1 ORDER BY date DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanFatigueScore)
+}
+
+func (p *PostgresStore) ListFatigueScores(ctx context.Context, userID string, from, to *time.Time, opts ListOptions) ([]models.FatigueScore, string, error) {
+	q := newPgQuery()
+	q.where("user_id = " + q.arg(userID))
+	q.timeRange("date", from, to)
+	return queryPage(ctx, p.db, q, "fatigue_scores", fatigueScoreColumns, opts, fatigueScoreSortFields, "-date", scanFatigueScore)
+}
+
+func (p *PostgresStore) LatestScorePerUser(ctx context.Context, limit int64) ([]models.FatigueScore, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+fatigueScoreColumns+` FROM (
+			SELECT DISTINCT ON (user_id) `+fatigueScoreColumns+`
+			FROM fatigue_scores
+			ORDER BY user_id, date DESC
+		) latest
+		ORDER BY burnout_probability DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanFatigueScore)
+}
+
+// ---------------- account deletion ----------------
+
+func (p *PostgresStore) DeleteUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	return err
+}
+
+func (p *PostgresStore) DeleteSessionsByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM study_sessions WHERE user_id = $1`, userID)
+	return err
+}
+
+func (p *PostgresStore) DeleteSession(ctx context.Context, sessionID string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM study_sessions WHERE id = $1`, sessionID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) DeleteFatigueScore(ctx context.Context, userID string, date time.Time) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM fatigue_scores WHERE user_id = $1 AND date = $2`, userID, date)
+	return err
+}
+
+func (p *PostgresStore) DeleteFatigueScoresByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM fatigue_scores WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- backup / restore ----------------
+
+func eachRow[T any](ctx context.Context, db querier, query string, args []interface{}, scan func(rowScanner, ...interface{}) (T, error), fn func(*T) error) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(&item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func userIDQuery(userIDs []string) *pgQuery {
+	q := newPgQuery()
+	if userIDs != nil {
+		q.where("user_id = ANY(" + q.arg(userIDs) + ")")
+	}
+	return q
+}
+
+func (p *PostgresStore) EachUser(ctx context.Context, orgID, userID string, fn func(*models.User) error) error {
+	q := newPgQuery()
+	if orgID != "" {
+		q.where("org_id = " + q.arg(orgID))
+	}
+	if userID != "" {
+		q.where("id = " + q.arg(userID))
+	}
+	return eachRow(ctx, p.db, `SELECT `+userColumns+` FROM users`+q.whereSQL()+` ORDER BY id`, q.args, scanUser, fn)
+}
+
+func (p *PostgresStore) EachSession(ctx context.Context, userIDs []string, fn func(*models.StudySession) error) error {
+	q := userIDQuery(userIDs)
+	return eachRow(ctx, p.db, `SELECT `+sessionColumns+` FROM study_sessions`+q.whereSQL()+` ORDER BY id`, q.args, scanSession, fn)
+}
+
+func (p *PostgresStore) EachFatigueScore(ctx context.Context, userIDs []string, fn func(*models.FatigueScore) error) error {
+	q := userIDQuery(userIDs)
+	return eachRow(ctx, p.db, `SELECT `+fatigueScoreColumns+` FROM fatigue_scores`+q.whereSQL()+` ORDER BY id`, q.args, scanFatigueScore, fn)
+}
+
+func (p *PostgresStore) EachGoal(ctx context.Context, userIDs []string, fn func(*models.Goal) error) error {
+	q := userIDQuery(userIDs)
+	return eachRow(ctx, p.db, `SELECT `+goalColumns+` FROM goals`+q.whereSQL()+` ORDER BY id`, q.args, scanGoal, fn)
+}
+
+func (p *PostgresStore) exists(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	var ok bool
+	err := p.db.QueryRowContext(ctx, `SELECT EXISTS (`+query+`)`, args...).Scan(&ok)
+	return ok, err
+}
+
+func (p *PostgresStore) UserExists(ctx context.Context, userID string) (bool, error) {
+	return p.exists(ctx, `SELECT 1 FROM users WHERE id = $1`, userID)
+}
+
+func (p *PostgresStore) SessionExists(ctx context.Context, sessionID string) (bool, error) {
+	return p.exists(ctx, `SELECT 1 FROM study_sessions WHERE id = $1`, sessionID)
+}
+
+func (p *PostgresStore) FatigueScoreExists(ctx context.Context, userID string, date time.Time) (bool, error) {
+	return p.exists(ctx, `SELECT 1 FROM fatigue_scores WHERE user_id = $1 AND date = $2`, userID, date)
+}
+
+func (p *PostgresStore) ReplaceUser(ctx context.Context, u *models.User) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (id) DO UPDATE SET
+			first_name = EXCLUDED.first_name, last_name = EXCLUDED.last_name,
+			password = EXCLUDED.password, email = EXCLUDED.email, phone = EXCLUDED.phone,
+			token = EXCLUDED.token, role = EXCLUDED.role, refresh_token = EXCLUDED.refresh_token,
+			reset_token = EXCLUDED.reset_token, reset_expires = EXCLUDED.reset_expires,
+			created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at, org_id = EXCLUDED.org_id,
+			timezone = EXCLUDED.timezone`,
+		userArgs(u)...)
+	return err
+}
+
+func (p *PostgresStore) ReplaceSession(ctx context.Context, s *models.StudySession) error {
+	args, err := sessionArgs(s)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO study_sessions (`+sessionColumns+`)
+		VALUES (`+sessionPlaceholders+`)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = EXCLUDED.user_id, mode = EXCLUDED.mode, goal = EXCLUDED.goal,
+			planned_min = EXCLUDED.planned_min, started_at = EXCLUDED.started_at,
+			ended_at = EXCLUDED.ended_at, duration_min = EXCLUDED.duration_min,
+			focus_score = EXCLUDED.focus_score, pause_count = EXCLUDED.pause_count,
+			self_rating = EXCLUDED.self_rating, self_on_task = EXCLUDED.self_on_task,
+			breaks = EXCLUDED.breaks, created_at = EXCLUDED.created_at,
+			status = EXCLUDED.status, paused_at = EXCLUDED.paused_at, updated_at = EXCLUDED.updated_at,
+			model_version = EXCLUDED.model_version, goal_id = EXCLUDED.goal_id`, args...)
+	return err
+}
+
+// ---------------- recompute jobs ----------------
+
+const recomputeJobColumns = `id, user_id, org_id, date_from, date_to, dry_run, status, checkpoint,
+	users_done, sessions_checked, sessions_changed, days_checked, days_changed, diffs, error,
+	created_at, updated_at, model_version, owner, locked_until`
+
+func (p *PostgresStore) SaveRecomputeJob(ctx context.Context, j *models.RecomputeJob) error {
+	var diffs []byte
+	if len(j.Diffs) > 0 {
+		b, err := json.Marshal(j.Diffs)
+		if err != nil {
+			return err
+		}
+		diffs = b
+	}
+	_, err := p.db.ExecContext(ctx, `INSERT INTO recompute_jobs (`+recomputeJobColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, checkpoint = EXCLUDED.checkpoint,
+			users_done = EXCLUDED.users_done, sessions_checked = EXCLUDED.sessions_checked,
+			sessions_changed = EXCLUDED.sessions_changed, days_checked = EXCLUDED.days_checked,
+			days_changed = EXCLUDED.days_changed, diffs = EXCLUDED.diffs, error = EXCLUDED.error,
+			updated_at = EXCLUDED.updated_at, owner = EXCLUDED.owner, locked_until = EXCLUDED.locked_until`,
+		recomputeJobArgs(j, diffs)...)
+	return err
+}
+
+func recomputeJobArgs(j *models.RecomputeJob, diffs []byte) []interface{} {
+	return []interface{}{j.ID.Hex(), j.UserID, j.OrgID, j.From, j.To, j.DryRun, j.Status, j.Checkpoint,
+		j.UsersDone, j.SessionsChecked, j.SessionsChanged, j.DaysChecked, j.DaysChanged, diffs, j.Error,
+		j.CreatedAt, j.UpdatedAt, j.ModelVersion, j.Owner, j.LockedUntil}
+}
+
+func (p *PostgresStore) ClaimRecomputeJob(ctx context.Context, jobID, owner string, now, lockedUntil time.Time) error {
+	res, err := p.db.ExecContext(ctx, `UPDATE recompute_jobs SET status = $2, owner = $3, locked_until = $4
+		WHERE id = $1 AND status <> $5 AND (owner = $3 OR locked_until <= $6)`,
+		jobID, models.RecomputeRunning, owner, lockedUntil, models.RecomputeCompleted, now)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStale
+	}
+	return nil
+}
+
+func (p *PostgresStore) UpdateRecomputeJob(ctx context.Context, j *models.RecomputeJob) error {
+	var diffs []byte
+	if len(j.Diffs) > 0 {
+		b, err := json.Marshal(j.Diffs)
+		if err != nil {
+			return err
+		}
+		diffs = b
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE recompute_jobs SET (`+recomputeJobColumns+`)
+		= ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+		WHERE id = $1 AND owner = $19`, recomputeJobArgs(j, diffs)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStale
+	}
+	return nil
+}
+
+func (p *PostgresStore) FindRecomputeJob(ctx context.Context, jobID string) (*models.RecomputeJob, error) {
+	var (
+		j     models.RecomputeJob
+		id    string
+		diffs []byte
+	)
+	err := p.db.QueryRowContext(ctx, `SELECT `+recomputeJobColumns+` FROM recompute_jobs WHERE id = $1`, jobID).Scan(
+		&id, &j.UserID, &j.OrgID, &j.From, &j.To, &j.DryRun, &j.Status, &j.Checkpoint,
+		&j.UsersDone, &j.SessionsChecked, &j.SessionsChanged, &j.DaysChecked, &j.DaysChanged, &diffs, &j.Error,
+		&j.CreatedAt, &j.UpdatedAt, &j.ModelVersion, &j.Owner, &j.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.ID, _ = primitive.ObjectIDFromHex(id)
+	if len(diffs) > 0 {
+		if err := json.Unmarshal(diffs, &j.Diffs); err != nil {
+			return nil, err
+		}
+	}
+	return &j, nil
+}
+
+// ---------------- scoring models ----------------
+
+const scoringModelColumns = `version, description, params, active, created_at, activated_at,
+	focus_scorer, fatigue_model`
+
+func scanScoringModel(row rowScanner, extra ...interface{}) (models.ScoringModel, error) {
+	var (
+		m         models.ScoringModel
+		params    []byte
+		activated sql.NullTime
+	)
+	dest := []interface{}{&m.Version, &m.Description, &params, &m.Active, &m.CreatedAt, &activated,
+		&m.FocusScorer, &m.FatigueModel}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return m, err
+	}
+	m.ActivatedAt = timePtr(activated)
+	if err := json.Unmarshal(params, &m.Params); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func (p *PostgresStore) ListScoringModels(ctx context.Context) ([]models.ScoringModel, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+scoringModelColumns+` FROM scoring_models ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanScoringModel)
+}
+
+func (p *PostgresStore) findScoringModel(ctx context.Context, query string, args ...interface{}) (*models.ScoringModel, error) {
+	m, err := scanScoringModel(p.db.QueryRowContext(ctx, `SELECT `+scoringModelColumns+` FROM scoring_models `+query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (p *PostgresStore) FindScoringModel(ctx context.Context, version string) (*models.ScoringModel, error) {
+	return p.findScoringModel(ctx, `WHERE version = $1`, version)
+}
+
+func (p *PostgresStore) ActiveScoringModel(ctx context.Context) (*models.ScoringModel, error) {
+	return p.findScoringModel(ctx, `WHERE active ORDER BY activated_at DESC LIMIT 1`)
+}
+
+func (p *PostgresStore) CreateScoringModel(ctx context.Context, m *models.ScoringModel) error {
+	params, err := json.Marshal(m.Params)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `INSERT INTO scoring_models (`+scoringModelColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (version) DO NOTHING`,
+		m.Version, m.Description, params, m.Active, m.CreatedAt, m.ActivatedAt,
+		m.FocusScorer, m.FatigueModel)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (p *PostgresStore) ActivateScoringModel(ctx context.Context, version string, at time.Time) error {
+	return p.RunInTx(ctx, func(ctx context.Context, tx Store) error {
+		db := tx.(*PostgresStore).db
+		res, err := db.ExecContext(ctx, `UPDATE scoring_models SET active = TRUE, activated_at = $2 WHERE version = $1`, version, at)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		_, err = db.ExecContext(ctx, `UPDATE scoring_models SET active = FALSE WHERE version <> $1 AND active`, version)
+		return err
+	})
+}
+
+// ---------------- organization settings ----------------
+
+func (p *PostgresStore) FindOrgSettings(ctx context.Context, orgID string) (*models.OrgSettings, error) {
+	var o models.OrgSettings
+	err := p.db.QueryRowContext(ctx, `SELECT org_id, scoring_model, updated_at FROM org_settings WHERE org_id = $1`, orgID).
+		Scan(&o.OrgID, &o.ScoringModel, &o.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (p *PostgresStore) SaveOrgSettings(ctx context.Context, o *models.OrgSettings) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO org_settings (org_id, scoring_model, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id) DO UPDATE SET
+			scoring_model = EXCLUDED.scoring_model, updated_at = EXCLUDED.updated_at`,
+		o.OrgID, o.ScoringModel, o.UpdatedAt)
+	return err
+}
+
+// ---------------- goal baselines ----------------
+
+const goalBaselineColumns = `user_id, goal, baseline_min, default_min, median_min, samples, updated_at`
+
+func scanGoalBaseline(row rowScanner, extra ...interface{}) (models.GoalBaseline, error) {
+	var b models.GoalBaseline
+	dest := []interface{}{&b.UserID, &b.Goal, &b.BaselineMin, &b.DefaultMin, &b.MedianMin, &b.Samples, &b.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	return b, err
+}
+
+func (p *PostgresStore) UpsertGoalBaseline(ctx context.Context, b *models.GoalBaseline) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO goal_baselines (`+goalBaselineColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id, goal) DO UPDATE SET
+			baseline_min = EXCLUDED.baseline_min, default_min = EXCLUDED.default_min,
+			median_min = EXCLUDED.median_min, samples = EXCLUDED.samples, updated_at = EXCLUDED.updated_at`,
+		b.UserID, b.Goal, b.BaselineMin, b.DefaultMin, b.MedianMin, b.Samples, b.UpdatedAt)
+	return err
+}
+
+func (p *PostgresStore) FindGoalBaseline(ctx context.Context, userID, goal string) (*models.GoalBaseline, error) {
+	b, err := scanGoalBaseline(p.db.QueryRowContext(ctx, `SELECT `+goalBaselineColumns+` FROM goal_baselines
+		WHERE user_id = $1 AND goal = $2`, userID, goal))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (p *PostgresStore) ListGoalBaselines(ctx context.Context, userID string) ([]models.GoalBaseline, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+goalBaselineColumns+` FROM goal_baselines
+		WHERE user_id = $1 ORDER BY goal`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanGoalBaseline)
+}
+
+func (p *PostgresStore) DeleteGoalBaseline(ctx context.Context, userID, goal string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM goal_baselines WHERE user_id = $1 AND goal = $2`, userID, goal)
+	return err
+}
+
+func (p *PostgresStore) DeleteGoalBaselinesByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM goal_baselines WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- goals ----------------
+
+const goalColumns = `id, user_id, org_id, name, category, color, target_min, weekly_target_min,
+	aliases, archived, created_at, updated_at`
+
+func scanGoal(row rowScanner, extra ...interface{}) (models.Goal, error) {
+	var (
+		g       models.Goal
+		id      string
+		aliases []byte
+	)
+	dest := []interface{}{&id, &g.UserID, &g.OrgID, &g.Name, &g.Category, &g.Color, &g.TargetMin,
+		&g.WeeklyTargetMin, &aliases, &g.Archived, &g.CreatedAt, &g.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return g, err
+	}
+	g.ID, _ = primitive.ObjectIDFromHex(id)
+	if len(aliases) > 0 {
+		if err := json.Unmarshal(aliases, &g.Aliases); err != nil {
+			return g, err
+		}
+	}
+	return g, nil
+}
+
+func goalArgs(g *models.Goal) ([]interface{}, error) {
+	var aliases []byte
+	if len(g.Aliases) > 0 {
+		b, err := json.Marshal(g.Aliases)
+		if err != nil {
+			return nil, err
+		}
+		aliases = b
+	}
+	return []interface{}{g.ID.Hex(), g.UserID, g.OrgID, g.Name, g.Category, g.Color, g.TargetMin,
+		g.WeeklyTargetMin, aliases, g.Archived, g.CreatedAt, g.UpdatedAt}, nil
+}
+
+func (p *PostgresStore) CreateGoal(ctx context.Context, g *models.Goal) error {
+	args, err := goalArgs(g)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO goals (`+goalColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`, args...)
+	return err
+}
+
+func (p *PostgresStore) UpdateGoal(ctx context.Context, g *models.Goal) error {
+	args, err := goalArgs(g)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE goals SET
+			user_id = $2, org_id = $3, name = $4, category = $5, color = $6, target_min = $7,
+			weekly_target_min = $8, aliases = $9, archived = $10, created_at = $11, updated_at = $12
+		WHERE id = $1`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) FindGoal(ctx context.Context, goalID string) (*models.Goal, error) {
+	g, err := scanGoal(p.db.QueryRowContext(ctx, `SELECT `+goalColumns+` FROM goals WHERE id = $1`, goalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (p *PostgresStore) ListGoals(ctx context.Context, userID, orgID string, includeArchived bool) ([]models.Goal, error) {
+	if userID == "" && orgID == "" {
+		return nil, nil
+	}
+	q := newPgQuery()
+	var owners []string
+	if userID != "" {
+		owners = append(owners, "user_id = "+q.arg(userID))
+	}
+	if orgID != "" {
+		owners = append(owners, "org_id = "+q.arg(orgID))
+	}
+	q.where("(" + strings.Join(owners, " OR ") + ")")
+	if !includeArchived {
+		q.where("NOT archived")
+	}
+	rows, err := p.db.QueryContext(ctx, `SELECT `+goalColumns+` FROM goals`+q.whereSQL()+` ORDER BY id`, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanGoal)
+}
+
+func (p *PostgresStore) ReplaceGoal(ctx context.Context, g *models.Goal) error {
+	args, err := goalArgs(g)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO goals (`+goalColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = EXCLUDED.user_id, org_id = EXCLUDED.org_id, name = EXCLUDED.name,
+			category = EXCLUDED.category, color = EXCLUDED.color, target_min = EXCLUDED.target_min,
+			weekly_target_min = EXCLUDED.weekly_target_min, aliases = EXCLUDED.aliases,
+			archived = EXCLUDED.archived, created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at`, args...)
+	return err
+}
+
+func (p *PostgresStore) DeleteGoalsByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM goals WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- alerts ----------------
+
+const alertRuleColumns = `id, org_id, name, kind, metric, threshold, days, severity, cooldown_hours,
+	enabled, created_at, updated_at`
+
+func scanAlertRule(row rowScanner, extra ...interface{}) (models.AlertRule, error) {
+	var r models.AlertRule
+	dest := []interface{}{&r.ID, &r.OrgID, &r.Name, &r.Kind, &r.Metric, &r.Threshold, &r.Days, &r.Severity,
+		&r.CooldownHours, &r.Enabled, &r.CreatedAt, &r.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	return r, err
+}
+
+func alertRuleArgs(r *models.AlertRule) []interface{} {
+	return []interface{}{r.ID, r.OrgID, r.Name, r.Kind, r.Metric, r.Threshold, r.Days, r.Severity,
+		r.CooldownHours, r.Enabled, r.CreatedAt, r.UpdatedAt}
+}
+
+func (p *PostgresStore) ListAlertRules(ctx context.Context) ([]models.AlertRule, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanAlertRule)
+}
+
+func (p *PostgresStore) FindAlertRule(ctx context.Context, ruleID string) (*models.AlertRule, error) {
+	r, err := scanAlertRule(p.db.QueryRowContext(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = $1`, ruleID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (p *PostgresStore) CreateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	res, err := p.db.ExecContext(ctx, `INSERT INTO alert_rules (`+alertRuleColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) ON CONFLICT (id) DO NOTHING`,
+		alertRuleArgs(r)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (p *PostgresStore) UpdateAlertRule(ctx context.Context, r *models.AlertRule) error {
+	res, err := p.db.ExecContext(ctx, `UPDATE alert_rules SET
+			org_id = $2, name = $3, kind = $4, metric = $5, threshold = $6, days = $7, severity = $8,
+			cooldown_hours = $9, enabled = $10, created_at = $11, updated_at = $12
+		WHERE id = $1`, alertRuleArgs(r)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const alertColumns = `id, user_id, org_id, rule_id, severity, status, message, value, date, created_at,
+	acknowledged_at, acknowledged_by, resolved_at, resolved_by`
+
+func scanAlert(row rowScanner, extra ...interface{}) (models.Alert, error) {
+	var (
+		a            models.Alert
+		id           string
+		ackAt, resAt sql.NullTime
+	)
+	dest := []interface{}{&id, &a.UserID, &a.OrgID, &a.RuleID, &a.Severity, &a.Status, &a.Message, &a.Value,
+		&a.Date, &a.CreatedAt, &ackAt, &a.AcknowledgedBy, &resAt, &a.ResolvedBy}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return a, err
+	}
+	a.ID, _ = primitive.ObjectIDFromHex(id)
+	a.AcknowledgedAt = timePtr(ackAt)
+	a.ResolvedAt = timePtr(resAt)
+	return a, nil
+}
+
+func alertArgs(a *models.Alert) []interface{} {
+	return []interface{}{a.ID.Hex(), a.UserID, a.OrgID, a.RuleID, a.Severity, a.Status, a.Message, a.Value,
+		a.Date, a.CreatedAt, a.AcknowledgedAt, a.AcknowledgedBy, a.ResolvedAt, a.ResolvedBy}
+}
+
+func (p *PostgresStore) CreateAlert(ctx context.Context, a *models.Alert) error {
+	_, err := p.db.ExecContext(ctx, `INSERT INTO alerts (`+alertColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`, alertArgs(a)...)
+	return err
+}
+
+func (p *PostgresStore) UpdateAlert(ctx context.Context, a *models.Alert) error {
+	res, err := p.db.ExecContext(ctx, `UPDATE alerts SET
+			user_id = $2, org_id = $3, rule_id = $4, severity = $5, status = $6, message = $7, value = $8,
+			date = $9, created_at = $10, acknowledged_at = $11, acknowledged_by = $12,
+			resolved_at = $13, resolved_by = $14
+		WHERE id = $1`, alertArgs(a)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) findAlert(ctx context.Context, query string, args ...interface{}) (*models.Alert, error) {
+	a, err := scanAlert(p.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts `+query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (p *PostgresStore) FindAlert(ctx context.Context, alertID string) (*models.Alert, error) {
+	return p.findAlert(ctx, `WHERE id = $1`, alertID)
+}
+
+func (p *PostgresStore) LatestAlert(ctx context.Context, userID, ruleID string) (*models.Alert, error) {
+	return p.findAlert(ctx, `WHERE user_id = $1 AND rule_id = $2 ORDER BY created_at DESC, id DESC LIMIT 1`, userID, ruleID)
+}
+
+func (p *PostgresStore) ListAlerts(ctx context.Context, f AlertFilter, opts ListOptions) ([]models.Alert, string, error) {
+	q := newPgQuery()
+	if f.UserID != "" {
+		q.where("user_id = " + q.arg(f.UserID))
+	}
+	if f.OrgID != "" {
+		q.where("org_id = " + q.arg(f.OrgID))
+	}
+	if f.RuleID != "" {
+		q.where("rule_id = " + q.arg(f.RuleID))
+	}
+	if f.Status != "" {
+		q.where("status = " + q.arg(f.Status))
+	}
+	return queryPage(ctx, p.db, q, "alerts", alertColumns, opts, alertSortFields, "-created_at", scanAlert)
+}
+
+func (p *PostgresStore) DeleteAlertsByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM alerts WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- notifications ----------------
+
+// dataJSON encodes a notification's template data; empty maps are NULL.
+func dataJSON(data map[string]string) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(data)
+}
+
+func scanData(b []byte) (map[string]string, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	var data map[string]string
+	err := json.Unmarshal(b, &data)
+	return data, err
+}
+
+const notificationColumns = `id, user_id, kind, title, body, data, read_at, created_at`
+
+func scanNotification(row rowScanner, extra ...interface{}) (models.Notification, error) {
+	var (
+		n      models.Notification
+		id     string
+		data   []byte
+		readAt sql.NullTime
+	)
+	dest := []interface{}{&id, &n.UserID, &n.Kind, &n.Title, &n.Body, &data, &readAt, &n.CreatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return n, err
+	}
+	n.ID, _ = primitive.ObjectIDFromHex(id)
+	n.ReadAt = timePtr(readAt)
+	var err error
+	n.Data, err = scanData(data)
+	return n, err
+}
+
+func (p *PostgresStore) CreateNotification(ctx context.Context, n *models.Notification) error {
+	data, err := dataJSON(n.Data)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO notifications (`+notificationColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		n.ID.Hex(), n.UserID, n.Kind, n.Title, n.Body, data, n.ReadAt, n.CreatedAt)
+	return err
+}
+
+func (p *PostgresStore) ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts ListOptions) ([]models.Notification, string, error) {
+	q := newPgQuery()
+	q.where("user_id = " + q.arg(userID))
+	if unreadOnly {
+		q.where("read_at IS NULL")
+	}
+	return queryPage(ctx, p.db, q, "notifications", notificationColumns, opts, notificationSortFields, "-created_at", scanNotification)
+}
+
+func (p *PostgresStore) MarkNotificationRead(ctx context.Context, userID, notificationID string, at time.Time) (*models.Notification, error) {
+	n, err := scanNotification(p.db.QueryRowContext(ctx, `UPDATE notifications SET read_at = COALESCE(read_at, $3)
+		WHERE id = $1 AND user_id = $2 RETURNING `+notificationColumns, notificationID, userID, at))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (p *PostgresStore) MarkAllNotificationsRead(ctx context.Context, userID string, at time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `UPDATE notifications SET read_at = $2 WHERE user_id = $1 AND read_at IS NULL`, userID, at)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *PostgresStore) CountUnreadNotifications(ctx context.Context, userID string) (int64, error) {
+	var n int64
+	err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func (p *PostgresStore) DeleteNotificationsByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM notifications WHERE user_id = $1`, userID)
+	return err
+}
+
+func (p *PostgresStore) FindNotificationPrefs(ctx context.Context, userID string) (*models.NotificationPrefs, error) {
+	var (
+		np       models.NotificationPrefs
+		channels []byte
+	)
+	err := p.db.QueryRowContext(ctx, `SELECT user_id, channels, webhook_url, quiet_start, quiet_end, updated_at
+		FROM notification_prefs WHERE user_id = $1`, userID).
+		Scan(&np.UserID, &channels, &np.WebhookURL, &np.QuietStart, &np.QuietEnd, &np.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(channels, &np.Channels); err != nil {
+		return nil, err
+	}
+	return &np, nil
+}
+
+func (p *PostgresStore) SaveNotificationPrefs(ctx context.Context, np *models.NotificationPrefs) error {
+	channels, err := json.Marshal(np.Channels)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO notification_prefs (user_id, channels, webhook_url, quiet_start, quiet_end, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			channels = EXCLUDED.channels, webhook_url = EXCLUDED.webhook_url, quiet_start = EXCLUDED.quiet_start,
+			quiet_end = EXCLUDED.quiet_end, updated_at = EXCLUDED.updated_at`,
+		np.UserID, channels, np.WebhookURL, np.QuietStart, np.QuietEnd, np.UpdatedAt)
+	return err
+}
+
+func (p *PostgresStore) DeleteNotificationPrefs(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM notification_prefs WHERE user_id = $1`, userID)
+	return err
+}
+
+const deliveryColumns = `id, user_id, channel, kind, target, subject, body, data, status, attempts,
+	next_attempt_at, last_error, created_at, sent_at`
+
+func scanDelivery(row rowScanner, extra ...interface{}) (models.NotificationDelivery, error) {
+	var (
+		d      models.NotificationDelivery
+		id     string
+		data   []byte
+		sentAt sql.NullTime
+	)
+	dest := []interface{}{&id, &d.UserID, &d.Channel, &d.Kind, &d.Target, &d.Subject, &d.Body, &data, &d.Status,
+		&d.Attempts, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &sentAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return d, err
+	}
+	d.ID, _ = primitive.ObjectIDFromHex(id)
+	d.SentAt = timePtr(sentAt)
+	var err error
+	d.Data, err = scanData(data)
+	return d, err
+}
+
+func deliveryArgs(d *models.NotificationDelivery) ([]interface{}, error) {
+	data, err := dataJSON(d.Data)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{d.ID.Hex(), d.UserID, d.Channel, d.Kind, d.Target, d.Subject, d.Body, data, d.Status,
+		d.Attempts, d.NextAttemptAt, d.LastError, d.CreatedAt, d.SentAt}, nil
+}
+
+func (p *PostgresStore) EnqueueDelivery(ctx context.Context, d *models.NotificationDelivery) error {
+	args, err := deliveryArgs(d)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO notification_queue (`+deliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`, args...)
+	return err
+}
+
+func (p *PostgresStore) ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.NotificationDelivery, error) {
+	rows, err := p.db.QueryContext(ctx, `UPDATE notification_queue SET next_attempt_at = $3
+		WHERE id IN (
+			SELECT id FROM notification_queue
+			WHERE status = $1 AND next_attempt_at <= $2
+			ORDER BY next_attempt_at, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns, models.DeliveryPending, now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	out, err := collectRows(rows, scanDelivery)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (p *PostgresStore) UpdateDelivery(ctx context.Context, d *models.NotificationDelivery) error {
+	args, err := deliveryArgs(d)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE notification_queue SET
+			user_id = $2, channel = $3, kind = $4, target = $5, subject = $6, body = $7, data = $8,
+			status = $9, attempts = $10, next_attempt_at = $11, last_error = $12, created_at = $13, sent_at = $14
+		WHERE id = $1`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) DeleteDeliveriesByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM notification_queue WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- scheduled runs ----------------
+
+func (p *PostgresStore) ClaimScheduledRun(ctx context.Context, key, userID string, at time.Time) error {
+	res, err := p.db.ExecContext(ctx, `INSERT INTO scheduled_runs (key, user_id, ran_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING`, key, userID, at)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (p *PostgresStore) ReleaseScheduledRun(ctx context.Context, key string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM scheduled_runs WHERE key = $1`, key)
+	return err
+}
+
+func (p *PostgresStore) DeleteScheduledRunsByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM scheduled_runs WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- stats ----------------
+
+// statsQuery selects the user's finished sessions in r.
+func statsQuery(userID string, r StatsRange) *pgQuery {
+	q := newPgQuery()
+	q.where("user_id = " + q.arg(userID))
+	q.where("status NOT IN ('active', 'paused')")
+	q.timeRange("started_at", r.From, r.To)
+	return q
+}
+
+// tzArg adds r's timezone as an argument and returns its placeholder.
+func (q *pgQuery) tzArg(r StatsRange) string {
+	if r.Timezone == "" {
+		return q.arg("UTC")
+	}
+	return q.arg(r.Timezone)
+}
+
+func (p *PostgresStore) SessionDayTotals(ctx context.Context, userID string, r StatsRange) ([]DayTotal, error) {
+	q := statsQuery(userID, r)
+	tz := q.tzArg(r)
+	rows, err := p.db.QueryContext(ctx, `SELECT date_trunc('day', started_at AT TIME ZONE `+tz+`) AS day,
+			COUNT(*), COALESCE(SUM(duration_min), 0),
+			COALESCE(SUM(GREATEST(pause_count, COALESCE(jsonb_array_length(breaks), 0))), 0),
+			COALESCE(SUM(focus_score), 0)
+		FROM study_sessions`+q.whereSQL()+` GROUP BY day ORDER BY day`, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, func(row rowScanner, _ ...interface{}) (DayTotal, error) {
+		var d DayTotal
+		err := row.Scan(&d.Day, &d.Sessions, &d.Minutes, &d.Pauses, &d.FocusSum)
+		d.Day = time.Date(d.Day.Year(), d.Day.Month(), d.Day.Day(), 0, 0, 0, 0, time.UTC)
+		return d, err
+	})
+}
+
+func (p *PostgresStore) SessionGroupTotals(ctx context.Context, userID string, r StatsRange) ([]GroupTotal, error) {
+	q := statsQuery(userID, r)
+	rows, err := p.db.QueryContext(ctx, `SELECT goal, mode, COUNT(*), COALESCE(SUM(duration_min), 0),
+			COALESCE(SUM(focus_score), 0)
+		FROM study_sessions`+q.whereSQL()+`
+		GROUP BY goal, mode ORDER BY 4 DESC, goal, mode`, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, func(row rowScanner, _ ...interface{}) (GroupTotal, error) {
+		var g GroupTotal
+		err := row.Scan(&g.Goal, &g.Mode, &g.Sessions, &g.Minutes, &g.FocusSum)
+		return g, err
+	})
+}
+
+func (p *PostgresStore) SessionTimeSlots(ctx context.Context, userID string, r StatsRange) ([]TimeSlot, error) {
+	q := statsQuery(userID, r)
+	tz := q.tzArg(r)
+	rows, err := p.db.QueryContext(ctx, `SELECT EXTRACT(DOW FROM started_at AT TIME ZONE `+tz+`)::int AS dow,
+			EXTRACT(HOUR FROM started_at AT TIME ZONE `+tz+`)::int AS hour,
+			COUNT(*), COALESCE(SUM(focus_score), 0)
+		FROM study_sessions`+q.whereSQL()+` GROUP BY dow, hour ORDER BY dow, hour`, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, func(row rowScanner, _ ...interface{}) (TimeSlot, error) {
+		var (
+			s   TimeSlot
+			dow int
+		)
+		err := row.Scan(&dow, &s.Hour, &s.Sessions, &s.FocusSum)
+		s.Weekday = time.Weekday(dow)
+		return s, err
+	})
+}
+
+// ---------------- study plans ----------------
+
+const studyPlanColumns = `id, user_id, goal, goal_id, start_at, planned_min, rrule, exdates, timezone, note,
+	external_uid, created_at, updated_at`
+
+func scanStudyPlan(row rowScanner, extra ...interface{}) (models.StudyPlan, error) {
+	var (
+		sp      models.StudyPlan
+		id      string
+		exdates []byte
+	)
+	dest := []interface{}{&id, &sp.UserID, &sp.Goal, &sp.GoalID, &sp.StartAt, &sp.PlannedMin, &sp.RRule, &exdates,
+		&sp.Timezone, &sp.Note, &sp.ExternalUID, &sp.CreatedAt, &sp.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return sp, err
+	}
+	sp.ID, _ = primitive.ObjectIDFromHex(id)
+	if len(exdates) > 0 {
+		if err := json.Unmarshal(exdates, &sp.ExDates); err != nil {
+			return sp, err
+		}
+	}
+	return sp, nil
+}
+
+func studyPlanArgs(sp *models.StudyPlan) ([]interface{}, error) {
+	var exdates []byte
+	if len(sp.ExDates) > 0 {
+		var err error
+		if exdates, err = json.Marshal(sp.ExDates); err != nil {
+			return nil, err
+		}
+	}
+	return []interface{}{sp.ID.Hex(), sp.UserID, sp.Goal, sp.GoalID, sp.StartAt, sp.PlannedMin, sp.RRule, exdates,
+		sp.Timezone, sp.Note, sp.ExternalUID, sp.CreatedAt, sp.UpdatedAt}, nil
+}
+
+func (p *PostgresStore) CreateStudyPlan(ctx context.Context, sp *models.StudyPlan) error {
+	args, err := studyPlanArgs(sp)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO study_plans (`+studyPlanColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`, args...)
+	return err
+}
+
+func (p *PostgresStore) UpdateStudyPlan(ctx context.Context, sp *models.StudyPlan) error {
+	args, err := studyPlanArgs(sp)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE study_plans SET
+			user_id = $2, goal = $3, goal_id = $4, start_at = $5, planned_min = $6, rrule = $7, exdates = $8,
+			timezone = $9, note = $10, external_uid = $11, created_at = $12, updated_at = $13
+		WHERE id = $1`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) FindStudyPlan(ctx context.Context, planID string) (*models.StudyPlan, error) {
+	sp, err := scanStudyPlan(p.db.QueryRowContext(ctx, `SELECT `+studyPlanColumns+` FROM study_plans WHERE id = $1`, planID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+func (p *PostgresStore) ListStudyPlans(ctx context.Context, userID string) ([]models.StudyPlan, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+studyPlanColumns+` FROM study_plans WHERE user_id = $1 ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, scanStudyPlan)
+}
+
+func (p *PostgresStore) DeleteStudyPlan(ctx context.Context, planID string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM study_plans WHERE id = $1`, planID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	_, err = p.db.ExecContext(ctx, `DELETE FROM plan_matches WHERE plan_id = $1`, planID)
+	return err
+}
+
+func (p *PostgresStore) DeleteStudyPlansByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM study_plans WHERE user_id = $1`, userID)
+	return err
+}
+
+const planMatchColumns = `id, user_id, plan_id, occurrence_at, session_id, planned_min, actual_min,
+	start_delay_min, on_time, minutes_ratio, adherence, created_at`
+
+func (p *PostgresStore) CreatePlanMatch(ctx context.Context, m *models.PlanMatch) error {
+	res, err := p.db.ExecContext(ctx, `INSERT INTO plan_matches (`+planMatchColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO NOTHING`,
+		m.ID, m.UserID, m.PlanID, m.OccurrenceAt, m.SessionID, m.PlannedMin, m.ActualMin,
+		m.StartDelayMin, m.OnTime, m.MinutesRatio, m.Adherence, m.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (p *PostgresStore) ListPlanMatches(ctx context.Context, userID string, from, to *time.Time) ([]models.PlanMatch, error) {
+	q := newPgQuery()
+	q.where("user_id = " + q.arg(userID))
+	q.timeRange("occurrence_at", from, to)
+	rows, err := p.db.QueryContext(ctx, `SELECT `+planMatchColumns+` FROM plan_matches`+q.whereSQL()+` ORDER BY occurrence_at`, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, func(row rowScanner, _ ...interface{}) (models.PlanMatch, error) {
+		var m models.PlanMatch
+		err := row.Scan(&m.ID, &m.UserID, &m.PlanID, &m.OccurrenceAt, &m.SessionID, &m.PlannedMin, &m.ActualMin,
+			&m.StartDelayMin, &m.OnTime, &m.MinutesRatio, &m.Adherence, &m.CreatedAt)
+		return m, err
+	})
+}
+
+func (p *PostgresStore) DeletePlanMatchesByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM plan_matches WHERE user_id = $1`, userID)
+	return err
+}
+
+func (p *PostgresStore) DeletePlanMatchesBySession(ctx context.Context, sessionID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM plan_matches WHERE session_id = $1`, sessionID)
+	return err
+}
+
+// ---------------- session edits ----------------
+
+const sessionEditColumns = `id, session_id, user_id, edited_by, action, fields, original, created_at`
+
+func (p *PostgresStore) CreateSessionEdit(ctx context.Context, e *models.SessionEdit) error {
+	var fields []byte
+	if len(e.Fields) > 0 {
+		var err error
+		if fields, err = json.Marshal(e.Fields); err != nil {
+			return err
+		}
+	}
+	original, err := json.Marshal(e.Original)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO session_edits (`+sessionEditColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		e.ID.Hex(), e.SessionID, e.UserID, e.EditedBy, e.Action, fields, original, e.CreatedAt)
+	return err
+}
+
+func (p *PostgresStore) ListSessionEdits(ctx context.Context, sessionID string) ([]models.SessionEdit, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+sessionEditColumns+` FROM session_edits
+		WHERE session_id = $1 ORDER BY created_at, id`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return collectRows(rows, func(row rowScanner, _ ...interface{}) (models.SessionEdit, error) {
+		var (
+			e                models.SessionEdit
+			id               string
+			fields, original []byte
+		)
+		if err := row.Scan(&id, &e.SessionID, &e.UserID, &e.EditedBy, &e.Action, &fields, &original, &e.CreatedAt); err != nil {
+			return e, err
+		}
+		e.ID, _ = primitive.ObjectIDFromHex(id)
+		if len(fields) > 0 {
+			if err := json.Unmarshal(fields, &e.Fields); err != nil {
+				return e, err
+			}
+		}
+		return e, json.Unmarshal(original, &e.Original)
+	})
+}
+
+func (p *PostgresStore) DeleteSessionEditsByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM session_edits WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- idempotency keys ----------------
+
+const idempotencyColumns = `id, user_id, request_hash, status, content_type, body, created_at, expires_at, locked_until`
+
+func (p *PostgresStore) ClaimIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord) error {
+	res, err := p.db.ExecContext(ctx, `INSERT INTO idempotency_keys (`+idempotencyColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO NOTHING`,
+		r.ID, r.UserID, r.RequestHash, r.Status, r.ContentType, r.Body, r.CreatedAt, r.ExpiresAt, r.LockedUntil)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (p *PostgresStore) TakeOverIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord, now time.Time) error {
+	res, err := p.db.ExecContext(ctx, `UPDATE idempotency_keys SET (`+idempotencyColumns+`)
+		= ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		WHERE id = $1 AND (expires_at <= $10 OR (status = 0 AND locked_until <= $10))`,
+		r.ID, r.UserID, r.RequestHash, r.Status, r.ContentType, r.Body, r.CreatedAt, r.ExpiresAt, r.LockedUntil, now)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (p *PostgresStore) FindIdempotencyKey(ctx context.Context, id string) (*models.IdempotencyRecord, error) {
+	var r models.IdempotencyRecord
+	err := p.db.QueryRowContext(ctx, `SELECT `+idempotencyColumns+` FROM idempotency_keys WHERE id = $1`, id).
+		Scan(&r.ID, &r.UserID, &r.RequestHash, &r.Status, &r.ContentType, &r.Body, &r.CreatedAt, &r.ExpiresAt, &r.LockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (p *PostgresStore) SaveIdempotencyResponse(ctx context.Context, r *models.IdempotencyRecord) error {
+	res, err := p.db.ExecContext(ctx, `UPDATE idempotency_keys SET status = $2, content_type = $3, body = $4
+		WHERE id = $1`, r.ID, r.Status, r.ContentType, r.Body)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStore) DeleteIdempotencyKey(ctx context.Context, id string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE id = $1`, id)
+	return err
+}
+
+func (p *PostgresStore) DeleteExpiredIdempotencyKeys(ctx context.Context, t time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *PostgresStore) DeleteIdempotencyKeysByUser(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- calendar ----------------
+
+const calendarColumns = `user_id, feed_token_hash, feed_created_at, import_keywords, updated_at`
+
+func (p *PostgresStore) findCalendarSettings(ctx context.Context, where string, arg string) (*models.CalendarSettings, error) {
+	var (
+		cs       models.CalendarSettings
+		keywords []byte
+	)
+	err := p.db.QueryRowContext(ctx, `SELECT `+calendarColumns+` FROM calendar_settings WHERE `+where+` = $1`, arg).
+		Scan(&cs.UserID, &cs.FeedTokenHash, &cs.FeedCreatedAt, &keywords, &cs.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(keywords, &cs.ImportKeywords); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+func (p *PostgresStore) FindCalendarSettings(ctx context.Context, userID string) (*models.CalendarSettings, error) {
+	return p.findCalendarSettings(ctx, "user_id", userID)
+}
+
+func (p *PostgresStore) FindCalendarSettingsByFeedToken(ctx context.Context, tokenHash string) (*models.CalendarSettings, error) {
+	if tokenHash == "" {
+		return nil, ErrNotFound
+	}
+	return p.findCalendarSettings(ctx, "feed_token_hash", tokenHash)
+}
+
+func (p *PostgresStore) SaveCalendarSettings(ctx context.Context, cs *models.CalendarSettings) error {
+	keywords, err := json.Marshal(cs.ImportKeywords)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `INSERT INTO calendar_settings (`+calendarColumns+`)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE SET
+			feed_token_hash = EXCLUDED.feed_token_hash, feed_created_at = EXCLUDED.feed_created_at,
+			import_keywords = EXCLUDED.import_keywords, updated_at = EXCLUDED.updated_at`,
+		cs.UserID, cs.FeedTokenHash, cs.FeedCreatedAt, keywords, cs.UpdatedAt)
+	return err
+}
+
+func (p *PostgresStore) DeleteCalendarSettings(ctx context.Context, userID string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM calendar_settings WHERE user_id = $1`, userID)
+	return err
+}
+
+// ---------------- query helpers ----------------
+
+func collectRows[T any](rows *sql.Rows, scan func(rowScanner, ...interface{}) (T, error)) ([]T, error) {
+	defer rows.Close()
+	var out []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+// pgQuery accumulates WHERE clauses and their positional arguments.
+type pgQuery struct {
+	conds []string
+	args  []interface{}
+}
+
+func newPgQuery() *pgQuery {
+	return &pgQuery{}
+}
+
+// arg appends v and returns its placeholder.
+func (q *pgQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *pgQuery) where(cond string) {
+	q.conds = append(q.conds, cond)
+}
+
+func (q *pgQuery) timeRange(column string, from, to *time.Time) {
+	if from != nil {
+		q.where(column + " >= " + q.arg(*from))
+	}
+	if to != nil {
+		q.where(column + " < " + q.arg(*to))
+	}
+}
+
+func (q *pgQuery) whereSQL() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// pgSortCol is a whitelisted sort field: the column to order by, the type
+// its cursor value is read back as, and whether it can be NULL.
+type pgSortCol struct {
+	expr     string
+	typ      string
+	nullable bool
+}
+
+var pgSortExprs = map[string]pgSortCol{
+	"created_at":          {"created_at", "timestamptz", false},
+	"first_name":          {"first_name", "text", true},
+	"last_name":           {"last_name", "text", true},
+	"email":               {"email", "text", false},
+	"started_at":          {"started_at", "timestamptz", false},
+	"duration_min":        {"duration_min", "integer", false},
+	"focus_score":         {"focus_score", "integer", false},
+	"date":                {"date", "timestamptz", false},
+	"fatigue_index":       {"fatigue_index", "double precision", false},
+	"burnout_probability": {"burnout_probability", "double precision", false},
+}
+
+// pgNullSort is what a NULL sorts as: below every other value, as in Mongo.
+// A NULL in the keyset comparison would otherwise drop the row.
+var pgNullSort = map[string]string{
+	"text":             "''",
+	"timestamptz":      "'-infinity'::timestamptz",
+	"integer":          "-2147483648",
+	"double precision": "'-Infinity'::double precision",
+}
+
+// sortExpr is the non-null expression rows are ordered and compared by.
+func (c pgSortCol) sortExpr() string {
+	if !c.nullable {
+		return c.expr
+	}
+	return "COALESCE(" + c.expr + ", " + pgNullSort[c.typ] + ")"
+}
+
+// pgTimestampLayouts cover timestamptz as Postgres writes it as text.
+var pgTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999-07",
+	"2006-01-02 15:04:05.999999-07:00",
+	"2006-01-02 15:04:05.999999-07:00:00",
+}
+
+// cursorValue checks a cursor value from the client against the column
+// type, so a tampered cursor is ErrInvalidCursor rather than a cast error.
+func (c pgSortCol) cursorValue(v string) (interface{}, error) {
+	switch c.typ {
+	case "timestamptz":
+		if v == "infinity" || v == "-infinity" {
+			return v, nil
+		}
+		for _, layout := range pgTimestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return nil, ErrInvalidCursor
+	case "integer":
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return n, nil
+	case "double precision":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return f, nil
+	}
+	return v, nil
+}
+
+type pgCursor struct {
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// queryPage is the Postgres counterpart of findPage: keyset pagination on
+// (sort expression, id) with an opaque cursor.
+func queryPage[T any](ctx context.Context, db querier, q *pgQuery, table, columns string, opts ListOptions, allowed map[string]bool, defaultSort string, scan func(rowScanner, ...interface{}) (T, error)) ([]T, string, error) {
+	field, dir, err := parseSort(opts.Sort, defaultSort, allowed)
+	if err != nil {
+		return nil, "", err
+	}
+	col := pgSortExprs[field]
+	expr := col.sortExpr()
+	limit := pageLimit(opts.Limit)
+	order, cmp := "ASC", ">"
+	if dir < 0 {
+		order, cmp = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		var pc pgCursor
+		if err := json.Unmarshal(raw, &pc); err != nil || pc.ID == "" {
+			return nil, "", ErrInvalidCursor
+		}
+		value, err := col.cursorValue(pc.Value)
+		if err != nil {
+			return nil, "", err
+		}
+		q.where(fmt.Sprintf("(%s, id) %s (%s::%s, %s)", expr, cmp, q.arg(value), col.typ, q.arg(pc.ID)))
+	}
+
+	query := fmt.Sprintf("SELECT %s, (%s)::text, id FROM %s%s ORDER BY %s %s, id %s LIMIT %d",
+		columns, expr, table, q.whereSQL(), expr, order, order, limit+1)
+	rows, err := db.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var (
+		out     []T
+		lastKey string
+		lastID  string
+	)
+	for rows.Next() {
+		var key, id string
+		item, err := scan(rows, &key, &id)
+		if err != nil {
+			return nil, "", err
+		}
+		if int64(len(out)) == limit {
+			b, err := json.Marshal(pgCursor{Value: lastKey, ID: lastID})
+			if err != nil {
+				return nil, "", err
+			}
+			return out, base64.RawURLEncoding.EncodeToString(b), rows.Err()
+		}
+		out = append(out, item)
+		lastKey, lastID = key, id
+	}
+	if out == nil {
+		out = []T{}
+	}
+	return out, "", rows.Err()
+}
@@ -0,0 +1,477 @@
+package store
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrDuplicate     = errors.New("already exists")
+	ErrStale         = errors.New("changed since it was read")
+)
+
+const maxPageLimit = 100
+
+// ListOptions controls keyset pagination for list endpoints.
+// Sort is a whitelisted field name, prefixed with "-" for descending order.
+type ListOptions struct {
+	Limit  int64
+	Cursor string
+	Sort   string
+}
+
+// UserFilter narrows ListUsers. Search matches first name, last name or email.
+type UserFilter struct {
+	OrgID       string
+	Role        string
+	Search      string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+}
+
+// SessionFilter narrows ListSessions. From/To bound started_at.
+type SessionFilter struct {
+	Goal   string
+	GoalID string
+	Mode   string
+	From   *time.Time
+	To     *time.Time
+}
+
+// AlertFilter narrows ListAlerts; empty fields match everything.
+type AlertFilter struct {
+	UserID string
+	OrgID  string
+	RuleID string
+	Status string
+}
+
+var (
+	userSortFields = map[string]bool{
+		"created_at": true,
+		"first_name": true,
+		"last_name":  true,
+		"email":      true,
+	}
+	sessionSortFields = map[string]bool{
+		"created_at":   true,
+		"started_at":   true,
+		"duration_min": true,
+		"focus_score":  true,
+	}
+	fatigueScoreSortFields = map[string]bool{
+		"date":                true,
+		"fatigue_index":       true,
+		"burnout_probability": true,
+	}
+	alertSortFields = map[string]bool{
+		"created_at": true,
+		"date":       true,
+	}
+	notificationSortFields = map[string]bool{
+		"created_at": true,
+	}
+)
+
+// parseSort validates sort against allowed and splits off the direction.
+func parseSort(sort, defaultSort string, allowed map[string]bool) (string, int, error) {
+	if sort == "" {
+		sort = defaultSort
+	}
+	dir := 1
+	if len(sort) > 0 && sort[0] == '-' {
+		dir = -1
+		sort = sort[1:]
+	}
+	if !allowed[sort] {
+		return "", 0, ErrInvalidSort
+	}
+	return sort, dir, nil
+}
+
+func pageLimit(limit int64) int64 {
+	if limit <= 0 || limit > maxPageLimit {
+		return maxPageLimit
+	}
+	return limit
+}
+
+type UserStore interface {
+	CreateUser(ctx context.Context, u *models.User) error
+	// CountUsersWithContact counts users with the email, or the phone when non-empty.
+	CountUsersWithContact(ctx context.Context, email, phone string) (int64, error)
+	FindUserByID(ctx context.Context, userID string) (*models.User, error)
+	FindUserByEmail(ctx context.Context, email string) (*models.User, error)
+	FindUserByResetToken(ctx context.Context, token string) (*models.User, error)
+	UpdateUserTokens(ctx context.Context, userID, token, refreshToken string) error
+	SetResetToken(ctx context.Context, userID, token string, expires time.Time) error
+	// UpdatePassword stores a new password hash and clears any reset token.
+	UpdatePassword(ctx context.Context, userID, hashedPassword string) error
+	ListUsers(ctx context.Context, f UserFilter, opts ListOptions) ([]models.User, string, error)
+	// SetUserOrg assigns the user to an organization ("" removes it).
+	SetUserOrg(ctx context.Context, userID, orgID string) error
+	// SetUserTimezone stores the user's IANA timezone ("" means UTC).
+	SetUserTimezone(ctx context.Context, userID, timezone string) error
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, s *models.StudySession) error
+	// RecentSessions returns the user's newest sessions by created_at.
+	RecentSessions(ctx context.Context, userID string, limit int64) ([]models.StudySession, error)
+	ListSessions(ctx context.Context, userID string, f SessionFilter, opts ListOptions) ([]models.StudySession, string, error)
+	DeleteSessionsByUser(ctx context.Context, userID string) error
+	// DeleteSession returns ErrNotFound if there is no such session.
+	DeleteSession(ctx context.Context, sessionID string) error
+	FindSession(ctx context.Context, sessionID string) (*models.StudySession, error)
+	// StartSession inserts an open session, or returns ErrDuplicate if the
+	// user already has one active or paused.
+	StartSession(ctx context.Context, s *models.StudySession) error
+	// ReplaceSessionIf overwrites the stored session only while it still
+	// has the given status and updated_at, and returns ErrStale otherwise.
+	ReplaceSessionIf(ctx context.Context, s *models.StudySession, status string, updatedAt *time.Time) error
+	// FindOpenSession returns the user's active or paused session.
+	FindOpenSession(ctx context.Context, userID string) (*models.StudySession, error)
+	// IdleOpenSessions returns active or paused sessions last updated before idleSince.
+	IdleOpenSessions(ctx context.Context, idleSince time.Time, limit int64) ([]models.StudySession, error)
+	// SessionsBetween returns the user's sessions with started_at in [from, to), oldest first.
+	SessionsBetween(ctx context.Context, userID string, from, to time.Time) ([]models.StudySession, error)
+	// SessionDays lists each (user, UTC day) with a session started at or after since.
+	SessionDays(ctx context.Context, since time.Time) ([]UserDay, error)
+}
+
+// UserDay identifies one user's calendar day (midnight UTC).
+type UserDay struct {
+	UserID string
+	Day    time.Time
+}
+
+type FatigueScoreStore interface {
+	// UpsertFatigueScore replaces the score for (UserID, Date).
+	UpsertFatigueScore(ctx context.Context, s *models.FatigueScore) error
+	// RecentFatigueScores returns the user's newest scores by date.
+	RecentFatigueScores(ctx context.Context, userID string, limit int64) ([]models.FatigueScore, error)
+	ListFatigueScores(ctx context.Context, userID string, from, to *time.Time, opts ListOptions) ([]models.FatigueScore, string, error)
+	// LatestScorePerUser returns each user's most recent score, highest burnout first.
+	LatestScorePerUser(ctx context.Context, limit int64) ([]models.FatigueScore, error)
+	// DeleteFatigueScore removes the score for (userID, date), if any.
+	DeleteFatigueScore(ctx context.Context, userID string, date time.Time) error
+	DeleteFatigueScoresByUser(ctx context.Context, userID string) error
+}
+
+// BackupStore streams and writes whole records for backup and restore.
+type BackupStore interface {
+	// EachUser calls fn for every user, narrowed to orgID and/or userID when set.
+	EachUser(ctx context.Context, orgID, userID string, fn func(*models.User) error) error
+	// EachSession calls fn for every session owned by userIDs (all sessions when nil).
+	EachSession(ctx context.Context, userIDs []string, fn func(*models.StudySession) error) error
+	// EachFatigueScore calls fn for every score owned by userIDs (all scores when nil).
+	EachFatigueScore(ctx context.Context, userIDs []string, fn func(*models.FatigueScore) error) error
+	// EachGoal calls fn for every goal owned by userIDs (all goals, including
+	// organization goals, when nil).
+	EachGoal(ctx context.Context, userIDs []string, fn func(*models.Goal) error) error
+	UserExists(ctx context.Context, userID string) (bool, error)
+	SessionExists(ctx context.Context, sessionID string) (bool, error)
+	FatigueScoreExists(ctx context.Context, userID string, date time.Time) (bool, error)
+	// ReplaceUser inserts u or overwrites the user with the same ID.
+	ReplaceUser(ctx context.Context, u *models.User) error
+	// ReplaceSession inserts s or overwrites the session with the same ID.
+	ReplaceSession(ctx context.Context, s *models.StudySession) error
+	// ReplaceGoal inserts g or overwrites the goal with the same ID.
+	ReplaceGoal(ctx context.Context, g *models.Goal) error
+}
+
+// RecomputeJobStore persists recompute job progress.
+type RecomputeJobStore interface {
+	// SaveRecomputeJob inserts j or overwrites the job with the same ID.
+	SaveRecomputeJob(ctx context.Context, j *models.RecomputeJob) error
+	FindRecomputeJob(ctx context.Context, jobID string) (*models.RecomputeJob, error)
+	// ClaimRecomputeJob marks the job running for owner until lockedUntil,
+	// unless it has completed or another owner's lease is still live at
+	// now, in which case it returns ErrStale.
+	ClaimRecomputeJob(ctx context.Context, jobID, owner string, now, lockedUntil time.Time) error
+	// UpdateRecomputeJob overwrites j while j.Owner still holds the job,
+	// and returns ErrStale once another run has taken it over.
+	UpdateRecomputeJob(ctx context.Context, j *models.RecomputeJob) error
+}
+
+// ScoringModelStore keeps the scoring model versions.
+type ScoringModelStore interface {
+	ListScoringModels(ctx context.Context) ([]models.ScoringModel, error)
+	FindScoringModel(ctx context.Context, version string) (*models.ScoringModel, error)
+	// ActiveScoringModel returns the most recently activated model.
+	ActiveScoringModel(ctx context.Context) (*models.ScoringModel, error)
+	// CreateScoringModel returns ErrDuplicate if the version exists; versions are immutable.
+	CreateScoringModel(ctx context.Context, m *models.ScoringModel) error
+	// ActivateScoringModel makes version the only active model.
+	ActivateScoringModel(ctx context.Context, version string, at time.Time) error
+}
+
+// GoalBaselineStore keeps learned per-user goal baselines.
+type GoalBaselineStore interface {
+	// UpsertGoalBaseline replaces the baseline for (UserID, Goal).
+	UpsertGoalBaseline(ctx context.Context, b *models.GoalBaseline) error
+	FindGoalBaseline(ctx context.Context, userID, goal string) (*models.GoalBaseline, error)
+	ListGoalBaselines(ctx context.Context, userID string) ([]models.GoalBaseline, error)
+	DeleteGoalBaseline(ctx context.Context, userID, goal string) error
+	DeleteGoalBaselinesByUser(ctx context.Context, userID string) error
+}
+
+// GoalStore keeps the goals catalog.
+type GoalStore interface {
+	CreateGoal(ctx context.Context, g *models.Goal) error
+	// UpdateGoal overwrites the goal with the same ID.
+	UpdateGoal(ctx context.Context, g *models.Goal) error
+	FindGoal(ctx context.Context, goalID string) (*models.Goal, error)
+	// ListGoals returns the goals owned by userID or shared with orgID
+	// (either may be empty), oldest first.
+	ListGoals(ctx context.Context, userID, orgID string, includeArchived bool) ([]models.Goal, error)
+	DeleteGoalsByUser(ctx context.Context, userID string) error
+}
+
+// AlertStore keeps burnout alert rules and the alerts they raise.
+type AlertStore interface {
+	ListAlertRules(ctx context.Context) ([]models.AlertRule, error)
+	FindAlertRule(ctx context.Context, ruleID string) (*models.AlertRule, error)
+	// CreateAlertRule returns ErrDuplicate if the ID is taken.
+	CreateAlertRule(ctx context.Context, r *models.AlertRule) error
+	// UpdateAlertRule overwrites the rule with the same ID.
+	UpdateAlertRule(ctx context.Context, r *models.AlertRule) error
+	CreateAlert(ctx context.Context, a *models.Alert) error
+	// UpdateAlert overwrites the alert with the same ID.
+	UpdateAlert(ctx context.Context, a *models.Alert) error
+	FindAlert(ctx context.Context, alertID string) (*models.Alert, error)
+	// LatestAlert returns the newest alert ruleID raised for userID.
+	LatestAlert(ctx context.Context, userID, ruleID string) (*models.Alert, error)
+	ListAlerts(ctx context.Context, f AlertFilter, opts ListOptions) ([]models.Alert, string, error)
+	DeleteAlertsByUser(ctx context.Context, userID string) error
+}
+
+// NotificationStore keeps the in-app inbox, notification preferences and
+// the email/webhook delivery queue.
+type NotificationStore interface {
+	CreateNotification(ctx context.Context, n *models.Notification) error
+	ListNotifications(ctx context.Context, userID string, unreadOnly bool, opts ListOptions) ([]models.Notification, string, error)
+	// MarkNotificationRead returns ErrNotFound unless userID owns the item.
+	MarkNotificationRead(ctx context.Context, userID, notificationID string, at time.Time) (*models.Notification, error)
+	// MarkAllNotificationsRead returns how many unread items it marked.
+	MarkAllNotificationsRead(ctx context.Context, userID string, at time.Time) (int64, error)
+	CountUnreadNotifications(ctx context.Context, userID string) (int64, error)
+	DeleteNotificationsByUser(ctx context.Context, userID string) error
+
+	FindNotificationPrefs(ctx context.Context, userID string) (*models.NotificationPrefs, error)
+	// SaveNotificationPrefs inserts p or overwrites the user's preferences.
+	SaveNotificationPrefs(ctx context.Context, p *models.NotificationPrefs) error
+	DeleteNotificationPrefs(ctx context.Context, userID string) error
+
+	EnqueueDelivery(ctx context.Context, d *models.NotificationDelivery) error
+	// ClaimDeliveries returns up to limit pending deliveries due at now,
+	// oldest first, and pushes their NextAttemptAt to leaseUntil so other
+	// workers skip them while they are being sent.
+	ClaimDeliveries(ctx context.Context, now, leaseUntil time.Time, limit int) ([]models.NotificationDelivery, error)
+	// UpdateDelivery overwrites the delivery with the same ID.
+	UpdateDelivery(ctx context.Context, d *models.NotificationDelivery) error
+	DeleteDeliveriesByUser(ctx context.Context, userID string) error
+}
+
+// ScheduledRunStore records scheduled per-user jobs that have run, so each
+// runs once however many servers are up.
+type ScheduledRunStore interface {
+	// ClaimScheduledRun records key, or returns ErrDuplicate if it exists.
+	ClaimScheduledRun(ctx context.Context, key, userID string, at time.Time) error
+	// ReleaseScheduledRun forgets key so the job can run again.
+	ReleaseScheduledRun(ctx context.Context, key string) error
+	DeleteScheduledRunsByUser(ctx context.Context, userID string) error
+}
+
+// PlanStore keeps study plans and the sessions matched to their
+// occurrences.
+type PlanStore interface {
+	CreateStudyPlan(ctx context.Context, p *models.StudyPlan) error
+	// UpdateStudyPlan overwrites the plan with the same ID.
+	UpdateStudyPlan(ctx context.Context, p *models.StudyPlan) error
+	FindStudyPlan(ctx context.Context, planID string) (*models.StudyPlan, error)
+	// ListStudyPlans returns all the user's plans, oldest first.
+	ListStudyPlans(ctx context.Context, userID string) ([]models.StudyPlan, error)
+	// DeleteStudyPlan removes the plan and its matches.
+	DeleteStudyPlan(ctx context.Context, planID string) error
+	DeleteStudyPlansByUser(ctx context.Context, userID string) error
+
+	// CreatePlanMatch returns ErrDuplicate if the occurrence is already matched.
+	CreatePlanMatch(ctx context.Context, m *models.PlanMatch) error
+	// ListPlanMatches returns the user's matches with occurrence_at in [from, to).
+	ListPlanMatches(ctx context.Context, userID string, from, to *time.Time) ([]models.PlanMatch, error)
+	DeletePlanMatchesByUser(ctx context.Context, userID string) error
+	// DeletePlanMatchesBySession frees the occurrence a session was matched to.
+	DeletePlanMatchesBySession(ctx context.Context, sessionID string) error
+}
+
+// SessionEditStore keeps the edit history of study sessions.
+type SessionEditStore interface {
+	CreateSessionEdit(ctx context.Context, e *models.SessionEdit) error
+	// ListSessionEdits returns the session's edits, oldest first.
+	ListSessionEdits(ctx context.Context, sessionID string) ([]models.SessionEdit, error)
+	DeleteSessionEditsByUser(ctx context.Context, userID string) error
+}
+
+// IdempotencyStore keeps the responses to requests sent with an
+// Idempotency-Key header.
+type IdempotencyStore interface {
+	// ClaimIdempotencyKey inserts r, or returns ErrDuplicate if its ID is taken.
+	ClaimIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord) error
+	// TakeOverIdempotencyKey overwrites the record with r's ID if, at now,
+	// it has expired or is still in flight past its lease. It returns
+	// ErrDuplicate if the record is live, or gone.
+	TakeOverIdempotencyKey(ctx context.Context, r *models.IdempotencyRecord, now time.Time) error
+	FindIdempotencyKey(ctx context.Context, id string) (*models.IdempotencyRecord, error)
+	// SaveIdempotencyResponse stores the status and body of a claimed key.
+	SaveIdempotencyResponse(ctx context.Context, r *models.IdempotencyRecord) error
+	DeleteIdempotencyKey(ctx context.Context, id string) error
+	// DeleteExpiredIdempotencyKeys removes keys that expired before t.
+	DeleteExpiredIdempotencyKeys(ctx context.Context, t time.Time) (int64, error)
+	DeleteIdempotencyKeysByUser(ctx context.Context, userID string) error
+}
+
+// CalendarStore keeps each user's ICS feed token and import keywords.
+type CalendarStore interface {
+	FindCalendarSettings(ctx context.Context, userID string) (*models.CalendarSettings, error)
+	// FindCalendarSettingsByFeedToken looks the settings up by the SHA-256
+	// of a feed token.
+	FindCalendarSettingsByFeedToken(ctx context.Context, tokenHash string) (*models.CalendarSettings, error)
+	// SaveCalendarSettings inserts s or overwrites the user's settings.
+	SaveCalendarSettings(ctx context.Context, s *models.CalendarSettings) error
+	DeleteCalendarSettings(ctx context.Context, userID string) error
+}
+
+// StatsRange bounds a stats query on started_at and names the IANA
+// timezone that days, weekdays and hours are counted in ("" is UTC).
+type StatsRange struct {
+	From     *time.Time
+	To       *time.Time
+	Timezone string
+}
+
+// DayTotal sums a user's finished sessions on one local day.
+type DayTotal struct {
+	Day      time.Time // midnight UTC of the local date
+	Sessions int
+	Minutes  int
+	Pauses   int
+	FocusSum float64
+}
+
+// GroupTotal sums a user's finished sessions for one goal and mode.
+type GroupTotal struct {
+	Goal     string
+	Mode     string
+	Sessions int
+	Minutes  int
+	FocusSum float64
+}
+
+// TimeSlot sums focus for sessions started in one local weekday and hour.
+type TimeSlot struct {
+	Weekday  time.Weekday
+	Hour     int
+	Sessions int
+	FocusSum float64
+}
+
+// StatsStore aggregates a user's finished study sessions in the database.
+type StatsStore interface {
+	// SessionDayTotals returns one row per local day with sessions, oldest first.
+	SessionDayTotals(ctx context.Context, userID string, r StatsRange) ([]DayTotal, error)
+	SessionGroupTotals(ctx context.Context, userID string, r StatsRange) ([]GroupTotal, error)
+	SessionTimeSlots(ctx context.Context, userID string, r StatsRange) ([]TimeSlot, error)
+}
+
+// OrgSettingsStore keeps per-organization settings.
+type OrgSettingsStore interface {
+	FindOrgSettings(ctx context.Context, orgID string) (*models.OrgSettings, error)
+	// SaveOrgSettings inserts o or overwrites the organization's settings.
+	SaveOrgSettings(ctx context.Context, o *models.OrgSettings) error
+}
+
+// Transactor runs multi-record writes atomically where the backend allows.
+type Transactor interface {
+	// SupportsTransactions reports whether RunInTx is atomic. Standalone
+	// MongoDB servers (no replica set) cannot run multi-document transactions.
+	SupportsTransactions(ctx context.Context) bool
+	// RunInTx runs fn in a transaction. fn must do all its writes through tx
+	// and ctx; the transaction commits only if fn returns nil.
+	RunInTx(ctx context.Context, fn func(ctx context.Context, tx Store) error) error
+}
+
+// OutboxStore persists units of work for backends without transactions.
+type OutboxStore interface {
+	InsertOutbox(ctx context.Context, e *models.OutboxEntry) error
+	// UpdateOutbox records progress on an entry that is still pending.
+	UpdateOutbox(ctx context.Context, e *models.OutboxEntry) error
+	DeleteOutbox(ctx context.Context, id primitive.ObjectID) error
+	// PendingOutbox returns entries last touched before olderThan, oldest first.
+	PendingOutbox(ctx context.Context, olderThan time.Time, limit int64) ([]models.OutboxEntry, error)
+}
+
+// Store is the persistence API used by services and controllers.
+type Store interface {
+	UserStore
+	SessionStore
+	FatigueScoreStore
+	BackupStore
+	RecomputeJobStore
+	ScoringModelStore
+	OrgSettingsStore
+	GoalBaselineStore
+	GoalStore
+	AlertStore
+	NotificationStore
+	ScheduledRunStore
+	StatsStore
+	PlanStore
+	CalendarStore
+	SessionEditStore
+	IdempotencyStore
+	Transactor
+}
+
+var current Store
+
+// Init opens the backend selected by DB_BACKEND. It must run before Get.
+func Init(ctx context.Context) error {
+	switch config.DBBackend() {
+	case config.BackendPostgres:
+		s, err := NewPostgresStore(ctx, config.ConnectPostgres())
+		if err != nil {
+			return err
+		}
+		current = s
+	default:
+		s := NewMongoStore(config.MongoClient().Database("usersdb"))
+		if err := s.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		current = s
+	}
+	return nil
+}
+
+// Get returns the active store.
+func Get() Store {
+	if current == nil {
+		panic("store: Init has not been called")
+	}
+	return current
+}
+
+// Set replaces the active store, e.g. with a store opened by a command.
+func Set(s Store) {
+	current = s
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"authentication/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OpHandler applies one serialised write. Handlers must be idempotent: the
+// outbox relay may replay an op whose result was not yet recorded.
+type OpHandler func(ctx context.Context, st Store, payload []byte) error
+
+var (
+	opHandlersMu sync.RWMutex
+	opHandlers   = map[string]OpHandler{}
+)
+
+// RegisterOp makes kind available to units of work. Call it from init.
+func RegisterOp(kind string, h OpHandler) {
+	opHandlersMu.Lock()
+	defer opHandlersMu.Unlock()
+	if _, dup := opHandlers[kind]; dup {
+		panic("store: op registered twice: " + kind)
+	}
+	opHandlers[kind] = h
+}
+
+func opHandler(kind string) (OpHandler, error) {
+	opHandlersMu.RLock()
+	defer opHandlersMu.RUnlock()
+	h, ok := opHandlers[kind]
+	if !ok {
+		return nil, fmt.Errorf("store: no handler for op %q", kind)
+	}
+	return h, nil
+}
+
+// NewOp serialises payload for the handler registered under kind.
+func NewOp(kind string, payload interface{}) (models.OutboxOp, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return models.OutboxOp{}, err
+	}
+	return models.OutboxOp{Kind: kind, Payload: b}, nil
+}
+
+func applyOps(ctx context.Context, st Store, ops []models.OutboxOp) error {
+	for _, op := range ops {
+		h, err := opHandler(op.Kind)
+		if err != nil {
+			return err
+		}
+		if err := h(ctx, st, op.Payload); err != nil {
+			return fmt.Errorf("%s: %w", op.Kind, err)
+		}
+	}
+	return nil
+}
+
+// RunUnit applies ops as one unit of work.
+//
+// With transaction support all ops commit or none do. Without it (standalone
+// MongoDB) the unit is first written to the outbox and then applied in
+// order. If the first op fails nothing has changed, so the entry is dropped
+// and the error returned. Once the first op has succeeded the unit is
+// committed: later failures are left to the outbox relay, which retries the
+// remaining ops until they succeed.
+func RunUnit(ctx context.Context, name string, ops ...models.OutboxOp) error {
+	st := Get()
+	if st.SupportsTransactions(ctx) {
+		return st.RunInTx(ctx, func(ctx context.Context, tx Store) error {
+			return applyOps(ctx, tx, ops)
+		})
+	}
+	ob, ok := st.(OutboxStore)
+	if !ok {
+		return applyOps(ctx, st, ops)
+	}
+
+	now := time.Now()
+	entry := &models.OutboxEntry{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		Ops:       ops,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := ob.InsertOutbox(ctx, entry); err != nil {
+		return err
+	}
+	if err := advance(ctx, st, ob, entry); err != nil {
+		if entry.Applied == 0 {
+			ob.DeleteOutbox(context.WithoutCancel(ctx), entry.ID)
+			return err
+		}
+		log.Printf("outbox: %s %s left pending after %d/%d ops: %v", name, entry.ID.Hex(), entry.Applied, len(ops), err)
+	}
+	return nil
+}
+
+// advance applies the entry's remaining ops, recording progress after each
+// one, and deletes the entry once every op has been applied.
+func advance(ctx context.Context, st Store, ob OutboxStore, e *models.OutboxEntry) error {
+	for e.Applied < len(e.Ops) {
+		if err := applyOps(ctx, st, e.Ops[e.Applied:e.Applied+1]); err != nil {
+			e.Attempts++
+			e.LastError = err.Error()
+			e.UpdatedAt = time.Now()
+			ob.UpdateOutbox(context.WithoutCancel(ctx), e)
+			return err
+		}
+		e.Applied++
+		e.UpdatedAt = time.Now()
+		if e.Applied < len(e.Ops) {
+			if err := ob.UpdateOutbox(ctx, e); err != nil {
+				return err
+			}
+		}
+	}
+	return ob.DeleteOutbox(ctx, e.ID)
+}
+
+// outboxGrace keeps the relay away from units that are still being applied
+// by the request that created them.
+const outboxGrace = 30 * time.Second
+
+// RelayOutbox finishes pending units of work and returns how many completed.
+func RelayOutbox(ctx context.Context) (int, error) {
+	st := Get()
+	ob, ok := st.(OutboxStore)
+	if !ok {
+		return 0, nil
+	}
+	entries, err := ob.PendingOutbox(ctx, time.Now().Add(-outboxGrace), 100)
+	if err != nil {
+		return 0, err
+	}
+	done := 0
+	for i := range entries {
+		if err := advance(ctx, st, ob, &entries[i]); err != nil {
+			log.Printf("outbox: %s %s retry failed: %v", entries[i].Name, entries[i].ID.Hex(), err)
+			continue
+		}
+		done++
+	}
+	return done, nil
+}
+
+// StartOutboxRelay runs RelayOutbox every interval until ctx is cancelled.
+// It is a no-op for backends with transaction support.
+func StartOutboxRelay(ctx context.Context, interval time.Duration) {
+	st := Get()
+	if _, ok := st.(OutboxStore); !ok || st.SupportsTransactions(ctx) {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := RelayOutbox(ctx); err != nil {
+					log.Printf("outbox relay: %v", err)
+				} else if n > 0 {
+					log.Printf("outbox relay: completed %d pending unit(s)", n)
+				}
+			}
+		}
+	}()
+}
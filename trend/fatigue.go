@@ -0,0 +1,206 @@
+package trend
+
+import (
+	"authentication/models"
+	"sort"
+	"time"
+)
+
+const (
+	// BaselineDays of scores before a day are its baseline for z-scores.
+	BaselineDays = 28
+	// MinBaselineDays is how many scored days a baseline needs.
+	MinBaselineDays = 7
+	// MinStdDev floors the baseline's spread, so a very steady history
+	// does not turn a few points' move into an anomaly.
+	MinStdDev = 5.0
+	// DefaultZThreshold is how far from the baseline, in standard
+	// deviations, an anomalous day is.
+	DefaultZThreshold = 2.0
+	// SteadyChange is the largest fitted change across a window, in
+	// points, that still counts as steady.
+	SteadyChange = 5.0
+	// HistoryDays of scores before the window are needed for the first
+	// day's rolling means and baseline.
+	HistoryDays = 28
+)
+
+// Metrics a fatigue trend covers, named as in alert rules.
+const (
+	MetricFatigueIndex       = "fatigue_index"
+	MetricBurnoutProbability = "burnout_probability"
+)
+
+// Point is one metric on one day.
+type Point struct {
+	Value    float64  `json:"value"`
+	Mean7    float64  `json:"mean_7d"`            // scored days in the 7 days ending here
+	Mean28   float64  `json:"mean_28d"`           // and in the 28 days
+	Baseline *float64 `json:"baseline,omitempty"` // mean of the BaselineDays before
+	Z        *float64 `json:"z,omitempty"`        // nil under MinBaselineDays of history
+}
+
+// Day is one scored day in the window.
+type Day struct {
+	Date               time.Time `json:"date"`
+	FatigueIndex       Point     `json:"fatigue_index"`
+	BurnoutProbability Point     `json:"burnout_probability"`
+	Anomalous          bool      `json:"anomalous"` // either metric's |z| reached the threshold
+}
+
+// Metric returns the day's point for a metric name.
+func (d *Day) Metric(metric string) Point {
+	if metric == MetricFatigueIndex {
+		return d.FatigueIndex
+	}
+	return d.BurnoutProbability
+}
+
+// Summary describes one metric across the window.
+type Summary struct {
+	Mean7       float64 `json:"mean_7d"` // scored days in the window's last 7 days
+	Mean28      float64 `json:"mean_28d"`
+	SlopePerDay float64 `json:"slope_per_day"`
+	Direction   string  `json:"direction,omitempty"` // rising | falling | steady; empty under 2 scored days
+}
+
+// Fatigue is the analysis of the daily scores from From to To.
+type Fatigue struct {
+	From               time.Time   `json:"from"`
+	To                 time.Time   `json:"to"` // inclusive
+	ZThreshold         float64     `json:"z_threshold"`
+	FatigueIndex       Summary     `json:"fatigue_index"`
+	BurnoutProbability Summary     `json:"burnout_probability"`
+	Days               []Day       `json:"days"` // oldest first
+	AnomalousDays      []time.Time `json:"anomalous_days"`
+}
+
+// Latest returns the window's newest scored day, or nil.
+func (f *Fatigue) Latest() *Day {
+	if len(f.Days) == 0 {
+		return nil
+	}
+	return &f.Days[len(f.Days)-1]
+}
+
+type dayValue struct {
+	day   time.Time
+	value float64
+}
+
+// Analyze reads the daily scores dated from to to (date keys, inclusive).
+// scores may be in any order and should reach HistoryDays before from.
+// Days whose |z| on either metric is at least zThreshold (DefaultZThreshold
+// when 0) are anomalous.
+func Analyze(scores []models.FatigueScore, from, to time.Time, zThreshold float64) *Fatigue {
+	if zThreshold <= 0 {
+		zThreshold = DefaultZThreshold
+	}
+	sorted := append([]models.FatigueScore(nil), scores...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	fatigue := make([]dayValue, len(sorted))
+	burnout := make([]dayValue, len(sorted))
+	for i := range sorted {
+		day := sorted[i].Date.UTC()
+		fatigue[i] = dayValue{day, sorted[i].FatigueIndex}
+		burnout[i] = dayValue{day, sorted[i].BurnoutProbability}
+	}
+
+	out := &Fatigue{From: from, To: to, ZThreshold: zThreshold, Days: []Day{}, AnomalousDays: []time.Time{}}
+	for i := range sorted {
+		day := fatigue[i].day
+		if day.Before(from) || day.After(to) {
+			continue
+		}
+		d := Day{
+			Date:               day,
+			FatigueIndex:       pointAt(fatigue, i),
+			BurnoutProbability: pointAt(burnout, i),
+		}
+		d.Anomalous = exceeds(d.FatigueIndex.Z, zThreshold) || exceeds(d.BurnoutProbability.Z, zThreshold)
+		if d.Anomalous {
+			out.AnomalousDays = append(out.AnomalousDays, day)
+		}
+		out.Days = append(out.Days, d)
+	}
+	out.FatigueIndex = summarize(fatigue, from, to)
+	out.BurnoutProbability = summarize(burnout, from, to)
+	return out
+}
+
+func exceeds(z *float64, threshold float64) bool {
+	return z != nil && (*z >= threshold || *z <= -threshold)
+}
+
+// pointAt computes the rolling means and z-score of vs[i]; vs is sorted by day.
+func pointAt(vs []dayValue, i int) Point {
+	day := vs[i].day
+	p := Point{Value: vs[i].value}
+	var sum7, sum28 float64
+	var n7, n28 int
+	var baseline []float64
+	for j := i; j >= 0; j-- {
+		age := int(day.Sub(vs[j].day).Hours() / 24)
+		if age >= 28 && age > BaselineDays {
+			break
+		}
+		if age < 7 {
+			sum7 += vs[j].value
+			n7++
+		}
+		if age < 28 {
+			sum28 += vs[j].value
+			n28++
+		}
+		if j < i && age <= BaselineDays {
+			baseline = append(baseline, vs[j].value)
+		}
+	}
+	p.Mean7 = round(sum7/float64(n7), 1)
+	p.Mean28 = round(sum28/float64(n28), 1)
+	if len(baseline) >= MinBaselineDays {
+		mean, sd := MeanStdDev(baseline)
+		if sd < MinStdDev {
+			sd = MinStdDev
+		}
+		b, z := round(mean, 1), round((p.Value-mean)/sd, 2)
+		p.Baseline, p.Z = &b, &z
+	}
+	return p
+}
+
+// summarize fits the window's values and averages its last 7 and 28 days.
+func summarize(vs []dayValue, from, to time.Time) Summary {
+	var s Summary
+	var xs, ys []float64
+	var sum7, sum28 float64
+	var n7, n28 int
+	for _, v := range vs {
+		if v.day.Before(from) || v.day.After(to) {
+			continue
+		}
+		xs = append(xs, v.day.Sub(from).Hours()/24)
+		ys = append(ys, v.value)
+		age := int(to.Sub(v.day).Hours() / 24)
+		if age < 7 {
+			sum7 += v.value
+			n7++
+		}
+		if age < 28 {
+			sum28 += v.value
+			n28++
+		}
+	}
+	if n7 > 0 {
+		s.Mean7 = round(sum7/float64(n7), 1)
+	}
+	if n28 > 0 {
+		s.Mean28 = round(sum28/float64(n28), 1)
+	}
+	if slope, ok := Slope(xs, ys); ok {
+		s.SlopePerDay = round(slope, 2)
+		span := to.Sub(from).Hours() / 24
+		s.Direction = Direction(slope*span, SteadyChange)
+	}
+	return s
+}
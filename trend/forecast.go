@@ -0,0 +1,242 @@
+package trend
+
+import (
+	"authentication/models"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+var ErrNotEnoughHistory = errors.New("not enough recent fatigue scores to forecast")
+
+const (
+	// ForecastHistoryDays of scores before asOf feed a forecast.
+	ForecastHistoryDays = 90
+	// MinForecastDays is how many scored days a forecast needs, the
+	// latest of them within MaxForecastGap days of asOf.
+	MinForecastDays = 7
+	MaxForecastGap  = 14
+	// season is the weekly cycle Holt-Winters fits once the series spans
+	// two of them; shorter series get Holt's linear method.
+	season = 7
+)
+
+// Forecast methods.
+const (
+	MethodHoltWinters = "holt_winters"
+	MethodHolt        = "holt"
+)
+
+// smoothingGrid is searched for the parameters with the smallest one-step
+// error on the scored days.
+var smoothingGrid = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+
+// Band is a forecast value with its 80% and 95% prediction intervals.
+type Band struct {
+	Value  float64 `json:"value"`
+	Low80  float64 `json:"low_80"`
+	High80 float64 `json:"high_80"`
+	Low95  float64 `json:"low_95"`
+	High95 float64 `json:"high_95"`
+}
+
+type ForecastDay struct {
+	Date               time.Time `json:"date"`
+	FatigueIndex       Band      `json:"fatigue_index"`
+	BurnoutProbability Band      `json:"burnout_probability"`
+}
+
+// FatigueForecast projects the daily fatigue index, and the burnout
+// probability it implies, over the days after AsOf.
+type FatigueForecast struct {
+	AsOf        time.Time     `json:"as_of"`
+	Method      string        `json:"method"` // holt_winters | holt
+	Alpha       float64       `json:"alpha"`
+	Beta        float64       `json:"beta"`
+	Gamma       float64       `json:"gamma,omitempty"`
+	ScoredDays  int           `json:"scored_days"`
+	LastScored  time.Time     `json:"last_scored"`
+	LastBurnout float64       `json:"last_burnout_probability"`
+	Days        []ForecastDay `json:"days"`
+	PeakDate    time.Time     `json:"peak_date"` // the day with the highest projected burnout
+	PeakBurnout Band          `json:"peak_burnout"`
+}
+
+// holtFit is one parameter choice fitted to a series.
+type holtFit struct {
+	alpha, beta, gamma float64
+	level, slope       float64
+	seasonal           []float64 // by index mod season; nil for Holt
+	sse                float64
+	n                  int // one-step errors in sse
+}
+
+// Forecast projects the fatigue index for the horizon days after asOf (a
+// date key) from daily scores up to asOf. Days without a score are
+// interpolated between their neighbours but do not count towards the fit
+// error. burnout maps a fatigue index to a burnout probability, as the
+// user's scoring model does.
+func Forecast(scores []models.FatigueScore, asOf time.Time, horizon int, burnout func(float64) float64) (*FatigueForecast, error) {
+	sorted := make([]models.FatigueScore, 0, len(scores))
+	for _, s := range scores {
+		if d := s.Date.UTC(); !d.After(asOf) && asOf.Sub(d) < ForecastHistoryDays*24*time.Hour {
+			sorted = append(sorted, s)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	if len(sorted) < MinForecastDays {
+		return nil, ErrNotEnoughHistory
+	}
+	first, last := sorted[0].Date.UTC(), sorted[len(sorted)-1].Date.UTC()
+	if asOf.Sub(last) > MaxForecastGap*24*time.Hour {
+		return nil, ErrNotEnoughHistory
+	}
+
+	// One value per calendar day from first to last, gaps interpolated.
+	n := int(last.Sub(first).Hours()/24) + 1
+	series := make([]float64, n)
+	observed := make([]bool, n)
+	prev := 0
+	for k, s := range sorted {
+		i := int(s.Date.UTC().Sub(first).Hours() / 24)
+		series[i], observed[i] = s.FatigueIndex, true
+		if k > 0 {
+			for j := prev + 1; j < i; j++ {
+				series[j] = series[prev] + (series[i]-series[prev])*float64(j-prev)/float64(i-prev)
+			}
+		}
+		prev = i
+	}
+
+	seasonal := n >= 2*season
+	var best *holtFit
+	gammas := []float64{0}
+	if seasonal {
+		gammas = smoothingGrid
+	}
+	for _, a := range smoothingGrid {
+		for _, b := range smoothingGrid {
+			for _, g := range gammas {
+				f := fitHolt(series, observed, a, b, g, seasonal)
+				if best == nil || f.sse < best.sse {
+					best = f
+				}
+			}
+		}
+	}
+
+	out := &FatigueForecast{
+		AsOf:        asOf,
+		Method:      MethodHolt,
+		Alpha:       best.alpha,
+		Beta:        best.beta,
+		ScoredDays:  len(sorted),
+		LastScored:  last,
+		LastBurnout: sorted[len(sorted)-1].BurnoutProbability,
+		Days:        make([]ForecastDay, 0, horizon),
+	}
+	if seasonal {
+		out.Method, out.Gamma = MethodHoltWinters, best.gamma
+	}
+	sigma := 0.0
+	if best.n > 0 {
+		sigma = math.Sqrt(best.sse / float64(best.n))
+	}
+	// Steps past the last observed day; asOf may be a few days later.
+	skip := int(asOf.Sub(last).Hours() / 24)
+	for d := 1; d <= horizon; d++ {
+		h := skip + d
+		value := best.level + float64(h)*best.slope
+		if seasonal {
+			value += best.seasonal[(n+h-1)%season]
+		}
+		// Additive Holt-Winters h-step variance (Hyndman et al., 2008).
+		variance := 1.0
+		for j := 1; j < h; j++ {
+			c := best.alpha * (1 + float64(j)*best.beta)
+			if seasonal && j%season == 0 {
+				c += best.gamma * (1 - best.alpha)
+			}
+			variance += c * c
+		}
+		sd := sigma * math.Sqrt(variance)
+		fatigue := Band{
+			Value:  clampScore(value),
+			Low80:  clampScore(value - 1.2816*sd),
+			High80: clampScore(value + 1.2816*sd),
+			Low95:  clampScore(value - 1.96*sd),
+			High95: clampScore(value + 1.96*sd),
+		}
+		day := ForecastDay{
+			Date:               asOf.AddDate(0, 0, d),
+			FatigueIndex:       fatigue,
+			BurnoutProbability: mapBand(fatigue, burnout),
+		}
+		if d == 1 || day.BurnoutProbability.Value > out.PeakBurnout.Value {
+			out.PeakDate, out.PeakBurnout = day.Date, day.BurnoutProbability
+		}
+		out.Days = append(out.Days, day)
+	}
+	return out, nil
+}
+
+// fitHolt runs (additive) Holt-Winters over series and sums the squared
+// one-step errors on observed days.
+func fitHolt(series []float64, observed []bool, alpha, beta, gamma float64, seasonal bool) *holtFit {
+	f := &holtFit{alpha: alpha, beta: beta, gamma: gamma}
+	start := 1
+	if seasonal {
+		var m1, m2 float64
+		for i := 0; i < season; i++ {
+			m1 += series[i]
+			m2 += series[season+i]
+		}
+		m1, m2 = m1/season, m2/season
+		f.level, f.slope = m1, (m2-m1)/season
+		f.seasonal = make([]float64, season)
+		for i := 0; i < season; i++ {
+			f.seasonal[i] = series[i] - m1
+		}
+		start = season
+	} else {
+		f.level, f.slope = series[0], series[1]-series[0]
+	}
+	for i := start; i < len(series); i++ {
+		s := 0.0
+		if seasonal {
+			s = f.seasonal[i%season]
+		}
+		if observed[i] {
+			e := series[i] - (f.level + f.slope + s)
+			f.sse += e * e
+			f.n++
+		}
+		level := alpha*(series[i]-s) + (1-alpha)*(f.level+f.slope)
+		f.slope = beta*(level-f.level) + (1-beta)*f.slope
+		if seasonal {
+			f.seasonal[i%season] = gamma*(series[i]-level) + (1-gamma)*s
+		}
+		f.level = level
+	}
+	return f
+}
+
+func clampScore(v float64) float64 {
+	return round(math.Max(0, math.Min(100, v)), 1)
+}
+
+// mapBand maps each bound through fn, keeping low below high.
+func mapBand(b Band, fn func(float64) float64) Band {
+	out := Band{Value: fn(b.Value)}
+	out.Low80, out.High80 = minMax(fn(b.Low80), fn(b.High80))
+	out.Low95, out.High95 = minMax(fn(b.Low95), fn(b.High95))
+	return out
+}
+
+func minMax(a, b float64) (float64, float64) {
+	if a > b {
+		return b, a
+	}
+	return a, b
+}
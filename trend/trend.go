@@ -0,0 +1,66 @@
+// Package trend interprets a user's daily fatigue scores: rolling means,
+// least-squares slopes and days that stand out against the user's own
+// history. It does no I/O, so the API and the alert rules read scores the
+// same way.
+package trend
+
+import "math"
+
+// Directions of a slope.
+const (
+	Rising  = "rising"
+	Falling = "falling"
+	Steady  = "steady"
+)
+
+// Slope fits y = a + bx by least squares and returns b. ok is false with
+// fewer than two distinct x values.
+func Slope(xs, ys []float64) (slope float64, ok bool) {
+	n := float64(len(xs))
+	if n < 2 {
+		return 0, false
+	}
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, false
+	}
+	return (n*sxy - sx*sy) / den, true
+}
+
+// Direction classifies slope: beyond ±threshold either way is a trend.
+func Direction(slope, threshold float64) string {
+	switch {
+	case slope > threshold:
+		return Rising
+	case slope < -threshold:
+		return Falling
+	}
+	return Steady
+}
+
+// MeanStdDev returns the mean and population standard deviation of vs.
+func MeanStdDev(vs []float64) (mean, sd float64) {
+	if len(vs) == 0 {
+		return 0, 0
+	}
+	for _, v := range vs {
+		mean += v
+	}
+	mean /= float64(len(vs))
+	for _, v := range vs {
+		sd += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(vs)))
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}